@@ -0,0 +1,68 @@
+package core
+
+import "errors"
+
+// ErrBatchDone indicates an operation on a write batch already flushed or cancelled.
+var ErrBatchDone = errors.New("the write batch has already been flushed or cancelled")
+
+// KVWriteBatch groups many blind writes so that the driver can apply them at the cost of
+// a few transactions, as done by the bulk loader.
+//
+// A batch is not a transaction: its writes may become visible before Flush, a failed
+// batch may be partially applied, and it offers no read. It is used by one goroutine at
+// a time.
+type KVWriteBatch interface {
+
+	// RawSet queues the storage of value under key.
+	RawSet(key IKey, value []byte) error
+
+	// RawDelete queues the removal of key; removing an absent key is not an error.
+	RawDelete(key IKey) error
+
+	// Flush applies every queued write and waits for them to be stored. The batch can
+	// not be used afterward.
+	Flush() error
+
+	// Cancel drops the writes not applied yet. Calling it after Flush is a no-op.
+	Cancel()
+}
+
+// NewLoopWriteBatch returns a KVWriteBatch applying each write right away through the
+// driver, for drivers without a cheaper way to group writes.
+func NewLoopWriteBatch(driver KVDriver) KVWriteBatch {
+	return &loopWriteBatch{driver: driver}
+}
+
+type loopWriteBatch struct {
+	driver KVDriver
+	done   bool
+}
+
+func (b *loopWriteBatch) RawSet(key IKey, value []byte) error {
+	if b.done {
+		return ErrBatchDone
+	}
+	return b.driver.RawSet(key, value)
+}
+
+func (b *loopWriteBatch) RawDelete(key IKey) error {
+	if b.done {
+		return ErrBatchDone
+	}
+	if err := b.driver.RawDelete(key); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (b *loopWriteBatch) Flush() error {
+	if b.done {
+		return ErrBatchDone
+	}
+	b.done = true
+	return nil
+}
+
+func (b *loopWriteBatch) Cancel() {
+	b.done = true
+}
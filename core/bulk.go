@@ -0,0 +1,350 @@
+package core
+
+import (
+	"context"
+	"errors"
+)
+
+// BulkOptions tunes a BulkLoader.
+type BulkOptions struct {
+	// BatchSize is the number of records written per driver batch; IDs are reserved by
+	// blocks of this size too.
+	BatchSize int
+
+	// SkipTriggers loads the records without running their triggers, for trusted imports.
+	SkipTriggers bool
+}
+
+// DefaultBulkOptions are the options used by InsertMany.
+var DefaultBulkOptions = BulkOptions{
+	BatchSize:    1000,
+	SkipTriggers: false,
+}
+
+// BulkLoader inserts a stream of records through the write batches of the driver,
+// reserving their IDs by blocks, instead of paying one transaction per record.
+//
+// Triggers run per record as with Insert: a before trigger can reject a record, and the
+// after triggers fire once the batch holding it is flushed. Unique values are checked
+// against the store and the records pending in the loader, but not against concurrent
+// writers.
+//
+// A loading is not atomic: on a failure, the batches already flushed are kept. A loader
+// is used by one goroutine at a time.
+type BulkLoader struct {
+	db      *KVStoreManager
+	ctx     context.Context
+	options BulkOptions
+
+	// writer is the manager writing through view, the pending batch.
+	writer *KVStoreManager
+	view   *batchView
+
+	// ids are the reserved IDs not used yet, per table, and remaining the number of
+	// records still expected, when known, so that no more IDs than needed are reserved.
+	ids       map[string][]string
+	remaining int
+
+	// afterFlush holds the after triggers of the records of the pending batch, and
+	// pendingIds their IDs, per table, released if the batch is cancelled.
+	afterFlush []func()
+	pendingIds map[string][]string
+	pending    int
+
+	err    error
+	closed bool
+}
+
+// NewBulkLoader starts a BulkLoader on the manager. It must be closed to flush the last
+// batch and release the IDs reserved in excess.
+func (db *KVStoreManager) NewBulkLoader(options BulkOptions) *BulkLoader {
+	return db.NewBulkLoaderCtx(context.Background(), options)
+}
+
+// NewBulkLoaderCtx is NewBulkLoader with a context, handed to the triggers. Once ctx is
+// done, the loader fails with ctx.Err().
+func (db *KVStoreManager) NewBulkLoaderCtx(ctx context.Context, options BulkOptions) *BulkLoader {
+
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultBulkOptions.BatchSize
+	}
+
+	return &BulkLoader{
+		db:         db,
+		ctx:        ctx,
+		options:    options,
+		writer:     &KVStoreManager{marshaller: db.marshaller, parent: db},
+		ids:        make(map[string][]string),
+		pendingIds: make(map[string][]string),
+	}
+}
+
+// Add queues the insertion of value and returns the key allocated to it. The record is
+// stored once its batch is flushed, which happens every BatchSize records and on Close.
+//
+// Possible Errors:
+//   - ErrCancelledByTrigger: If a before trigger rejected the record; the loader remains usable.
+//   - ErrUniqueViolation: If a unique field holds a value already used; the loader remains usable.
+//   - Any error of the driver or of the context, after which the loader is failed.
+func (l *BulkLoader) Add(value *any) (*TableKey, error) {
+	record, err := l.add(value)
+	if err != nil {
+		return nil, err
+	}
+	return record.key, nil
+}
+
+// add is Add, also returning the header of the record.
+func (l *BulkLoader) add(value *any) (storedRecord, error) {
+
+	if l.closed {
+		return storedRecord{}, ErrBatchDone
+	}
+	if err := l.check(); err != nil {
+		return storedRecord{}, err
+	}
+
+	tableKey := NewTableKeyFromObject(*value)
+	table := tableKey.Name()
+	if l.view == nil {
+		l.view = newBatchView(l.db.KVDriver)
+		l.writer.KVDriver = l.view
+	}
+	for {
+		if len(l.ids[table]) == 0 {
+			size := l.options.BatchSize
+			if l.remaining > 0 && l.remaining < size {
+				size = l.remaining
+			}
+			ids, err := l.db.newIds(table, size)
+			if err != nil {
+				return storedRecord{}, l.fail(err)
+			}
+			l.ids[table] = ids
+		}
+		tableKey.SetId(l.ids[table][0])
+
+		// Skip the IDs chosen by a caller of InsertWithId.
+		_, err := l.view.RawGet(tableKey)
+		if errors.Is(err, ErrNotFound) {
+			break
+		}
+		if err != nil {
+			return storedRecord{}, l.fail(err)
+		}
+		l.ids[table] = l.ids[table][1:]
+	}
+
+	if !l.options.SkipTriggers && !l.writer.runBeforeTriggers(l.ctx, InsertOperation, tableKey, value) {
+		return storedRecord{}, ErrCancelledByTrigger
+	}
+	header := l.db.newHeader()
+	encoded, err := l.db.encode(header, value)
+	if err != nil {
+		return storedRecord{}, err
+	}
+	_, uniqueKeys := l.writer.indexEntries(tableKey, value)
+	if err = l.writer.checkUnique(tableKey, uniqueKeys); err != nil {
+		return storedRecord{}, err
+	}
+
+	l.ids[table] = l.ids[table][1:]
+	l.pendingIds[table] = append(l.pendingIds[table], tableKey.Id())
+	if l.remaining > 0 {
+		l.remaining--
+	}
+
+	if err = l.view.RawSet(tableKey, encoded); err != nil {
+		return storedRecord{}, l.fail(failedToSet(err))
+	}
+	if err = l.writer.updateIndexes(tableKey, nil, value); err != nil {
+		return storedRecord{}, l.fail(err)
+	}
+
+	if !l.options.SkipTriggers {
+		l.afterFlush = append(l.afterFlush, func() {
+			l.db.runAfterTriggers(l.ctx, InsertOperation, tableKey, value)
+		})
+	}
+
+	l.pending++
+	if l.pending >= l.options.BatchSize {
+		if err = l.Flush(); err != nil {
+			return storedRecord{}, err
+		}
+	}
+
+	return storedRecord{key: tableKey, value: value, header: header}, nil
+}
+
+// Flush writes the pending batch, then fires the after triggers of its records.
+func (l *BulkLoader) Flush() error {
+
+	if err := l.check(); err != nil {
+		return err
+	}
+	if l.view == nil {
+		return nil
+	}
+
+	if err := l.view.batch.Flush(); err != nil {
+		return l.fail(err)
+	}
+
+	afterFlush := l.afterFlush
+	l.view, l.afterFlush, l.pending = nil, nil, 0
+	clear(l.pendingIds)
+
+	for _, after := range afterFlush {
+		l.db.afterCommit(after)
+	}
+
+	return nil
+}
+
+// Close flushes the pending batch and releases the IDs reserved in excess. It returns
+// the error which failed the loader, if any.
+func (l *BulkLoader) Close() error {
+
+	if l.closed {
+		return l.err
+	}
+
+	err := l.Flush()
+	l.closed = true
+	for table, ids := range l.ids {
+		_ = l.db.releaseIds(table, ids...)
+	}
+	l.ids = nil
+
+	return err
+}
+
+// check returns the error which failed the loader, failing it first if its context is
+// done.
+func (l *BulkLoader) check() error {
+	if l.err == nil {
+		if err := l.ctx.Err(); err != nil {
+			return l.fail(err)
+		}
+	}
+	return l.err
+}
+
+// fail cancels the pending batch, releasing the IDs of its records, and makes every later
+// call return err.
+func (l *BulkLoader) fail(err error) error {
+	if l.view != nil {
+		l.view.batch.Cancel()
+	}
+	for table, ids := range l.pendingIds {
+		_ = l.db.releaseIds(table, ids...)
+	}
+	clear(l.pendingIds)
+	l.view, l.afterFlush, l.pending = nil, nil, 0
+	l.err = err
+	return err
+}
+
+// InsertMany inserts the values through a BulkLoader with the DefaultBulkOptions and
+// returns their keys, in order.
+//
+// On error, the keys of the records stored before the failure are returned with it.
+func (db *KVStoreManager) InsertMany(values []*any) ([]*TableKey, error) {
+	return db.InsertManyCtx(context.Background(), values)
+}
+
+// InsertManyCtx is InsertMany with a context, handed to the triggers.
+func (db *KVStoreManager) InsertManyCtx(ctx context.Context, values []*any) ([]*TableKey, error) {
+	records, err := db.insertMany(ctx, values)
+	tableKeys, _, _ := splitRecords(records)
+	return tableKeys, err
+}
+
+// insertMany is InsertManyCtx, returning whole records.
+func (db *KVStoreManager) insertMany(ctx context.Context, values []*any) ([]storedRecord, error) {
+
+	loader := db.NewBulkLoaderCtx(ctx, DefaultBulkOptions)
+	loader.remaining = len(values)
+
+	records := make([]storedRecord, 0, len(values))
+	flushed := 0
+	for _, value := range values {
+		record, err := loader.add(value)
+		if err != nil {
+			// The pending records are still stored, unless the loader itself failed.
+			if loader.Close() != nil {
+				return records[:flushed], err
+			}
+			return records, err
+		}
+		records = append(records, record)
+		if loader.pending == 0 {
+			flushed = len(records)
+		}
+	}
+
+	if err := loader.Close(); err != nil {
+		return records[:flushed], err
+	}
+
+	return records, nil
+}
+
+// batchView is a driver writing through a KVWriteBatch, whose pending writes are visible
+// to its own reads so that the unique values of a batch are checked against each other.
+type batchView struct {
+	KVDriver
+	batch   KVWriteBatch
+	written map[string][]byte
+	deleted map[string]bool
+}
+
+func newBatchView(driver KVDriver) *batchView {
+	return &batchView{
+		KVDriver: driver,
+		batch:    driver.NewWriteBatch(),
+		written:  make(map[string][]byte),
+		deleted:  make(map[string]bool),
+	}
+}
+
+func (v *batchView) RawSet(key IKey, value []byte) error {
+	if err := v.batch.RawSet(key, value); err != nil {
+		return err
+	}
+	delete(v.deleted, key.Key())
+	v.written[key.Key()] = value
+	return nil
+}
+
+func (v *batchView) RawGet(key IKey) ([]byte, error) {
+	if v.deleted[key.Key()] {
+		return nil, ErrNotFound
+	}
+	if value, ok := v.written[key.Key()]; ok {
+		return value, nil
+	}
+	return v.KVDriver.RawGet(key)
+}
+
+func (v *batchView) RawDelete(key IKey) error {
+	if _, err := v.RawGet(key); err != nil {
+		return err
+	}
+	if err := v.batch.RawDelete(key); err != nil {
+		return err
+	}
+	delete(v.written, key.Key())
+	v.deleted[key.Key()] = true
+	return nil
+}
+
+func (v *batchView) Exist(key IKey) bool {
+	_, err := v.RawGet(key)
+	return err == nil
+}
+
+func (v *batchView) Begin() (KVTx, error) {
+	return nil, ErrNestedTx
+}
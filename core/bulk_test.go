@@ -0,0 +1,227 @@
+package core_test
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	. "github.com/Phosmachina/FluentKV/core"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestInsertMany(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	var values []*SimpleType
+	for i := 0; i < 2500; i++ {
+		values = append(values, NewSimpleType("t1", "t2", i))
+	}
+
+	// Act
+	objs, err := InsertMany(db, values...)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("InsertMany failed: expected %v, got %v", nil, err)
+	}
+	if len(objs) != len(values) {
+		t.Fatalf("InsertMany failed: expected %d wrappers, got %d", len(values), len(objs))
+	}
+	if count := Count[SimpleType](db); count != len(values) {
+		t.Errorf("InsertMany failed: expected %d objects, got %d", len(values), count)
+	}
+	ids := make(map[string]bool)
+	for i, obj := range objs {
+		ids[obj.Key().Id()] = true
+		stored, err := Get[SimpleType](db, obj.Key().Id())
+		if err != nil || stored.Value().Val != i {
+			t.Fatalf("InsertMany failed: expected %d under %s, got %v (%v)", i, obj.Key().Id(), stored.Value(), err)
+		}
+	}
+	if len(ids) != len(values) {
+		t.Errorf("InsertMany failed: expected %d distinct IDs, got %d", len(values), len(ids))
+	}
+}
+
+func TestInsertMany_Triggers(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	var afterCount atomic.Int32
+	_ = AddAfterTrigger(db, "count", InsertOperation,
+		func(operation Operation, key IKey, value *SimpleType) {
+			afterCount.Add(1)
+		})
+	_ = AddBeforeTrigger(db, "reject", InsertOperation,
+		func(operation Operation, key IKey, value *SimpleType) bool {
+			return value.Val != 2
+		})
+
+	// Act
+	objs, err := InsertMany(db,
+		NewSimpleType("t1", "t2", 0),
+		NewSimpleType("t1", "t2", 1),
+		NewSimpleType("t1", "t2", 2),
+		NewSimpleType("t1", "t2", 3))
+
+	// Assert
+	if !errors.Is(err, ErrCancelledByTrigger) {
+		t.Errorf("InsertMany failed: expected %v, got %v", ErrCancelledByTrigger, err)
+	}
+	if len(objs) != 2 || Count[SimpleType](db) != 2 {
+		t.Errorf("InsertMany failed: expected %d objects, got %d wrappers and %d stored",
+			2, len(objs), Count[SimpleType](db))
+	}
+	if afterCount.Load() != 2 {
+		t.Errorf("InsertMany failed: expected %d after triggers, got %d", 2, afterCount.Load())
+	}
+}
+
+func TestInsertMany_UniqueWithinBatch(t *testing.T) {
+
+	// Arrange
+	gob.Register(UniqueType{})
+	db := prepareTestableDb()
+
+	// Act
+	objs, err := InsertMany(db,
+		&UniqueType{Email: "a@b.c", Name: "first"},
+		&UniqueType{Email: "a@b.c", Name: "second"})
+
+	// Assert
+	var violation *ErrUniqueViolation
+	if !errors.As(err, &violation) {
+		t.Fatalf("InsertMany failed: expected %T, got %v", violation, err)
+	}
+	if len(objs) != 1 || Count[UniqueType](db) != 1 {
+		t.Errorf("InsertMany failed: expected %d object, got %d", 1, Count[UniqueType](db))
+	}
+	if results, _ := FindBy[UniqueType](db, "Email", "a@b.c"); len(results) != 1 {
+		t.Errorf("InsertMany failed: expected %d indexed object, got %d", 1, len(results))
+	}
+}
+
+func TestLoader_SkipTriggers(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	triggered := false
+	_ = AddBeforeTrigger(db, "check", InsertOperation,
+		func(operation Operation, key IKey, value *SimpleType) bool {
+			triggered = true
+			return true
+		})
+	loader := NewLoader[SimpleType](db, BulkOptions{BatchSize: 10, SkipTriggers: true})
+
+	// Act
+	for i := 0; i < 25; i++ {
+		if _, err := loader.Add(NewSimpleType("t1", "t2", i)); err != nil {
+			t.Fatalf("Add failed: expected %v, got %v", nil, err)
+		}
+	}
+	err := loader.Close()
+
+	// Assert
+	if err != nil {
+		t.Errorf("Close failed: expected %v, got %v", nil, err)
+	}
+	if triggered {
+		t.Error("Trigger run despite SkipTriggers")
+	}
+	if count := Count[SimpleType](db); count != 25 {
+		t.Errorf("Loader failed: expected %d objects, got %d", 25, count)
+	}
+}
+
+func TestLoader_ReleasesUnusedIds(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	loader := NewLoader[SimpleType](db, BulkOptions{BatchSize: 10})
+	for i := 0; i < 3; i++ {
+		_, _ = loader.Add(NewSimpleType("t1", "t2", i))
+	}
+
+	// Act
+	_ = loader.Close()
+	var values []*SimpleType
+	for i := 3; i < AutoIdBuffer; i++ {
+		values = append(values, NewSimpleType("t1", "t2", i))
+	}
+	objs, _ := InsertMany(db, values...)
+
+	// Assert
+	for _, obj := range objs {
+		if id, _ := strconv.Atoi(obj.Key().Id()); id >= AutoIdBuffer {
+			t.Fatalf("InsertMany failed: expected an ID below %d, got %d", AutoIdBuffer, id)
+		}
+	}
+}
+
+func TestLoader_ReleasesCancelledIds(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	ctx, cancel := context.WithCancel(context.Background())
+	loader := NewLoaderCtx[SimpleType](ctx, db, BulkOptions{BatchSize: 10})
+	for i := 0; i < 3; i++ {
+		_, _ = loader.Add(NewSimpleType("t1", "t2", i))
+	}
+
+	// Act: the pending batch is cancelled.
+	cancel()
+	_, err := loader.Add(NewSimpleType("t1", "t2", 3))
+	_ = loader.Close()
+	ids, _ := db.GetFreeIds(AutoIdBuffer)
+
+	// Assert
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Add failed: expected %v, got %v", context.Canceled, err)
+	}
+	for _, raw := range ids {
+		if id, _ := strconv.Atoi(raw); id >= AutoIdBuffer {
+			t.Fatalf("GetFreeIds failed: expected an ID below %d, got %d", AutoIdBuffer, id)
+		}
+	}
+}
+
+func TestInsertMany_RolledBackWithTx(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	rollback := errors.New("rollback")
+
+	// Act
+	err := WithTx(db, func(tx *KVStoreManager) error {
+		if _, err := InsertMany(tx, NewSimpleType("t1", "t2", 0), NewSimpleType("t1", "t2", 1)); err != nil {
+			return err
+		}
+		return rollback
+	})
+
+	// Assert
+	if !errors.Is(err, rollback) {
+		t.Errorf("WithTx failed: expected %v, got %v", rollback, err)
+	}
+	if count := Count[SimpleType](db); count != 0 {
+		t.Errorf("WithTx failed: expected %d objects, got %d", 0, count)
+	}
+}
+
+func BenchmarkInsertMany(b *testing.B) {
+
+	db := prepareTestableDb()
+	values := make([]*SimpleType, 10_000)
+	for i := range values {
+		values[i] = NewSimpleType("t1", "t2", i)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := InsertMany(db, values...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
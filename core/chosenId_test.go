@@ -0,0 +1,188 @@
+package core_test
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+
+	. "github.com/Phosmachina/FluentKV/core"
+)
+
+func TestInsertWithId(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+
+	// Act
+	inserted, err := InsertWithId(db, "alice", NewSimpleType("t1", "t2", 1))
+	_, errTaken := InsertWithId(db, "alice", NewSimpleType("t1", "t2", 2))
+
+	// Assert
+	if err != nil {
+		t.Fatalf("InsertWithId failed: expected %v, got %v", nil, err)
+	}
+	if inserted.Key().Id() != "alice" {
+		t.Errorf("InsertWithId failed: expected ID %v, got %v", "alice", inserted.Key().Id())
+	}
+	if !errors.Is(errTaken, ErrIdTaken) {
+		t.Errorf("InsertWithId failed: expected %v, got %v", ErrIdTaken, errTaken)
+	}
+	if stored, _ := Get[SimpleType](db, "alice"); stored.Value().Val != 1 {
+		t.Errorf("Get failed: expected %v, got %v", 1, stored.Value().Val)
+	}
+}
+
+func TestInsertWithId_MalformedId(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+
+	for _, id := range []string{"", "a" + LinkDelimiter + "b"} {
+		// Act
+		_, err := InsertWithId(db, id, NewSimpleType("t1", "t2", 1))
+		_, errUpsert := Upsert(db, id, NewSimpleType("t1", "t2", 1))
+
+		// Assert
+		if !errors.Is(err, ErrMalformedId) {
+			t.Errorf("InsertWithId failed: expected %v, got %v", ErrMalformedId, err)
+		}
+		if !errors.Is(errUpsert, ErrMalformedId) {
+			t.Errorf("Upsert failed: expected %v, got %v", ErrMalformedId, errUpsert)
+		}
+	}
+}
+
+func TestUpsert(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	var operations []Operation
+	_ = AddAfterTrigger[SimpleType](
+		db,
+		"trigger",
+		InsertOperation|UpdateOperation,
+		func(operation Operation, key IKey, value *SimpleType) {
+			operations = append(operations, operation)
+		},
+	)
+
+	// Act
+	_, errInsert := Upsert(db, "bob", NewSimpleType("t1", "t2", 1))
+	_, errUpdate := Upsert(db, "bob", NewSimpleType("t1", "t2", 2))
+
+	// Assert
+	if errInsert != nil || errUpdate != nil {
+		t.Fatalf("Upsert failed: expected %v, got %v and %v", nil, errInsert, errUpdate)
+	}
+	if stored, _ := Get[SimpleType](db, "bob"); stored.Value().Val != 2 {
+		t.Errorf("Upsert failed: expected %v, got %v", 2, stored.Value().Val)
+	}
+	expected := []Operation{InsertOperation, UpdateOperation}
+	if !slices.Equal(operations, expected) {
+		t.Errorf("Upsert failed: expected operations %v, got %v", expected, operations)
+	}
+}
+
+func TestInsertWithId_NeverAllocated(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	_, _ = InsertWithId(db, "5", NewSimpleType("t1", "t2", 5))
+
+	// Act
+	var ids []string
+	for i := 0; i < 10; i++ {
+		inserted, _ := Insert(db, NewSimpleType("t1", "t2", i))
+		ids = append(ids, inserted.Key().Id())
+	}
+
+	// Assert
+	if slices.Contains(ids, "5") {
+		t.Errorf("Insert failed: the chosen ID %v was handed out in %v", "5", ids)
+	}
+	if stored, _ := Get[SimpleType](db, "5"); stored.Value().Val != 5 {
+		t.Errorf("Insert failed: the chosen record was overwritten by %v", stored.Value().Val)
+	}
+}
+
+func TestInsertWithId_FreedId(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	for i := 0; i < 3; i++ {
+		_, _ = Insert(db, NewSimpleType("t1", "t2", i))
+	}
+	_ = Delete[SimpleType](db, "1")
+	_, _ = InsertWithId(db, "1", NewSimpleType("t1", "t2", 10))
+
+	// Act
+	inserted, _ := Insert(db, NewSimpleType("t1", "t2", 3))
+	restarted := NewKVStoreManager(db.KVDriver)
+	afterRestart, _ := Insert(restarted, NewSimpleType("t1", "t2", 4))
+
+	// Assert
+	if inserted.Key().Id() == "1" {
+		t.Errorf("Insert failed: the chosen ID %v was handed out", "1")
+	}
+	if afterRestart.Key().Id() == "1" {
+		t.Errorf("Insert failed: the chosen ID %v was handed out after restart", "1")
+	}
+}
+
+func TestInsertWithId_LargeNaturalKey(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	_, _ = Insert(db, NewSimpleType("t1", "t2", 0))
+	_, _ = InsertWithId(db, "2024000", NewSimpleType("t1", "t2", 1))
+
+	// Act
+	same, _ := Insert(db, NewSimpleType("t1", "t2", 2))
+	other, _ := Insert(db, NewAnotherType("t3", 1.1))
+
+	// Assert
+	for _, id := range []string{same.Key().Id(), other.Key().Id()} {
+		if n, _ := strconv.Atoi(id); n >= AutoIdBuffer {
+			t.Errorf("Insert failed: expected an ID below %d, got %v", AutoIdBuffer, id)
+		}
+	}
+}
+
+func TestInsertWithId_SequenceIdGenerator(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	SetIdGenerator[SimpleType](db, NewSequenceIdGenerator())
+	_, _ = Insert(db, NewSimpleType("t1", "t2", 0))
+	_, _ = InsertWithId(db, "7", NewSimpleType("t1", "t2", 7))
+
+	// Act
+	next, err := Insert(db, NewSimpleType("t1", "t2", 8))
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Insert failed: expected %v, got %v", nil, err)
+	}
+	if next.Key().Id() != "8" {
+		t.Errorf("Insert failed: expected ID %v, got %v", 8, next.Key().Id())
+	}
+}
+
+func TestInsertWithId_Rollback(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	_ = WithTx(db, func(tx *KVStoreManager) error {
+		_, _ = InsertWithId(tx, "0", NewSimpleType("t1", "t2", 0))
+		return errors.New("rollback")
+	})
+
+	// Act
+	inserted, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+
+	// Assert
+	if inserted.Key().Id() != "0" {
+		t.Errorf("Insert failed: expected the rolled back ID %v, got %v", 0, inserted.Key().Id())
+	}
+}
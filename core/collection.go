@@ -1,8 +1,12 @@
 package core
 
 import (
+	"cmp"
+	"context"
 	. "github.com/Phosmachina/FluentKV/helper"
+	"iter"
 	"sort"
+	"sync"
 )
 
 func (c *Collection[T]) Len() int {
@@ -23,13 +27,27 @@ type Collection[T any] struct {
 }
 
 func NewCollection[T any](db *KVStoreManager) *Collection[T] {
+	collection, _ := NewCollectionCtx[T](context.Background(), db)
+	return collection
+}
+
+// NewCollectionCtx is NewCollection with a context: once ctx is done, the loading stops
+// and ctx.Err() is returned.
+func NewCollectionCtx[T any](ctx context.Context, db *KVStoreManager) (*Collection[T], error) {
 
 	var list []KVWrapper[T]
-	Foreach[T](db, func(key IKey, value *T) {
-		list = append(list, NewKVWrapper(db, key.(*TableKey), value))
+	var m sync.Mutex
+	err := db.foreach(ctx, NewTableKey[T](), nil, func(record storedRecord) {
+		wrapper := wrapRecord[T](db, record)
+		m.Lock()
+		defer m.Unlock()
+		list = append(list, wrapper)
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	return &Collection[T]{objects: list}
+	return &Collection[T]{objects: list}, nil
 }
 
 // GetArray give the underlying KVWrapper array of the current collection.
@@ -68,3 +86,129 @@ func (c *Collection[T]) Distinct() *Collection[T] {
 
 	return c
 }
+
+// Values returns an iterator over the objects of the collection, in its order, to feed
+// the aggregations such as Sum or CountBy.
+func (c *Collection[T]) Values() iter.Seq[*T] {
+	return func(yield func(*T) bool) {
+		for _, object := range c.objects {
+			if !yield(object.value) {
+				return
+			}
+		}
+	}
+}
+
+//region Aggregations
+
+// Number is the constraint of the values Sum and Avg add up.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// GroupBy splits the collection by the key keyFn gives to each object. Each group keeps
+// the order of the collection.
+func GroupBy[T any, K comparable](c *Collection[T], keyFn func(value *T) K) map[K]*Collection[T] {
+
+	groups := make(map[K]*Collection[T])
+	for _, object := range c.objects {
+		key := keyFn(object.value)
+		group, ok := groups[key]
+		if !ok {
+			group = &Collection[T]{}
+			groups[key] = group
+		}
+		group.objects = append(group.objects, object)
+	}
+
+	return groups
+}
+
+// CountBy counts the values by the key keyFn gives to each of them.
+//
+// The values come from Collection.Values, or straight from the store with Values, in
+// which case each one is decoded as the driver reaches it. Outside a transaction, the
+// drivers read the values of the table by batches, so they are never all held at once.
+// The same goes for the other aggregations.
+func CountBy[T any, K comparable](values iter.Seq[*T], keyFn func(value *T) K) map[K]int {
+
+	counts := make(map[K]int)
+	for value := range values {
+		counts[keyFn(value)]++
+	}
+
+	return counts
+}
+
+// Sum adds up the numbers extractor gives for the values.
+func Sum[T any, N Number](values iter.Seq[*T], extractor func(value *T) N) N {
+
+	var sum N
+	for value := range values {
+		sum += extractor(value)
+	}
+
+	return sum
+}
+
+// Avg returns the mean of the numbers extractor gives for the values; ok is false when
+// there is no value.
+func Avg[T any, N Number](values iter.Seq[*T], extractor func(value *T) N) (avg float64, ok bool) {
+
+	var sum float64
+	ct := 0
+	for value := range values {
+		sum += float64(extractor(value))
+		ct++
+	}
+	if ct == 0 {
+		return 0, false
+	}
+
+	return sum / float64(ct), true
+}
+
+// Min returns the least of the values extractor gives for the values; ok is false when
+// there is no value.
+func Min[T any, V cmp.Ordered](values iter.Seq[*T], extractor func(value *T) V) (least V, ok bool) {
+	return extremum(values, extractor, -1)
+}
+
+// Max returns the greatest of the values extractor gives for the values; ok is false when
+// there is no value.
+func Max[T any, V cmp.Ordered](values iter.Seq[*T], extractor func(value *T) V) (greatest V, ok bool) {
+	return extremum(values, extractor, 1)
+}
+
+// extremum returns the value extractor gives which compares to each other one as sign
+// tells: -1 for the least, 1 for the greatest.
+func extremum[T any, V cmp.Ordered](values iter.Seq[*T], extractor func(value *T) V, sign int) (V, bool) {
+
+	var result V
+	found := false
+	for value := range values {
+		extracted := extractor(value)
+		if !found || cmp.Compare(extracted, result) == sign {
+			result = extracted
+			found = true
+		}
+	}
+
+	return result, found
+}
+
+// Map returns an iterator over the projection fn gives of each value, computed as the
+// iteration goes; slices.Collect gathers them.
+func Map[T any, U any](values iter.Seq[*T], fn func(value *T) U) iter.Seq[U] {
+	return func(yield func(U) bool) {
+		for value := range values {
+			if !yield(fn(value)) {
+				return
+			}
+		}
+	}
+}
+
+//endregion
@@ -0,0 +1,92 @@
+package core_test
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	. "github.com/Phosmachina/FluentKV/core"
+)
+
+func city(person *PersonType) string {
+	if person.Address == nil {
+		return ""
+	}
+	return person.Address.City
+}
+
+func age(person *PersonType) int {
+	return person.Age
+}
+
+func TestGroupBy(t *testing.T) {
+
+	// Arrange
+	db := preparePersonDb()
+	collection := NewCollection[PersonType](db).Sort(func(x, y KVWrapper[PersonType]) bool {
+		return x.Value().Name < y.Value().Name
+	})
+
+	// Act
+	groups := GroupBy(collection, city)
+
+	// Assert
+	if expected := []string{"", "London", "New York"}; !slices.Equal(slices.Sorted(maps.Keys(groups)), expected) {
+		t.Errorf("GroupBy failed: expected the groups %v, got %v", expected, slices.Sorted(maps.Keys(groups)))
+	}
+	if london := names(groups["London"].GetArray()); !slices.Equal(london, []string{"Ada", "Alan"}) {
+		t.Errorf("GroupBy failed: expected %v, got %v", []string{"Ada", "Alan"}, london)
+	}
+}
+
+func TestAggregations(t *testing.T) {
+
+	// Arrange
+	db := preparePersonDb()
+	collection := NewCollection[PersonType](db).Filter(func(objWrp KVWrapper[PersonType]) bool {
+		return city(objWrp.Value()) == "London"
+	})
+
+	// Act
+	sum := Sum(Values[PersonType](db), age)
+	avg, okAvg := Avg(collection.Values(), age)
+	least, okMin := Min(Values[PersonType](db), age)
+	greatest, okMax := Max(collection.Values(), func(person *PersonType) string { return person.Name })
+	counts := CountBy(Values[PersonType](db), city)
+	projected := slices.Sorted(Map(Values[PersonType](db), func(person *PersonType) string { return person.Name }))
+
+	// Assert
+	if sum != 190 {
+		t.Errorf("Sum failed: expected %d, got %d", 190, sum)
+	}
+	if !okAvg || avg != 38.5 {
+		t.Errorf("Avg failed: expected %v, got %v (%v)", 38.5, avg, okAvg)
+	}
+	if !okMin || least != 28 {
+		t.Errorf("Min failed: expected %d, got %d (%v)", 28, least, okMin)
+	}
+	if !okMax || greatest != "Alan" {
+		t.Errorf("Max failed: expected %v, got %v (%v)", "Alan", greatest, okMax)
+	}
+	if expected := map[string]int{"London": 2, "New York": 1, "": 1}; !maps.Equal(counts, expected) {
+		t.Errorf("CountBy failed: expected %v, got %v", expected, counts)
+	}
+	if expected := []string{"Ada", "Alan", "Grace", "Linus"}; !slices.Equal(projected, expected) {
+		t.Errorf("Map failed: expected %v, got %v", expected, projected)
+	}
+}
+
+func TestAggregations_Empty(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+
+	// Act
+	_, okAvg := Avg(Values[PersonType](db), age)
+	_, okMax := Max(Values[PersonType](db), age)
+
+	// Assert
+	if okAvg || okMax {
+		t.Errorf("Avg and Max failed: expected no result, got %v and %v", okAvg, okMax)
+	}
+}
@@ -0,0 +1,384 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ExpirySweepInterval is the period of the background sweeper removing the records
+	// whose time-to-live elapsed, see SweepExpired. It is read when the sweeper starts.
+	ExpirySweepInterval = time.Minute
+
+	// ExpiryGracePeriod is added to the time-to-live of the records written through a
+	// KVExpiringDriver: the sweeper normally removes them first, with their links and
+	// triggers, and the driver only drops those it missed, e.g. while the store was closed.
+	ExpiryGracePeriod = time.Hour
+
+	// errExpired reports a record whose time-to-live elapsed, which is read as missing.
+	errExpired = fmt.Errorf("%w: the record expired", ErrNotFound)
+)
+
+// InsertWithTTL is Insert for a record which expires once ttl elapsed: it is no longer
+// read from then on, and the sweeper removes it like Delete would, running the triggers
+// with ExpireOperation. A ttl not above zero gives a record which never expires.
+func (db *KVStoreManager) InsertWithTTL(value *any, ttl time.Duration) (*TableKey, error) {
+	return db.InsertWithTTLCtx(context.Background(), value, ttl)
+}
+
+// InsertWithTTLCtx is InsertWithTTL with a context, handed to the triggers. Nothing is
+// committed once ctx is done.
+func (db *KVStoreManager) InsertWithTTLCtx(
+	ctx context.Context,
+	value *any,
+	ttl time.Duration,
+) (*TableKey, error) {
+	record, err := db.insert(ctx, value, expiryTime(ttl))
+	return record.key, err
+}
+
+// SetTTL makes the record of tableKey expire once ttl elapsed from now, replacing its
+// previous time-to-live; a ttl not above zero makes it never expire. The value is kept
+// as is, but the write counts in the version of the record.
+// If the key does not exist in the store, ErrInvalidId is returned.
+func (db *KVStoreManager) SetTTL(tableKey *TableKey, ttl time.Duration) error {
+	return db.SetTTLCtx(context.Background(), tableKey, ttl)
+}
+
+// SetTTLCtx is SetTTL with a context. Nothing is committed once ctx is done.
+func (db *KVStoreManager) SetTTLCtx(ctx context.Context, tableKey *TableKey, ttl time.Duration) error {
+	_, err := db.setTTL(ctx, tableKey, ttl)
+	return err
+}
+
+// setTTL is SetTTLCtx, also returning the header of the record.
+func (db *KVStoreManager) setTTL(
+	ctx context.Context,
+	tableKey *TableKey,
+	ttl time.Duration,
+) (recordHeader, error) {
+
+	var header recordHeader
+
+	err := db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
+		raw, err := tx.rawLive(ctx, tableKey)
+		if err != nil {
+			return invalidIdOr(err)
+		}
+
+		var payload []byte
+		header, payload, err = decodeRecord(raw)
+		if err != nil {
+			return err
+		}
+		previous := header.expires
+
+		// The payload is kept, and so is the marshaller it was encoded with.
+		header.version++
+		header.updated = time.Now().UnixNano()
+		header.expires = expiryTime(ttl)
+
+		if err = tx.writeRecord(tableKey, header, encodeRecord(header, payload)); err != nil {
+			return err
+		}
+		if err = tx.dropExpiry(tableKey, previous); err != nil {
+			return err
+		}
+		return tx.scheduleExpiry(tableKey, header.expires)
+	})
+
+	return header, err
+}
+
+// SweepExpired removes the records whose time-to-live elapsed, as the background
+// sweeper does every ExpirySweepInterval, and returns how many it removed. Each one is
+// removed in its own transaction, like Delete would, with the triggers run with
+// ExpireOperation.
+// The records already dropped by a KVExpiringDriver have their ID released and their
+// links removed, without trigger as their value is lost.
+func (db *KVStoreManager) SweepExpired() (int, error) {
+	return db.SweepExpiredCtx(context.Background())
+}
+
+// SweepExpiredCtx is SweepExpired with a context, handed to the triggers: the sweep
+// stops once ctx is done, returning ctx.Err().
+func (db *KVStoreManager) SweepExpiredCtx(ctx context.Context) (int, error) {
+
+	now := time.Now().UnixNano()
+
+	// Not every driver iterates in key order, so every entry is looked at.
+	var due []*ExpiryKey
+	db.RawIterKey(NewProtoExpiryKey(), func(key IKey) (stop bool) {
+		if expiryKey := key.(*ExpiryKey); expiryKey.at <= now && expiryKey.record != nil {
+			due = append(due, expiryKey)
+		}
+		return ctx.Err() != nil
+	})
+
+	swept := 0
+	for _, expiryKey := range due {
+		if err := ctx.Err(); err != nil {
+			return swept, err
+		}
+
+		var removed bool
+		err := db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
+			var err error
+			removed, err = tx.expire(ctx, expiryKey.record, expiryKey.at, now)
+			return err
+		})
+		if err != nil {
+			return swept, err
+		}
+		if removed {
+			swept++
+		}
+	}
+
+	return swept, nil
+}
+
+// expire removes the record of tableKey, scheduled to expire at the given time, if its
+// time-to-live elapsed at now, along with its expiry entry. It must be run in a
+// transaction, and reports whether a record was removed.
+func (db *KVStoreManager) expire(
+	ctx context.Context,
+	tableKey *TableKey,
+	at int64,
+	now int64,
+) (bool, error) {
+
+	if !db.Exist(NewExpiryKey(at, tableKey)) {
+		// Already removed, e.g. deleted since the entry was read.
+		return false, nil
+	}
+
+	raw, err := db.RawGet(tableKey)
+	if errors.Is(err, ErrNotFound) {
+		// Dropped by the driver: only its value is lost.
+		if err := db.releaseRecordId(tableKey); err != nil {
+			return false, err
+		}
+		if _, err := unlinkAll(db, tableKey); err != nil {
+			return false, err
+		}
+		return true, db.dropExpiry(tableKey, at)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	value, header, err := db.decode(raw)
+	if err != nil {
+		return false, err
+	}
+	if !header.expired(now) {
+		if header.expires == at {
+			return false, nil
+		}
+		// The entry was left by a previous time-to-live.
+		return false, db.dropExpiry(tableKey, at)
+	}
+
+	// The before triggers are told about the expiry, but can not keep the record.
+	db.runBeforeTriggers(ctx, ExpireOperation, tableKey, value)
+
+	if err := db.archive(tableKey, raw, ExpireOperation); err != nil {
+		return false, err
+	}
+	if _, err := db.deleteRecord(tableKey, value, header); err != nil {
+		return false, err
+	}
+
+	db.afterCommit(func() {
+		db.runAfterTriggers(ctx, ExpireOperation, tableKey, value)
+	})
+
+	return true, nil
+}
+
+// rawLive reads the record of tableKey for a write. A record whose time-to-live elapsed
+// is expired on the spot and reported missing, so that writes never bring it back.
+func (db *KVStoreManager) rawLive(ctx context.Context, tableKey *TableKey) ([]byte, error) {
+
+	raw, err := db.RawGet(tableKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header, _, err := decodeRecord(raw)
+	now := time.Now().UnixNano()
+	if err != nil || !header.expired(now) {
+		return raw, nil
+	}
+
+	if _, err = db.expire(ctx, tableKey, header.expires, now); err != nil {
+		return nil, err
+	}
+
+	return nil, errExpired
+}
+
+// isLive reports whether a record of the given header is still live at now. Meeting an
+// expired record starts the sweeper, so that the ones left by a previous run of the
+// store get removed.
+func (db *KVStoreManager) isLive(header recordHeader, now int64) bool {
+	if header.expired(now) {
+		db.root().sweeper.start(db.root())
+		return false
+	}
+	return true
+}
+
+// exists reports whether the record of tableKey is stored and live.
+func (db *KVStoreManager) exists(tableKey *TableKey) bool {
+
+	raw, err := db.RawGet(tableKey)
+	if err != nil {
+		return false
+	}
+	header, _, err := decodeRecord(raw)
+
+	return err == nil && db.isLive(header, time.Now().UnixNano())
+}
+
+// writeRecord stores raw, the encoded record of tableKey, through the KVExpiringDriver
+// when the header has an expiry time and the driver is one.
+func (db *KVStoreManager) writeRecord(tableKey *TableKey, header recordHeader, raw []byte) error {
+
+	if expiring, ok := db.KVDriver.(KVExpiringDriver); ok && header.expires != 0 {
+		ttl := time.Until(time.Unix(0, header.expires)) + ExpiryGracePeriod
+		return failedToSet(expiring.RawSetWithTTL(tableKey, raw, max(ttl, time.Second)))
+	}
+
+	return failedToSet(db.RawSet(tableKey, raw))
+}
+
+// scheduleExpiry writes the expiry entry of the record of tableKey, expiring at the given
+// time, and starts the sweeper. Nothing is done for a record which never expires.
+func (db *KVStoreManager) scheduleExpiry(tableKey *TableKey, at int64) error {
+
+	if at == 0 {
+		return nil
+	}
+	if err := db.RawSet(NewExpiryKey(at, tableKey), nil); err != nil {
+		return failedToSet(err)
+	}
+	db.root().sweeper.start(db.root())
+
+	return nil
+}
+
+// dropExpiry removes the expiry entry of the record of tableKey, expiring at the given
+// time, if any.
+func (db *KVStoreManager) dropExpiry(tableKey *TableKey, at int64) error {
+
+	if at == 0 {
+		return nil
+	}
+	if err := db.RawDelete(NewExpiryKey(at, tableKey)); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// countExpired counts the records matching the key prefix which expired but are still
+// stored, waiting for the sweeper. The expiry entries sort by time, so that a driver
+// implementing KVOrderedDriver is only scanned up to now.
+func (db *KVStoreManager) countExpired(key *TableKey) int {
+
+	now := time.Now().UnixNano()
+	_, ordered := db.KVDriver.(KVOrderedDriver)
+	var due []*TableKey
+	db.RawIterKey(NewProtoExpiryKey(), func(k IKey) (stop bool) {
+		expiryKey := k.(*ExpiryKey)
+		if expiryKey.at > now {
+			return ordered // The next entries expire later.
+		}
+		if expiryKey.record != nil &&
+			strings.HasPrefix(expiryKey.record.Key(), key.Prefix()) {
+			due = append(due, expiryKey.record)
+		}
+		return false
+	})
+
+	ct := 0
+	for _, tableKey := range due {
+		raw, err := db.RawGet(tableKey)
+		if err != nil {
+			continue
+		}
+		if header, _, err := decodeRecord(raw); err == nil && header.expired(now) {
+			ct++
+		}
+	}
+
+	return ct
+}
+
+// expiryTime returns the expiry time, in Unix nanoseconds, of a record written now with
+// the given time-to-live; 0 when it never expires.
+func expiryTime(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Now().Add(ttl).UnixNano()
+}
+
+// expirySweeper runs SweepExpired in the background every ExpirySweepInterval, from the
+// first time a record with a time-to-live is written or met until the manager is closed.
+type expirySweeper struct {
+	m      sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+// start starts the sweeper of db, unless it already runs or was closed.
+func (s *expirySweeper) start(db *KVStoreManager) {
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.stop != nil || s.closed {
+		return
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go func(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				_, _ = db.SweepExpired()
+			}
+		}
+	}(ExpirySweepInterval, s.stop, s.done)
+}
+
+// close stops the sweeper, waiting for the running sweep to end.
+func (s *expirySweeper) close() {
+
+	s.m.Lock()
+	s.closed = true
+	stop, done := s.stop, s.done
+	s.stop = nil
+	s.m.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
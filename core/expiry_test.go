@@ -0,0 +1,173 @@
+package core_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	. "github.com/Phosmachina/FluentKV/core"
+)
+
+func TestInsertWithTTL_Expires(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	expiring, _ := InsertWithTTL(db, NewSimpleType("t1", "t2", 1), 10*time.Millisecond)
+	_, _ = Insert(db, NewSimpleType("t1", "t2", 2))
+	id := expiring.Key().Id()
+
+	// Act
+	time.Sleep(20 * time.Millisecond)
+	_, err := Get[SimpleType](db, id)
+	var values []int
+	Foreach(db, func(key IKey, value *SimpleType) { values = append(values, value.Val) })
+
+	// Assert
+	if expiring.Meta().ExpiresAt.IsZero() {
+		t.Errorf("Meta failed: expected an expiry time, got %+v", expiring.Meta())
+	}
+	if !errors.Is(err, ErrInvalidId) {
+		t.Errorf("Get failed: expected %v, got %v", ErrInvalidId, err)
+	}
+	if Exist[SimpleType](db, id) {
+		t.Errorf("Exist failed: expected %v, got %v", false, true)
+	}
+	if ct := Count[SimpleType](db); ct != 1 {
+		t.Errorf("Count failed: expected %d, got %d", 1, ct)
+	}
+	if !slices.Equal(values, []int{2}) {
+		t.Errorf("Foreach failed: expected %v, got %v", []int{2}, values)
+	}
+	if ct := len(NewCollection[SimpleType](db).GetArray()); ct != 1 {
+		t.Errorf("NewCollection failed: expected %d objects, got %d", 1, ct)
+	}
+	if _, err = Set(db, id, NewSimpleType("t1", "t2", 3)); !errors.Is(err, ErrInvalidId) {
+		t.Errorf("Set failed: expected %v, got %v", ErrInvalidId, err)
+	}
+}
+
+func TestSweepExpired(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	var expired []int
+	_ = AddAfterTrigger[SimpleType](db, "trigger", ExpireOperation,
+		func(operation Operation, key IKey, value *SimpleType) {
+			expired = append(expired, value.Val)
+		})
+	session, _ := InsertWithTTL(db, NewSimpleType("t1", "t2", 1), 10*time.Millisecond)
+	_, _ = InsertWithTTL(db, NewSimpleType("t1", "t2", 2), time.Hour)
+	owner, _ := Insert(db, NewAnotherType("t3", 0))
+	_ = Link(owner, true, session)
+	time.Sleep(20 * time.Millisecond)
+
+	// Act
+	swept, err := db.SweepExpired()
+	reinserted, _ := Insert(db, NewSimpleType("t1", "t2", 3))
+
+	// Assert
+	if err != nil || swept != 1 {
+		t.Errorf("SweepExpired failed: expected %d, got %d (%v)", 1, swept, err)
+	}
+	if !slices.Equal(expired, []int{1}) {
+		t.Errorf("Trigger failed: expected %v, got %v", []int{1}, expired)
+	}
+	if links := CollectAllLinkedKey[AnotherType](db, owner.Key().Id()); len(links) != 0 {
+		t.Errorf("SweepExpired failed: expected no link, got %v", links)
+	}
+	if reinserted.Key().Id() != session.Key().Id() {
+		t.Errorf("SweepExpired failed: expected the ID %v released, got %v",
+			session.Key().Id(), reinserted.Key().Id())
+	}
+	if ct := Count[SimpleType](db); ct != 2 {
+		t.Errorf("Count failed: expected %d, got %d", 2, ct)
+	}
+}
+
+func TestSetTTL(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	kept, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	cleared, _ := InsertWithTTL(db, NewSimpleType("t1", "t2", 2), 10*time.Millisecond)
+
+	// Act
+	errKept := SetTTL[SimpleType](db, kept.Key().Id(), 10*time.Millisecond)
+	updated, _ := Update(db, kept.Key().Id(), func(value *SimpleType) { value.Val = 10 })
+	errCleared := SetTTL[SimpleType](db, cleared.Key().Id(), 0)
+	time.Sleep(20 * time.Millisecond)
+
+	// Assert
+	if errKept != nil || errCleared != nil {
+		t.Fatalf("SetTTL failed: expected %v, got %v and %v", nil, errKept, errCleared)
+	}
+	if updated.Meta().ExpiresAt.IsZero() || updated.Version() != 3 {
+		t.Errorf("Update failed: expected the expiry time kept at version %v, got %+v",
+			3, updated.Meta())
+	}
+	if Exist[SimpleType](db, kept.Key().Id()) {
+		t.Errorf("SetTTL failed: expected the record %v expired", kept.Key().Id())
+	}
+	if read, err := Get[SimpleType](db, cleared.Key().Id()); err != nil || read.Value().Val != 2 {
+		t.Errorf("SetTTL failed: expected Val=%v, got %v (%v)", 2, read.Value(), err)
+	}
+	if swept, _ := db.SweepExpired(); swept != 1 {
+		t.Errorf("SweepExpired failed: expected %d, got %d", 1, swept)
+	}
+}
+
+func TestUpsert_OverExpired(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	var operations []Operation
+	_ = AddAfterTrigger[SimpleType](
+		db,
+		"trigger",
+		InsertOperation|UpdateOperation|ExpireOperation,
+		func(operation Operation, key IKey, value *SimpleType) {
+			operations = append(operations, operation)
+		},
+	)
+	expiring, _ := InsertWithTTL(db, NewSimpleType("t1", "t2", 1), 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	// Act
+	upserted, err := Upsert(db, expiring.Key().Id(), NewSimpleType("t1", "t2", 2))
+
+	// Assert
+	if err != nil || upserted.Version() != 1 || !upserted.Meta().ExpiresAt.IsZero() {
+		t.Errorf("Upsert failed: expected a new record, got %+v (%v)", upserted.Meta(), err)
+	}
+	expected := []Operation{InsertOperation, ExpireOperation, InsertOperation}
+	if !slices.Equal(operations, expected) {
+		t.Errorf("Upsert failed: expected operations %v, got %v", expected, operations)
+	}
+	if swept, _ := db.SweepExpired(); swept != 0 {
+		t.Errorf("SweepExpired failed: expected %d, got %d", 0, swept)
+	}
+}
+
+func TestExpirySweeper(t *testing.T) {
+
+	// Arrange
+	interval := ExpirySweepInterval
+	ExpirySweepInterval = 5 * time.Millisecond
+	defer func() { ExpirySweepInterval = interval }()
+
+	db := prepareMemoryDb()
+	defer db.Close()
+	expiring, _ := InsertWithTTL(db, NewSimpleType("t1", "t2", 1), 5*time.Millisecond)
+
+	// Act
+	deadline := time.Now().Add(time.Second)
+	for db.Exist(expiring.Key()) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Assert
+	if db.Exist(expiring.Key()) {
+		t.Errorf("Sweeper failed: expected the record %v removed", expiring.Key().Id())
+	}
+}
@@ -1,6 +1,12 @@
 package core
 
-import "github.com/Phosmachina/FluentKV/helper"
+import (
+	"context"
+	"errors"
+	"github.com/Phosmachina/FluentKV/helper"
+	"iter"
+	"time"
+)
 
 //region Base
 
@@ -15,16 +21,191 @@ func TableName[T any]() string {
 //
 // Possible Error:
 //   - ErrFailedToSet: If the underlying driver fails to store the data.
+//   - ErrUniqueViolation: If a unique field holds a value already used in the table.
 func Insert[T any](db *KVStoreManager, value *T) (KVWrapper[T], error) {
+	return InsertCtx(context.Background(), db, value)
+}
+
+// InsertCtx is Insert with a context, handed to the triggers.
+func InsertCtx[T any](ctx context.Context, db *KVStoreManager, value *T) (KVWrapper[T], error) {
+	return insert(ctx, db, value, 0)
+}
+
+// insert is InsertCtx for a record expiring at the given time, 0 for never.
+func insert[T any](ctx context.Context, db *KVStoreManager, value *T, expires int64) (KVWrapper[T], error) {
+
+	valueAsAny := any(*value)
+	record, err := db.insert(ctx, &valueAsAny, expires)
+
+	if err != nil {
+		return KVWrapper[T]{}, err
+	}
+
+	return newRecordWrapper(db, record.key, value, record.header), nil
+}
+
+// InsertMany stores many new values at once, through the write batches of the driver,
+// and returns their wrappers in order. Triggers run per record as with Insert.
+// Unlike Insert, the whole insertion is not atomic: on error, the wrappers of the records
+// stored before the failure are returned with it.
+//
+// Possible Errors:
+//   - ErrCancelledByTrigger: If a before trigger rejected a record.
+//   - ErrUniqueViolation: If a unique field holds a value already used in the table.
+//   - ErrFailedToSet: If the underlying driver fails to store the data.
+func InsertMany[T any](db *KVStoreManager, values ...*T) ([]KVWrapper[T], error) {
+	return InsertManyCtx(context.Background(), db, values...)
+}
+
+// InsertManyCtx is InsertMany with a context, handed to the triggers.
+func InsertManyCtx[T any](ctx context.Context, db *KVStoreManager, values ...*T) ([]KVWrapper[T], error) {
+
+	valuesAsAny := make([]*any, len(values))
+	for i, value := range values {
+		valueAsAny := any(*value)
+		valuesAsAny[i] = &valueAsAny
+	}
+
+	records, err := db.insertMany(ctx, valuesAsAny)
+
+	objs := make([]KVWrapper[T], len(records))
+	for i, record := range records {
+		objs[i] = newRecordWrapper(db, record.key, values[i], record.header)
+	}
+
+	return objs, err
+}
+
+// Loader streams new objects of type T into the database, see BulkLoader.
+type Loader[T any] struct {
+	db     *KVStoreManager
+	loader *BulkLoader
+}
+
+// NewLoader starts a Loader for the objects of type T. It must be closed to store the
+// last objects added.
+func NewLoader[T any](db *KVStoreManager, options BulkOptions) *Loader[T] {
+	return NewLoaderCtx[T](context.Background(), db, options)
+}
+
+// NewLoaderCtx is NewLoader with a context, handed to the triggers.
+func NewLoaderCtx[T any](ctx context.Context, db *KVStoreManager, options BulkOptions) *Loader[T] {
+	return &Loader[T]{db: db, loader: db.NewBulkLoaderCtx(ctx, options)}
+}
+
+// Add queues the insertion of value; it is stored once its batch is flushed.
+// See BulkLoader.Add for the possible errors.
+func (l *Loader[T]) Add(value *T) (KVWrapper[T], error) {
+
+	valueAsAny := any(*value)
+	record, err := l.loader.add(&valueAsAny)
+	if err != nil {
+		return KVWrapper[T]{}, err
+	}
+
+	return newRecordWrapper(l.db, record.key, value, record.header), nil
+}
+
+// Flush stores the objects added since the last flush.
+func (l *Loader[T]) Flush() error {
+	return l.loader.Flush()
+}
+
+// Close stores the last objects added and releases the loader.
+func (l *Loader[T]) Close() error {
+	return l.loader.Close()
+}
+
+// InsertWithId stores a new value under an ID chosen by the caller, e.g. a natural key,
+// instead of an allocated one. The ID generator of the table never hands it out after.
+//
+// Possible Errors:
+//   - ErrIdTaken: If the ID is already used in the table, or held by an object in the trash.
+//   - ErrMalformedId: If the ID is empty or holds LinkDelimiter.
+//   - ErrFailedToSet: If the underlying driver fails to store the data.
+//   - ErrUniqueViolation: If a unique field holds a value already used in the table.
+func InsertWithId[T any](db *KVStoreManager, id string, value *T) (KVWrapper[T], error) {
+	return InsertWithIdCtx(context.Background(), db, id, value)
+}
+
+// InsertWithIdCtx is InsertWithId with a context, handed to the triggers.
+func InsertWithIdCtx[T any](ctx context.Context, db *KVStoreManager, id string, value *T) (KVWrapper[T], error) {
+
+	tableKey := NewTableKey[T]().SetId(id)
+	valueAsAny := any(*value)
+
+	header, err := db.insertWithId(ctx, tableKey, &valueAsAny)
+	if err != nil {
+		return KVWrapper[T]{}, err
+	}
 
+	return newRecordWrapper(db, tableKey, value, header), nil
+}
+
+// Upsert stores a value under an ID chosen by the caller: it is inserted if the ID is
+// unused, as with InsertWithId, or replaces the existing value, as with Set. Triggers run
+// with InsertOperation or UpdateOperation accordingly.
+//
+// Possible Errors:
+//   - ErrIdTaken: If the ID is held by an object in the trash.
+//   - ErrMalformedId: If the ID is empty or holds LinkDelimiter.
+//   - ErrFailedToSet: If the underlying driver fails to store the data.
+//   - ErrUniqueViolation: If a unique field holds a value already used in the table.
+func Upsert[T any](db *KVStoreManager, id string, value *T) (KVWrapper[T], error) {
+	return UpsertCtx(context.Background(), db, id, value)
+}
+
+// UpsertCtx is Upsert with a context, handed to the triggers.
+func UpsertCtx[T any](ctx context.Context, db *KVStoreManager, id string, value *T) (KVWrapper[T], error) {
+
+	tableKey := NewTableKey[T]().SetId(id)
 	valueAsAny := any(*value)
-	tableKey, err := db.Insert(&valueAsAny)
 
+	header, err := db.upsert(ctx, tableKey, &valueAsAny)
 	if err != nil {
 		return KVWrapper[T]{}, err
 	}
 
-	return NewKVWrapper(db, tableKey, value), nil
+	return newRecordWrapper(db, tableKey, value, header), nil
+}
+
+// InsertWithTTL is Insert for a value which expires once ttl elapsed, e.g. a session:
+// from then on, it is no longer read, counted or collected, and the sweeper removes it
+// like Delete would, releasing its ID, removing its links and running the triggers with
+// ExpireOperation. A ttl not above zero gives a value which never expires.
+// Set and Update keep the expiry time, see SetTTL to change it.
+//
+// Possible Error:
+//   - ErrFailedToSet: If the underlying driver fails to store the data.
+//   - ErrUniqueViolation: If a unique field holds a value already used in the table.
+func InsertWithTTL[T any](db *KVStoreManager, value *T, ttl time.Duration) (KVWrapper[T], error) {
+	return InsertWithTTLCtx(context.Background(), db, value, ttl)
+}
+
+// InsertWithTTLCtx is InsertWithTTL with a context, handed to the triggers.
+func InsertWithTTLCtx[T any](
+	ctx context.Context,
+	db *KVStoreManager,
+	value *T,
+	ttl time.Duration,
+) (KVWrapper[T], error) {
+	return insert(ctx, db, value, expiryTime(ttl))
+}
+
+// SetTTL makes the value with the given ID expire once ttl elapsed from now, as with
+// InsertWithTTL, replacing its previous time-to-live; a ttl not above zero makes it
+// never expire. The value itself is kept, but its version is incremented.
+//
+// Possible Error:
+//   - ErrInvalidId: If the specified ID is not recognized in the database.
+//   - ErrFailedToSet: If the underlying driver fails to update the data.
+func SetTTL[T any](db *KVStoreManager, id string, ttl time.Duration) error {
+	return SetTTLCtx[T](context.Background(), db, id, ttl)
+}
+
+// SetTTLCtx is SetTTL with a context: nothing is committed once ctx is done.
+func SetTTLCtx[T any](ctx context.Context, db *KVStoreManager, id string, ttl time.Duration) error {
+	return db.SetTTLCtx(ctx, NewTableKey[T]().SetId(id), ttl)
 }
 
 // Set updates a value that must already exist, identified by a specific string ID.
@@ -33,75 +214,184 @@ func Insert[T any](db *KVStoreManager, value *T) (KVWrapper[T], error) {
 // Possible Error:
 //   - ErrInvalidId: If the specified ID is not recognized in the database.
 //   - ErrFailedToSet: If the underlying driver fails to update the data.
+//   - ErrUniqueViolation: If a unique field holds a value already used in the table.
 func Set[T any](db *KVStoreManager, id string, value *T) (KVWrapper[T], error) {
+	return SetCtx(context.Background(), db, id, value)
+}
+
+// SetCtx is Set with a context, handed to the triggers.
+func SetCtx[T any](ctx context.Context, db *KVStoreManager, id string, value *T) (KVWrapper[T], error) {
+	return set(ctx, db, id, value, nil)
+}
+
+// CompareAndSwap updates a value like Set, provided its record is still at the given
+// version, e.g. the one of the wrapper it was read with (see KVWrapper.Version).
+// Returns a new wrapper of the updated value, at the next version.
+//
+// Possible Error:
+//   - ErrVersionConflict: If the record was written since.
+//   - ErrInvalidId: If the specified ID is not recognized in the database.
+//   - ErrFailedToSet: If the underlying driver fails to update the data.
+//   - ErrUniqueViolation: If a unique field holds a value already used in the table.
+func CompareAndSwap[T any](db *KVStoreManager, id string, version uint64, value *T) (KVWrapper[T], error) {
+	return CompareAndSwapCtx(context.Background(), db, id, version, value)
+}
+
+// CompareAndSwapCtx is CompareAndSwap with a context, handed to the triggers.
+func CompareAndSwapCtx[T any](
+	ctx context.Context,
+	db *KVStoreManager,
+	id string,
+	version uint64,
+	value *T,
+) (KVWrapper[T], error) {
+	return set(ctx, db, id, value, &version)
+}
+
+// set is SetCtx, or CompareAndSwapCtx when version is not nil.
+func set[T any](
+	ctx context.Context,
+	db *KVStoreManager,
+	id string,
+	value *T,
+	version *uint64,
+) (KVWrapper[T], error) {
 
 	tableKey := NewTableKey[T]().SetId(id)
 	valueAsAny := any(value)
 
-	if err := db.Set(tableKey, &valueAsAny); err != nil {
+	header, err := db.set(ctx, tableKey, &valueAsAny, version)
+	if err != nil {
 		return KVWrapper[T]{}, err
 	}
 
-	return NewKVWrapper(db, tableKey, value), nil
+	return newRecordWrapper(db, tableKey, value, header), nil
 }
 
 // SetWrp is similar to Set, but takes a KVWrapper instead of separate parameters.
-// It updates the wrapped object's value in the database.
+// It updates the wrapped object's value in the database, provided the record was not
+// written since the wrapper was made, as with CompareAndSwap. Wrappers of an unknown
+// version (0) are written unconditionally.
+//
+// Possible Error:
+//   - ErrVersionConflict: If the record was written since the wrapper was made.
 func SetWrp[T any](objWrp KVWrapper[T]) (KVWrapper[T], error) {
-	return Set(objWrp.db, objWrp.key.id, objWrp.value)
+	if objWrp.header.version == 0 {
+		return Set(objWrp.db, objWrp.key.id, objWrp.value)
+	}
+	return CompareAndSwap(objWrp.db, objWrp.key.id, objWrp.header.version, objWrp.value)
 }
 
 // Get retrieves a value from the database by its string ID. A successful call
 // returns a wrapper containing the retrieved data.
 //
 // Possible Error:
-//   - ErrInvalidId: If the specified ID is not found in the database.
+//   - ErrInvalidId: If the specified ID is not found in the database; it also wraps
+//     ErrNotFound.
+//   - Any error of the underlying driver, such as ErrClosed.
 func Get[T any](db *KVStoreManager, id string) (KVWrapper[T], error) {
+	return GetCtx[T](context.Background(), db, id)
+}
+
+// GetCtx is Get with a context, handed to the triggers.
+func GetCtx[T any](ctx context.Context, db *KVStoreManager, id string) (KVWrapper[T], error) {
 
 	tableKey := NewTableKey[T]().SetId(id)
-	value, err := db.Get(tableKey)
+	record, err := db.get(ctx, tableKey)
 
 	if err != nil {
 		return KVWrapper[T]{}, err
 	}
 
-	valueAsT := (*value).(T)
-
-	return NewKVWrapper(db, tableKey, &valueAsT), nil
+	return wrapRecord[T](db, record), nil
 }
 
 // Update fetches an existing record by ID, applies a user-defined function
 // to modify the record, and writes the changes back to the database.
 // Returns a wrapper around the updated value.
+// The editor runs once: if the record is written by someone else in the meantime,
+// nothing is saved, see UpdateWithRetry.
 //
 // Possible Error:
+//   - ErrVersionConflict: If the record was written while being updated.
 //   - ErrInvalidId: If the specified ID is not recognized in the database.
 //   - ErrFailedToSet: If the underlying driver fails to update the modified data.
+//   - ErrUniqueViolation: If a unique field holds a value already used in the table.
 func Update[T any](
 	db *KVStoreManager,
 	id string,
 	editor func(value *T),
 ) (KVWrapper[T], error) {
+	return UpdateCtx(context.Background(), db, id, editor)
+}
+
+// UpdateCtx is Update with a context, handed to the triggers.
+func UpdateCtx[T any](
+	ctx context.Context,
+	db *KVStoreManager,
+	id string,
+	editor func(value *T),
+) (KVWrapper[T], error) {
+	return update(ctx, db, id, editor, 0)
+}
+
+// UpdateWithRetry is Update, running the editor again on the new value of the record
+// when it was written by someone else in the meantime, up to MaxTxRetries times. The
+// editor must thus have no side effects.
+//
+// Possible Error:
+//   - ErrVersionConflict: If the record is still written concurrently after the retries.
+//   - ErrInvalidId: If the specified ID is not recognized in the database.
+//   - ErrFailedToSet: If the underlying driver fails to update the modified data.
+//   - ErrUniqueViolation: If a unique field holds a value already used in the table.
+func UpdateWithRetry[T any](
+	db *KVStoreManager,
+	id string,
+	editor func(value *T),
+) (KVWrapper[T], error) {
+	return UpdateWithRetryCtx(context.Background(), db, id, editor)
+}
+
+// UpdateWithRetryCtx is UpdateWithRetry with a context, handed to the triggers.
+func UpdateWithRetryCtx[T any](
+	ctx context.Context,
+	db *KVStoreManager,
+	id string,
+	editor func(value *T),
+) (KVWrapper[T], error) {
+	return update(ctx, db, id, editor, MaxTxRetries)
+}
+
+// update is UpdateCtx, retrying up to retries times on ErrVersionConflict.
+func update[T any](
+	ctx context.Context,
+	db *KVStoreManager,
+	id string,
+	editor func(value *T),
+	retries int,
+) (KVWrapper[T], error) {
 
 	var valueAsT T
 	tableKey := NewTableKey[T]().SetId(id)
 
-	_, err := db.Update(tableKey, func(value *any) *any {
+	record, err := db.update(ctx, tableKey, func(value *any) *any {
 		valueAsT = (*value).(T)
 		editor(&valueAsT)
 		valueAsAny := any(valueAsT)
 		return &valueAsAny
-	})
+	}, retries)
 
 	if err != nil {
 		return KVWrapper[T]{}, err
 	}
 
-	return NewKVWrapper(db, tableKey, &valueAsT), nil
+	return newRecordWrapper(db, tableKey, &valueAsT, record.header), nil
 }
 
 // Delete removes an object by its ID from the database.
 // Once deleted, the ID is freed for future re-use and any related links are also removed.
+// If SetSoftDelete is enabled for T, the object is moved to the trash instead, as with
+// SoftDelete.
 //
 // Possible Error:
 //   - ErrInvalidId: If the specified ID is not found or cannot be removed.
@@ -109,6 +399,11 @@ func Delete[T any](db *KVStoreManager, id string) error {
 	return db.Delete(NewTableKey[T]().SetId(id))
 }
 
+// DeleteCtx is Delete with a context, handed to the triggers.
+func DeleteCtx[T any](ctx context.Context, db *KVStoreManager, id string) error {
+	return db.DeleteCtx(ctx, NewTableKey[T]().SetId(id))
+}
+
 // DeleteWrp removes the object referenced by the wrapper from the database. Once deleted,
 // its ID is freed and any related links are cleared.
 func DeleteWrp[T any](objWrp KVWrapper[T]) error {
@@ -116,7 +411,8 @@ func DeleteWrp[T any](objWrp KVWrapper[T]) error {
 }
 
 // DeepDelete removes an object and all recursively linked objects in a single operation.
-// Use this if you need to purge an object along with all its connections.
+// Use this if you need to purge an object along with all its connections. The objects of
+// the types for which SetSoftDelete is enabled are moved to the trash.
 //
 // Possible Error:
 //   - ErrInvalidId: If the specified ID is not recognized.
@@ -124,15 +420,20 @@ func DeepDelete[T any](db *KVStoreManager, id string) error {
 	return db.DeepDelete(NewTableKey[T]().SetId(id))
 }
 
+// DeepDeleteCtx is DeepDelete with a context, handed to the triggers.
+func DeepDeleteCtx[T any](ctx context.Context, db *KVStoreManager, id string) error {
+	return db.DeepDeleteCtx(ctx, NewTableKey[T]().SetId(id))
+}
+
 // DeepDeleteWrp removes the object in the wrapper and all recursively linked objects.
 func DeepDeleteWrp[T any](objWrp KVWrapper[T]) error {
 	return DeepDelete[T](objWrp.db, objWrp.key.id)
 }
 
 // Exist checks if an object with the given ID is present in the database.
-// Returns true if found, false otherwise.
+// Returns true if found, false otherwise, including when the object expired.
 func Exist[T any](db *KVStoreManager, id string) bool {
-	return db.Exist(NewTableKey[T]().SetId(id))
+	return db.exists(NewTableKey[T]().SetId(id))
 }
 
 // ExistWrp is the wrapper-based version of Exist, checking if the wrapped object
@@ -146,10 +447,21 @@ func Count[T any](db *KVStoreManager) int {
 	return db.Count(NewTableKey[T]())
 }
 
+// CountCtx is Count with a context; it returns ctx.Err() once ctx is done.
+func CountCtx[T any](ctx context.Context, db *KVStoreManager) (int, error) {
+	return db.CountCtx(ctx, NewTableKey[T]())
+}
+
 // Foreach iterates over all objects of type T in the database, calling the provided
 // function for each item. The do callback supplies both the key and the typed value.
 func Foreach[T any](db *KVStoreManager, do func(key IKey, value *T)) {
-	db.Foreach(NewTableKey[T](), func(key *TableKey, value *any) {
+	_ = ForeachCtx(context.Background(), db, do)
+}
+
+// ForeachCtx is Foreach with a context: once ctx is done, do is no longer called and
+// ctx.Err() is returned.
+func ForeachCtx[T any](ctx context.Context, db *KVStoreManager, do func(key IKey, value *T)) error {
+	return db.ForeachCtx(ctx, NewTableKey[T](), func(key *TableKey, value *any) {
 		t := (*value).(T)
 		do(key, &t)
 	})
@@ -162,8 +474,20 @@ func FindFirst[T any](
 	db *KVStoreManager,
 	predicate func(key *TableKey, value *T) bool,
 ) KVWrapper[T] {
+	result, _ := FindFirstCtx(context.Background(), db, predicate)
+	return result
+}
+
+// FindFirstCtx is FindFirst with a context: the scan stops once ctx is done, returning
+// ctx.Err().
+func FindFirstCtx[T any](
+	ctx context.Context,
+	db *KVStoreManager,
+	predicate func(key *TableKey, value *T) bool,
+) (KVWrapper[T], error) {
 
-	tableKey, resultValue := db.FindFirst(
+	record, err := db.findFirst(
+		ctx,
 		NewTableKey[T](),
 		func(key *TableKey, value *any) bool {
 			t := (*value).(T)
@@ -171,13 +495,11 @@ func FindFirst[T any](
 		},
 	)
 
-	if resultValue == nil {
-		return KVWrapper[T]{}
+	if err != nil || record.value == nil {
+		return KVWrapper[T]{}, err
 	}
 
-	resultValueAsT := (*resultValue).(T)
-
-	return NewKVWrapper(db, tableKey, &resultValueAsT)
+	return wrapRecord[T](db, record), nil
 }
 
 // FindAll collects all objects of type T matching the predicate. Each result
@@ -186,25 +508,82 @@ func FindAll[T any](
 	db *KVStoreManager,
 	predicate func(key *TableKey, value *T) bool,
 ) []KVWrapper[T] {
+	objs, _ := FindAllCtx(context.Background(), db, predicate)
+	return objs
+}
+
+// FindAllCtx is FindAll with a context: once ctx is done, the scan stops and ctx.Err()
+// is returned.
+func FindAllCtx[T any](
+	ctx context.Context,
+	db *KVStoreManager,
+	predicate func(key *TableKey, value *T) bool,
+) ([]KVWrapper[T], error) {
 
 	var objs []KVWrapper[T]
 
-	tableKeys, results := db.FindAll(
+	records, err := db.findAll(
+		ctx,
 		NewTableKey[T](),
 		func(key *TableKey, value *any) bool {
 			t := (*value).(T)
 			return predicate(key, &t)
 		},
 	)
+	if err != nil {
+		return nil, err
+	}
 
-	for i, tableKey := range tableKeys {
-		t := (*results[i]).(T)
-		objs = append(objs, NewKVWrapper(db, tableKey, &t))
+	for _, record := range records {
+		objs = append(objs, wrapRecord[T](db, record))
 	}
 
+	return objs, nil
+}
+
+// ModifiedSince collects all objects of type T written (inserted or updated) at or after
+// since, as told by their metadata (see KVWrapper.Meta). The other records are not
+// decoded. The records stored before FluentKV recorded their update time are left out.
+func ModifiedSince[T any](db *KVStoreManager, since time.Time) []KVWrapper[T] {
+	objs, _ := ModifiedSinceCtx[T](context.Background(), db, since)
 	return objs
 }
 
+// ModifiedSinceCtx is ModifiedSince with a context: once ctx is done, the scan stops and
+// ctx.Err() is returned.
+func ModifiedSinceCtx[T any](ctx context.Context, db *KVStoreManager, since time.Time) ([]KVWrapper[T], error) {
+
+	records, err := db.modifiedSince(ctx, NewTableKey[T](), since)
+	if err != nil {
+		return nil, err
+	}
+
+	var objs []KVWrapper[T]
+	for _, record := range records {
+		objs = append(objs, wrapRecord[T](db, record))
+	}
+
+	return objs, nil
+}
+
+// WithTx runs fn in a single transaction: every Insert, Set, Update, Delete or Link made
+// through tx is committed together when fn returns nil, and rolled back otherwise.
+// A commit failing because of a concurrent transaction (ErrConflict) is retried
+// automatically, re-running fn up to MaxTxRetries times.
+//
+// Possible Errors:
+//   - Any error returned by fn, after the transaction is rolled back.
+//   - ErrConflict: If the transaction still conflicts after MaxTxRetries attempts.
+func WithTx(db *KVStoreManager, fn func(tx *KVStoreManager) error) error {
+	return db.WithTx(fn)
+}
+
+// WithTxCtx is WithTx with a context: once ctx is done, the transaction is rolled back
+// and ctx.Err() is returned.
+func WithTxCtx(ctx context.Context, db *KVStoreManager, fn func(tx *KVStoreManager) error) error {
+	return db.WithTxCtx(ctx, fn)
+}
+
 //endregion
 
 //region Links
@@ -221,68 +600,110 @@ func Link[Current any, Target any](
 	biDirectional bool,
 	targets ...KVWrapper[Target],
 ) error {
+	return LinkCtx(context.Background(), current, biDirectional, targets...)
+}
 
-	if !ExistWrp(current) {
-		return ErrInvalidId
-	}
+// LinkCtx is Link with a context: nothing is committed once ctx is done.
+func LinkCtx[Current any, Target any](
+	ctx context.Context,
+	current KVWrapper[Current],
+	biDirectional bool,
+	targets ...KVWrapper[Target],
+) error {
 
-	for _, target := range targets {
+	return current.db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
 
-		exist := current.db.Exist(target.key)
-		if !exist {
+		if !tx.exists(current.key) {
 			return ErrInvalidId
 		}
 
-		if target.key.Id() == current.key.Id() {
-			return ErrSelfBind
-		}
+		for _, target := range targets {
 
-		if biDirectional {
-			if !current.db.RawSet(NewLinkKey(target.key, current.key), nil) {
-				return ErrFailedToSet
+			exist := tx.exists(target.key)
+			if !exist {
+				return ErrInvalidId
+			}
+
+			if target.key.Id() == current.key.Id() {
+				return ErrSelfBind
 			}
-		}
 
-		if !current.db.RawSet(NewLinkKey(current.key, target.key), nil) {
-			return ErrFailedToSet
+			if biDirectional {
+				if err := setLink(tx, NewLinkKey(target.key, current.key)); err != nil {
+					return failedToSet(err)
+				}
+			}
+
+			if err := setLink(tx, NewLinkKey(current.key, target.key)); err != nil {
+				return failedToSet(err)
+			}
 		}
-	}
 
-	return nil
+		return nil
+	})
 }
 
 // LinkNew works like Link, but first inserts each provided target object into the database,
 // then creates the links.
 // Returns a collection of wrappers for the newly inserted and linked target objects.
 //
-// Errors encountered during Insert or linking are silently skipped for individual targets.
-// For instance, if inserting a target fails, that target is not linked.
+// The inserts and the links are written in one transaction: if any of them fails, nothing
+// is written and no wrapper is returned. LinkNewCtx tells the error.
 func LinkNew[Current any, Target any](
 	current KVWrapper[Current],
 	biDirectional bool,
 	targets ...*Target,
 ) []KVWrapper[Target] {
+	targetsWrp, _ := LinkNewCtx(context.Background(), current, biDirectional, targets...)
+	return targetsWrp
+}
+
+// LinkNewCtx is LinkNew with a context, handed to the triggers of the inserts, returning
+// the error which rolled the transaction back. Nothing is committed once ctx is done, and
+// ctx.Err() is returned.
+//
+// Possible Errors:
+//   - ErrInvalidId: If the current object is not recognized in the database.
+//   - The errors of Insert and Link.
+func LinkNewCtx[Current any, Target any](
+	ctx context.Context,
+	current KVWrapper[Current],
+	biDirectional bool,
+	targets ...*Target,
+) ([]KVWrapper[Target], error) {
 
 	var targetsWrp []KVWrapper[Target]
 
-	if !ExistWrp(current) {
-		return targetsWrp
-	}
+	err := current.db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
 
-	for _, target := range targets {
-		object := any(*target)
-		tableKey, err := current.db.Insert(&object)
-		if err != nil {
-			// Skip if unable to insert
-			continue
+		targetsWrp = nil
+		if !tx.exists(current.key) {
+			return ErrInvalidId
 		}
 
-		targetWrp := NewKVWrapper(current.db, tableKey, target)
-		_ = Link[Current, Target](current, biDirectional, targetWrp)
-		targetsWrp = append(targetsWrp, targetWrp)
+		currentInTx := current
+		currentInTx.db = tx
+		for _, target := range targets {
+			object := any(*target)
+			record, err := tx.insert(ctx, &object, 0)
+			if err != nil {
+				return err
+			}
+
+			targetWrp := newRecordWrapper(tx, record.key, target, record.header)
+			if err = LinkCtx[Current, Target](ctx, currentInTx, biDirectional, targetWrp); err != nil {
+				return err
+			}
+			targetsWrp = append(targetsWrp, newRecordWrapper(current.db, record.key, target, record.header))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return targetsWrp
+	return targetsWrp, nil
 }
 
 // TODO potentially make FromLink method
@@ -299,23 +720,14 @@ func CollectLinked[Current any, Target any](
 
 	var targetsWrp []KVWrapper[Target]
 	tableKey := NewTableKey[Current]().SetId(currentId)
-	targetTableName := NewTableKey[Target]().name
-
-	db.RawIterKey(NewProtoLinkKey(), func(key IKey) (stop bool) {
-		linkKey := key.(*LinkKey)
-
-		if linkKey.currentTableKey.Equals(tableKey) &&
-			linkKey.targetTableKey.name == targetTableName {
-			object, _ := db.Get(linkKey.targetTableKey)
-			value := (*object).(Target)
-			targetsWrp = append(
-				targetsWrp,
-				NewKVWrapper[Target](db, linkKey.targetTableKey, &value),
-			)
-		}
 
-		return false
-	})
+	for _, linkKey := range outgoingLinks(db, tableKey, NewTableKey[Target]()) {
+		record, err := db.get(context.Background(), linkKey.targetTableKey)
+		if err != nil {
+			continue
+		}
+		targetsWrp = append(targetsWrp, wrapRecord[Target](db, record))
+	}
 
 	return targetsWrp
 }
@@ -328,71 +740,106 @@ func CollectLinkedWrp[Current any, Target any](
 	return CollectLinked[Current, Target](current.db, current.key.id)
 }
 
+// Linked is the iterator variant of CollectLinked: the links are scanned as the
+// iteration goes, each Target object is read when it is reached, and breaking out of the
+// loop stops the scan.
+func Linked[Current any, Target any](db *KVStoreManager, currentId string) iter.Seq2[*TableKey, *Target] {
+	return LinkedCtx[Current, Target](context.Background(), db, currentId)
+}
+
+// LinkedCtx is Linked with a context: the iteration stops once ctx is done, which the
+// caller tells with ctx.Err().
+func LinkedCtx[Current any, Target any](
+	ctx context.Context,
+	db *KVStoreManager,
+	currentId string,
+) iter.Seq2[*TableKey, *Target] {
+	return func(yield func(*TableKey, *Target) bool) {
+		current := NewTableKey[Current]().SetId(currentId)
+		for record := range db.linked(ctx, current, NewTableKey[Target]()) {
+			if valueAsT, ok := (*record.value).(Target); ok && !yield(record.key, &valueAsT) {
+				return
+			}
+		}
+	}
+}
+
+// LinkedWrp is the wrapper-based variant of Linked.
+func LinkedWrp[Current any, Target any](current KVWrapper[Current]) iter.Seq2[*TableKey, *Target] {
+	return Linked[Current, Target](current.db, current.key.id)
+}
+
 // Unlink removes any links between two objects, both the forward link (Current -> Target)
-// and the backward link (Target -> Current), if it exists. Returns true if at least one link
+// and the backward link (Target -> Current), if it exists. Returns nil if at least one link
 // was successfully removed.
-func Unlink[Current any, Target any](db KVDriver, idOfC string, idOfT string) bool {
+//
+// Possible Error(s):
+//   - ErrNotFound: If the objects were not linked.
+//   - Any error of the underlying driver.
+func Unlink[Current any, Target any](db KVDriver, idOfC string, idOfT string) error {
 	currentTableKey := NewTableKey[Current]().SetId(idOfC)
 	targetCurrentKey := NewTableKey[Target]().SetId(idOfT)
 
-	return db.RawDelete(NewLinkKey(targetCurrentKey, currentTableKey)) ||
-		db.RawDelete(NewLinkKey(currentTableKey, targetCurrentKey))
+	backward := deleteLink(db, NewLinkKey(targetCurrentKey, currentTableKey))
+	forward := deleteLink(db, NewLinkKey(currentTableKey, targetCurrentKey))
+
+	for _, err := range []error{backward, forward} {
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	if backward != nil && forward != nil {
+		return forward
+	}
+
+	return nil
 }
 
 // UnlinkWrp does the same as Unlink, but with wrapper types for convenience.
 func UnlinkWrp[Current any, Target any](
 	current KVWrapper[Current],
 	target KVWrapper[Target],
-) bool {
+) error {
 	return Unlink[Current, Target](current.db, current.key.id, target.key.id)
 }
 
 // UnlinkAllTarget removes all links between an object identified by id
 // and objects in the specified Target table.
-func UnlinkAllTarget[Current any, Target any](db KVDriver, id string) {
-
-	db.RawIterKey(NewProtoLinkKey(), func(key IKey) (stop bool) {
-		linkKey := key.(*LinkKey)
-		currentTableKey := NewTableKey[Current]().SetId(id)
-		targetTableName := NewTableKey[Target]().name
-
-		if linkKey.currentTableKey.Equals(currentTableKey) &&
-			linkKey.targetTableKey.name == targetTableName ||
-			linkKey.targetTableKey.Equals(currentTableKey) &&
-				linkKey.currentTableKey.name == targetTableName {
-			db.RawDelete(linkKey)
+func UnlinkAllTarget[Current any, Target any](db KVDriver, id string) error {
+
+	currentTableKey := NewTableKey[Current]().SetId(id)
+	targetTableKey := NewTableKey[Target]()
+
+	for _, linkKey := range outgoingLinks(db, currentTableKey, targetTableKey) {
+		if err := deleteLink(db, linkKey); err != nil {
+			return err
+		}
+	}
+	for _, linkKey := range incomingLinks(db, targetTableKey, currentTableKey) {
+		if err := deleteLink(db, linkKey); err != nil {
+			return err
 		}
+	}
 
-		return false
-	})
+	return nil
 }
 
 // UnlinkAllTargetWrp is the wrapper-based counterpart of UnlinkAllTarget.
-func UnlinkAllTargetWrp[Current any, Target any](current KVWrapper[Current]) {
-	UnlinkAllTarget[Current, Target](current.db, current.key.id)
+func UnlinkAllTargetWrp[Current any, Target any](current KVWrapper[Current]) error {
+	return UnlinkAllTarget[Current, Target](current.db, current.key.id)
 }
 
 // UnlinkAll removes every link connected to the specified object, effectively
 // disconnecting it from all related records.
-func UnlinkAll[Current any](db KVDriver, id string) {
-
-	db.RawIterKey(NewProtoLinkKey(), func(key IKey) (stop bool) {
-		linkKey := key.(*LinkKey)
-		currentTableKey := NewTableKey[Current]().SetId(id)
-
-		if linkKey.currentTableKey.Equals(currentTableKey) ||
-			linkKey.targetTableKey.Equals(currentTableKey) {
-			db.RawDelete(linkKey)
-		}
-
-		return false
-	})
+func UnlinkAll[Current any](db KVDriver, id string) error {
+	_, err := unlinkAll(db, NewTableKey[Current]().SetId(id))
+	return err
 }
 
 // UnlinkAllWrp is a wrapper-based version of UnlinkAll, removing all links
 // from the object in the provided wrapper.
-func UnlinkAllWrp[Current any](current KVWrapper[Current]) {
-	UnlinkAll[Current](current.db, current.key.id)
+func UnlinkAllWrp[Current any](current KVWrapper[Current]) error {
+	return UnlinkAll[Current](current.db, current.key.id)
 }
 
 // CollectAllLinkedKey scans all linked objects
@@ -401,19 +848,21 @@ func UnlinkAllWrp[Current any](current KVWrapper[Current]) {
 func CollectAllLinkedKey[Current any](db KVDriver, currentId string) []*TableKey {
 
 	var tableKeys []*TableKey
+	currentTableKey := NewTableKey[Current]().SetId(currentId)
+	seen := make(map[string]bool)
 
-	db.RawIterKey(NewProtoLinkKey(), func(key IKey) (stop bool) {
-		linkKey := key.(*LinkKey)
-		currentTableKey := NewTableKey[Current]().SetId(currentId)
-
-		if linkKey.targetTableKey.Equals(currentTableKey) {
-			tableKeys = append(tableKeys, linkKey.targetTableKey)
-		} else if linkKey.currentTableKey.Equals(currentTableKey) {
-			tableKeys = append(tableKeys, linkKey.currentTableKey)
+	collect := func(tableKey *TableKey) {
+		if !seen[tableKey.Key()] {
+			seen[tableKey.Key()] = true
+			tableKeys = append(tableKeys, tableKey)
 		}
-
-		return false
-	})
+	}
+	for _, linkKey := range outgoingLinks(db, currentTableKey, nil) {
+		collect(linkKey.targetTableKey)
+	}
+	for _, linkKey := range incomingLinks(db, nil, currentTableKey) {
+		collect(linkKey.currentTableKey)
+	}
 
 	return tableKeys
 }
@@ -485,6 +934,422 @@ func (c *Collection[T]) Filter(
 
 //endregion
 
+//region Iterators
+
+// All returns an iterator over the objects of type T, in the order of the driver, e.g.
+// for k, v := range All[User](db). Unlike NewCollection, it streams straight from the
+// driver: each object is decoded when it is reached, and breaking out of the loop stops
+// the underlying iteration. It composes with the iterator helpers of the standard
+// library, such as maps.Collect.
+func All[T any](db *KVStoreManager) iter.Seq2[*TableKey, *T] {
+	return AllCtx[T](context.Background(), db)
+}
+
+// AllCtx is All with a context: the iteration stops once ctx is done, which the caller
+// tells with ctx.Err().
+func AllCtx[T any](ctx context.Context, db *KVStoreManager) iter.Seq2[*TableKey, *T] {
+	return func(yield func(*TableKey, *T) bool) {
+		for record := range db.records(ctx, NewTableKey[T](), true) {
+			if valueAsT, ok := (*record.value).(T); ok && !yield(record.key, &valueAsT) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns an iterator over the keys of the objects of type T, like All without
+// decoding the objects.
+func Keys[T any](db *KVStoreManager) iter.Seq[*TableKey] {
+	return KeysCtx[T](context.Background(), db)
+}
+
+// KeysCtx is Keys with a context: the iteration stops once ctx is done, which the caller
+// tells with ctx.Err().
+func KeysCtx[T any](ctx context.Context, db *KVStoreManager) iter.Seq[*TableKey] {
+	return func(yield func(*TableKey) bool) {
+		for record := range db.records(ctx, NewTableKey[T](), false) {
+			if !yield(record.key) {
+				return
+			}
+		}
+	}
+}
+
+// Values returns an iterator over the objects of type T, like All without their keys,
+// e.g. slices.Collect(Values[User](db)).
+func Values[T any](db *KVStoreManager) iter.Seq[*T] {
+	return ValuesCtx[T](context.Background(), db)
+}
+
+// ValuesCtx is Values with a context: the iteration stops once ctx is done, which the
+// caller tells with ctx.Err().
+func ValuesCtx[T any](ctx context.Context, db *KVStoreManager) iter.Seq[*T] {
+	return func(yield func(*T) bool) {
+		for _, value := range AllCtx[T](ctx, db) {
+			if !yield(value) {
+				return
+			}
+		}
+	}
+}
+
+//endregion
+
+//region IDs
+
+// SetIdGenerator makes the objects of type T inserted from now on take their IDs from
+// generator, instead of the allocator shared by every table, which reuses the IDs of
+// deleted objects. A nil generator restores the shared allocator.
+//
+// The built-in generators are NewSequenceIdGenerator, NewUUIDv4IdGenerator,
+// NewUUIDv7IdGenerator, NewULIDIdGenerator and NewSnowflakeIdGenerator.
+func SetIdGenerator[T any](db *KVStoreManager, generator IdGenerator) {
+	var t T
+	db.setIdGenerator(t, generator)
+}
+
+//endregion
+
+//region Trash
+
+// SetSoftDelete makes Delete and DeepDelete move the objects of type T to the trash from
+// now on, as SoftDelete does, when enabled is set.
+func SetSoftDelete[T any](db *KVStoreManager, enabled bool) {
+	var t T
+	db.setSoftDelete(t, enabled)
+}
+
+// SoftDelete moves the object with the given ID to the trash, with its links, whatever
+// the mode of its table: it is no longer read, found or linked, and its ID is held back,
+// until it is given back by Restore or removed for good by Purge.
+// Triggers run with DeleteOperation.
+//
+// Possible Error:
+//   - ErrInvalidId: If the specified ID is not recognized in the database.
+func SoftDelete[T any](db *KVStoreManager, id string) error {
+	return SoftDeleteCtx[T](context.Background(), db, id)
+}
+
+// SoftDeleteCtx is SoftDelete with a context, handed to the triggers.
+func SoftDeleteCtx[T any](ctx context.Context, db *KVStoreManager, id string) error {
+	return db.SoftDeleteCtx(ctx, NewTableKey[T]().SetId(id))
+}
+
+// Restore brings the object with the given ID back from the trash, with its links to the
+// objects which are not deleted, and returns a wrapper of it.
+// Triggers run with InsertOperation.
+//
+// Possible Errors:
+//   - ErrInvalidId: If the object is not in the trash.
+//   - ErrUniqueViolation: If a unique field holds a value taken since it was trashed.
+func Restore[T any](db *KVStoreManager, id string) (KVWrapper[T], error) {
+	return RestoreCtx[T](context.Background(), db, id)
+}
+
+// RestoreCtx is Restore with a context, handed to the triggers.
+func RestoreCtx[T any](ctx context.Context, db *KVStoreManager, id string) (KVWrapper[T], error) {
+
+	record, err := db.restore(ctx, NewTableKey[T]().SetId(id))
+	if err != nil {
+		return KVWrapper[T]{}, err
+	}
+
+	return wrapRecord[T](db, record), nil
+}
+
+// Purge removes the object with the given ID from the trash for good, and releases its
+// ID.
+//
+// Possible Error:
+//   - ErrInvalidId: If the object is not in the trash.
+func Purge[T any](db *KVStoreManager, id string) error {
+	return PurgeCtx[T](context.Background(), db, id)
+}
+
+// PurgeCtx is Purge with a context: nothing is committed once ctx is done.
+func PurgeCtx[T any](ctx context.Context, db *KVStoreManager, id string) error {
+	return db.PurgeCtx(ctx, NewTableKey[T]().SetId(id))
+}
+
+// PurgeOlderThan purges the objects of type T moved to the trash more than age ago, and
+// returns how many were purged.
+func PurgeOlderThan[T any](db *KVStoreManager, age time.Duration) (int, error) {
+	return PurgeOlderThanCtx[T](context.Background(), db, age)
+}
+
+// PurgeOlderThanCtx is PurgeOlderThan with a context: the purge stops once ctx is done,
+// returning ctx.Err().
+func PurgeOlderThanCtx[T any](ctx context.Context, db *KVStoreManager, age time.Duration) (int, error) {
+	return db.PurgeOlderThanCtx(ctx, NewTableKey[T](), age)
+}
+
+// Trash returns the wrappers of the objects of type T in the trash; their Meta tells when
+// they were deleted.
+func Trash[T any](db *KVStoreManager) []KVWrapper[T] {
+	wrappers, _ := TrashCtx[T](context.Background(), db)
+	return wrappers
+}
+
+// TrashCtx is Trash with a context: the scan stops once ctx is done, returning ctx.Err().
+func TrashCtx[T any](ctx context.Context, db *KVStoreManager) ([]KVWrapper[T], error) {
+
+	records, err := db.trash(ctx, NewTableKey[T]())
+	if err != nil {
+		return nil, err
+	}
+
+	var wrappers []KVWrapper[T]
+	for _, record := range records {
+		wrappers = append(wrappers, wrapRecord[T](db, record))
+	}
+
+	return wrappers, nil
+}
+
+//endregion
+
+//region History
+
+// SetHistory makes Set, Update and Delete keep the former values of the objects of type T
+// from now on, bounded by policy, so that History lists them and Revert writes one back.
+// A nil policy stops keeping them; the revisions already kept remain.
+func SetHistory[T any](db *KVStoreManager, policy *HistoryPolicy) {
+	var t T
+	db.setHistory(t, policy)
+}
+
+// History returns the revisions kept for the object with the given ID, from the oldest
+// to the latest, with the time each value was replaced. They outlive the object.
+func History[T any](db *KVStoreManager, id string) []Revision {
+	return db.History(NewTableKey[T]().SetId(id))
+}
+
+// HistoryCtx is History with a context, returning ctx.Err() once ctx is done.
+func HistoryCtx[T any](ctx context.Context, db *KVStoreManager, id string) ([]Revision, error) {
+	return db.HistoryCtx(ctx, NewTableKey[T]().SetId(id))
+}
+
+// GetRevision returns a wrapper of the value the object with the given ID held at the
+// revision of the given number; its Meta describes the object at the time.
+//
+// Possible Error:
+//   - ErrUnknownRevision: If the revision is not kept.
+func GetRevision[T any](db *KVStoreManager, id string, rev uint64) (KVWrapper[T], error) {
+	return GetRevisionCtx[T](context.Background(), db, id, rev)
+}
+
+// GetRevisionCtx is GetRevision with a context.
+func GetRevisionCtx[T any](ctx context.Context, db *KVStoreManager, id string, rev uint64) (KVWrapper[T], error) {
+
+	record, err := db.getRevision(ctx, NewTableKey[T]().SetId(id), rev)
+	if err != nil {
+		return KVWrapper[T]{}, err
+	}
+
+	return wrapRecord[T](db, record), nil
+}
+
+// Revert writes back the value the object with the given ID held at the revision of the
+// given number, keeping its current value as a new revision, and returns a wrapper of
+// it. A deleted object is inserted again.
+// Triggers run with UpdateOperation or InsertOperation accordingly.
+//
+// Possible Errors:
+//   - ErrUnknownRevision: If the revision is not kept.
+//   - ErrIdTaken: If the object is in the trash, see Restore.
+func Revert[T any](db *KVStoreManager, id string, rev uint64) (KVWrapper[T], error) {
+	return RevertCtx[T](context.Background(), db, id, rev)
+}
+
+// RevertCtx is Revert with a context, handed to the triggers.
+func RevertCtx[T any](ctx context.Context, db *KVStoreManager, id string, rev uint64) (KVWrapper[T], error) {
+
+	record, err := db.revert(ctx, NewTableKey[T]().SetId(id), rev)
+	if err != nil {
+		return KVWrapper[T]{}, err
+	}
+
+	return wrapRecord[T](db, record), nil
+}
+
+// PruneHistory removes the revisions of the objects of type T which the policy set with
+// SetHistory no longer allows, e.g. those older than its MaxAge, and returns how many
+// were removed. The history of an object is otherwise only pruned when it gets a new
+// revision.
+func PruneHistory[T any](db *KVStoreManager) (int, error) {
+	return PruneHistoryCtx[T](context.Background(), db)
+}
+
+// PruneHistoryCtx is PruneHistory with a context: the pruning stops once ctx is done,
+// returning ctx.Err().
+func PruneHistoryCtx[T any](ctx context.Context, db *KVStoreManager) (int, error) {
+	return db.PruneHistoryCtx(ctx, NewTableKey[T]())
+}
+
+//endregion
+
+//region Pages
+
+// PageResult is a page of objects, returned by Page and PageReverse.
+type PageResult[T any] struct {
+	// Items are the wrappers of the objects of the page.
+	Items []KVWrapper[T]
+	// Next is the cursor of the following page, in the same order; it is empty after the
+	// last page.
+	Next string
+	// Previous is the cursor of the objects before Items, to read in the other order: with
+	// PageReverse for a page of Page, and the reverse. It is empty when Items is.
+	Previous string
+}
+
+// Page returns the objects of type T following cursor, up to limit, in the order of their
+// IDs, with the cursors around the page. An empty cursor starts from the first object,
+// and a limit of 0 or less reads them all. Pages keep going on from their cursor while
+// objects are inserted or deleted.
+//
+// Possible Error:
+//   - ErrInvalidCursor: If cursor was not returned by a page.
+func Page[T any](db *KVStoreManager, cursor string, limit int) (PageResult[T], error) {
+	return PageCtx[T](context.Background(), db, cursor, limit)
+}
+
+// PageCtx is Page with a context: the scan stops once ctx is done, returning ctx.Err().
+func PageCtx[T any](ctx context.Context, db *KVStoreManager, cursor string, limit int) (PageResult[T], error) {
+	return page[T](ctx, db, cursor, limit, false)
+}
+
+// PageReverse is Page in the reverse order of the IDs: an empty cursor starts from the
+// last object.
+func PageReverse[T any](db *KVStoreManager, cursor string, limit int) (PageResult[T], error) {
+	return PageReverseCtx[T](context.Background(), db, cursor, limit)
+}
+
+// PageReverseCtx is PageReverse with a context: the scan stops once ctx is done,
+// returning ctx.Err().
+func PageReverseCtx[T any](ctx context.Context, db *KVStoreManager, cursor string, limit int) (PageResult[T], error) {
+	return page[T](ctx, db, cursor, limit, true)
+}
+
+func page[T any](
+	ctx context.Context,
+	db *KVStoreManager,
+	cursor string,
+	limit int,
+	reverse bool,
+) (PageResult[T], error) {
+
+	records, next, err := db.page(ctx, NewTableKey[T](), cursor, limit, reverse)
+	if err != nil {
+		return PageResult[T]{}, err
+	}
+
+	result := PageResult[T]{Next: next}
+	for _, record := range records {
+		result.Items = append(result.Items, wrapRecord[T](db, record))
+	}
+	if len(records) > 0 {
+		result.Previous = encodeCursor(records[0].key)
+	}
+
+	return result, nil
+}
+
+//endregion
+
+//region Indexes
+
+// AddIndex declares a secondary index named name on the table of T, whose values are
+// computed by the extractor. Indexes on plain fields can also be declared with the
+// `fkv:"index"` struct tag.
+//
+// Records stored before the declaration are only indexed after a call to Reindex.
+//
+// Possible Errors:
+//   - ErrDuplicateIndex: If an index with the same name is already declared for T.
+func AddIndex[T any](db *KVStoreManager, name string, extractor func(value *T) any) error {
+	return addIndex(db, name, false, extractor)
+}
+
+// AddUniqueIndex works like AddIndex, but also forbids two objects of type T to share
+// the same extracted value: Insert, Set and Update then fail with an ErrUniqueViolation.
+// Unique indexes on plain fields can also be declared with the `fkv:"unique"` struct tag.
+//
+// Possible Errors:
+//   - ErrDuplicateIndex: If an index with the same name is already declared for T.
+func AddUniqueIndex[T any](db *KVStoreManager, name string, extractor func(value *T) any) error {
+	return addIndex(db, name, true, extractor)
+}
+
+func addIndex[T any](
+	db *KVStoreManager,
+	name string,
+	unique bool,
+	extractor func(value *T) any,
+) error {
+
+	var t T
+
+	return db.addIndex(t, name, unique, func(value any) any {
+		valueAsT, ok := value.(T)
+		if !ok {
+			valueAsT = *value.(*T)
+		}
+		return extractor(&valueAsT)
+	})
+}
+
+// FindBy returns all objects of type T whose index named field holds value.
+// Unlike FindAll, only the matching records are read and decoded.
+//
+// Possible Errors:
+//   - ErrUnknownIndex: If no index named field is declared for T.
+func FindBy[T any](db *KVStoreManager, field string, value any) ([]KVWrapper[T], error) {
+	return FindByCtx[T](context.Background(), db, field, value)
+}
+
+// FindByCtx is FindBy with a context: the scan stops once ctx is done, returning
+// ctx.Err().
+func FindByCtx[T any](
+	ctx context.Context,
+	db *KVStoreManager,
+	field string,
+	value any,
+) ([]KVWrapper[T], error) {
+
+	var t T
+	db.schemaOf(t)
+
+	records, err := db.findBy(ctx, NewTableKey[T](), field, value)
+	if err != nil {
+		return nil, err
+	}
+
+	var objs []KVWrapper[T]
+	for _, record := range records {
+		objs = append(objs, wrapRecord[T](db, record))
+	}
+
+	return objs, nil
+}
+
+// Reindex rebuilds the index entries of all objects of type T, for instance after an
+// index was declared on a table already holding records.
+func Reindex[T any](db *KVStoreManager) error {
+	return ReindexCtx[T](context.Background(), db)
+}
+
+// ReindexCtx is Reindex with a context: the rebuild stops once ctx is done, returning
+// ctx.Err(), and the entries are left as they were.
+func ReindexCtx[T any](ctx context.Context, db *KVStoreManager) error {
+
+	var t T
+	db.schemaOf(t)
+
+	return db.ReindexCtx(ctx, NewTableKey[T]())
+}
+
+//endregion
+
 //region Triggers
 
 // AddBeforeTrigger registers a new trigger that fires before the specified operations
@@ -507,18 +1372,34 @@ func AddBeforeTrigger[T any](
 	operations Operation,
 	action func(operation Operation, key IKey, value *T) bool,
 ) error {
+	return AddBeforeTriggerCtx(db, id, operations,
+		func(_ context.Context, operation Operation, key IKey, value *T) bool {
+			return action(operation, key, value)
+		})
+}
+
+// AddBeforeTriggerCtx works like AddBeforeTrigger, but the action also receives the
+// context of the operation (context.Background() for the variants without one), so that
+// it can read request-scoped values.
+func AddBeforeTriggerCtx[T any](
+	db *KVStoreManager,
+	id string,
+	operations Operation,
+	action func(ctx context.Context, operation Operation, key IKey, value *T) bool,
+) error {
 
 	triggerToBeAdded := trigger{
 		id:         id,
 		tableName:  TableName[T](),
 		operations: operations,
 		isBefore:   true,
-		beforeTask: func(operation Operation, key IKey, value *any) bool {
+		beforeTask: func(ctx context.Context, operation Operation, key IKey, value *any) bool {
 			valueAsT := (*value).(T)
-			return action(operation, key, &valueAsT)
+			return action(ctx, operation, key, &valueAsT)
 		},
 	}
 
+	db = db.root()
 	db.m.Lock()
 	defer db.m.Unlock()
 
@@ -551,18 +1432,34 @@ func AddAfterTrigger[T any](
 	operations Operation,
 	action func(operation Operation, key IKey, value *T),
 ) error {
+	return AddAfterTriggerCtx(db, id, operations,
+		func(_ context.Context, operation Operation, key IKey, value *T) {
+			action(operation, key, value)
+		})
+}
+
+// AddAfterTriggerCtx works like AddAfterTrigger, but the action also receives the context
+// of the operation. The action runs once the data is committed, possibly after ctx is
+// done: it should not rely on its cancellation.
+func AddAfterTriggerCtx[T any](
+	db *KVStoreManager,
+	id string,
+	operations Operation,
+	action func(ctx context.Context, operation Operation, key IKey, value *T),
+) error {
 
 	triggerToBeAdded := trigger{
 		id:         id,
 		tableName:  TableName[T](),
 		operations: operations,
 		isBefore:   false,
-		afterTask: func(operation Operation, key IKey, value *any) {
+		afterTask: func(ctx context.Context, operation Operation, key IKey, value *any) {
 			valueAsAny := (*value).(T)
-			action(operation, key, &valueAsAny)
+			action(ctx, operation, key, &valueAsAny)
 		},
 	}
 
+	db = db.root()
 	db.m.Lock()
 	defer db.m.Unlock()
 
@@ -592,6 +1489,7 @@ func DeleteTrigger[T any](db *KVStoreManager, id string) error {
 		tableName: TableName[T](),
 	}
 
+	db = db.root()
 	db.m.Lock()
 	defer db.m.Unlock()
 
@@ -1,23 +1,46 @@
 package core_test
 
 import (
+	"context"
 	"encoding/gob"
 	"errors"
 	. "github.com/Phosmachina/FluentKV/core"
 	"github.com/Phosmachina/FluentKV/driver"
 	. "github.com/Phosmachina/FluentKV/helper"
+	"os"
 	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
+// newTestableDriver opens the driver the suite runs on: the generic implementation first, then
+// the in-memory one, which behaves like Badger (see TestMain).
+var newTestableDriver = driver.NewGeneric
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if code == 0 {
+		newTestableDriver = driver.NewMemory
+		code = m.Run()
+	}
+	os.Exit(code)
+}
+
 func prepareTestableDb() *KVStoreManager {
 
 	// Register types used in DB.
 	gob.Register(SimpleType{})
 	gob.Register(AnotherType{})
 
-	// Use generic implementation for testing.
-	return NewKVStoreManager(driver.NewGeneric())
+	return newTestableDriver()
+}
+
+// prepareMemoryDb is prepareTestableDb for the tests relying on ordered keys, concurrent use,
+// conflicting transactions or Close, which only the in-memory implementation provides.
+func prepareMemoryDb() *KVStoreManager {
+	prepareTestableDb()
+	return driver.NewMemory()
 }
 
 func checkObjectWrapper(
@@ -431,6 +454,36 @@ func TestLinkNew(t *testing.T) {
 	}
 }
 
+func TestLinkNew_RollsBack(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	gob.Register(UniqueType{})
+	current, _ := Insert(db, NewAnotherType("t3", 1.1))
+	missing, _ := Insert(db, NewAnotherType("t3", 1.2))
+	_ = Delete[AnotherType](db, missing.Key().Id())
+
+	// Act
+	_, errMissing := LinkNewCtx(context.Background(), missing, false, NewSimpleType("t1", "t2", 1))
+	targets, err := LinkNewCtx(context.Background(), current, false,
+		&UniqueType{Email: "a@b.c"}, &UniqueType{Email: "a@b.c"})
+
+	// Assert
+	if !errors.Is(errMissing, ErrInvalidId) {
+		t.Errorf("LinkNewCtx failed: expected %v, got %v", ErrInvalidId, errMissing)
+	}
+	var violation *ErrUniqueViolation
+	if !errors.As(err, &violation) || len(targets) != 0 {
+		t.Errorf("LinkNewCtx failed: expected a unique violation, got %v (%v)", targets, err)
+	}
+	if ct := Count[UniqueType](db); ct != 0 {
+		t.Errorf("LinkNewCtx failed: expected nothing written, got %d objects", ct)
+	}
+	if ct := Count[SimpleType](db); ct != 0 {
+		t.Errorf("LinkNewCtx failed: expected nothing written, got %d objects", ct)
+	}
+}
+
 func TestAllFromLink(t *testing.T) {
 
 	// Arrange
@@ -475,11 +528,15 @@ func TestRemoveLink(t *testing.T) {
 	target := LinkNew(current, false, NewSimpleType("t1", "t2", 1))[0]
 
 	// Act
-	isRemoved := Unlink[AnotherType, SimpleType](db, current.Key().Id(), target.Key().Id())
+	err := Unlink[AnotherType, SimpleType](db, current.Key().Id(), target.Key().Id())
 
 	// Assert
-	if !isRemoved {
-		t.Errorf("Remove failed: expected %v, got %v", true, isRemoved)
+	if err != nil {
+		t.Errorf("Remove failed: expected %v, got %v", nil, err)
+	}
+	err = Unlink[AnotherType, SimpleType](db, current.Key().Id(), target.Key().Id())
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Remove failed: expected %v, got %v", ErrNotFound, err)
 	}
 	if len(CollectLinked[AnotherType, SimpleType](db, current.Key().Id())) != 0 {
 		t.Error("Expecting no linked object")
@@ -542,6 +599,52 @@ func TestRemoveAllLink(t *testing.T) {
 	}
 }
 
+func TestCollectAllLinkedKey(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	current, _ := Insert(db, NewAnotherType("t3", 1.1))
+	outgoing := LinkNew(current, true, NewSimpleType("t1", "t2", 1))[0]
+	incoming, _ := Insert(db, NewAnotherType("t3", 2.2))
+	_ = Link(incoming, false, current)
+
+	// Act
+	linkedKeys := CollectAllLinkedKey[AnotherType](db, current.Key().Id())
+
+	// Assert
+	if len(linkedKeys) != 2 {
+		t.Fatalf("CollectAllLinkedKey failed: expected %v, got %v", 2, len(linkedKeys))
+	}
+	if !linkedKeys[0].Equals(outgoing.Key()) && !linkedKeys[1].Equals(outgoing.Key()) ||
+		!linkedKeys[0].Equals(incoming.Key()) && !linkedKeys[1].Equals(incoming.Key()) {
+		t.Errorf("CollectAllLinkedKey failed: unexpected keys %v", linkedKeys)
+	}
+}
+
+func TestDelete_RemovesReverseLinks(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	current, _ := Insert(db, NewAnotherType("t3", 1.1))
+	target := LinkNew(current, true, NewSimpleType("t1", "t2", 1))[0]
+
+	// Act
+	err := DeleteWrp(target)
+
+	// Assert
+	if err != nil {
+		t.Errorf("Delete failed: expected %v, got %v", nil, err)
+	}
+	count := 0
+	db.RawIterKey(NewLinkKey(nil, nil).Reverse(), func(_ IKey) (stop bool) {
+		count++
+		return false
+	})
+	if count != 0 || len(CollectAllLinkedKey[AnotherType](db, current.Key().Id())) != 0 {
+		t.Errorf("Delete failed: expected no link left, got %v reverse entries", count)
+	}
+}
+
 //endregion
 
 //region Triggers
@@ -774,3 +877,250 @@ func TestTrigger_CancelInsert(t *testing.T) {
 // TODO add some test to ensure that parallelized access works as expected
 
 //endregion
+
+//region Transactions
+
+// conflictingDriver wraps a KVDriver so that the first commits writing a record fail with
+// ErrConflict. The transactions of the ID allocator, which only write its state, commit.
+type conflictingDriver struct {
+	KVDriver
+	conflicts int
+}
+
+func (d *conflictingDriver) Begin() (KVTx, error) {
+	tx, err := d.KVDriver.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &conflictingTx{KVTx: tx, driver: d}, nil
+}
+
+type conflictingTx struct {
+	KVTx
+	driver *conflictingDriver
+	record bool
+}
+
+func (tx *conflictingTx) RawSet(key IKey, value []byte) error {
+	if _, ok := key.(*TableKey); ok {
+		tx.record = true
+	}
+	return tx.KVTx.RawSet(key, value)
+}
+
+func (tx *conflictingTx) Commit() error {
+	if tx.record && tx.driver.conflicts > 0 {
+		tx.driver.conflicts--
+		tx.KVTx.Rollback()
+		return ErrConflict
+	}
+	return tx.KVTx.Commit()
+}
+
+func TestWithTx_Commit(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	var current KVWrapper[SimpleType]
+	var target KVWrapper[AnotherType]
+
+	// Act
+	err := WithTx(db, func(tx *KVStoreManager) error {
+		current, _ = Insert(tx, NewSimpleType("t1", "t2", 1))
+		target, _ = Insert(tx, NewAnotherType("t3", 1.1))
+		return Link(current, true, target)
+	})
+
+	// Assert
+	if err != nil {
+		t.Errorf("WithTx failed: expected %v, got %v", nil, err)
+	}
+	if !Exist[SimpleType](db, current.Key().Id()) || !Exist[AnotherType](db, target.Key().Id()) {
+		t.Error("WithTx failed: inserted objects not found after commit")
+	}
+	if len(CollectLinked[AnotherType, SimpleType](db, target.Key().Id())) != 1 {
+		t.Error("WithTx failed: link not found after commit")
+	}
+	if !ExistWrp(current) {
+		t.Error("WithTx failed: wrapper created in the transaction is not usable after it")
+	}
+}
+
+func TestWithTx_Rollback(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	expectedErr := errors.New("abort")
+	kept, _ := Insert(db, NewSimpleType("t1", "t2", 0))
+
+	// Act
+	err := WithTx(db, func(tx *KVStoreManager) error {
+		current, _ := Insert(tx, NewSimpleType("t1", "t2", 1))
+		target, _ := Insert(tx, NewAnotherType("t3", 1.1))
+		_ = Link(current, true, target)
+		_ = Delete[SimpleType](tx, kept.Key().Id())
+		return expectedErr
+	})
+
+	// Assert
+	if !errors.Is(err, expectedErr) {
+		t.Errorf("WithTx failed: expected %v, got %v", expectedErr, err)
+	}
+	if Count[SimpleType](db) != 1 || Count[AnotherType](db) != 0 {
+		t.Error("WithTx failed: writes of the rolled back transaction are visible")
+	}
+	if !ExistWrp(kept) {
+		t.Error("WithTx failed: object deleted by the rolled back transaction is missing")
+	}
+	reused, _ := Insert(db, NewSimpleType("t1", "t2", 2))
+	if reused.Key().Id() == kept.Key().Id() {
+		t.Error("WithTx failed: ID of an object still in use was freed")
+	}
+}
+
+func TestWithTx_RetryOnConflict(t *testing.T) {
+
+	// Arrange
+	db := NewKVStoreManager(&conflictingDriver{KVDriver: prepareTestableDb(), conflicts: 2})
+	attempts := 0
+
+	// Act
+	err := WithTx(db, func(tx *KVStoreManager) error {
+		attempts++
+		_, err := Insert(tx, NewSimpleType("t1", "t2", 1))
+		return err
+	})
+
+	// Assert
+	if err != nil {
+		t.Errorf("WithTx failed: expected %v, got %v", nil, err)
+	}
+	if attempts != 3 {
+		t.Errorf("WithTx failed: expected %d attempts, got %d", 3, attempts)
+	}
+	if Count[SimpleType](db) != 1 {
+		t.Errorf("WithTx failed: expected %d object, got %d", 1, Count[SimpleType](db))
+	}
+}
+
+func TestWithTx_AfterTriggerOnCommit(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	visibleInTrigger := false
+	_ = AddAfterTrigger(db, "check", InsertOperation,
+		func(operation Operation, key IKey, value *SimpleType) {
+			visibleInTrigger = db.Exist(key)
+		})
+
+	// Act
+	_ = WithTx(db, func(tx *KVStoreManager) error {
+		_, err := Insert(tx, NewSimpleType("t1", "t2", 1))
+		return err
+	})
+
+	// Assert
+	if !visibleInTrigger {
+		t.Error("After trigger fired before the transaction was committed")
+	}
+}
+
+//endregion
+
+//region Context
+
+type requestIdKey struct{}
+
+func TestInsertCtx_Cancelled(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Act
+	_, err := InsertCtx(ctx, db, NewSimpleType("t1", "t2", 1))
+
+	// Assert
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("InsertCtx failed: expected %v, got %v", context.Canceled, err)
+	}
+	if Count[SimpleType](db) != 0 {
+		t.Error("InsertCtx failed: object stored despite the cancellation")
+	}
+}
+
+func TestForeachCtx_CancelStopsScan(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	total := 500
+	for i := 0; i < total; i++ {
+		_, _ = Insert(db, NewSimpleType("t1", "t2", i))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls atomic.Int32
+
+	// Act
+	err := ForeachCtx(ctx, db, func(key IKey, value *SimpleType) {
+		calls.Add(1)
+		cancel()
+	})
+
+	// Assert
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ForeachCtx failed: expected %v, got %v", context.Canceled, err)
+	}
+	if int(calls.Load()) >= total {
+		t.Errorf("ForeachCtx failed: expected the scan to stop early, got %d calls", calls.Load())
+	}
+}
+
+func TestFindAllCtx_DeadlineExceeded(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	_, _ = Insert(db, NewSimpleType("t1", "t2", 1))
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+
+	// Act
+	results, err := FindAllCtx(ctx, db, func(key *TableKey, value *SimpleType) bool {
+		return true
+	})
+
+	// Assert
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("FindAllCtx failed: expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if len(results) != 0 {
+		t.Errorf("FindAllCtx failed: expected no result, got %v", results)
+	}
+}
+
+func TestAddBeforeTriggerCtx_SeesContextValues(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	var seen any
+	_ = AddBeforeTriggerCtx(db, "audit", InsertOperation,
+		func(ctx context.Context, operation Operation, key IKey, value *SimpleType) bool {
+			seen = ctx.Value(requestIdKey{})
+			return true
+		})
+	ctx := context.WithValue(context.Background(), requestIdKey{}, "req-42")
+
+	// Act
+	_, err := InsertCtx(ctx, db, NewSimpleType("t1", "t2", 1))
+
+	// Assert
+	if err != nil {
+		t.Errorf("InsertCtx failed: expected %v, got %v", nil, err)
+	}
+	if seen != "req-42" {
+		t.Errorf("Trigger failed: expected %v, got %v", "req-42", seen)
+	}
+}
+
+//endregion
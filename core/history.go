@@ -0,0 +1,405 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownRevision indicates a revision which is not kept in the history of a record.
+var ErrUnknownRevision = errors.New("the revision specified is not kept for this record")
+
+// HistoryPolicy sets how many former values the history of a table keeps for each of its
+// records, see SetHistory. The zero HistoryPolicy keeps them all.
+type HistoryPolicy struct {
+	// MaxRevisions caps the revisions kept for a record: the oldest ones are removed
+	// first. 0 means no cap.
+	MaxRevisions int
+
+	// MaxAge is how long a revision is kept once its value was replaced. 0 means no cap.
+	MaxAge time.Duration
+}
+
+// Revision describes a former value of a record, kept by the history of its table.
+type Revision struct {
+	// Number identifies the revision among the ones of the record: 1 for the first value
+	// replaced, incremented by each revision kept since.
+	Number uint64
+
+	// Operation is the one which replaced the value: UpdateOperation, DeleteOperation
+	// or ExpireOperation.
+	Operation Operation
+
+	// ReplacedAt is the time the value was replaced.
+	ReplacedAt time.Time
+
+	// Meta describes the record as it was when it held the value.
+	Meta RecordMeta
+}
+
+// setHistory makes the writes to the records of the value's table keep their former
+// values, bounded by policy; a nil policy stops keeping them. The revisions already kept
+// are left as they are.
+func (db *KVStoreManager) setHistory(value any, policy *HistoryPolicy) {
+
+	schema := db.schemaOf(value)
+
+	root := db.root()
+	root.m.Lock()
+	defer root.m.Unlock()
+
+	if policy != nil {
+		policy = &HistoryPolicy{MaxRevisions: policy.MaxRevisions, MaxAge: policy.MaxAge}
+	}
+	schema.history = policy
+}
+
+// historyPolicy returns the policy of the history of the table, nil when it has none.
+func (db *KVStoreManager) historyPolicy(table string) *HistoryPolicy {
+
+	root := db.root()
+	root.m.Lock()
+	defer root.m.Unlock()
+
+	if schema, ok := root.schemas[table]; ok {
+		return schema.history
+	}
+	return nil
+}
+
+// archive keeps raw, the record of tableKey being replaced by operation, as its next
+// revision when its table has a history, then drops the revisions the policy no longer
+// allows. It must be run in a transaction.
+func (db *KVStoreManager) archive(tableKey *TableKey, raw []byte, operation Operation) error {
+
+	policy := db.historyPolicy(tableKey.Name())
+	if policy == nil {
+		return nil
+	}
+
+	header, payload, err := decodeRecord(raw)
+	if err != nil {
+		return err
+	}
+	header.archived = time.Now().UnixNano()
+	header.operation = operation
+
+	revisions := db.revisions(NewRevisionKey(tableKey))
+	number, err := db.lastRevisionNumber(tableKey, revisions)
+	if err != nil {
+		return err
+	}
+	number++
+
+	revisionKey := NewRevisionKey(tableKey).SetNumber(number)
+	if err = db.RawSet(revisionKey, encodeRecord(header, payload)); err != nil {
+		return failedToSet(err)
+	}
+	counter := []byte(strconv.FormatUint(number, 10))
+	if err = db.RawSet(revisionNumberKey(tableKey), counter); err != nil {
+		return failedToSet(err)
+	}
+	revisions = append(revisions, storedRevision{number: number, header: header})
+
+	_, err = db.prune(tableKey, revisions, policy, header.archived)
+	return err
+}
+
+// lastRevisionNumber returns the number of the last revision of the record of tableKey,
+// whose revisions are given, 0 if it never had one. It is recorded apart from them, so
+// that the numbers do not start over once they are all pruned.
+func (db *KVStoreManager) lastRevisionNumber(tableKey *TableKey, revisions []storedRevision) (uint64, error) {
+
+	raw, err := db.RawGet(revisionNumberKey(tableKey))
+	if err == nil {
+		return strconv.ParseUint(string(raw), 10, 64)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return 0, err
+	}
+
+	// Kept before the number was recorded.
+	if len(revisions) > 0 {
+		return revisions[len(revisions)-1].number, nil
+	}
+	return 0, nil
+}
+
+// revisionNumberKey returns the key of the number of the last revision of the record of
+// tableKey.
+func revisionNumberKey(tableKey *TableKey) *TankKey {
+	return NewTankKey(TankRevisionNumber + IdDelimiter + tableKey.Base())
+}
+
+// releaseRecordId gives the ID of the record of tableKey, deleted for good, back to its
+// IdGenerator, unless the record has a history: the ID is then kept out of the free list
+// until its revisions are pruned, see dropHistory, so that Revert never writes them over
+// another record.
+func (db *KVStoreManager) releaseRecordId(tableKey *TableKey) error {
+	if db.Exist(revisionNumberKey(tableKey)) {
+		return nil
+	}
+	return db.releaseIds(tableKey.Name(), tableKey.Id())
+}
+
+// dropHistory forgets the history of the record of tableKey, whose revisions were all
+// pruned, once it is deleted for good, and releases its ID.
+func (db *KVStoreManager) dropHistory(tableKey *TableKey) error {
+
+	if db.Exist(tableKey) || db.Exist(NewTrashKey(tableKey)) {
+		return nil
+	}
+	err := db.RawDelete(revisionNumberKey(tableKey))
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return db.releaseIds(tableKey.Name(), tableKey.Id())
+}
+
+// storedRevision is a revision as read from the store, without its value.
+type storedRevision struct {
+	key    *TableKey
+	number uint64
+	header recordHeader
+}
+
+// revision returns the exported form of r.
+func (r storedRevision) revision() Revision {
+	return Revision{
+		Number:     r.number,
+		Operation:  r.header.operation,
+		ReplacedAt: time.Unix(0, r.header.archived),
+		Meta:       r.header.meta(),
+	}
+}
+
+// revisions reads the revisions matching the revisionKey prefix, sorted by record and by
+// number, as not every driver iterates in key order.
+func (db *KVStoreManager) revisions(revisionKey *RevisionKey) []storedRevision {
+
+	var revisions []storedRevision
+	db.RawIterKV(revisionKey, func(key IKey, raw []byte) (stop bool) {
+		header, _, err := decodeRecord(raw)
+		if err == nil {
+			revisionKey := key.(*RevisionKey)
+			revisions = append(revisions, storedRevision{
+				key:    revisionKey.TableKey(),
+				number: revisionKey.Number(),
+				header: header,
+			})
+		}
+		return false
+	})
+
+	slices.SortFunc(revisions, func(a, b storedRevision) int {
+		return cmp.Or(strings.Compare(a.key.Key(), b.key.Key()), cmp.Compare(a.number, b.number))
+	})
+
+	return revisions
+}
+
+// prune removes the revisions of the record of tableKey, sorted by number, which policy
+// does not allow at now, and returns how many it removed.
+func (db *KVStoreManager) prune(
+	tableKey *TableKey,
+	revisions []storedRevision,
+	policy *HistoryPolicy,
+	now int64,
+) (int, error) {
+
+	pruned := 0
+	for i, revision := range revisions {
+		tooMany := policy.MaxRevisions > 0 && len(revisions)-i > policy.MaxRevisions
+		tooOld := policy.MaxAge > 0 && revision.header.archived <= now-policy.MaxAge.Nanoseconds()
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		err := db.RawDelete(NewRevisionKey(tableKey).SetNumber(revision.number))
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return pruned, err
+		}
+		pruned++
+	}
+
+	return pruned, nil
+}
+
+// History returns the revisions kept for the record of tableKey, from the oldest to the
+// latest. They are kept from the time its table has a history, see SetHistory, and
+// outlive the record, so that a deleted record can be reverted: its ID is only released
+// once they are all pruned.
+func (db *KVStoreManager) History(tableKey *TableKey) []Revision {
+	revisions, _ := db.HistoryCtx(context.Background(), tableKey)
+	return revisions
+}
+
+// HistoryCtx is History with a context, returning ctx.Err() once ctx is done.
+func (db *KVStoreManager) HistoryCtx(ctx context.Context, tableKey *TableKey) ([]Revision, error) {
+
+	var revisions []Revision
+	for _, revision := range db.revisions(NewRevisionKey(tableKey)) {
+		revisions = append(revisions, revision.revision())
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// GetRevision returns the value the record of tableKey held at the revision of the given
+// number. The value is decoded with the current marshaller.
+// If the revision is not kept, ErrUnknownRevision is returned.
+func (db *KVStoreManager) GetRevision(tableKey *TableKey, number uint64) (*any, error) {
+	record, err := db.getRevision(context.Background(), tableKey, number)
+	return record.value, err
+}
+
+// GetRevisionCtx is GetRevision with a context.
+func (db *KVStoreManager) GetRevisionCtx(ctx context.Context, tableKey *TableKey, number uint64) (*any, error) {
+	record, err := db.getRevision(ctx, tableKey, number)
+	return record.value, err
+}
+
+// getRevision is GetRevisionCtx, also returning the header of the record at the revision.
+func (db *KVStoreManager) getRevision(
+	ctx context.Context,
+	tableKey *TableKey,
+	number uint64,
+) (storedRecord, error) {
+
+	if err := ctx.Err(); err != nil {
+		return storedRecord{}, err
+	}
+
+	raw, err := db.RawGet(NewRevisionKey(tableKey).SetNumber(number))
+	if errors.Is(err, ErrNotFound) {
+		return storedRecord{}, ErrUnknownRevision
+	}
+	if err != nil {
+		return storedRecord{}, err
+	}
+
+	value, header, err := db.decode(raw)
+	if err != nil {
+		return storedRecord{}, err
+	}
+
+	return storedRecord{key: tableKey, value: value, header: header}, nil
+}
+
+// Revert writes back the value the record of tableKey held at the revision of the given
+// number. The record is replaced as with Set, keeping its current value as a new
+// revision, or inserted again if it was deleted, as with InsertWithId.
+// Triggers run with UpdateOperation or InsertOperation accordingly.
+//
+// Possible Errors:
+//   - ErrUnknownRevision: If the revision is not kept.
+//   - ErrIdTaken: If the deleted record is in the trash, see Restore.
+//   - ErrUniqueViolation: If a unique value of the revision is taken by another record.
+func (db *KVStoreManager) Revert(tableKey *TableKey, number uint64) error {
+	return db.RevertCtx(context.Background(), tableKey, number)
+}
+
+// RevertCtx is Revert with a context, handed to the triggers. Nothing is committed once
+// ctx is done.
+func (db *KVStoreManager) RevertCtx(ctx context.Context, tableKey *TableKey, number uint64) error {
+	_, err := db.revert(ctx, tableKey, number)
+	return err
+}
+
+// revert is RevertCtx, also returning the reverted record.
+func (db *KVStoreManager) revert(
+	ctx context.Context,
+	tableKey *TableKey,
+	number uint64,
+) (storedRecord, error) {
+
+	record := storedRecord{key: tableKey}
+
+	err := db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
+		revision, err := tx.getRevision(ctx, tableKey, number)
+		if err != nil {
+			return err
+		}
+		record.value = revision.value
+
+		raw, err := tx.rawLive(ctx, tableKey)
+		if errors.Is(err, ErrNotFound) {
+			if tx.Exist(NewTrashKey(tableKey)) {
+				return ErrIdTaken
+			}
+			record.header, err = tx.insertChosen(ctx, tableKey, record.value)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		record.header, err = tx.replaceRecord(ctx, tableKey, raw, record.value)
+		return err
+	})
+
+	return record, err
+}
+
+// PruneHistory removes the revisions of the records matching the tableKey prefix which
+// the policy of their table no longer allows, e.g. those older than its MaxAge, and
+// returns how many it removed. The history of a record is otherwise only pruned when it
+// gets a new revision. Nothing is removed for a table without history. The IDs of the
+// deleted records whose revisions are all removed are released.
+func (db *KVStoreManager) PruneHistory(tableKey *TableKey) (int, error) {
+	return db.PruneHistoryCtx(context.Background(), tableKey)
+}
+
+// PruneHistoryCtx is PruneHistory with a context: the pruning stops once ctx is done,
+// returning ctx.Err().
+func (db *KVStoreManager) PruneHistoryCtx(ctx context.Context, tableKey *TableKey) (int, error) {
+
+	policy := db.historyPolicy(tableKey.Name())
+	if policy == nil {
+		return 0, nil
+	}
+
+	revisions := db.revisions(NewRevisionKey(tableKey))
+	now := time.Now().UnixNano()
+
+	pruned := 0
+	for start := 0; start < len(revisions); {
+		if err := ctx.Err(); err != nil {
+			return pruned, err
+		}
+
+		end := start + 1
+		for end < len(revisions) && revisions[end].key.Equals(revisions[start].key) {
+			end++
+		}
+
+		var ct int
+		err := db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
+			var err error
+			ct, err = tx.prune(revisions[start].key, revisions[start:end], policy, now)
+			if err != nil || ct < end-start {
+				return err
+			}
+			return tx.dropHistory(revisions[start].key)
+		})
+		if err != nil {
+			return pruned, err
+		}
+		pruned += ct
+		start = end
+	}
+
+	return pruned, nil
+}
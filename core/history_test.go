@@ -0,0 +1,195 @@
+package core_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/Phosmachina/FluentKV/core"
+)
+
+func TestHistory_GetRevision(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	SetHistory[SimpleType](db, &HistoryPolicy{})
+	object, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	id := object.Key().Id()
+	_, _ = Set(db, id, NewSimpleType("t1", "t2", 2))
+	_, _ = Update(db, id, func(value *SimpleType) { value.Val = 3 })
+	_ = Delete[SimpleType](db, id)
+
+	// Act
+	revisions := History[SimpleType](db, id)
+	first, err := GetRevision[SimpleType](db, id, 1)
+	_, errUnknown := GetRevision[SimpleType](db, id, 4)
+
+	// Assert
+	if len(revisions) != 3 {
+		t.Fatalf("History failed: expected %d revisions, got %v", 3, revisions)
+	}
+	expected := []Operation{UpdateOperation, UpdateOperation, DeleteOperation}
+	for i, revision := range revisions {
+		if revision.Number != uint64(i+1) || revision.Operation != expected[i] {
+			t.Errorf("History failed: expected revision %d by %v, got %+v", i+1, expected[i], revision)
+		}
+		if revision.ReplacedAt.IsZero() || revision.Meta.Version != uint64(i+1) {
+			t.Errorf("History failed: expected version %d with a time, got %+v", i+1, revision)
+		}
+	}
+	if err != nil || first.Value().Val != 1 || first.Version() != 1 {
+		t.Errorf("GetRevision failed: expected Val=%v, got %v (%v)", 1, first.Value(), err)
+	}
+	if !errors.Is(errUnknown, ErrUnknownRevision) {
+		t.Errorf("GetRevision failed: expected %v, got %v", ErrUnknownRevision, errUnknown)
+	}
+}
+
+func TestRevert(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	SetHistory[SimpleType](db, &HistoryPolicy{})
+	updated, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	_, _ = Set(db, updated.Key().Id(), NewSimpleType("t1", "t2", 2))
+	deleted, _ := Insert(db, NewSimpleType("t1", "t2", 10))
+	_ = Delete[SimpleType](db, deleted.Key().Id())
+	var operations []Operation
+	_ = AddAfterTrigger[SimpleType](db, "trigger", InsertOperation|UpdateOperation,
+		func(operation Operation, key IKey, value *SimpleType) {
+			operations = append(operations, operation)
+		})
+
+	// Act
+	reverted, err := Revert[SimpleType](db, updated.Key().Id(), 1)
+	reinserted, errDeleted := Revert[SimpleType](db, deleted.Key().Id(), 1)
+
+	// Assert
+	if err != nil || reverted.Value().Val != 1 || reverted.Version() != 3 {
+		t.Errorf("Revert failed: expected Val=%v at version %v, got %v (%v)",
+			1, 3, reverted.Value(), err)
+	}
+	if revisions := History[SimpleType](db, updated.Key().Id()); len(revisions) != 2 {
+		t.Errorf("Revert failed: expected %d revisions, got %v", 2, revisions)
+	}
+	if errDeleted != nil || reinserted.Value().Val != 10 {
+		t.Errorf("Revert failed: expected Val=%v, got %v (%v)", 10, reinserted.Value(), errDeleted)
+	}
+	if !Exist[SimpleType](db, deleted.Key().Id()) {
+		t.Errorf("Revert failed: expected the object %v inserted", deleted.Key().Id())
+	}
+	expected := []Operation{UpdateOperation, InsertOperation}
+	if len(operations) != 2 || operations[0] != expected[0] || operations[1] != expected[1] {
+		t.Errorf("Trigger failed: expected operations %v, got %v", expected, operations)
+	}
+}
+
+func TestHistoryPolicy(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	SetHistory[SimpleType](db, &HistoryPolicy{MaxRevisions: 2, MaxAge: 10 * time.Millisecond})
+	capped, _ := Insert(db, NewSimpleType("t1", "t2", 0))
+	for i := 1; i <= 4; i++ {
+		_, _ = Set(db, capped.Key().Id(), NewSimpleType("t1", "t2", i))
+	}
+	aged, _ := Insert(db, NewSimpleType("t1", "t2", 0))
+	_, _ = Set(db, aged.Key().Id(), NewSimpleType("t1", "t2", 1))
+	cappedRevisions := History[SimpleType](db, capped.Key().Id())
+
+	// Act
+	time.Sleep(20 * time.Millisecond)
+	pruned, err := PruneHistory[SimpleType](db)
+
+	// Assert
+	if len(cappedRevisions) != 2 || cappedRevisions[0].Number != 3 || cappedRevisions[1].Number != 4 {
+		t.Errorf("History failed: expected revisions %v and %v, got %v", 3, 4, cappedRevisions)
+	}
+	if err != nil || pruned != 3 {
+		t.Errorf("PruneHistory failed: expected %d, got %d (%v)", 3, pruned, err)
+	}
+	if revisions := History[SimpleType](db, aged.Key().Id()); len(revisions) != 0 {
+		t.Errorf("PruneHistory failed: expected no revision, got %v", revisions)
+	}
+}
+
+func TestHistory_KeepsIdOfDeletedRecord(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	SetHistory[SimpleType](db, &HistoryPolicy{})
+	deleted, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	_ = Delete[SimpleType](db, deleted.Key().Id())
+
+	// Act
+	other, _ := Insert(db, NewSimpleType("t1", "t2", 2))
+	_, err := Revert[SimpleType](db, deleted.Key().Id(), 1)
+
+	// Assert
+	if other.Key().Id() == deleted.Key().Id() {
+		t.Errorf("Insert failed: expected a new ID, got the one of %v", deleted.Key().Id())
+	}
+	if err != nil {
+		t.Errorf("Revert failed: expected %v, got %v", nil, err)
+	}
+	if value, err := Get[SimpleType](db, other.Key().Id()); err != nil || value.Value().Val != 2 {
+		t.Errorf("Revert failed: expected the other object untouched, got %v (%v)", value, err)
+	}
+}
+
+func TestPruneHistory_ReleasesId(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	SetHistory[SimpleType](db, &HistoryPolicy{MaxAge: 10 * time.Millisecond})
+	deleted, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	_ = Delete[SimpleType](db, deleted.Key().Id())
+	time.Sleep(20 * time.Millisecond)
+
+	// Act
+	pruned, err := PruneHistory[SimpleType](db)
+	id, _ := db.GetFreeId()
+
+	// Assert
+	if err != nil || pruned != 1 {
+		t.Errorf("PruneHistory failed: expected %d, got %d (%v)", 1, pruned, err)
+	}
+	if id != deleted.Key().Id() {
+		t.Errorf("GetFreeId failed: expected %v, got %v", deleted.Key().Id(), id)
+	}
+}
+
+func TestHistory_NumbersAfterPruning(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	SetHistory[SimpleType](db, &HistoryPolicy{MaxAge: 10 * time.Millisecond})
+	object, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	_, _ = Set(db, object.Key().Id(), NewSimpleType("t1", "t2", 2))
+	time.Sleep(20 * time.Millisecond)
+	_, _ = PruneHistory[SimpleType](db)
+
+	// Act
+	_, _ = Set(db, object.Key().Id(), NewSimpleType("t1", "t2", 3))
+	revisions := History[SimpleType](db, object.Key().Id())
+
+	// Assert
+	if len(revisions) != 1 || revisions[0].Number != 2 {
+		t.Errorf("History failed: expected the revision %d only, got %v", 2, revisions)
+	}
+}
+
+func TestSetHistory_Disabled(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	object, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+
+	// Act
+	_, _ = Set(db, object.Key().Id(), NewSimpleType("t1", "t2", 2))
+
+	// Assert
+	if revisions := History[SimpleType](db, object.Key().Id()); len(revisions) != 0 {
+		t.Errorf("History failed: expected no revision, got %v", revisions)
+	}
+}
@@ -0,0 +1,550 @@
+package core
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// ErrCorruptedIdPage indicates a page of the free list of IDs which can not be decoded.
+var ErrCorruptedIdPage = errors.New("a page of the free list of IDs is corrupted")
+
+// idAllocator hands out the auto-generated IDs of a store. Its state is kept in the tank
+// keyspace and only accessed by key, so that neither opening a store nor allocating an ID
+// scans it:
+//   - the high-water mark (TankIdHighWater) bounds every ID handed out so far; it is
+//     raised by blocks of AutoIdBuffer IDs before any ID of the block is used;
+//   - the free list holds the IDs released by deletes, as a stack of pages of at most
+//     AutoIdBuffer IDs (TankAvailableKey), counted by TankIdFreePages. A page is taken
+//     off the stack before any of its IDs is handed out again.
+//
+// Both are only changed in transactions of the store, read-modify-write, so that the
+// managers of several processes sharing a store each reserve their own blocks and pages.
+// The count of pages is read again with each block, to reuse the IDs the others released.
+//
+// A crash loses the rest of the reserved block, the IDs of the pages taken off the stack
+// and the releases not recorded yet, but never hands out an ID twice.
+//
+// The allocator of a sequence (see NewSequenceIdGenerator) only has a high-water mark,
+// and never reuses an ID.
+type idAllocator struct {
+	driver KVDriver
+
+	// table is the table of the sequence, or empty for the allocator shared by every
+	// table.
+	table string
+
+	// next is the next fresh ID, and reserved the end of the block of fresh IDs, recorded
+	// as the high-water mark when this allocator reserved it.
+	next     uint64
+	reserved uint64
+
+	// pages is the number of pages of the free list when last read, and free the IDs of
+	// the pages taken off it, smallest first.
+	pages uint64
+	free  idHeap
+
+	loaded bool
+	m      sync.Mutex
+}
+
+func newIdAllocator(driver KVDriver) *idAllocator {
+	return &idAllocator{driver: driver}
+}
+
+func newSequenceAllocator(driver KVDriver, table string) *idAllocator {
+	return &idAllocator{driver: driver, table: table}
+}
+
+// NewIds implements IdGenerator: the allocator is bound to its store and tables.
+func (a *idAllocator) NewIds(_ KVDriver, _ string, n int) ([]string, error) {
+	return a.take(n)
+}
+
+// Release implements IdGenerator.
+func (a *idAllocator) Release(_ KVDriver, _ string, ids ...string) error {
+	return a.release(ids...)
+}
+
+// Claim implements IdGenerator.
+func (a *idAllocator) Claim(_ KVDriver, _ string, ids ...string) error {
+	return a.claim(ids...)
+}
+
+// take returns n IDs, reusing the free ones first.
+func (a *idAllocator) take(n int) ([]string, error) {
+
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if err := a.load(); err != nil {
+		return nil, err
+	}
+	for a.free.Len() < n && a.pages > 0 {
+		if err := a.takePages(n - a.free.Len()); err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]string, 0, n)
+	for len(ids) < n && a.free.Len() > 0 {
+		ids = append(ids, strconv.FormatUint(heap.Pop(&a.free).(uint64), 10))
+	}
+
+	for len(ids) < n && a.next < a.reserved {
+		ids = append(ids, strconv.FormatUint(a.next, 10))
+		a.next++
+	}
+
+	// Fresh IDs are only handed out once the mark covering them is recorded.
+	missing := uint64(n - len(ids))
+	if missing > 0 {
+		if err := a.reserve(max(missing, uint64(AutoIdBuffer))); err != nil {
+			a.giveBack(ids)
+			return nil, err
+		}
+	}
+	for ; missing > 0; missing-- {
+		ids = append(ids, strconv.FormatUint(a.next, 10))
+		a.next++
+	}
+
+	return ids, nil
+}
+
+// takePages takes pages off the free list until they hold at least n IDs, the list is
+// empty, or MigrationBatchSize pages were taken, in one transaction.
+func (a *idAllocator) takePages(n int) error {
+
+	var pages uint64
+	var taken []uint64
+	err := a.update(func(tx KVTx) (err error) {
+
+		taken = taken[:0]
+		if pages, err = readCount(tx, NewTankKey(TankIdFreePages), 0); err != nil {
+			return err
+		}
+		limit := max(MigrationBatchSize, 1)
+		for ; len(taken) < n && pages > 0 && limit > 0; limit-- {
+			key := NewTankAvailableKey(strconv.FormatUint(pages, 10))
+			pages--
+
+			// A page missing was being taken during a crash: its IDs are lost.
+			raw, err := tx.RawGet(key)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if taken, err = decodeIdPage(raw, taken); err != nil {
+				return err
+			}
+			if err = tx.RawDelete(key); err != nil {
+				return failedToSet(err)
+			}
+		}
+
+		return setCount(tx, NewTankKey(TankIdFreePages), pages)
+	})
+	if err != nil {
+		return err
+	}
+
+	a.pages = pages
+	for _, id := range taken {
+		heap.Push(&a.free, id)
+	}
+
+	return nil
+}
+
+// release pushes the given IDs onto the free list. IDs which were not handed out, such
+// as the ones chosen by the caller of Set, are ignored, as well as every ID released to
+// a sequence.
+func (a *idAllocator) release(ids ...string) error {
+
+	if a.table != "" {
+		return nil
+	}
+
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if err := a.load(); err != nil {
+		return err
+	}
+
+	released := make([]uint64, 0, len(ids))
+	for _, raw := range ids {
+		if id, err := strconv.ParseUint(raw, 10, 64); err == nil && id < a.next {
+			released = append(released, id)
+		}
+	}
+
+	return a.pushPages(released)
+}
+
+// claim makes sure the given IDs, chosen by the caller, are not handed out from the free
+// IDs held in memory.
+//
+// The free list in the store is not rewritten, and the shared mark is not raised past
+// them, so that a large natural key does not make the IDs of every table jump: an ID chosen
+// among the ones still to be handed out can come out, and Insert skips the IDs already used
+// in the table. The mark of a sequence, which only serves its table, is raised past them.
+func (a *idAllocator) claim(ids ...string) error {
+
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if err := a.load(); err != nil {
+		return err
+	}
+
+	next := a.next
+	for _, raw := range ids {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil || id == math.MaxUint64 {
+			continue
+		}
+		if i := slices.Index(a.free, id); i != -1 {
+			heap.Remove(&a.free, i)
+		}
+		if a.table != "" {
+			next = max(next, id+1)
+		}
+	}
+
+	if next > a.reserved {
+		if err := a.raise(next); err != nil {
+			return err
+		}
+	}
+	a.next = next
+
+	return nil
+}
+
+// pushPages records ids as new pages of the free list, MigrationBatchSize pages per
+// transaction.
+func (a *idAllocator) pushPages(ids []uint64) error {
+
+	for batch := range slices.Chunk(ids, max(MigrationBatchSize, 1)*AutoIdBuffer) {
+		var pages uint64
+		err := a.update(func(tx KVTx) (err error) {
+
+			if pages, err = readCount(tx, NewTankKey(TankIdFreePages), 0); err != nil {
+				return err
+			}
+			for page := range slices.Chunk(batch, AutoIdBuffer) {
+				pages++
+				key := NewTankAvailableKey(strconv.FormatUint(pages, 10))
+				if err = tx.RawSet(key, encodeIdPage(page)); err != nil {
+					return failedToSet(err)
+				}
+			}
+
+			return setCount(tx, NewTankKey(TankIdFreePages), pages)
+		})
+		if err != nil {
+			return err
+		}
+		a.pages = pages
+	}
+
+	return nil
+}
+
+// close records the IDs held in memory back in the free list, and gives the rest of the
+// block back, so that nothing is lost when the store is opened again: the mark is lowered
+// to the next fresh ID, unless another allocator reserved a block above it meanwhile, in
+// which case the rest of the block joins the free list.
+func (a *idAllocator) close() error {
+
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if !a.loaded {
+		return nil
+	}
+
+	lowered := a.next == a.reserved
+	if !lowered {
+		err := a.update(func(tx KVTx) error {
+			mark, err := readCount(tx, highWaterKey(a.table), a.reserved)
+			if lowered = mark == a.reserved; err != nil || !lowered {
+				return err
+			}
+			return setCount(tx, highWaterKey(a.table), a.next)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	freed := a.free
+	for id := a.next; !lowered && a.table == "" && id < a.reserved; id++ {
+		freed = append(freed, id)
+	}
+	if err := a.pushPages(freed); err != nil {
+		return err
+	}
+	a.free = nil
+	a.next = a.reserved
+
+	return nil
+}
+
+// load reads the state of the allocator, on first use.
+func (a *idAllocator) load() error {
+
+	if a.loaded {
+		return nil
+	}
+
+	var mark, pages uint64
+	var err error
+	if a.table == "" {
+		mark, pages, err = seedIdAllocator(a.driver)
+	} else {
+		mark, err = seedSequence(a.driver, a.table)
+	}
+	if err != nil {
+		return err
+	}
+	a.next, a.reserved, a.pages, a.loaded = mark, mark, pages, true
+
+	return nil
+}
+
+func (a *idAllocator) giveBack(ids []string) {
+	for _, raw := range ids {
+		id, _ := strconv.ParseUint(raw, 10, 64)
+		heap.Push(&a.free, id)
+	}
+}
+
+// reserve records a mark n IDs above the one in the store, and makes the IDs in between
+// the block of fresh IDs of the allocator. The count of free list pages is read again.
+func (a *idAllocator) reserve(n uint64) error {
+
+	var mark, pages uint64
+	err := a.update(func(tx KVTx) (err error) {
+
+		if mark, err = readCount(tx, highWaterKey(a.table), a.reserved); err != nil {
+			return err
+		}
+		if a.table == "" {
+			if pages, err = readCount(tx, NewTankKey(TankIdFreePages), 0); err != nil {
+				return err
+			}
+		}
+
+		return setCount(tx, highWaterKey(a.table), mark+n)
+	})
+	if err != nil {
+		return err
+	}
+
+	a.next, a.reserved = mark, mark+n
+	if a.table == "" {
+		a.pages = pages
+	}
+
+	return nil
+}
+
+// raise makes sure the mark in the store is at least mark, and ends the block of fresh IDs
+// of the allocator there.
+func (a *idAllocator) raise(mark uint64) error {
+
+	err := a.update(func(tx KVTx) error {
+		current, err := readCount(tx, highWaterKey(a.table), a.reserved)
+		if err != nil || current >= mark {
+			return err
+		}
+		return setCount(tx, highWaterKey(a.table), mark)
+	})
+	if err != nil {
+		return err
+	}
+
+	a.reserved = mark
+
+	return nil
+}
+
+// update runs fn in a transaction of the store, again when the commit conflicts with
+// another allocator, up to MaxTxRetries times.
+func (a *idAllocator) update(fn func(tx KVTx) error) error {
+
+	for attempt := 0; ; attempt++ {
+		tx, err := a.driver.Begin()
+		if err != nil {
+			return err
+		}
+		if err = fn(tx); err == nil {
+			err = tx.Commit()
+		}
+		tx.Rollback()
+
+		if !errors.Is(err, ErrConflict) || attempt >= MaxTxRetries {
+			return err
+		}
+	}
+}
+
+// readCount reads the counter stored under key, or returns missing when there is none.
+func readCount(driver KVDriver, key IKey, missing uint64) (uint64, error) {
+
+	raw, err := driver.RawGet(key)
+	if errors.Is(err, ErrNotFound) {
+		return missing, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(string(raw), 10, 64)
+}
+
+func setCount(driver KVDriver, key IKey, count uint64) error {
+	if err := driver.RawSet(key, []byte(strconv.FormatUint(count, 10))); err != nil {
+		return failedToSet(err)
+	}
+	return nil
+}
+
+// seedIdAllocator returns the high-water mark and the number of free list pages of the
+// store. When the mark is missing, it is computed from the IDs found in the tables, whose
+// gaps make up the free list. This scan only happens once per store.
+//
+// The free list is written MigrationBatchSize pages at a time, and the mark last: an
+// interrupted seeding starts over, writing the same pages again.
+func seedIdAllocator(driver KVDriver) (mark uint64, pages uint64, err error) {
+
+	raw, err := driver.RawGet(NewTankKey(TankIdHighWater))
+	if err == nil {
+		if mark, err = strconv.ParseUint(string(raw), 10, 64); err != nil {
+			return 0, 0, err
+		}
+		raw, err = driver.RawGet(NewTankKey(TankIdFreePages))
+		if errors.Is(err, ErrNotFound) {
+			return mark, 0, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		pages, err = strconv.ParseUint(string(raw), 10, 64)
+		return mark, pages, err
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return 0, 0, err
+	}
+
+	var used []uint64
+	driver.RawIterKey(NewProtoTableKey(), func(key IKey) (stop bool) {
+		if id, err := strconv.ParseUint(key.(*TableKey).Id(), 10, 64); err == nil {
+			used = append(used, id)
+		}
+		return false
+	})
+	slices.Sort(used)
+
+	seeder := &idAllocator{driver: driver, loaded: true}
+	batchSize := max(MigrationBatchSize, 1) * AutoIdBuffer
+	var gaps []uint64
+	for _, id := range used {
+		for ; mark < id; mark++ {
+			if gaps = append(gaps, mark); len(gaps) == batchSize {
+				if err = seeder.pushPages(gaps); err != nil {
+					return 0, 0, err
+				}
+				gaps = gaps[:0]
+			}
+		}
+		mark = max(mark, id+1)
+	}
+
+	if err = seeder.pushPages(gaps); err != nil {
+		return 0, 0, err
+	}
+	if err = setCount(driver, NewTankKey(TankIdHighWater), mark); err != nil {
+		return 0, 0, err
+	}
+
+	return mark, seeder.pages, nil
+}
+
+// seedSequence returns the high-water mark of the sequence of the table. When it is
+// missing, it is computed from the largest integer ID of the table.
+func seedSequence(driver KVDriver, table string) (uint64, error) {
+
+	raw, err := driver.RawGet(highWaterKey(table))
+	if err == nil {
+		return strconv.ParseUint(string(raw), 10, 64)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return 0, err
+	}
+
+	mark := uint64(0)
+	driver.RawIterKey(NewProtoTableKey().setName(table), func(key IKey) (stop bool) {
+		if id, err := strconv.ParseUint(key.(*TableKey).Id(), 10, 64); err == nil {
+			mark = max(mark, id+1)
+		}
+		return false
+	})
+
+	return mark, nil
+}
+
+// highWaterKey returns the key of the high-water mark of the sequence of the table, or
+// of the shared allocator when table is empty.
+func highWaterKey(table string) *TankKey {
+	if table == "" {
+		return NewTankKey(TankIdHighWater)
+	}
+	return NewTankKey(TankIdSequence + IdDelimiter + table)
+}
+
+// encodeIdPage packs the IDs of a page of the free list as uvarints.
+func encodeIdPage(ids []uint64) []byte {
+	page := make([]byte, 0, len(ids)*binary.MaxVarintLen32)
+	for _, id := range ids {
+		page = binary.AppendUvarint(page, id)
+	}
+	return page
+}
+
+// decodeIdPage appends the IDs of a page of the free list to ids.
+func decodeIdPage(page []byte, ids []uint64) ([]uint64, error) {
+	for len(page) > 0 {
+		id, n := binary.Uvarint(page)
+		if n <= 0 {
+			return ids, fmt.Errorf("%w: %x", ErrCorruptedIdPage, page)
+		}
+		ids = append(ids, id)
+		page = page[n:]
+	}
+	return ids, nil
+}
+
+// idHeap is a min-heap of IDs, for container/heap.
+type idHeap []uint64
+
+func (h idHeap) Len() int           { return len(h) }
+func (h idHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h idHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *idHeap) Push(x any)        { *h = append(*h, x.(uint64)) }
+func (h *idHeap) Pop() any {
+	old := *h
+	id := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return id
+}
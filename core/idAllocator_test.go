@@ -0,0 +1,185 @@
+package core_test
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	. "github.com/Phosmachina/FluentKV/core"
+)
+
+func TestIdAllocator_RestartWithoutClose(t *testing.T) {
+
+	// Arrange: a manager dropped without Close, as after a crash.
+	db := prepareTestableDb()
+	for i := 0; i < 10; i++ {
+		_, _ = Insert(db, NewSimpleType("t1", "t2", i))
+	}
+	_ = Delete[SimpleType](db, "3")
+
+	// Act
+	restarted := NewKVStoreManager(db.KVDriver)
+	ids, err := restarted.GetFreeIds(2)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("GetFreeIds failed: expected %v, got %v", nil, err)
+	}
+	expected := []string{"3", strconv.Itoa(AutoIdBuffer)}
+	if !slices.Equal(ids, expected) {
+		t.Errorf("GetFreeIds failed: expected %v, got %v", expected, ids)
+	}
+}
+
+func TestIdAllocator_SeedFromTables(t *testing.T) {
+
+	// Arrange: a store written before the allocator state was recorded.
+	db := prepareTestableDb()
+	for _, id := range []string{"0", "1", "2", "5"} {
+		_ = db.RawSet(NewTableKey[SimpleType]().SetId(id), nil)
+	}
+	_ = db.RawSet(NewTableKey[AnotherType]().SetId("1"), nil)
+
+	// Act
+	ids, err := NewKVStoreManager(db.KVDriver).GetFreeIds(3)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("GetFreeIds failed: expected %v, got %v", nil, err)
+	}
+	expected := []string{"3", "4", "6"}
+	if !slices.Equal(ids, expected) {
+		t.Errorf("GetFreeIds failed: expected %v, got %v", expected, ids)
+	}
+}
+
+func TestIdAllocator_ReleaseIgnoresUnallocated(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	first, _ := db.GetFreeId()
+	chosen := strconv.Itoa(AutoIdBuffer + 5)
+
+	// Act
+	err := db.FreeId(chosen, "custom")
+	ids, _ := db.GetFreeIds(AutoIdBuffer + 10)
+
+	// Assert
+	if err != nil {
+		t.Errorf("FreeId failed: expected %v, got %v", nil, err)
+	}
+	if slices.Contains(ids, first) {
+		t.Errorf("GetFreeIds failed: %v handed out twice", first)
+	}
+	if index := slices.Index(ids, chosen); index != AutoIdBuffer+4 {
+		t.Errorf("GetFreeIds failed: expected %v at %d, got it at %d", chosen, AutoIdBuffer+4, index)
+	}
+}
+
+func TestIdAllocator_SharedStore(t *testing.T) {
+
+	// Arrange: two managers on one store, as two processes sharing it.
+	shared := prepareMemoryDb().KVDriver
+	first := NewKVStoreManager(keepOpen{shared})
+	second := NewKVStoreManager(keepOpen{shared})
+	defer second.Close()
+
+	// Act: the first one needs a second block while the second one holds its own.
+	ids, _ := first.GetFreeIds(1)
+	secondIds, _ := second.GetFreeIds(1)
+	more, _ := first.GetFreeIds(AutoIdBuffer)
+	ids = append(append(ids, secondIds...), more...)
+	first.Close()
+	third := NewKVStoreManager(keepOpen{shared})
+	defer third.Close()
+	thirdIds, _ := third.GetFreeIds(2 * AutoIdBuffer)
+	moreSecondIds, _ := second.GetFreeIds(AutoIdBuffer - 1)
+	ids = append(append(ids, thirdIds...), moreSecondIds...)
+
+	// Assert
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			t.Errorf("GetFreeIds failed: %v handed out twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+//region Benchmarks
+
+// benchmarkRecords is the number of records of the store the allocator is measured on.
+const benchmarkRecords = 10_000_000
+
+var (
+	largeDriver KVDriver
+	largeDbOnce sync.Once
+)
+
+// keepOpen is a driver whose Close leaves the underlying one open, so that the managers
+// of a benchmark can be closed without closing the prepared store.
+type keepOpen struct {
+	KVDriver
+}
+
+func (keepOpen) Close() {}
+
+// openLargeDb opens a manager on a store of benchmarkRecords records, one in a hundred of
+// them deleted, prepared once. The manager must be closed before another one is opened,
+// so that its allocator records its state.
+func openLargeDb(b *testing.B) *KVStoreManager {
+	largeDbOnce.Do(func() {
+		driver := prepareTestableDb().KVDriver
+		db := NewKVStoreManager(keepOpen{driver})
+		ids, _ := db.GetFreeIds(benchmarkRecords)
+		batch := db.NewWriteBatch()
+		var deleted []string
+		for i, id := range ids {
+			if i%100 == 0 {
+				deleted = append(deleted, id)
+				continue
+			}
+			_ = batch.RawSet(NewTableKey[SimpleType]().SetId(id), nil)
+		}
+		_ = batch.Flush()
+		_ = db.FreeId(deleted...)
+		db.Close()
+		largeDriver = driver
+	})
+	b.ResetTimer()
+	return NewKVStoreManager(keepOpen{largeDriver})
+}
+
+func BenchmarkIdAllocator_Open(b *testing.B) {
+	openLargeDb(b).Close()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		db := NewKVStoreManager(keepOpen{largeDriver})
+		id, _ := db.GetFreeId()
+
+		b.StopTimer()
+		_ = db.FreeId(id)
+		db.Close()
+		b.StartTimer()
+	}
+}
+
+func BenchmarkIdAllocator_GetFreeId(b *testing.B) {
+	db := openLargeDb(b)
+	defer db.Close()
+	for n := 0; n < b.N; n++ {
+		_, _ = db.GetFreeId()
+	}
+}
+
+func BenchmarkIdAllocator_FreeId(b *testing.B) {
+	db := openLargeDb(b)
+	defer db.Close()
+	for n := 0; n < b.N; n++ {
+		id, _ := db.GetFreeId()
+		_ = db.FreeId(id)
+	}
+}
+
+//endregion
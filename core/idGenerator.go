@@ -0,0 +1,403 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidNode indicates a Snowflake node number out of the range [0, SnowflakeMaxNode].
+	ErrInvalidNode = errors.New("the node number does not fit in a snowflake ID")
+
+	// SnowflakeEpoch is the origin of the timestamps of the IDs made by
+	// NewSnowflakeIdGenerator. Changing it for an existing store breaks their order.
+	SnowflakeEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// SnowflakeMaxNode is the largest node number of a Snowflake ID.
+const SnowflakeMaxNode = 1<<snowflakeNodeBits - 1
+
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+)
+
+// IdGenerator hands out the IDs of the records inserted in a table. Each table uses the
+// generator set with SetIdGenerator, or else the allocator shared by every table, which
+// reuses the IDs of deleted records.
+//
+// IDs must not contain the key delimiters (IdDelimiter, LinkDelimiter...). A generator
+// may serve several tables of a store and must be safe for concurrent use.
+type IdGenerator interface {
+
+	// NewIds returns n IDs never handed out before for the table. driver is the store,
+	// where the generator may record its state; these writes are not part of the
+	// transaction of the insertion.
+	NewIds(driver KVDriver, table string, n int) ([]string, error)
+
+	// Release is told the IDs of the deleted records of the table, and of the records
+	// never stored, e.g. by a rolled back transaction. Generators which never reuse an ID
+	// ignore it.
+	Release(driver KVDriver, table string, ids ...string) error
+
+	// Claim is told the IDs chosen by the caller for new records of the table, which the
+	// generator must not hand out anymore. Generators whose IDs can not collide with the
+	// chosen ones ignore it.
+	Claim(driver KVDriver, table string, ids ...string) error
+}
+
+// idGeneratorCloser is implemented by the generators recording a state to be saved when
+// the manager is closed.
+type idGeneratorCloser interface {
+	close() error
+}
+
+// setIdGenerator makes the value's table take the IDs of its new records from generator;
+// a nil generator restores the shared allocator.
+func (db *KVStoreManager) setIdGenerator(value any, generator IdGenerator) {
+
+	schema := db.schemaOf(value)
+
+	root := db.root()
+	root.m.Lock()
+	defer root.m.Unlock()
+
+	schema.idGenerator = generator
+}
+
+// idGenerator returns the generator of the table: the one set for it, or else the
+// shared allocator.
+func (db *KVStoreManager) idGenerator(table string) IdGenerator {
+
+	root := db.root()
+	root.m.Lock()
+	defer root.m.Unlock()
+
+	if schema, ok := root.schemas[table]; ok && schema.idGenerator != nil {
+		return schema.idGenerator
+	}
+
+	return root.ids
+}
+
+// idGenerators returns the generators set for the tables.
+func (db *KVStoreManager) idGenerators() []IdGenerator {
+
+	root := db.root()
+	root.m.Lock()
+	defer root.m.Unlock()
+
+	var generators []IdGenerator
+	for _, schema := range root.schemas {
+		if schema.idGenerator != nil {
+			generators = append(generators, schema.idGenerator)
+		}
+	}
+
+	return generators
+}
+
+//region Sequence
+
+// NewSequenceIdGenerator returns an IdGenerator handing out, per table, the integers in
+// increasing order, never reusing the ones of deleted records. Each sequence is recorded
+// in the tank keyspace, under TankIdSequence, and reserved by blocks of AutoIdBuffer
+// like the shared allocator; it starts after the largest integer ID of the table.
+func NewSequenceIdGenerator() IdGenerator {
+	return &sequenceIdGenerator{tables: make(map[string]*idAllocator)}
+}
+
+type sequenceIdGenerator struct {
+	tables map[string]*idAllocator
+	m      sync.Mutex
+}
+
+func (g *sequenceIdGenerator) NewIds(driver KVDriver, table string, n int) ([]string, error) {
+	return g.sequence(driver, table).take(n)
+}
+
+func (g *sequenceIdGenerator) Release(KVDriver, string, ...string) error {
+	return nil
+}
+
+func (g *sequenceIdGenerator) Claim(driver KVDriver, table string, ids ...string) error {
+	return g.sequence(driver, table).claim(ids...)
+}
+
+func (g *sequenceIdGenerator) sequence(driver KVDriver, table string) *idAllocator {
+
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	sequence, ok := g.tables[table]
+	if !ok {
+		sequence = newSequenceAllocator(driver, table)
+		g.tables[table] = sequence
+	}
+
+	return sequence
+}
+
+func (g *sequenceIdGenerator) close() error {
+
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var errs []error
+	for _, sequence := range g.tables {
+		errs = append(errs, sequence.close())
+	}
+
+	return errors.Join(errs...)
+}
+
+//endregion
+
+//region UUID
+
+// NewUUIDv4IdGenerator returns an IdGenerator of random UUIDs (RFC 9562, version 4), in
+// their canonical textual form.
+func NewUUIDv4IdGenerator() IdGenerator {
+	return uuidV4IdGenerator{}
+}
+
+type uuidV4IdGenerator struct{}
+
+func (uuidV4IdGenerator) NewIds(_ KVDriver, _ string, n int) ([]string, error) {
+
+	ids := make([]string, n)
+	for i := range ids {
+		var uuid [16]byte
+		if _, err := rand.Read(uuid[:]); err != nil {
+			return nil, err
+		}
+		uuid[6] = uuid[6]&0x0f | 0x40 // Version 4.
+		uuid[8] = uuid[8]&0x3f | 0x80 // RFC 9562 variant.
+		ids[i] = formatUUID(uuid)
+	}
+
+	return ids, nil
+}
+
+func (uuidV4IdGenerator) Release(KVDriver, string, ...string) error {
+	return nil
+}
+
+func (uuidV4IdGenerator) Claim(KVDriver, string, ...string) error {
+	return nil
+}
+
+// NewUUIDv7IdGenerator returns an IdGenerator of time-ordered UUIDs (RFC 9562, version 7)
+// in their canonical textual form. The 12 bits following the millisecond timestamp count
+// the IDs made within it, so that the IDs of a generator sort in the order they were made.
+func NewUUIDv7IdGenerator() IdGenerator {
+	return &uuidV7IdGenerator{}
+}
+
+type uuidV7IdGenerator struct {
+	clock monotonicClock
+}
+
+func (g *uuidV7IdGenerator) NewIds(_ KVDriver, _ string, n int) ([]string, error) {
+
+	ids := make([]string, n)
+	for i := range ids {
+		var uuid [16]byte
+		if _, err := rand.Read(uuid[8:]); err != nil {
+			return nil, err
+		}
+		millis, counter := g.clock.tick(time.Now().UnixMilli(), 12)
+		binary.BigEndian.PutUint64(uuid[:8], millis<<16|0x7000|counter) // Version 7.
+		uuid[8] = uuid[8]&0x3f | 0x80                                   // RFC 9562 variant.
+		ids[i] = formatUUID(uuid)
+	}
+
+	return ids, nil
+}
+
+func (g *uuidV7IdGenerator) Release(KVDriver, string, ...string) error {
+	return nil
+}
+
+func (g *uuidV7IdGenerator) Claim(KVDriver, string, ...string) error {
+	return nil
+}
+
+// formatUUID writes uuid in its canonical textual form, e.g.
+// 0190163d-8694-739b-aea5-966c26f8ad91.
+func formatUUID(uuid [16]byte) string {
+	var text [36]byte
+	hex.Encode(text[0:8], uuid[0:4])
+	text[8] = '-'
+	hex.Encode(text[9:13], uuid[4:6])
+	text[13] = '-'
+	hex.Encode(text[14:18], uuid[6:8])
+	text[18] = '-'
+	hex.Encode(text[19:23], uuid[8:10])
+	text[23] = '-'
+	hex.Encode(text[24:], uuid[10:])
+	return string(text[:])
+}
+
+//endregion
+
+//region ULID
+
+// crockfordBase32 is the alphabet of ULIDs, which sorts like the values it encodes.
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULIDIdGenerator returns an IdGenerator of ULIDs: 48 bits of millisecond timestamp
+// and 80 random bits, as 26 characters of Crockford's base32. Within a millisecond, the
+// random part is incremented, so that the IDs of a generator sort in the order they
+// were made.
+func NewULIDIdGenerator() IdGenerator {
+	return &ulidIdGenerator{}
+}
+
+type ulidIdGenerator struct {
+	last [16]byte
+	m    sync.Mutex
+}
+
+func (g *ulidIdGenerator) NewIds(_ KVDriver, _ string, n int) ([]string, error) {
+
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	ids := make([]string, n)
+	for i := range ids {
+		if err := g.next(uint64(time.Now().UnixMilli())); err != nil {
+			return nil, err
+		}
+		ids[i] = formatULID(g.last)
+	}
+
+	return ids, nil
+}
+
+// next sets last to the ULID following it at the given millisecond.
+func (g *ulidIdGenerator) next(millis uint64) error {
+
+	lastMillis := binary.BigEndian.Uint64(g.last[:8]) >> 16
+	if millis <= lastMillis {
+		// Increment the random part, or move to the next millisecond on overflow.
+		for i := 15; i >= 6; i-- {
+			g.last[i]++
+			if g.last[i] != 0 {
+				return nil
+			}
+		}
+		millis = lastMillis + 1
+	}
+
+	var ulid [16]byte
+	binary.BigEndian.PutUint64(ulid[:8], millis<<16)
+	if _, err := rand.Read(ulid[6:]); err != nil {
+		return err
+	}
+	g.last = ulid
+
+	return nil
+}
+
+func (g *ulidIdGenerator) Release(KVDriver, string, ...string) error {
+	return nil
+}
+
+func (g *ulidIdGenerator) Claim(KVDriver, string, ...string) error {
+	return nil
+}
+
+// formatULID encodes the 128 bits of ulid, most significant first, in 26 characters of
+// 5 bits, the first one only holding 3.
+func formatULID(ulid [16]byte) string {
+
+	high := binary.BigEndian.Uint64(ulid[:8])
+	low := binary.BigEndian.Uint64(ulid[8:])
+
+	var text [26]byte
+	for i := 25; i >= 0; i-- {
+		text[i] = crockfordBase32[low&0x1f]
+		low = low>>5 | high<<59
+		high >>= 5
+	}
+
+	return string(text[:])
+}
+
+//endregion
+
+//region Snowflake
+
+// NewSnowflakeIdGenerator returns an IdGenerator of Snowflake IDs: decimal 63-bit
+// integers made of 41 bits of milliseconds since SnowflakeEpoch, 10 bits of node and 12
+// bits counting the IDs made within the millisecond. They are ordered by time and unique
+// as long as every process inserting in the store uses its own node number.
+//
+// Possible Error:
+//   - ErrInvalidNode: If node is out of the range [0, SnowflakeMaxNode].
+func NewSnowflakeIdGenerator(node int) (IdGenerator, error) {
+
+	if node < 0 || node > SnowflakeMaxNode {
+		return nil, ErrInvalidNode
+	}
+
+	return &snowflakeIdGenerator{node: uint64(node)}, nil
+}
+
+type snowflakeIdGenerator struct {
+	node  uint64
+	clock monotonicClock
+}
+
+func (g *snowflakeIdGenerator) NewIds(_ KVDriver, _ string, n int) ([]string, error) {
+
+	ids := make([]string, n)
+	for i := range ids {
+		millis, sequence := g.clock.tick(time.Since(SnowflakeEpoch).Milliseconds(), snowflakeSequenceBits)
+		id := millis<<(snowflakeNodeBits+snowflakeSequenceBits) | g.node<<snowflakeSequenceBits | sequence
+		ids[i] = strconv.FormatUint(id, 10)
+	}
+
+	return ids, nil
+}
+
+func (g *snowflakeIdGenerator) Release(KVDriver, string, ...string) error {
+	return nil
+}
+
+func (g *snowflakeIdGenerator) Claim(KVDriver, string, ...string) error {
+	return nil
+}
+
+//endregion
+
+// monotonicClock numbers the events of each millisecond. When the wall clock goes back,
+// or a millisecond has no number left, it carries on from the following millisecond, so
+// the (millisecond, counter) pairs it returns are always increasing.
+type monotonicClock struct {
+	millis  uint64
+	counter uint64
+	m       sync.Mutex
+}
+
+// tick returns the millisecond and the counter of a new event at now, a counter taking
+// at most bits bits.
+func (c *monotonicClock) tick(now int64, bits int) (millis uint64, counter uint64) {
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if now > 0 && uint64(now) > c.millis {
+		c.millis, c.counter = uint64(now), 0
+	} else if c.counter++; c.counter >= 1<<bits {
+		c.millis, c.counter = c.millis+1, 0
+	}
+
+	return c.millis, c.counter
+}
@@ -0,0 +1,203 @@
+package core_test
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strconv"
+	"testing"
+
+	. "github.com/Phosmachina/FluentKV/core"
+)
+
+// checkOrderedIds checks that generator makes n distinct IDs, in increasing order.
+func checkOrderedIds(t *testing.T, generator IdGenerator, n int, less func(a, b string) bool) []string {
+
+	ids, err := generator.NewIds(nil, TableName[SimpleType](), n)
+	if err != nil {
+		t.Fatalf("NewIds failed: expected %v, got %v", nil, err)
+	}
+	for i := 1; i < len(ids); i++ {
+		if !less(ids[i-1], ids[i]) {
+			t.Fatalf("NewIds failed: expected %v before %v", ids[i-1], ids[i])
+		}
+	}
+
+	return ids
+}
+
+func TestSequenceIdGenerator(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	SetIdGenerator[SimpleType](db, NewSequenceIdGenerator())
+	other, _ := Insert(db, NewAnotherType("t3", 1.1))
+	for i := 0; i < 3; i++ {
+		_, _ = Insert(db, NewSimpleType("t1", "t2", i))
+	}
+	_ = Delete[SimpleType](db, "2")
+
+	// Act
+	next, err := Insert(db, NewSimpleType("t1", "t2", 3))
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Insert failed: expected %v, got %v", nil, err)
+	}
+	if next.Key().Id() != "3" {
+		t.Errorf("Insert failed: expected ID %v, got %v", 3, next.Key().Id())
+	}
+	if other.Key().Id() != "0" {
+		t.Errorf("Insert failed: expected ID %v from the shared allocator, got %v", 0, other.Key().Id())
+	}
+}
+
+func TestSequenceIdGenerator_StartsAfterExisting(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	for i := 0; i < 3; i++ {
+		_, _ = Insert(db, NewSimpleType("t1", "t2", i))
+	}
+	SetIdGenerator[SimpleType](db, NewSequenceIdGenerator())
+
+	// Act
+	next, _ := Insert(db, NewSimpleType("t1", "t2", 3))
+	restarted := NewKVStoreManager(db.KVDriver)
+	SetIdGenerator[SimpleType](restarted, NewSequenceIdGenerator())
+	afterRestart, _ := Insert(restarted, NewSimpleType("t1", "t2", 4))
+
+	// Assert
+	if next.Key().Id() != "3" {
+		t.Errorf("Insert failed: expected ID %v, got %v", 3, next.Key().Id())
+	}
+	if id, _ := strconv.Atoi(afterRestart.Key().Id()); id <= 3 {
+		t.Errorf("Insert failed: expected an ID above %v after restart, got %v", 3, id)
+	}
+}
+
+func TestSequenceIdGenerator_Rollback(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	SetIdGenerator[SimpleType](db, NewSequenceIdGenerator())
+	var rolledBack KVWrapper[SimpleType]
+	_ = WithTx(db, func(tx *KVStoreManager) error {
+		rolledBack, _ = Insert(tx, NewSimpleType("t1", "t2", 0))
+		return errors.New("rollback")
+	})
+
+	// Act
+	next, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+
+	// Assert
+	if next.Key().Id() == rolledBack.Key().Id() {
+		t.Errorf("Insert failed: ID %v handed out twice", next.Key().Id())
+	}
+}
+
+func TestUUIDv4IdGenerator(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	SetIdGenerator[SimpleType](db, NewUUIDv4IdGenerator())
+	format := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	// Act
+	inserted, err := Insert(db, NewSimpleType("t1", "t2", 1))
+	target, _ := Insert(db, NewAnotherType("t3", 1.1))
+	_ = Link(inserted, false, target)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Insert failed: expected %v, got %v", nil, err)
+	}
+	if !format.MatchString(inserted.Key().Id()) {
+		t.Errorf("Insert failed: expected a UUIDv4, got %v", inserted.Key().Id())
+	}
+	if stored, err := Get[SimpleType](db, inserted.Key().Id()); err != nil || stored.Value().Val != 1 {
+		t.Errorf("Get failed: expected %v, got %v (%v)", 1, stored.Value(), err)
+	}
+	if linked := CollectLinked[SimpleType, AnotherType](db, inserted.Key().Id()); len(linked) != 1 {
+		t.Errorf("CollectLinked failed: expected %d object, got %d", 1, len(linked))
+	}
+}
+
+func TestUUIDv7IdGenerator(t *testing.T) {
+
+	// Arrange
+	format := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	// Act
+	ids := checkOrderedIds(t, NewUUIDv7IdGenerator(), 10_000, func(a, b string) bool { return a < b })
+
+	// Assert
+	for _, id := range ids {
+		if !format.MatchString(id) {
+			t.Fatalf("NewIds failed: expected a UUIDv7, got %v", id)
+		}
+	}
+}
+
+func TestULIDIdGenerator(t *testing.T) {
+
+	// Arrange
+	format := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+
+	// Act
+	ids := checkOrderedIds(t, NewULIDIdGenerator(), 10_000, func(a, b string) bool { return a < b })
+
+	// Assert
+	for _, id := range ids {
+		if !format.MatchString(id) {
+			t.Fatalf("NewIds failed: expected a ULID, got %v", id)
+		}
+	}
+}
+
+func TestSnowflakeIdGenerator(t *testing.T) {
+
+	// Arrange
+	generator, err := NewSnowflakeIdGenerator(42)
+	if err != nil {
+		t.Fatalf("NewSnowflakeIdGenerator failed: expected %v, got %v", nil, err)
+	}
+	numeric := func(a, b string) bool {
+		x, _ := strconv.ParseUint(a, 10, 64)
+		y, _ := strconv.ParseUint(b, 10, 64)
+		return x < y
+	}
+
+	// Act
+	ids := checkOrderedIds(t, generator, 10_000, numeric)
+
+	// Assert
+	for _, id := range ids {
+		if value, _ := strconv.ParseUint(id, 10, 64); value>>12&SnowflakeMaxNode != 42 {
+			t.Fatalf("NewIds failed: expected node %v in %v", 42, id)
+		}
+	}
+	if _, err = NewSnowflakeIdGenerator(SnowflakeMaxNode + 1); !errors.Is(err, ErrInvalidNode) {
+		t.Errorf("NewSnowflakeIdGenerator failed: expected %v, got %v", ErrInvalidNode, err)
+	}
+}
+
+func TestSetIdGenerator_InsertMany(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	SetIdGenerator[SimpleType](db, NewULIDIdGenerator())
+	values := []*SimpleType{NewSimpleType("t1", "t2", 0), NewSimpleType("t1", "t2", 1)}
+
+	// Act
+	objs, err := InsertMany(db, values...)
+
+	// Assert
+	if err != nil || len(objs) != 2 {
+		t.Fatalf("InsertMany failed: expected %d objects, got %d (%v)", 2, len(objs), err)
+	}
+	ids := []string{objs[0].Key().Id(), objs[1].Key().Id()}
+	if !slices.IsSorted(ids) || len(ids[0]) != 26 {
+		t.Errorf("InsertMany failed: expected ordered ULIDs, got %v", ids)
+	}
+}
@@ -0,0 +1,426 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/Phosmachina/FluentKV/helper"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	// TagName is the struct tag holding the FluentKV options of a field, for example
+	// `fkv:"index"` to declare a secondary index on it, or `fkv:"unique"` to also
+	// forbid two records of the table to share its value.
+	TagName = "fkv"
+
+	// ErrUnknownIndex indicates a lookup on an index that is not declared for the table.
+	ErrUnknownIndex = errors.New("no index is declared with this name for the table")
+
+	// ErrDuplicateIndex indicates an attempt to declare an index twice for a table.
+	ErrDuplicateIndex = errors.New("an index with the same name is already declared for the table")
+)
+
+// ErrUniqueViolation is returned by a write which would give a unique field a value
+// already held by another record of the table.
+type ErrUniqueViolation struct {
+	// Field is the name of the violated unique index.
+	Field string
+
+	// Key identifies the record already holding the value.
+	Key *TableKey
+}
+
+func (e *ErrUniqueViolation) Error() string {
+	return fmt.Sprintf("the value of the unique field %s is already held by %s", e.Field, e.Key.Key())
+}
+
+// index describes a secondary index of a table: its name, the function extracting
+// the indexed value from a record and whether this value must be unique.
+type index struct {
+	name    string
+	extract func(value any) any
+	unique  bool
+
+	// tagged is set for the indexes declared by a struct tag, whose entries hold the
+	// field of their name as it is, unlike the extractors of AddIndex.
+	tagged bool
+}
+
+// tableSchema gathers what the manager knows about a table, beyond its records.
+type tableSchema struct {
+	indexes []index
+
+	// idGenerator hands out the IDs of the table, instead of the shared allocator.
+	idGenerator IdGenerator
+
+	// softDelete makes Delete and DeepDelete move the records of the table to the trash.
+	softDelete bool
+
+	// history keeps the former values of the records of the table when it is not nil.
+	history *HistoryPolicy
+}
+
+// indexNamed returns the index with the given name, or nil.
+func (s *tableSchema) indexNamed(name string) *index {
+	for i := range s.indexes {
+		if s.indexes[i].name == name {
+			return &s.indexes[i]
+		}
+	}
+	return nil
+}
+
+// newTableSchema builds the schema declared by the struct tags of the value's type.
+func newTableSchema(value any) *tableSchema {
+
+	schema := &tableSchema{}
+
+	t := reflect.TypeOf(value)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return schema
+	}
+
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || len(field.Index) != 1 {
+			continue
+		}
+		indexed, unique := false, false
+		for _, option := range strings.Split(field.Tag.Get(TagName), ",") {
+			switch strings.TrimSpace(option) {
+			case "index":
+				indexed = true
+			case "unique":
+				indexed, unique = true, true
+			}
+		}
+		if indexed {
+			schema.indexes = append(schema.indexes, index{
+				name:    field.Name,
+				extract: fieldExtractor(field.Index),
+				unique:  unique,
+				tagged:  true,
+			})
+		}
+	}
+
+	return schema
+}
+
+// fieldExtractor returns a function reading the field at the given index of a struct
+// value, whether it is stored by value or by pointer.
+func fieldExtractor(fieldIndex []int) func(value any) any {
+	return func(value any) any {
+		v := reflect.ValueOf(value)
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		return v.FieldByIndex(fieldIndex).Interface()
+	}
+}
+
+// schemaOf returns the schema of the value's table, building it from the struct tags
+// the first time the table is met.
+func (db *KVStoreManager) schemaOf(value any) *tableSchema {
+
+	root := db.root()
+	name := StructName(value)
+
+	root.m.Lock()
+	defer root.m.Unlock()
+
+	if root.schemas == nil {
+		root.schemas = make(map[string]*tableSchema)
+	}
+
+	schema, ok := root.schemas[name]
+	if !ok {
+		schema = newTableSchema(value)
+		root.schemas[name] = schema
+	}
+
+	return schema
+}
+
+// addIndex declares a new index on the value's table.
+func (db *KVStoreManager) addIndex(
+	value any,
+	name string,
+	unique bool,
+	extract func(value any) any,
+) error {
+
+	schema := db.schemaOf(value)
+
+	root := db.root()
+	root.m.Lock()
+	defer root.m.Unlock()
+
+	if schema.indexNamed(name) != nil {
+		return ErrDuplicateIndex
+	}
+	schema.indexes = append(schema.indexes, index{name: name, extract: extract, unique: unique})
+
+	return nil
+}
+
+// indexEntries computes the index entries of a record, along with the reservations of
+// its unique values.
+func (db *KVStoreManager) indexEntries(
+	tableKey *TableKey,
+	value *any,
+) (keys []*IndexKey, uniqueKeys []*UniqueKey) {
+
+	if value == nil {
+		return nil, nil
+	}
+
+	for _, idx := range db.schemaOf(*value).indexes {
+		indexed := idx.extract(*value)
+		keys = append(keys, NewIndexKey(tableKey.name, idx.name).
+			SetValue(indexed).
+			SetId(tableKey.id))
+		if idx.unique {
+			uniqueKeys = append(uniqueKeys, NewUniqueKey(tableKey.name, idx.name).
+				SetValue(indexed))
+		}
+	}
+
+	return keys, uniqueKeys
+}
+
+// updateIndexes brings the index entries of a record from oldValue to newValue: a nil
+// oldValue stands for an insertion and a nil newValue for a deletion.
+// It must be run in the transaction writing the record, which it makes fail with an
+// ErrUniqueViolation when a unique value of newValue is held by another record.
+func (db *KVStoreManager) updateIndexes(tableKey *TableKey, oldValue, newValue *any) error {
+
+	newKeys, newUniqueKeys := db.indexEntries(tableKey, newValue)
+	oldKeys, oldUniqueKeys := db.indexEntries(tableKey, oldValue)
+
+	kept := make(map[string]bool, len(newKeys)+len(newUniqueKeys))
+	for _, key := range newKeys {
+		kept[key.Key()] = true
+	}
+	for _, key := range newUniqueKeys {
+		kept[key.Key()] = true
+	}
+
+	for _, key := range oldKeys {
+		if kept[key.Key()] {
+			continue
+		}
+		if err := db.RawDelete(key); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	for _, key := range oldUniqueKeys {
+		if kept[key.Key()] {
+			continue
+		}
+		owner, err := db.RawGet(key)
+		if errors.Is(err, ErrNotFound) || err == nil && string(owner) != tableKey.id {
+			continue
+		}
+		if err == nil {
+			err = db.RawDelete(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := db.checkUnique(tableKey, newUniqueKeys); err != nil {
+		return err
+	}
+	for _, key := range newUniqueKeys {
+		if err := db.RawSet(key, []byte(tableKey.id)); err != nil {
+			return failedToSet(err)
+		}
+	}
+
+	for _, key := range newKeys {
+		if err := db.RawSet(key, nil); err != nil {
+			return failedToSet(err)
+		}
+	}
+
+	return nil
+}
+
+// checkUnique returns an ErrUniqueViolation when one of the unique values is reserved
+// by a record other than tableKey. Nothing is written, so that a record can be rejected
+// before any of its entries is.
+// A value reserved by a record which is gone or expired is free.
+func (db *KVStoreManager) checkUnique(tableKey *TableKey, uniqueKeys []*UniqueKey) error {
+
+	for _, key := range uniqueKeys {
+		owner, err := db.RawGet(key)
+		switch {
+		case errors.Is(err, ErrNotFound):
+		case err != nil:
+			return err
+		case string(owner) != tableKey.id:
+			ownerKey := NewProtoTableKey().SetId(string(owner)).setName(tableKey.name)
+			if db.exists(ownerKey) {
+				return &ErrUniqueViolation{Field: key.field, Key: ownerKey}
+			}
+		}
+	}
+
+	return nil
+}
+
+// FindBy uses the index named field of the table to find the records holding value,
+// without decoding the rest of the table.
+// It returns the matching keys and their decoded objects.
+//
+// The table's schema must be known, see schemaOf.
+func (db *KVStoreManager) FindBy(
+	tableKey *TableKey,
+	field string,
+	value any,
+) ([]*TableKey, []*any, error) {
+	return db.FindByCtx(context.Background(), tableKey, field, value)
+}
+
+// FindByCtx is FindBy with a context: the scan stops once ctx is done, returning
+// ctx.Err().
+func (db *KVStoreManager) FindByCtx(
+	ctx context.Context,
+	tableKey *TableKey,
+	field string,
+	value any,
+) ([]*TableKey, []*any, error) {
+
+	records, err := db.findBy(ctx, tableKey, field, value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return splitRecords(records)
+}
+
+// findBy is FindByCtx, returning whole records.
+func (db *KVStoreManager) findBy(
+	ctx context.Context,
+	tableKey *TableKey,
+	field string,
+	value any,
+) ([]storedRecord, error) {
+
+	var records []storedRecord
+
+	if !db.hasIndex(tableKey.name, field) {
+		return nil, ErrUnknownIndex
+	}
+
+	db.RawIterKey(NewIndexKey(tableKey.name, field).SetValue(value),
+		func(key IKey) (stop bool) {
+			if ctx.Err() != nil {
+				return true
+			}
+			recordKey := key.(*IndexKey).TableKey()
+
+			raw, err := db.RawGet(recordKey)
+			if err != nil {
+				return false
+			}
+			object, header, err := db.decode(raw)
+			if err != nil || !db.isLive(header, time.Now().UnixNano()) {
+				return false
+			}
+
+			records = append(records, storedRecord{key: recordKey, value: object, header: header})
+
+			return false
+		})
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// hasIndex reports whether an index with the given name is declared for the table.
+func (db *KVStoreManager) hasIndex(tableName string, name string) bool {
+
+	root := db.root()
+	root.m.Lock()
+	defer root.m.Unlock()
+
+	schema, ok := root.schemas[tableName]
+	return ok && schema.indexNamed(name) != nil
+}
+
+// hasFieldIndex reports whether the field of the table is indexed by a struct tag, so
+// that its index entries hold its values as they are.
+func (db *KVStoreManager) hasFieldIndex(tableName string, field string) bool {
+
+	root := db.root()
+	root.m.Lock()
+	defer root.m.Unlock()
+
+	schema, ok := root.schemas[tableName]
+	if !ok {
+		return false
+	}
+	idx := schema.indexNamed(field)
+	return idx != nil && idx.tagged
+}
+
+// Reindex rebuilds every index entry of the table from its records. It is needed when
+// an index is declared on a table which already holds records. The expired records, not
+// swept yet, are left out.
+// The entries are wiped and rebuilt in one transaction, so that the lookups never see
+// them partly rebuilt; a failure leaves them as they were.
+// It stops with an ErrUniqueViolation when two records share the value of a unique index.
+func (db *KVStoreManager) Reindex(tableKey *TableKey) error {
+	return db.ReindexCtx(context.Background(), tableKey)
+}
+
+// ReindexCtx is Reindex with a context: the rebuild stops once ctx is done, returning
+// ctx.Err(), and nothing is committed.
+func (db *KVStoreManager) ReindexCtx(ctx context.Context, tableKey *TableKey) error {
+
+	return db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
+
+		var stale []IKey
+		for _, prefix := range []IKey{NewIndexKey(tableKey.name, ""), NewUniqueKey(tableKey.name, "")} {
+			tx.RawIterKey(prefix, func(key IKey) (stop bool) {
+				stale = append(stale, key)
+				return false
+			})
+		}
+		for _, key := range stale {
+			if err := tx.RawDelete(key); err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+
+		var err error
+		now := time.Now().UnixNano()
+		tx.RawIterKV(tableKey, func(key IKey, raw []byte) (stop bool) {
+			if err = ctx.Err(); err != nil {
+				return true
+			}
+			object, header, decodeErr := tx.decode(raw)
+			if decodeErr != nil || !tx.isLive(header, now) {
+				return false
+			}
+			err = tx.updateIndexes(key.(*TableKey), nil, object)
+			return err != nil
+		})
+
+		return err
+	})
+}
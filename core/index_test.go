@@ -0,0 +1,275 @@
+package core_test
+
+import (
+	"encoding/gob"
+	"errors"
+	. "github.com/Phosmachina/FluentKV/core"
+	"testing"
+	"time"
+)
+
+type IndexedType struct {
+	Email string `fkv:"index"`
+	Name  string
+	Age   int
+}
+
+func NewIndexedType(email string, name string, age int) *IndexedType {
+	return &IndexedType{Email: email, Name: name, Age: age}
+}
+
+func prepareIndexedDb() *KVStoreManager {
+	gob.Register(IndexedType{})
+	return prepareTestableDb()
+}
+
+func countIndexEntries(db *KVStoreManager) int {
+	var ct int
+	db.RawIterKey(NewProtoIndexKey(), func(_ IKey) (stop bool) {
+		ct++
+		return false
+	})
+	return ct
+}
+
+func TestFindBy_TagIndex(t *testing.T) {
+
+	// Arrange
+	db := prepareIndexedDb()
+	_, _ = Insert(db, NewIndexedType("a@b.c", "a", 1))
+	expected, _ := Insert(db, NewIndexedType("d@e.f", "d", 2))
+	_, _ = Insert(db, NewIndexedType("g@h.i", "g", 3))
+
+	// Act
+	results, err := FindBy[IndexedType](db, "Email", "d@e.f")
+
+	// Assert
+	if err != nil {
+		t.Errorf("FindBy failed: expected %v, got %v", nil, err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("FindBy failed: expected %d result, got %d", 1, len(results))
+	}
+	if !results[0].Key().Equals(expected.Key()) || results[0].Value().Name != "d" {
+		t.Errorf("FindBy failed: expected %v, got %v", expected.Key(), results[0].Key())
+	}
+}
+
+func TestFindBy_ExtractorIndex(t *testing.T) {
+
+	// Arrange
+	db := prepareIndexedDb()
+	err := AddIndex(db, "Major", func(value *IndexedType) any {
+		return value.Age >= 18
+	})
+	_, _ = Insert(db, NewIndexedType("a@b.c", "a", 12))
+	_, _ = Insert(db, NewIndexedType("d@e.f", "d", 20))
+	_, _ = Insert(db, NewIndexedType("g@h.i", "g", 40))
+
+	// Act
+	results, _ := FindBy[IndexedType](db, "Major", true)
+
+	// Assert
+	if err != nil {
+		t.Errorf("AddIndex failed: expected %v, got %v", nil, err)
+	}
+	if len(results) != 2 {
+		t.Errorf("FindBy failed: expected %d results, got %d", 2, len(results))
+	}
+	if !errors.Is(AddIndex(db, "Major", func(value *IndexedType) any { return nil }),
+		ErrDuplicateIndex) {
+		t.Errorf("AddIndex failed: expected %v", ErrDuplicateIndex)
+	}
+}
+
+func TestFindBy_UnknownIndex(t *testing.T) {
+
+	// Arrange
+	db := prepareIndexedDb()
+
+	// Act
+	_, err := FindBy[IndexedType](db, "Name", "a")
+
+	// Assert
+	if !errors.Is(err, ErrUnknownIndex) {
+		t.Errorf("FindBy failed: expected %v, got %v", ErrUnknownIndex, err)
+	}
+}
+
+func TestIndex_KeptInSync(t *testing.T) {
+
+	// Arrange
+	db := prepareIndexedDb()
+	objWrp, _ := Insert(db, NewIndexedType("a@b.c", "a", 1))
+	other, _ := Insert(db, NewIndexedType("d@e.f", "d", 2))
+
+	// Act & Assert: Set
+	_, _ = Set(db, objWrp.Key().Id(), NewIndexedType("x@y.z", "a", 1))
+	if results, _ := FindBy[IndexedType](db, "Email", "a@b.c"); len(results) != 0 {
+		t.Error("Set failed: stale index entry")
+	}
+	if results, _ := FindBy[IndexedType](db, "Email", "x@y.z"); len(results) != 1 {
+		t.Error("Set failed: missing index entry")
+	}
+
+	// Act & Assert: Update
+	_, _ = Update(db, objWrp.Key().Id(), func(value *IndexedType) {
+		value.Email = "u@v.w"
+	})
+	if results, _ := FindBy[IndexedType](db, "Email", "x@y.z"); len(results) != 0 {
+		t.Error("Update failed: stale index entry")
+	}
+	if results, _ := FindBy[IndexedType](db, "Email", "u@v.w"); len(results) != 1 {
+		t.Error("Update failed: missing index entry")
+	}
+
+	// Act & Assert: Delete and DeepDelete
+	_ = Delete[IndexedType](db, objWrp.Key().Id())
+	_ = DeepDelete[IndexedType](db, other.Key().Id())
+	if ct := countIndexEntries(db); ct != 0 {
+		t.Errorf("Delete failed: expected %d index entries, got %d", 0, ct)
+	}
+}
+
+func TestReindex(t *testing.T) {
+
+	// Arrange
+	db := prepareIndexedDb()
+	_, _ = Insert(db, NewIndexedType("a@b.c", "a", 1))
+	_, _ = Insert(db, NewIndexedType("d@e.f", "a", 2))
+	_ = AddIndex(db, "Name", func(value *IndexedType) any { return value.Name })
+
+	// Act
+	before, _ := FindBy[IndexedType](db, "Name", "a")
+	err := Reindex[IndexedType](db)
+	after, _ := FindBy[IndexedType](db, "Name", "a")
+
+	// Assert
+	if err != nil {
+		t.Errorf("Reindex failed: expected %v, got %v", nil, err)
+	}
+	if len(before) != 0 || len(after) != 2 {
+		t.Errorf("Reindex failed: expected %d then %d results, got %d then %d",
+			0, 2, len(before), len(after))
+	}
+}
+
+func TestReindex_RollsBack(t *testing.T) {
+
+	// Arrange: a unique index declared over records sharing its value.
+	db := prepareIndexedDb()
+	_, _ = Insert(db, NewIndexedType("a@b.c", "a", 1))
+	_, _ = Insert(db, NewIndexedType("d@e.f", "a", 2))
+	_ = AddUniqueIndex(db, "Name", func(value *IndexedType) any { return value.Name })
+
+	// Act
+	err := Reindex[IndexedType](db)
+	found, _ := FindBy[IndexedType](db, "Email", "d@e.f")
+
+	// Assert
+	var violation *ErrUniqueViolation
+	if !errors.As(err, &violation) {
+		t.Errorf("Reindex failed: expected a unique violation, got %v", err)
+	}
+	if len(found) != 1 {
+		t.Errorf("FindBy failed: expected the index entries kept, got %v", found)
+	}
+}
+
+func TestReindex_SkipsExpired(t *testing.T) {
+
+	// Arrange
+	db := prepareIndexedDb()
+	_, _ = InsertWithTTL(db, NewIndexedType("a@b.c", "a", 1), 10*time.Millisecond)
+	_, _ = Insert(db, NewIndexedType("d@e.f", "a", 2))
+	time.Sleep(20 * time.Millisecond)
+
+	// Act
+	err := Reindex[IndexedType](db)
+
+	// Assert
+	if err != nil {
+		t.Errorf("Reindex failed: expected %v, got %v", nil, err)
+	}
+	if ct := countIndexEntries(db); ct != 1 {
+		t.Errorf("Reindex failed: expected %d index entry, got %d", 1, ct)
+	}
+}
+
+type UniqueType struct {
+	Email string `fkv:"unique"`
+	Name  string
+}
+
+func TestUnique_Insert(t *testing.T) {
+
+	// Arrange
+	gob.Register(UniqueType{})
+	db := prepareTestableDb()
+	first, _ := Insert(db, &UniqueType{Email: "a@b.c", Name: "first"})
+
+	// Act
+	_, err := Insert(db, &UniqueType{Email: "a@b.c", Name: "second"})
+
+	// Assert
+	var violation *ErrUniqueViolation
+	if !errors.As(err, &violation) {
+		t.Fatalf("Insert failed: expected %T, got %v", violation, err)
+	}
+	if violation.Field != "Email" || !violation.Key.Equals(first.Key()) {
+		t.Errorf("Unexpected violation: %v", violation)
+	}
+	if Count[UniqueType](db) != 1 {
+		t.Errorf("Insert failed: expected %d object, got %d", 1, Count[UniqueType](db))
+	}
+	if results, _ := FindBy[UniqueType](db, "Email", "a@b.c"); len(results) != 1 {
+		t.Errorf("Insert failed: expected %d indexed object, got %d", 1, len(results))
+	}
+}
+
+func TestUnique_Update(t *testing.T) {
+
+	// Arrange
+	gob.Register(UniqueType{})
+	db := prepareTestableDb()
+	_, _ = Insert(db, &UniqueType{Email: "a@b.c"})
+	second, _ := Insert(db, &UniqueType{Email: "d@e.f"})
+
+	// Act
+	_, errTaken := Update(db, second.Key().Id(), func(value *UniqueType) {
+		value.Email = "a@b.c"
+	})
+	_, errSame := Update(db, second.Key().Id(), func(value *UniqueType) {
+		value.Name = "renamed"
+	})
+	_, errSet := Set(db, second.Key().Id(), &UniqueType{Email: "a@b.c"})
+
+	// Assert
+	var violation *ErrUniqueViolation
+	if !errors.As(errTaken, &violation) || !errors.As(errSet, &violation) {
+		t.Errorf("Update failed: expected %T, got %v and %v", violation, errTaken, errSet)
+	}
+	if errSame != nil {
+		t.Errorf("Update failed: expected %v, got %v", nil, errSame)
+	}
+	if stored, _ := Get[UniqueType](db, second.Key().Id()); stored.Value().Email != "d@e.f" {
+		t.Errorf("Update failed: expected %v, got %v", "d@e.f", stored.Value().Email)
+	}
+}
+
+func TestUnique_DeleteReleasesValue(t *testing.T) {
+
+	// Arrange
+	gob.Register(UniqueType{})
+	db := prepareTestableDb()
+	first, _ := Insert(db, &UniqueType{Email: "a@b.c"})
+	_ = Delete[UniqueType](db, first.Key().Id())
+
+	// Act
+	_, err := Insert(db, &UniqueType{Email: "a@b.c"})
+
+	// Assert
+	if err != nil {
+		t.Errorf("Insert failed: expected %v, got %v", nil, err)
+	}
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"iter"
+	"time"
+)
+
+// All returns an iterator over the live records of the table of tableKey, in the order of
+// the driver. It streams from RawIterKV: each record is decoded when it is reached, and
+// breaking out of the loop stops the underlying iteration.
+func (db *KVStoreManager) All(tableKey *TableKey) iter.Seq2[*TableKey, *any] {
+	return db.AllCtx(context.Background(), tableKey)
+}
+
+// AllCtx is All with a context: the iteration stops once ctx is done, which the caller
+// tells with ctx.Err().
+func (db *KVStoreManager) AllCtx(ctx context.Context, tableKey *TableKey) iter.Seq2[*TableKey, *any] {
+	return func(yield func(*TableKey, *any) bool) {
+		for record := range db.records(ctx, tableKey, true) {
+			if !yield(record.key, record.value) {
+				return
+			}
+		}
+	}
+}
+
+// records returns an iterator over the live records of the table of tableKey. Their
+// value is only decoded when decode is set; the header always is.
+func (db *KVStoreManager) records(ctx context.Context, tableKey *TableKey, decode bool) iter.Seq[storedRecord] {
+	return func(yield func(storedRecord) bool) {
+
+		now := time.Now().UnixNano()
+		db.RawIterKV(tableKey, func(key IKey, raw []byte) (stop bool) {
+			if ctx.Err() != nil {
+				return true
+			}
+			header, payload, err := decodeRecord(raw)
+			if err != nil || !db.isLive(header, now) {
+				return false
+			}
+			record := storedRecord{key: key.(*TableKey), header: header}
+			if decode {
+				if record.value, err = db.marshaller.Decode(payload); err != nil {
+					return false
+				}
+			}
+			return !yield(record)
+		})
+	}
+}
+
+// linked returns an iterator over the records current links to in the table of target.
+// The links are scanned as the iteration goes, and each record is read when reached.
+func (db *KVStoreManager) linked(ctx context.Context, current *TableKey, target *TableKey) iter.Seq[storedRecord] {
+	return func(yield func(storedRecord) bool) {
+
+		db.RawIterKey(NewLinkKey(current, target), func(key IKey) (stop bool) {
+			if ctx.Err() != nil {
+				return true
+			}
+			record, err := db.get(ctx, key.(*LinkKey).targetTableKey)
+			if err != nil {
+				return false
+			}
+			return !yield(record)
+		})
+	}
+}
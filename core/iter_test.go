@@ -0,0 +1,117 @@
+package core_test
+
+import (
+	"slices"
+	"testing"
+
+	. "github.com/Phosmachina/FluentKV/core"
+)
+
+func prepareIterDb() *KVStoreManager {
+	db := prepareMemoryDb() // Iterates in key order.
+	for i, id := range []string{"10", "1", "2"} {
+		_, _ = InsertWithId(db, id, NewSimpleType("t1", "t2", i))
+	}
+	_, _ = InsertWithId(db, "0", NewAnotherType("t3", 1.1))
+	return db
+}
+
+func TestAll(t *testing.T) {
+
+	// Arrange
+	db := prepareIterDb()
+
+	// Act
+	var ids []string
+	var values []int
+	for key, value := range All[SimpleType](db) {
+		ids = append(ids, key.Id())
+		values = append(values, value.Val)
+	}
+
+	// Assert
+	if expected := []string{"1", "2", "10"}; !slices.Equal(ids, expected) {
+		t.Errorf("All failed: expected %v, got %v", expected, ids)
+	}
+	if expected := []int{1, 2, 0}; !slices.Equal(values, expected) {
+		t.Errorf("All failed: expected %v, got %v", expected, values)
+	}
+}
+
+func TestAll_Break(t *testing.T) {
+
+	// Arrange
+	db := prepareIterDb()
+
+	// Act: the store is written within the loop, and after breaking out of it.
+	ct := 0
+	for key := range Keys[SimpleType](db) {
+		ct++
+		if _, err := Set(db, key.Id(), NewSimpleType("t1", "t2", 42)); err != nil {
+			t.Errorf("Set failed: expected %v, got %v", nil, err)
+		}
+		break
+	}
+	_, err := Insert(db, NewSimpleType("t1", "t2", 3))
+
+	// Assert
+	if ct != 1 {
+		t.Errorf("Keys failed: expected %d iteration, got %d", 1, ct)
+	}
+	if err != nil {
+		t.Errorf("Insert failed: expected %v, got %v", nil, err)
+	}
+	if first, _ := Get[SimpleType](db, "1"); first.Value().Val != 42 {
+		t.Errorf("Set failed: expected %d, got %d", 42, first.Value().Val)
+	}
+}
+
+func TestValues(t *testing.T) {
+
+	// Arrange
+	db := prepareIterDb()
+
+	// Act
+	values := slices.Collect(Values[SimpleType](db))
+	keys := slices.Collect(Keys[AnotherType](db))
+
+	// Assert
+	if len(values) != 3 || values[0].Val != 1 {
+		t.Errorf("Values failed: expected %d objects, got %v", 3, values)
+	}
+	if len(keys) != 1 || keys[0].Id() != "0" {
+		t.Errorf("Keys failed: expected %v, got %v", []string{"0"}, keys)
+	}
+}
+
+func TestLinked(t *testing.T) {
+
+	// Arrange
+	db := prepareIterDb()
+	current, _ := Get[AnotherType](db, "0")
+	first, _ := Get[SimpleType](db, "1")
+	second, _ := Get[SimpleType](db, "10")
+	_ = Link(current, false, first, second)
+
+	// Act
+	var ids []string
+	for key, value := range LinkedWrp[AnotherType, SimpleType](current) {
+		ids = append(ids, key.Id())
+		if value.T1 != "t1" {
+			t.Errorf("Linked failed: expected %v, got %v", "t1", value.T1)
+		}
+	}
+	ct := 0
+	for range Linked[AnotherType, SimpleType](db, "0") {
+		ct++
+		break
+	}
+
+	// Assert
+	if expected := []string{"1", "10"}; !slices.Equal(ids, expected) {
+		t.Errorf("Linked failed: expected %v, got %v", expected, ids)
+	}
+	if ct != 1 {
+		t.Errorf("Linked failed: expected %d iteration, got %d", 1, ct)
+	}
+}
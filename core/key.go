@@ -1,7 +1,11 @@
 package core
 
 import (
+	"encoding/hex"
+	"fmt"
 	"github.com/Phosmachina/FluentKV/helper"
+	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -18,6 +22,27 @@ var (
 	// PrefixLink denotes a relationship or link between two entities.
 	PrefixLink = "lnk" + PrefixDelimiter
 
+	// PrefixLinkReverse denotes the reverse index of links, grouped by their target.
+	PrefixLinkReverse = "rlk" + PrefixDelimiter
+
+	// PrefixIndex denotes the entries of secondary indexes on table fields.
+	PrefixIndex = "idx" + PrefixDelimiter
+
+	// PrefixUnique denotes the entries reserving the values of unique table fields.
+	PrefixUnique = "unq" + PrefixDelimiter
+
+	// PrefixTrash denotes the records moved to the trash by a soft delete, keyed like the
+	// table entries they come from.
+	PrefixTrash = "trs" + PrefixDelimiter
+
+	// PrefixRevision denotes the former values of the records kept by the history of
+	// their table.
+	PrefixRevision = "rev" + PrefixDelimiter
+
+	// PrefixExpiry denotes the entries scheduling the expiry of the records having a
+	// time-to-live.
+	PrefixExpiry = "exp" + PrefixDelimiter
+
 	// PrefixDelimiter acts as a general separator for domain-related prefixes.
 	PrefixDelimiter = "%"
 
@@ -27,11 +52,41 @@ var (
 	// LinkDelimiter separates two references for a link definition.
 	LinkDelimiter = "@"
 
+	// IndexDelimiter separates the field, the indexed value and the ID within an index key.
+	IndexDelimiter = "@"
+
+	// NumericIdMarker starts the order-preserving form of the decimal IDs within keys, see
+	// TableKey.Key. The IDs starting with it are escaped by doubling it.
+	NumericIdMarker = "#"
+
 	// PrefixTankAvailableIds marks entries for available IDs within the "tank" domain concept.
 	PrefixTankAvailableIds = PrefixTank + "avlbId" + IdDelimiter
 
 	// PrefixTankUsedIds marks entries for used IDs within the "tank" domain concept.
 	PrefixTankUsedIds = PrefixTank + "usedId" + IdDelimiter
+
+	// TankLayoutVersion names the tank entry holding the version of the key layout.
+	TankLayoutVersion = "layoutVersion"
+
+	// TankMigrationCursor names the tank entry holding how far the running step of
+	// Migrate went, so that an interrupted migration resumes there.
+	TankMigrationCursor = "migrationCursor"
+
+	// TankIdHighWater names the tank entry holding the high-water mark of the
+	// auto-generated IDs: no ID at or above it has been handed out.
+	TankIdHighWater = "idHighWater"
+
+	// TankIdSequence prefixes the names of the tank entries holding the high-water mark
+	// of the sequence of a table, followed by IdDelimiter and the table name.
+	TankIdSequence = "idSequence"
+
+	// TankRevisionNumber prefixes the names of the tank entries holding the number of the
+	// last revision of a record, followed by IdDelimiter and the base of its TableKey.
+	TankRevisionNumber = "revisionNumber"
+
+	// TankIdFreePages names the tank entry holding the number of pages of the free list
+	// of IDs, each page being stored under a TankAvailableKey.
+	TankIdFreePages = "idFreePages"
 )
 
 // IKey describes the capabilities required for a structured key,
@@ -45,22 +100,50 @@ type IKey interface {
 
 // NewKeyFromString inspects a plain string and produces an IKey that
 // aligns with one of the known domain concepts (tank availability, tank usage,
-// table reference, or link reference).
+// table reference, link reference, index, unique, trash, revision or expiry entry).
 // If the input key does not match any expected prefix, this function returns nil.
 func NewKeyFromString(key string) IKey {
 
+	var parsed IKey
 	switch {
 	case strings.HasPrefix(key, PrefixTankAvailableIds):
-		return NewTankAvailableKeyFromString(key)
+		parsed = NewTankAvailableKeyFromString(key)
 	case strings.HasPrefix(key, PrefixTankUsedIds):
-		return NewTankUsedKeyFromString(key)
+		parsed = NewTankUsedKeyFromString(key)
+	case strings.HasPrefix(key, PrefixTank):
+		parsed = NewTankKeyFromString(key)
 	case strings.HasPrefix(key, PrefixTable):
-		return NewTableKeyFromString(key)
-	case strings.HasPrefix(key, PrefixLink):
-		return NewLinkKeyFromString(key)
+		parsed = NewTableKeyFromString(key)
+	case strings.HasPrefix(key, PrefixLink), strings.HasPrefix(key, PrefixLinkReverse):
+		parsed = NewLinkKeyFromString(key)
+	case strings.HasPrefix(key, PrefixIndex):
+		parsed = NewIndexKeyFromString(key)
+	case strings.HasPrefix(key, PrefixUnique):
+		parsed = NewUniqueKeyFromString(key)
+	case strings.HasPrefix(key, PrefixTrash):
+		parsed = NewTrashKeyFromString(key)
+	case strings.HasPrefix(key, PrefixRevision):
+		parsed = NewRevisionKeyFromString(key)
+	case strings.HasPrefix(key, PrefixExpiry):
+		parsed = NewExpiryKeyFromString(key)
+	default:
+		return nil
 	}
 
-	return nil
+	if k, ok := parsed.(interface{ base() *baseKey }); ok {
+		k.base().source = key
+	}
+	return parsed
+}
+
+// sourceOf returns the string key was parsed from by NewKeyFromString, as it is stored,
+// which differs from Key for the entries written by a previous layout, see Migrate. It
+// is Key for the keys built otherwise.
+func sourceOf(key IKey) string {
+	if k, ok := key.(interface{ base() *baseKey }); ok && k.base().source != "" {
+		return k.base().source
+	}
+	return key.Key()
 }
 
 // baseKey provides underlying shared functionality for deriving prefix and
@@ -68,6 +151,7 @@ func NewKeyFromString(key string) IKey {
 // It can be embedded into higher-level key types.
 type baseKey struct {
 	IKey
+	source string
 }
 
 // newBaseKey embeds an existing IKey into a baseKey, centralizing raw access methods.
@@ -77,6 +161,10 @@ func newBaseKey(key IKey) *baseKey {
 	return k
 }
 
+func (b *baseKey) base() *baseKey {
+	return b
+}
+
 // RawPrefix returns the prefix portion in byte form.
 // This aids in low-level handling or comparison of prefix data.
 func (b *baseKey) RawPrefix() []byte {
@@ -109,14 +197,115 @@ func (k *KeyWithId) Id() string {
 	return k.id
 }
 
+// maxNumericIdDigits is the number of digits of the longest decimal ID written in the
+// order-preserving form, one letter per number of digits.
+const maxNumericIdDigits = 26
+
+// encodeId gives the representation of an ID within a key. Decimal IDs without leading
+// zero are prefixed with NumericIdMarker and a letter counting their digits, 'a' for one,
+// so that they sort by value. IDs starting with NumericIdMarker are escaped by doubling
+// it; the others are written as they are.
+func encodeId(id string) string {
+
+	switch {
+	case isNumericId(id):
+		return NumericIdMarker + string(rune('a'+len(id)-1)) + id
+	case strings.HasPrefix(id, NumericIdMarker):
+		return NumericIdMarker + id
+	}
+
+	return id
+}
+
+// decodeId gives back the ID written by encodeId. The IDs of the keys written before
+// the order-preserving form, see Migrate, are read as they are.
+func decodeId(encoded string) string {
+
+	after, found := strings.CutPrefix(encoded, NumericIdMarker)
+	switch {
+	case !found:
+		return encoded
+	case strings.HasPrefix(after, NumericIdMarker):
+		return after
+	case len(after) > 1 && int(after[0])-'a'+1 == len(after)-1 && isNumericId(after[1:]):
+		return after[1:]
+	}
+
+	return encoded
+}
+
+// isNumericId reports whether id is a decimal number without leading zero, short enough
+// for the order-preserving form.
+func isNumericId(id string) bool {
+
+	if len(id) == 0 || len(id) > maxNumericIdDigits || len(id) > 1 && id[0] == '0' {
+		return false
+	}
+	for i := range len(id) {
+		if id[i] < '0' || id[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+//region TankKey
+
+// TankKey addresses a named entry of the "tank" domain, holding internal bookkeeping
+// such as the version of the key layout.
+type TankKey struct {
+	*baseKey
+	name string
+}
+
+// NewTankKey creates the key of the named tank entry.
+func NewTankKey(name string) *TankKey {
+	key := &TankKey{name: name}
+	key.baseKey = newBaseKey(key)
+	return key
+}
+
+// NewTankKeyFromString extracts the name of a tank entry from a raw string.
+func NewTankKeyFromString(key string) *TankKey {
+	name, _ := strings.CutPrefix(key, PrefixTank)
+	return NewTankKey(name)
+}
+
+// Name returns the name of the tank entry.
+func (t *TankKey) Name() string {
+	return t.name
+}
+
+// Prefix references the "tank" domain.
+func (t *TankKey) Prefix() string {
+	return PrefixTank
+}
+
+// Key merges the domain prefix with the name of the entry.
+func (t *TankKey) Key() string {
+	return t.Prefix() + t.name
+}
+
+//endregion
+
 //region TankAvailableKey
 
 // TankAvailableKey addresses the concept of "available IDs" in a "tank" domain.
-// It embeds the idea of an identifier within a specialized structure.
+// It embeds the idea of an identifier within a specialized structure: the number of a
+// page of the free list, holding a batch of available IDs.
 type TankAvailableKey struct {
 	*KeyWithId
 }
 
+// NewTankAvailableKey creates the key of the given page of the free list.
+func NewTankAvailableKey(id string) *TankAvailableKey {
+	availableKey := &TankAvailableKey{}
+	availableKey.KeyWithId = newKeyWithId(availableKey)
+	availableKey.id = id
+	return availableKey
+}
+
 // NewTankAvailableKeyFromString constructs a key object, extracting the ID
 // from a raw string that reflects the "available ID" domain concept.
 func NewTankAvailableKeyFromString(key string) *TankAvailableKey {
@@ -212,7 +401,7 @@ func NewTableKeyFromString(key string) *TableKey {
 	tableName, id, found := strings.Cut(after, IdDelimiter)
 	tableKey.name = tableName
 	if found {
-		tableKey.id = id
+		tableKey.id = decodeId(id)
 	}
 
 	return tableKey
@@ -239,6 +428,12 @@ func (k *TableKey) Name() string {
 	return k.name
 }
 
+// setName assigns the table name of a TableKey.
+func (k *TableKey) setName(name string) *TableKey {
+	k.name = name
+	return k
+}
+
 // SetId assigns an identifier to a TableKey, enabling customization for
 // specific data entries or usage scenarios.
 func (k *TableKey) SetId(id string) *TableKey {
@@ -260,14 +455,18 @@ func (k *TableKey) Prefix() string {
 
 // Key merges the domain prefix with a particular identifier, reflecting a
 // complete definition of a table-based key.
+//
+// Decimal IDs are written in an order-preserving form, so that the keys of a table sort
+// by ID: 2 is written #a2 and comes before 10, written #b10 (see encodeId).
 func (k *TableKey) Key() string {
-	return k.Prefix() + k.id
+	return k.Prefix() + encodeId(k.id)
 }
 
 // Base returns a concise representation of the table name and ID,
 // useful for referencing combined pieces of TableKey logic in other contexts.
+// The ID is written as within Key.
 func (k *TableKey) Base() string {
-	return k.name + IdDelimiter + k.id
+	return k.name + IdDelimiter + encodeId(k.id)
 }
 
 // Equals determines whether two TableKeys share the same conceptual table name
@@ -282,10 +481,15 @@ func (k *TableKey) Equals(key *TableKey) bool {
 
 // LinkKey defines a conceptual link between two table domains (each represented by a TableKey).
 // It is a convenient abstraction for referencing a relationship between entities.
+//
+// A link is stored twice: under PrefixLink, grouped by its current side, and under
+// PrefixLinkReverse, grouped by its target side. Both groups can therefore be scanned
+// with a prefix, at a cost proportional to the number of links of the object.
 type LinkKey struct {
 	*baseKey
 	currentTableKey *TableKey
 	targetTableKey  *TableKey
+	reverse         bool
 }
 
 // NewProtoLinkKey returns an initially empty LinkKey instance, allowing
@@ -299,21 +503,34 @@ func NewProtoLinkKey() *LinkKey {
 
 // NewLinkKeyFromString parses a raw string to discern two separate TableKey
 // references, forming a LinkKey that holds a conceptual relationship between them.
+// Entries of the reverse index are recognized and give back a reverse LinkKey.
 // If parsing fails, a proto LinkKey is returned without set references.
 func NewLinkKeyFromString(key string) *LinkKey {
 
-	base, _ := strings.CutPrefix(key, PrefixLink)
+	base, reverse := strings.CutPrefix(key, PrefixLinkReverse)
+	if !reverse {
+		base, _ = strings.CutPrefix(key, PrefixLink)
+	}
 
 	links := strings.Split(base, LinkDelimiter)
 	if len(links) != 2 {
 		return NewProtoLinkKey()
 	}
 
-	return NewLinkKey(NewTableKeyFromString(links[0]), NewTableKeyFromString(links[1]))
+	first := NewTableKeyFromString(PrefixTable + links[0])
+	second := NewTableKeyFromString(PrefixTable + links[1])
+	if reverse {
+		return NewLinkKey(second, first).Reverse()
+	}
+
+	return NewLinkKey(first, second)
 }
 
 // NewLinkKey merges two TableKeys (current and target) to establish a single
 // LinkKey entity. This abstracts a domain-specific relationship.
+//
+// Either side may be partial to scan links: a nil target covers every link of current,
+// and a target without ID covers its links towards the target's table.
 func NewLinkKey(current *TableKey, target *TableKey) *LinkKey {
 
 	key := NewProtoLinkKey()
@@ -335,19 +552,463 @@ func (l *LinkKey) TargetTableKey() *TableKey {
 	return l.targetTableKey
 }
 
-// Prefix obtains the conceptual marker for links, leaving room for optional
-// customization if different partitions are needed for relationship tracking.
+// IsReverse reports whether this key addresses the reverse index entry of the link.
+func (l *LinkKey) IsReverse() bool {
+	return l.reverse
+}
+
+// Reverse returns the key of the reverse index entry of the same link, grouped by
+// its target side. On a partial key, it allows scanning the links towards the target:
+// NewLinkKey(nil, target).Reverse() covers every link pointing to target.
+func (l *LinkKey) Reverse() *LinkKey {
+	key := NewLinkKey(l.currentTableKey, l.targetTableKey)
+	key.reverse = true
+	return key
+}
+
+// Forward returns the key of the main entry of the same link.
+func (l *LinkKey) Forward() *LinkKey {
+	return NewLinkKey(l.currentTableKey, l.targetTableKey)
+}
+
+// sides returns the domain prefix and both sides of the link, in storage order.
+func (l *LinkKey) sides() (prefix string, first *TableKey, second *TableKey) {
+	if l.reverse {
+		return PrefixLinkReverse, l.targetTableKey, l.currentTableKey
+	}
+	return PrefixLink, l.currentTableKey, l.targetTableKey
+}
+
+// Prefix narrows down as the sides get set: the domain prefix alone, then all the links
+// of the first side, then its links towards the table of the second side.
 func (l *LinkKey) Prefix() string {
-	return PrefixLink
+
+	prefix, first, second := l.sides()
+
+	switch {
+	case first == nil:
+		return prefix
+	case second == nil:
+		return prefix + first.Base() + LinkDelimiter
+	}
+
+	return prefix + first.Base() + LinkDelimiter + second.name + IdDelimiter
 }
 
 // Key constructs the complete representation of a link, merging
 // the two TableKeys' base data with an internal delimiter to convey the relationship.
+// A partial key has no complete representation and gives its prefix.
 func (l *LinkKey) Key() string {
-	return l.Prefix() +
-		l.currentTableKey.Base() +
-		LinkDelimiter +
-		l.targetTableKey.Base()
+	prefix, first, second := l.sides()
+	if first == nil || second == nil {
+		return l.Prefix()
+	}
+	return prefix + first.Base() + LinkDelimiter + second.Base()
+}
+
+//endregion
+
+//region IndexKey
+
+// IndexKey references one entry of a secondary index: the record identified by the ID
+// holds the indexed value in the field of its table.
+//
+// The value is hex encoded, so that any value can be embedded in the key.
+type IndexKey struct {
+	*KeyWithId
+	name     string
+	field    string
+	value    string
+	hasValue bool
+}
+
+// NewProtoIndexKey returns an empty IndexKey, whose prefix covers every index entry.
+func NewProtoIndexKey() *IndexKey {
+	key := &IndexKey{}
+	key.KeyWithId = newKeyWithId(key)
+	return key
+}
+
+// NewIndexKey creates an IndexKey for the index on the given field of a table.
+// Without value, its prefix covers every entry of this index.
+func NewIndexKey(tableName string, field string) *IndexKey {
+	key := NewProtoIndexKey()
+	key.name = tableName
+	key.field = field
+	return key
+}
+
+// NewIndexKeyFromString parses a raw string to populate an IndexKey with its table name,
+// field, encoded value and ID. The missing parts remain unset.
+func NewIndexKeyFromString(key string) *IndexKey {
+
+	indexKey := NewProtoIndexKey()
+
+	after, _ := strings.CutPrefix(key, PrefixIndex)
+	tableName, after, found := strings.Cut(after, IdDelimiter)
+	indexKey.name = tableName
+	if !found {
+		return indexKey
+	}
+
+	indexKey.field, after, found = strings.Cut(after, IndexDelimiter)
+	if !found {
+		return indexKey
+	}
+
+	var id string
+	indexKey.value, id, indexKey.hasValue = strings.Cut(after, IndexDelimiter)
+	indexKey.id = decodeId(id)
+
+	return indexKey
+}
+
+// Name returns the name of the indexed table.
+func (k *IndexKey) Name() string {
+	return k.name
+}
+
+// Field returns the name of the index, which is the indexed field for tag-declared indexes.
+func (k *IndexKey) Field() string {
+	return k.field
+}
+
+// SetValue assigns the indexed value, narrowing the prefix to the entries holding it.
+func (k *IndexKey) SetValue(value any) *IndexKey {
+	k.value = encodeIndexValue(value)
+	k.hasValue = true
+	return k
+}
+
+// SetId assigns the ID of the record referenced by this entry.
+func (k *IndexKey) SetId(id string) *IndexKey {
+	k.id = id
+	return k
+}
+
+// TableKey returns the key of the record referenced by this entry.
+func (k *IndexKey) TableKey() *TableKey {
+	key := NewProtoTableKey().SetId(k.id)
+	key.name = k.name
+	return key
+}
+
+// Prefix narrows down as the table name, field and value get set, so that it can be
+// used to scan a whole table's indexes, a single index or the entries of one value.
+func (k *IndexKey) Prefix() string {
+
+	switch {
+	case len(k.name) == 0:
+		return PrefixIndex
+	case len(k.field) == 0:
+		return PrefixIndex + k.name + IdDelimiter
+	case !k.hasValue:
+		return PrefixIndex + k.name + IdDelimiter + k.field + IndexDelimiter
+	}
+
+	return PrefixIndex + k.name + IdDelimiter + k.field + IndexDelimiter +
+		k.value + IndexDelimiter
+}
+
+// Key merges the prefix with the ID of the referenced record, written as within
+// TableKey.Key.
+func (k *IndexKey) Key() string {
+	return k.Prefix() + encodeId(k.id)
+}
+
+//endregion
+
+//region UniqueKey
+
+// UniqueKey reserves a value of a unique field: there is at most one per table, field and
+// value, and it holds the ID of the record owning the value.
+type UniqueKey struct {
+	*baseKey
+	name     string
+	field    string
+	value    string
+	hasValue bool
+}
+
+// NewProtoUniqueKey returns an empty UniqueKey, whose prefix covers every unique entry.
+func NewProtoUniqueKey() *UniqueKey {
+	key := &UniqueKey{}
+	key.baseKey = newBaseKey(key)
+	return key
+}
+
+// NewUniqueKey creates a UniqueKey for the unique field of a table.
+// Without value, its prefix covers every value reserved for this field.
+func NewUniqueKey(tableName string, field string) *UniqueKey {
+	key := NewProtoUniqueKey()
+	key.name = tableName
+	key.field = field
+	return key
+}
+
+// NewUniqueKeyFromString parses a raw string to populate a UniqueKey with its table name,
+// field and encoded value. The missing parts remain unset.
+func NewUniqueKeyFromString(key string) *UniqueKey {
+
+	uniqueKey := NewProtoUniqueKey()
+
+	after, _ := strings.CutPrefix(key, PrefixUnique)
+	tableName, after, found := strings.Cut(after, IdDelimiter)
+	uniqueKey.name = tableName
+	if !found {
+		return uniqueKey
+	}
+
+	uniqueKey.field, uniqueKey.value, uniqueKey.hasValue = strings.Cut(after, IndexDelimiter)
+
+	return uniqueKey
+}
+
+// Name returns the name of the table.
+func (k *UniqueKey) Name() string {
+	return k.name
+}
+
+// Field returns the name of the unique index.
+func (k *UniqueKey) Field() string {
+	return k.field
+}
+
+// SetValue assigns the reserved value.
+func (k *UniqueKey) SetValue(value any) *UniqueKey {
+	k.value = encodeIndexValue(value)
+	k.hasValue = true
+	return k
+}
+
+// Prefix narrows down as the table name and field get set.
+func (k *UniqueKey) Prefix() string {
+
+	switch {
+	case len(k.name) == 0:
+		return PrefixUnique
+	case len(k.field) == 0:
+		return PrefixUnique + k.name + IdDelimiter
+	}
+
+	return PrefixUnique + k.name + IdDelimiter + k.field + IndexDelimiter
+}
+
+// Key merges the prefix with the reserved value.
+func (k *UniqueKey) Key() string {
+	return k.Prefix() + k.value
+}
+
+// encodeIndexValue gives the representation of a value within an index key; pointers
+// are dereferenced so that a value and a pointer to it share the same entries.
+func encodeIndexValue(value any) string {
+
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	if !v.IsValid() || v.Kind() == reflect.Pointer {
+		return ""
+	}
+
+	return hex.EncodeToString([]byte(fmt.Sprint(v.Interface())))
+}
+
+//endregion
+
+//region TrashKey
+
+// TrashKey addresses a record in the trash. It holds the table name and ID of the record,
+// whose key is given back by TableKey.
+type TrashKey struct {
+	*KeyWithId
+	name string
+}
+
+// NewTrashKey creates the key of the record of tableKey in the trash. Without ID, its
+// prefix covers the trashed records of the table, and without name every one of them.
+func NewTrashKey(tableKey *TableKey) *TrashKey {
+	key := &TrashKey{name: tableKey.name}
+	key.KeyWithId = newKeyWithId(key)
+	key.id = tableKey.id
+	return key
+}
+
+// NewTrashKeyFromString parses a raw string to populate a TrashKey with its table name and
+// ID. If the table name or ID is missing, they remain unset.
+func NewTrashKeyFromString(key string) *TrashKey {
+	after, _ := strings.CutPrefix(key, PrefixTrash)
+	return NewTrashKey(NewTableKeyFromString(PrefixTable + after))
+}
+
+// Name returns the name of the table of the record.
+func (k *TrashKey) Name() string {
+	return k.name
+}
+
+// TableKey returns the key of the record outside the trash.
+func (k *TrashKey) TableKey() *TableKey {
+	return NewProtoTableKey().setName(k.name).SetId(k.id)
+}
+
+// Prefix references the "trash" domain, narrowed down to the table once it is set.
+func (k *TrashKey) Prefix() string {
+
+	if len(k.name) == 0 {
+		return PrefixTrash
+	}
+
+	return PrefixTrash + k.name + IdDelimiter
+}
+
+// Key merges the prefix with the ID of the record, written as within TableKey.Key.
+func (k *TrashKey) Key() string {
+	return k.Prefix() + encodeId(k.id)
+}
+
+//endregion
+
+//region RevisionKey
+
+// RevisionKey addresses a former value of a record, kept by the history of its table.
+// The revision number follows the key of the record and LinkDelimiter, which IDs can not
+// hold; it is zero padded so that the revisions of the drivers iterating in key order
+// come in order.
+type RevisionKey struct {
+	*baseKey
+	record    *TableKey
+	number    uint64
+	hasNumber bool
+}
+
+// NewRevisionKey creates a RevisionKey for the record of tableKey. Without number, its
+// prefix covers every revision of the record, or of the table when tableKey has no ID.
+func NewRevisionKey(tableKey *TableKey) *RevisionKey {
+	key := &RevisionKey{record: tableKey}
+	key.baseKey = newBaseKey(key)
+	return key
+}
+
+// NewRevisionKeyFromString parses a raw string to populate a RevisionKey with the key of
+// its record and its number. The missing parts remain unset.
+func NewRevisionKeyFromString(key string) *RevisionKey {
+
+	after, _ := strings.CutPrefix(key, PrefixRevision)
+	base, number, found := strings.Cut(after, LinkDelimiter)
+
+	revisionKey := NewRevisionKey(NewTableKeyFromString(PrefixTable + base))
+	if found {
+		revisionKey.number, _ = strconv.ParseUint(number, 10, 64)
+		revisionKey.hasNumber = true
+	}
+
+	return revisionKey
+}
+
+// SetNumber assigns the revision number.
+func (k *RevisionKey) SetNumber(number uint64) *RevisionKey {
+	k.number = number
+	k.hasNumber = true
+	return k
+}
+
+// Number returns the revision number.
+func (k *RevisionKey) Number() uint64 {
+	return k.number
+}
+
+// TableKey returns the key of the record.
+func (k *RevisionKey) TableKey() *TableKey {
+	return k.record
+}
+
+// Prefix narrows down as the table name and the ID of the record get set.
+func (k *RevisionKey) Prefix() string {
+
+	switch {
+	case len(k.record.name) == 0:
+		return PrefixRevision
+	case len(k.record.id) == 0:
+		return PrefixRevision + k.record.name + IdDelimiter
+	}
+
+	return PrefixRevision + k.record.Base() + LinkDelimiter
+}
+
+// Key merges the prefix with the revision number.
+func (k *RevisionKey) Key() string {
+	if !k.hasNumber {
+		return k.Prefix()
+	}
+	return fmt.Sprintf("%s%020d", k.Prefix(), k.number)
+}
+
+//endregion
+
+//region ExpiryKey
+
+// ExpiryKey schedules the expiry of a record: the time, in Unix nanoseconds, is zero
+// padded so that the entries of the drivers iterating in key order come by expiry time.
+type ExpiryKey struct {
+	*baseKey
+	at     int64
+	record *TableKey
+}
+
+// NewProtoExpiryKey returns an empty ExpiryKey, whose prefix covers every expiry entry.
+func NewProtoExpiryKey() *ExpiryKey {
+	key := &ExpiryKey{}
+	key.baseKey = newBaseKey(key)
+	return key
+}
+
+// NewExpiryKey creates the entry scheduling the expiry of the record of tableKey at the
+// given time, in Unix nanoseconds.
+func NewExpiryKey(at int64, tableKey *TableKey) *ExpiryKey {
+	key := NewProtoExpiryKey()
+	key.at = at
+	key.record = tableKey
+	return key
+}
+
+// NewExpiryKeyFromString parses a raw string to populate an ExpiryKey with its time and
+// the key of its record. The missing parts remain unset.
+func NewExpiryKeyFromString(key string) *ExpiryKey {
+
+	expiryKey := NewProtoExpiryKey()
+
+	after, _ := strings.CutPrefix(key, PrefixExpiry)
+	at, base, found := strings.Cut(after, IdDelimiter)
+	expiryKey.at, _ = strconv.ParseInt(at, 10, 64)
+	if found {
+		expiryKey.record = NewTableKeyFromString(PrefixTable + base)
+	}
+
+	return expiryKey
+}
+
+// At returns the expiry time of the record, in Unix nanoseconds.
+func (k *ExpiryKey) At() int64 {
+	return k.at
+}
+
+// TableKey returns the key of the expiring record.
+func (k *ExpiryKey) TableKey() *TableKey {
+	return k.record
+}
+
+// Prefix references the "expiry" domain.
+func (k *ExpiryKey) Prefix() string {
+	return PrefixExpiry
+}
+
+// Key merges the prefix with the expiry time and the table name and ID of the record.
+func (k *ExpiryKey) Key() string {
+	if k.record == nil {
+		return k.Prefix()
+	}
+	return fmt.Sprintf("%s%020d%s%s", k.Prefix(), k.at, IdDelimiter, k.record.Base())
 }
 
 //endregion
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	. "github.com/Phosmachina/FluentKV/core"
 	. "github.com/Phosmachina/FluentKV/helper"
+	"strings"
 	"testing"
 )
 
@@ -172,8 +173,42 @@ func TestNewTableKey_WithoutId(t *testing.T) {
 
 func TestNewTableKey_WithNameAndId(t *testing.T) {
 	testerTableKey := NewTableKey[SimpleType]()
-	testerTableKey.SetId("0")
-	testNewTableKey(t, testerTableKey, "0", "SimpleType")
+	testerTableKey.SetId("Id")
+	testNewTableKey(t, testerTableKey, "Id", "SimpleType")
+}
+
+func TestTableKey_NumericId(t *testing.T) {
+
+	// Arrange
+	tests := []struct{ id, expectedKey string }{
+		{"0", "tbl%TableName_#a0"},
+		{"42", "tbl%TableName_#b42"},
+		{"042", "tbl%TableName_042"},
+		{"#a1", "tbl%TableName_##a1"},
+		{"Id", "tbl%TableName_Id"},
+	}
+
+	for _, test := range tests {
+		// Act
+		key := NewTableKeyFromString("tbl%TableName_").SetId(test.id)
+		parsed := NewTableKeyFromString(key.Key())
+
+		// Assert
+		if key.Key() != test.expectedKey || parsed.Id() != test.id {
+			t.Errorf("Unexpected key for %s: expected %s, got %s (parsed %s)",
+				test.id, test.expectedKey, key.Key(), parsed.Id())
+		}
+	}
+	if NewTableKeyFromString("tbl%TableName_42").Id() != "42" {
+		t.Error("Keys written before the order-preserving form must still be read")
+	}
+	for _, ids := range [][2]string{{"2", "10"}, {"99", "100"}, {"9", "18446744073709551615"}} {
+		first := NewTableKeyFromString("tbl%TableName_").SetId(ids[0]).Key()
+		second := NewTableKeyFromString("tbl%TableName_").SetId(ids[1]).Key()
+		if first >= second {
+			t.Errorf("Keys must sort by ID: %s is not before %s", first, second)
+		}
+	}
 }
 
 func TestEqualsTableKey(t *testing.T) {
@@ -201,3 +236,162 @@ func TestEqualsTableKey(t *testing.T) {
 		}
 	}
 }
+
+func TestNewIndexKeyFromString(t *testing.T) {
+
+	// Arrange
+	expected := NewIndexKey("TableName", "Field").SetValue("value").SetId("42")
+
+	// Act
+	parsed := NewIndexKeyFromString(expected.Key())
+
+	// Assert
+	if parsed.Key() != expected.Key() || parsed.Prefix() != expected.Prefix() {
+		t.Errorf("Unexpected key: expected %s, got %s", expected.Key(), parsed.Key())
+	}
+	if parsed.Name() != "TableName" || parsed.Field() != "Field" || parsed.Id() != "42" {
+		t.Errorf("Unexpected parts in %s", parsed.Key())
+	}
+	if !parsed.TableKey().Equals(NewTableKeyFromString("tbl%TableName_42")) {
+		t.Errorf("Unexpected table key: %s", parsed.TableKey().Key())
+	}
+}
+
+func TestIndexKey_Prefix(t *testing.T) {
+
+	// Arrange
+	keys := []*IndexKey{
+		NewProtoIndexKey(),
+		NewIndexKey("TableName", ""),
+		NewIndexKey("TableName", "Field"),
+		NewIndexKey("TableName", "Field").SetValue(42),
+	}
+
+	// Act & Assert: each prefix narrows the previous one.
+	for i := 1; i < len(keys); i++ {
+		if !strings.HasPrefix(keys[i].Prefix(), keys[i-1].Prefix()) ||
+			keys[i].Prefix() == keys[i-1].Prefix() {
+			t.Errorf("%s does not narrow %s", keys[i].Prefix(), keys[i-1].Prefix())
+		}
+	}
+	if strings.HasPrefix(
+		NewIndexKey("TableName", "Field").SetValue(42).Prefix(),
+		NewIndexKey("TableName", "Field").SetValue(4).Prefix(),
+	) {
+		t.Error("Prefix of a value must not match another value")
+	}
+}
+
+func TestNewLinkKeyFromString_Reverse(t *testing.T) {
+
+	// Arrange
+	current := NewTableKeyFromString("tbl%Current_1")
+	target := NewTableKeyFromString("tbl%Target_2")
+	expected := NewLinkKey(current, target).Reverse()
+
+	// Act
+	parsed := NewLinkKeyFromString(expected.Key())
+
+	// Assert
+	if !strings.HasPrefix(expected.Key(), PrefixLinkReverse+"Target_#a2") {
+		t.Errorf("Unexpected key: %s", expected.Key())
+	}
+	if !parsed.IsReverse() || parsed.Key() != expected.Key() {
+		t.Errorf("Unexpected key: expected %s, got %s", expected.Key(), parsed.Key())
+	}
+	if !parsed.CurrentTableKey().Equals(current) || !parsed.TargetTableKey().Equals(target) {
+		t.Errorf("Unexpected sides in %s", parsed.Key())
+	}
+	if parsed.Forward().Key() != NewLinkKey(current, target).Key() {
+		t.Errorf("Unexpected forward key: %s", parsed.Forward().Key())
+	}
+}
+
+func TestLinkKey_Prefix(t *testing.T) {
+
+	// Arrange
+	current := NewTableKeyFromString("tbl%Current_1")
+	keys := []*LinkKey{
+		NewProtoLinkKey(),
+		NewLinkKey(current, nil),
+		NewLinkKey(current, NewTableKeyFromString("tbl%Target_")),
+	}
+	link := NewLinkKey(current, NewTableKeyFromString("tbl%Target_2"))
+
+	// Act & Assert: each prefix narrows the previous one and covers the link.
+	for i := 1; i < len(keys); i++ {
+		if !strings.HasPrefix(keys[i].Prefix(), keys[i-1].Prefix()) ||
+			keys[i].Prefix() == keys[i-1].Prefix() {
+			t.Errorf("%s does not narrow %s", keys[i].Prefix(), keys[i-1].Prefix())
+		}
+	}
+	if !strings.HasPrefix(link.Key(), keys[len(keys)-1].Prefix()) {
+		t.Errorf("%s is not covered by %s", link.Key(), keys[len(keys)-1].Prefix())
+	}
+	if strings.HasPrefix(
+		NewLinkKey(NewTableKeyFromString("tbl%Current_12"), nil).Key(),
+		NewLinkKey(current, nil).Prefix(),
+	) {
+		t.Error("Prefix of an object must not match another object")
+	}
+}
+
+func TestNewExpiryKeyFromString(t *testing.T) {
+
+	// Arrange
+	record := NewTableKeyFromString("tbl%TableName_42")
+	expected := NewExpiryKey(1700000000000000000, record)
+
+	// Act
+	parsed := NewKeyFromString(expected.Key()).(*ExpiryKey)
+
+	// Assert
+	if parsed.Key() != expected.Key() || !strings.HasPrefix(parsed.Key(), PrefixExpiry) {
+		t.Errorf("Unexpected key: expected %s, got %s", expected.Key(), parsed.Key())
+	}
+	if parsed.At() != expected.At() || !parsed.TableKey().Equals(record) {
+		t.Errorf("Unexpected parts in %s", parsed.Key())
+	}
+	if NewExpiryKey(9, record).Key() >= NewExpiryKey(10, record).Key() {
+		t.Error("Expiry keys must sort by time")
+	}
+}
+
+func TestNewTrashKeyFromString(t *testing.T) {
+
+	// Arrange
+	record := NewTableKeyFromString("tbl%TableName_42")
+	expected := NewTrashKey(record)
+
+	// Act
+	parsed := NewKeyFromString(expected.Key()).(*TrashKey)
+
+	// Assert
+	if parsed.Key() != "trs%TableName_#b42" || parsed.Prefix() != "trs%TableName_" {
+		t.Errorf("Unexpected key: expected %s, got %s", expected.Key(), parsed.Key())
+	}
+	if !parsed.TableKey().Equals(record) {
+		t.Errorf("Unexpected table key: %s", parsed.TableKey().Key())
+	}
+}
+
+func TestNewRevisionKeyFromString(t *testing.T) {
+
+	// Arrange
+	record := NewTableKeyFromString("tbl%TableName_42")
+	expected := NewRevisionKey(record).SetNumber(7)
+
+	// Act
+	parsed := NewKeyFromString(expected.Key()).(*RevisionKey)
+
+	// Assert
+	if parsed.Key() != "rev%TableName_#b42@00000000000000000007" {
+		t.Errorf("Unexpected key: expected %s, got %s", expected.Key(), parsed.Key())
+	}
+	if parsed.Prefix() != "rev%TableName_#b42@" || parsed.Number() != 7 {
+		t.Errorf("Unexpected prefix: %s (number %d)", parsed.Prefix(), parsed.Number())
+	}
+	if !parsed.TableKey().Equals(record) {
+		t.Errorf("Unexpected table key: %s", parsed.TableKey().Key())
+	}
+}
@@ -1,26 +1,40 @@
 package core
 
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound indicates that no entry is stored under the requested key.
+	ErrNotFound = errors.New("no entry is stored under this key")
+
+	// ErrClosed indicates an operation on a driver already closed.
+	ErrClosed = errors.New("the driver is closed")
+)
+
 // KVDriver defines the core low-level database operations necessary for a key-value store.
 //
 // Each stored entry is identified by an IKey, which comprises a prefix (e.g., an internal
 // data-type indicator) and other identifying parts (e.g., a table name and/or unique ID).
 // This interface focuses on direct read, write, and iteration operations, leaving more complex
 // logic (like marshalling or triggers) to higher-level abstractions.
+//
+// Failures are reported with errors wrapping, when they apply, the sentinels ErrNotFound,
+// ErrClosed and ErrConflict, so that callers can tell a missing entry from a broken store.
 type KVDriver interface {
 
 	// RawSet stores the given byte slice (value) under the specified key.
-	// This method does not verify if the key is currently in use. If the call fails,
-	// it returns false.
-	RawSet(key IKey, value []byte) bool
+	// This method does not verify if the key is currently in use.
+	RawSet(key IKey, value []byte) error
 
 	// RawGet retrieves the byte slice (value) associated with the given key.
-	// If the key does not exist, it returns an empty slice and false.
-	// If found, it returns the stored byte slice and true.
-	RawGet(key IKey) ([]byte, bool)
+	// If the key does not exist, it returns an error wrapping ErrNotFound.
+	RawGet(key IKey) ([]byte, error)
 
 	// RawDelete removes the entry identified by the given key from the storage.
-	// Returns true if the deletion is successful, otherwise false.
-	RawDelete(key IKey) bool
+	// If the key does not exist, it returns an error wrapping ErrNotFound.
+	RawDelete(key IKey) error
 
 	// RawIterKey scans the storage for items whose key begins with the prefix defined
 	// by the given key, then invokes the provided action function on each matching key.
@@ -33,10 +47,46 @@ type KVDriver interface {
 	RawIterKV(key IKey, action func(key IKey, value []byte) (stop bool))
 
 	// Exist checks if an entry exists for the specified key. It returns true
-	// if the key is found, false otherwise.
+	// if the key is found, false otherwise, including when the lookup fails.
 	Exist(key IKey) bool
 
+	// Begin starts a read-write transaction. Writes made through the returned KVTx are
+	// only visible to other readers once it is committed.
+	Begin() (KVTx, error)
+
+	// NewWriteBatch starts a KVWriteBatch, for bulk writes. Drivers without native
+	// batching return NewLoopWriteBatch of themselves.
+	NewWriteBatch() KVWriteBatch
+
 	// Close signals the driver to release any held resources and prevents further use.
 	// Once Close is called, subsequent method calls are not guaranteed to succeed.
 	Close()
 }
+
+// KVExpiringDriver is implemented by the drivers, and their transactions, which can drop
+// an entry by themselves once a time-to-live elapsed. The manager writes the records
+// having a time-to-live through it, see ExpiryGracePeriod.
+type KVExpiringDriver interface {
+
+	// RawSetWithTTL stores value under key, like RawSet, for the duration of ttl.
+	RawSetWithTTL(key IKey, value []byte, ttl time.Duration) error
+}
+
+// KVSnapshotDriver is implemented by the drivers which can pin a view of their data, see
+// KVStoreManager.Snapshot.
+type KVSnapshotDriver interface {
+
+	// Snapshot returns a view of the data as it is now, which later writes do not change.
+	// Its Close releases it, without closing the driver.
+	Snapshot() (KVDriver, error)
+}
+
+// KVOrderedDriver is implemented by the drivers which keep their keys in lexicographic
+// order and can start an iteration at any key, see KVStoreManager.Page.
+type KVOrderedDriver interface {
+
+	// RawIterKVFrom behaves like RawIterKV, visiting the keys in lexicographic order from
+	// the first one not less than start or, when reverse is set, in reverse order from the
+	// last one not greater than start (the last one of the prefix when start is empty).
+	RawIterKVFrom(key IKey, start string, reverse bool, action func(key IKey, value []byte) (stop bool))
+}
@@ -1,20 +1,31 @@
 package core
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	. "github.com/Phosmachina/FluentKV/helper"
-	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 var (
 	// AutoIdBuffer defines the default batch size used for pre-allocated IDs.
-	// When IDs are required, a range of AutoIdBuffer IDs are added to the available set.
+	// When IDs are required, a block of AutoIdBuffer IDs is reserved in the store; it is
+	// also the size of the pages of the free list.
 	AutoIdBuffer = 1000
 
 	// ErrInvalidId indicates that a provided ID is not valid or is not found in the DB.
 	ErrInvalidId = errors.New("the Id specified is not used in the db")
 
+	// ErrIdTaken indicates that the ID chosen for a new record is already used in its table.
+	ErrIdTaken = errors.New("the Id specified is already used in the db")
+
+	// ErrMalformedId indicates an ID chosen by the caller which can not be part of a key:
+	// it is empty or holds LinkDelimiter.
+	ErrMalformedId = errors.New("the Id specified is empty or holds a key delimiter")
+
 	// ErrFailedToSet indicates that a Set or Insert operation failed at the storage driver layer.
 	ErrFailedToSet = errors.New("the set operation failed")
 
@@ -22,6 +33,23 @@ var (
 	ErrSelfBind = errors.New("try to link object to itself")
 )
 
+// invalidIdOr reports a missing entry, as returned by the driver, as an ErrInvalidId still
+// wrapping the cause; other errors are returned unchanged.
+func invalidIdOr(err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: %w", ErrInvalidId, err)
+	}
+	return err
+}
+
+// failedToSet reports a failed write of the driver as an ErrFailedToSet wrapping the cause.
+func failedToSet(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrFailedToSet, err)
+}
+
 // KVStoreManager provides a higher-level manager on top of a KVDriver to handle both
 // raw primitive operations (like RawSet, RawGet, RawDelete) and higher-level tasks such
 // as ID generation and marshaling.
@@ -34,54 +62,40 @@ type KVStoreManager struct {
 	// typed operations to be stored in a key-value format.
 	marshaller IMarshaller
 
-	// availableIds is the internal pool of IDs that are not currently in use.
-	// It’s populated during initialization and replenished as needed.
-	availableIds []string
-
-	// usedIds holds the set of IDs that are actively assigned in the store.
-	usedIds []string
+	// ids hands out the auto-generated IDs; it is only used on the root manager.
+	ids *idAllocator
 
 	// triggers is an optional set of ITrigger hooks that can be run before or after
 	// specific CRUD operations.
 	triggers []ITrigger
 
+	// schemas holds, per table name, the indexes declared for it.
+	schemas map[string]*tableSchema
+
+	// parent is the manager this one was derived from (e.g. by WithTx). IDs, triggers
+	// and schemas are always handled by the root of this chain.
+	parent *KVStoreManager
+
+	// tx is set while the manager is bound to a transaction.
+	tx *txState
+
+	// sweeper removes the expired records in the background; it is only used on the root
+	// manager.
+	sweeper expirySweeper
+
 	m sync.Mutex
 }
 
 // NewKVStoreManager initializes a KVStoreManager based on the given driver.
-// It scans the existing store (via KVDriver.RawIterKey) to determine which IDs are in use,
-// and it constructs an initial pool of available IDs up to AutoIdBuffer.
+// The state of the ID allocator is read from the tank keyspace on first use, so opening
+// a store does not scan it; a store written by an older version is scanned once, then
+// its allocator state is recorded.
 func NewKVStoreManager(driver KVDriver) *KVStoreManager {
-
-	kvStoreManager := KVStoreManager{
+	return &KVStoreManager{
 		KVDriver:   driver,
 		marshaller: &GobMarshaller{}, // Default marshaller for objects.
+		ids:        newIdAllocator(driver),
 	}
-
-	biggestId := 0
-
-	// Gather in-use IDs from the underlying storage.
-	driver.RawIterKey(NewProtoTableKey(), func(key IKey) (stop bool) {
-		id := key.(*TableKey).Id()
-		kvStoreManager.usedIds = append(kvStoreManager.usedIds, id)
-
-		idAsInt, _ := strconv.Atoi(id)
-		if biggestId < idAsInt {
-			biggestId = idAsInt
-		}
-
-		return false
-	})
-
-	// Pre-populate available IDs up to a range that safely encompasses current usage.
-	for i := 0; i < AutoIdBuffer*(1+biggestId/AutoIdBuffer); i++ {
-		key := strconv.Itoa(i)
-		if IndexOf(key, kvStoreManager.usedIds) == -1 {
-			kvStoreManager.availableIds = append(kvStoreManager.availableIds, key)
-		}
-	}
-
-	return &kvStoreManager
 }
 
 // SetMarshaller assigns a custom marshaller to the manager.
@@ -96,95 +110,427 @@ func (db *KVStoreManager) Marshaller() IMarshaller {
 	return db.marshaller
 }
 
-// GetFreeId fetches a free identifier from the pool (availableIds).
-// If the pool is empty, it repopulates it by adding a new batch of IDs.
-// The chosen ID is transferred to the usedIds list.
-// If an ID is not used in the store, it will be freed up automatically at the next start.
-func (db *KVStoreManager) GetFreeId() string {
+// root returns the manager owning the IDs and the triggers shared by derived managers.
+func (db *KVStoreManager) root() *KVStoreManager {
+	for db.parent != nil {
+		db = db.parent
+	}
+	return db
+}
 
-	db.m.Lock()
-	defer db.m.Unlock()
+// GetFreeId fetches a free identifier, reusing the ones released by deletes first.
+// Fresh identifiers are reserved by blocks of AutoIdBuffer in the store, so no
+// identifier is handed out twice, even after a crash.
+// Inside a transaction, the identifier is given back if it is rolled back.
+func (db *KVStoreManager) GetFreeId() (string, error) {
+	ids, err := db.GetFreeIds(1)
+	if err != nil {
+		return "", err
+	}
+	return ids[0], nil
+}
 
-	// If no IDs are available, create a new batch.
-	if len(db.availableIds) == 0 {
-		for i := len(db.usedIds); i < len(db.usedIds)+AutoIdBuffer; i++ {
-			db.availableIds = append(db.availableIds, strconv.Itoa(i))
-		}
+// GetFreeIds fetches n free identifiers at once, recording their allocation in a single
+// batch. It behaves like n calls to GetFreeId.
+func (db *KVStoreManager) GetFreeIds(n int) ([]string, error) {
+	return db.takeIds(db.root().ids, "", n)
+}
+
+// FreeId releases one or more IDs (passed as variadic arguments) to the free list, so
+// that they are handed out again.
+// This method is typically called whenever an object is deleted from the store.
+// Inside a transaction, the IDs are only released once it is committed.
+func (db *KVStoreManager) FreeId(ids ...string) error {
+	return db.giveIds(db.root().ids, "", ids)
+}
+
+// newIds fetches n IDs for new records of the table, from the IdGenerator set for it.
+func (db *KVStoreManager) newIds(table string, n int) ([]string, error) {
+	return db.takeIds(db.idGenerator(table), table, n)
+}
+
+// releaseIds gives the IDs of deleted records of the table back to its IdGenerator.
+func (db *KVStoreManager) releaseIds(table string, ids ...string) error {
+	return db.giveIds(db.idGenerator(table), table, ids)
+}
+
+// takeIds fetches n IDs from the generator. Inside a transaction, they are given back
+// if it is rolled back.
+func (db *KVStoreManager) takeIds(generator IdGenerator, table string, n int) ([]string, error) {
+
+	root := db.root()
+	ids, err := generator.NewIds(root.KVDriver, table, n)
+	if err != nil || root == db {
+		return ids, err
 	}
 
-	id := db.availableIds[0]
-	db.usedIds = append(db.usedIds, id)
-	db.availableIds = db.availableIds[1:]
+	db.m.Lock()
+	if db.tx != nil {
+		db.tx.allocatedIds = append(db.tx.allocatedIds, idLease{generator, table, ids})
+	}
+	db.m.Unlock()
 
-	return id
+	return ids, nil
 }
 
-// FreeId reclaims one or more IDs (passed as variadic arguments) by removing
-// them from the usedIds list and adding them back to the availableIds pool.
-// This method is typically called whenever an object is deleted from the store.
-func (db *KVStoreManager) FreeId(ids ...string) {
+// claimIds tells the IdGenerator of the table about IDs chosen by the caller. Inside a
+// transaction, they are given back if it is rolled back.
+func (db *KVStoreManager) claimIds(table string, ids ...string) error {
+
+	root := db.root()
+	generator := db.idGenerator(table)
+	if err := generator.Claim(root.KVDriver, table, ids...); err != nil || root == db {
+		return err
+	}
 
 	db.m.Lock()
-	defer db.m.Unlock()
+	if db.tx != nil {
+		db.tx.allocatedIds = append(db.tx.allocatedIds, idLease{generator, table, ids})
+	}
+	db.m.Unlock()
+
+	return nil
+}
 
-	for _, id := range ids {
-		if index := IndexOf(id, db.usedIds); index != -1 {
-			// Remove the ID from usedIds
-			db.usedIds = append(db.usedIds[:index], db.usedIds[index+1:]...)
+// giveIds releases the IDs to the generator; inside a transaction, once it is committed.
+func (db *KVStoreManager) giveIds(generator IdGenerator, table string, ids []string) error {
 
-			// Place ID back in availableIds
-			db.availableIds = append(db.availableIds, id)
+	root := db.root()
+	if root != db {
+		db.m.Lock()
+		if db.tx != nil {
+			db.tx.freedIds = append(db.tx.freedIds, idLease{generator, table, ids})
+			db.m.Unlock()
+			return nil
 		}
+		db.m.Unlock()
 	}
+
+	return generator.Release(root.KVDriver, table, ids...)
+}
+
+// Close stops the sweeper of the expired records and saves the state of the ID
+// generators, such as the IDs of the reserved blocks which were not handed out, then
+// closes the driver.
+func (db *KVStoreManager) Close() {
+	if db.root() == db {
+		db.sweeper.close()
+		_ = db.ids.close()
+		for _, generator := range db.idGenerators() {
+			if closer, ok := generator.(idGeneratorCloser); ok {
+				_ = closer.close()
+			}
+		}
+	}
+	db.KVDriver.Close()
 }
 
 // Insert encodes the given value (as *any) using the current marshaller and inserts it
-// into the underlying driver using a newly allocated key.
+// into the underlying driver using a newly allocated key, at version 1.
 // If insertion fails, the allocated ID is freed.
 // Triggers are run if defined.
 func (db *KVStoreManager) Insert(value *any) (*TableKey, error) {
+	return db.InsertCtx(context.Background(), value)
+}
+
+// InsertCtx is Insert with a context, handed to the triggers. Nothing is committed once
+// ctx is done.
+func (db *KVStoreManager) InsertCtx(ctx context.Context, value *any) (*TableKey, error) {
+	record, err := db.insert(ctx, value, 0)
+	return record.key, err
+}
+
+// insert is InsertCtx, for a record expiring at the given time (0 for never), also
+// returning the header of the record.
+func (db *KVStoreManager) insert(ctx context.Context, value *any, expires int64) (storedRecord, error) {
+
+	record := storedRecord{value: value}
+
+	err := db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
+		record.key = NewTableKeyFromObject(*value)
+		if err := tx.allocateId(record.key); err != nil {
+			return err
+		}
+
+		var err error
+		record.header, err = tx.insertRecord(ctx, record.key, value, expires)
+		if err != nil {
+			_ = tx.releaseIds(record.key.Name(), record.key.Id())
+		}
+
+		return err
+	})
 
-	tableKey := NewTableKeyFromObject(*value).SetId(db.GetFreeId())
+	return record, err
+}
 
-	errs := db.withTriggerWrapper(tableKey, value, InsertOperation, func() error {
-		encoded, err := db.marshaller.Encode(value)
+// allocateId sets the ID of tableKey to a new one from the generator of its table. The
+// IDs already used in the table, chosen by a caller, are skipped.
+func (db *KVStoreManager) allocateId(tableKey *TableKey) error {
+	for {
+		ids, err := db.newIds(tableKey.Name(), 1)
 		if err != nil {
 			return err
 		}
+		tableKey.SetId(ids[0])
 
-		if !db.RawSet(tableKey, encoded) {
-			return ErrFailedToSet
+		_, err = db.RawGet(tableKey)
+		if errors.Is(err, ErrNotFound) {
+			return nil
 		}
-		return nil
+		if err != nil {
+			_ = db.releaseIds(tableKey.Name(), tableKey.Id())
+			return err
+		}
+	}
+}
+
+// insertRecord writes value as the new record of tableKey, expiring at the given time (0
+// for never), running the insert triggers.
+func (db *KVStoreManager) insertRecord(
+	ctx context.Context,
+	tableKey *TableKey,
+	value *any,
+	expires int64,
+) (recordHeader, error) {
+
+	header := db.newHeader()
+	header.expires = expires
+
+	err := db.withTriggerWrapper(ctx, tableKey, value, InsertOperation, func() error {
+		encoded, err := db.encode(header, value)
+		if err != nil {
+			return err
+		}
+
+		if err = db.writeRecord(tableKey, header, encoded); err != nil {
+			return err
+		}
+		if err = db.scheduleExpiry(tableKey, expires); err != nil {
+			return err
+		}
+		return db.updateIndexes(tableKey, nil, value)
+	})
+
+	return header, err
+}
+
+// InsertWithId stores value as a new record under tableKey, whose ID is chosen by the
+// caller, e.g. a natural key, instead of being allocated. The generator of the table is
+// told about it, so that it never hands the ID out.
+// Triggers run with InsertOperation.
+//
+// Possible Errors:
+//   - ErrIdTaken: If the key is already used, or held by a record in the trash.
+//   - ErrMalformedId: If the ID is empty or holds LinkDelimiter.
+func (db *KVStoreManager) InsertWithId(tableKey *TableKey, value *any) error {
+	return db.InsertWithIdCtx(context.Background(), tableKey, value)
+}
+
+// InsertWithIdCtx is InsertWithId with a context, handed to the triggers. Nothing is
+// committed once ctx is done.
+func (db *KVStoreManager) InsertWithIdCtx(ctx context.Context, tableKey *TableKey, value *any) error {
+	_, err := db.insertWithId(ctx, tableKey, value)
+	return err
+}
+
+// insertWithId is InsertWithIdCtx, also returning the header of the record.
+func (db *KVStoreManager) insertWithId(
+	ctx context.Context,
+	tableKey *TableKey,
+	value *any,
+) (recordHeader, error) {
+
+	var header recordHeader
+
+	if err := checkChosenId(tableKey.Id()); err != nil {
+		return header, err
+	}
+
+	err := db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
+		_, err := tx.rawLive(ctx, tableKey)
+		if err == nil || tx.Exist(NewTrashKey(tableKey)) {
+			return ErrIdTaken
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+
+		header, err = tx.insertChosen(ctx, tableKey, value)
+		return err
 	})
 
-	if errs != nil {
-		db.FreeId(tableKey.Id())
+	return header, err
+}
+
+// Upsert stores value under tableKey, whose ID is chosen by the caller: the record is
+// inserted if the key is unused, as with InsertWithId, or replaced otherwise, as with Set.
+// Triggers run with InsertOperation or UpdateOperation accordingly.
+//
+// Possible Errors:
+//   - ErrIdTaken: If the ID is held by a record in the trash.
+//   - ErrMalformedId: If the ID is empty or holds LinkDelimiter.
+func (db *KVStoreManager) Upsert(tableKey *TableKey, value *any) error {
+	return db.UpsertCtx(context.Background(), tableKey, value)
+}
+
+// UpsertCtx is Upsert with a context, handed to the triggers. Nothing is committed once
+// ctx is done.
+func (db *KVStoreManager) UpsertCtx(ctx context.Context, tableKey *TableKey, value *any) error {
+	_, err := db.upsert(ctx, tableKey, value)
+	return err
+}
+
+// upsert is UpsertCtx, also returning the header of the record.
+func (db *KVStoreManager) upsert(ctx context.Context, tableKey *TableKey, value *any) (recordHeader, error) {
+
+	var header recordHeader
+
+	if err := checkChosenId(tableKey.Id()); err != nil {
+		return header, err
 	}
 
-	return tableKey, errs
+	err := db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
+		raw, err := tx.rawLive(ctx, tableKey)
+		if errors.Is(err, ErrNotFound) {
+			if tx.Exist(NewTrashKey(tableKey)) {
+				return ErrIdTaken
+			}
+			header, err = tx.insertChosen(ctx, tableKey, value)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		header, err = tx.replaceRecord(ctx, tableKey, raw, value)
+		return err
+	})
+
+	return header, err
+}
+
+// insertChosen claims the ID of tableKey from the generator of its table, then inserts
+// the record.
+func (db *KVStoreManager) insertChosen(
+	ctx context.Context,
+	tableKey *TableKey,
+	value *any,
+) (recordHeader, error) {
+
+	if err := db.claimIds(tableKey.Name(), tableKey.Id()); err != nil {
+		return recordHeader{}, err
+	}
+
+	return db.insertRecord(ctx, tableKey, value, 0)
+}
+
+// checkChosenId returns ErrMalformedId if id can not be part of a key.
+func checkChosenId(id string) error {
+	if id == "" || strings.Contains(id, LinkDelimiter) {
+		return ErrMalformedId
+	}
+	return nil
 }
 
 // Set updates the record corresponding to tableKey with a newly encoded representation
-// of the provided value.
+// of the provided value, whatever its current version. The former value is kept as a
+// revision when the table has a history, see SetHistory.
 // If the key does not exist in the store, ErrInvalidId is returned.
 // Triggers are run if defined.
 func (db *KVStoreManager) Set(tableKey *TableKey, value *any) error {
+	return db.SetCtx(context.Background(), tableKey, value)
+}
+
+// SetCtx is Set with a context, handed to the triggers. Nothing is committed once ctx
+// is done.
+func (db *KVStoreManager) SetCtx(ctx context.Context, tableKey *TableKey, value *any) error {
+	_, err := db.set(ctx, tableKey, value, nil)
+	return err
+}
 
-	if !db.Exist(tableKey) {
-		return ErrInvalidId
+// CompareAndSwap updates the record corresponding to tableKey like Set, provided it is
+// still at the given version, e.g. the one it had when it was read.
+//
+// Possible Errors:
+//   - ErrVersionConflict: If the record was written since.
+//   - ErrInvalidId: If the key does not exist in the store.
+func (db *KVStoreManager) CompareAndSwap(tableKey *TableKey, version uint64, value *any) error {
+	return db.CompareAndSwapCtx(context.Background(), tableKey, version, value)
+}
+
+// CompareAndSwapCtx is CompareAndSwap with a context, handed to the triggers. Nothing is
+// committed once ctx is done.
+func (db *KVStoreManager) CompareAndSwapCtx(
+	ctx context.Context,
+	tableKey *TableKey,
+	version uint64,
+	value *any,
+) error {
+	_, err := db.set(ctx, tableKey, value, &version)
+	return err
+}
+
+// set is SetCtx, or CompareAndSwapCtx when version is not nil, also returning the header
+// of the record.
+func (db *KVStoreManager) set(
+	ctx context.Context,
+	tableKey *TableKey,
+	value *any,
+	version *uint64,
+) (recordHeader, error) {
+
+	var header recordHeader
+
+	err := db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
+		raw, err := tx.rawLive(ctx, tableKey)
+		if err != nil {
+			return invalidIdOr(err)
+		}
+		if version != nil {
+			if stored, _, err := decodeRecord(raw); err != nil || stored.version != *version {
+				return ErrVersionConflict
+			}
+		}
+
+		header, err = tx.replaceRecord(ctx, tableKey, raw, value)
+		return err
+	})
+
+	return header, err
+}
+
+// replaceRecord writes value over raw, the record of tableKey, running the update
+// triggers. raw is kept as a revision when the table has a history.
+func (db *KVStoreManager) replaceRecord(
+	ctx context.Context,
+	tableKey *TableKey,
+	raw []byte,
+	value *any,
+) (recordHeader, error) {
+
+	oldValue, header, err := db.decode(raw)
+	if err != nil {
+		return header, err
 	}
+	header = db.nextHeader(header)
 
-	return db.withTriggerWrapper(tableKey, value, UpdateOperation, func() error {
-		encoded, err := db.marshaller.Encode(value)
+	err = db.withTriggerWrapper(ctx, tableKey, value, UpdateOperation, func() error {
+		encoded, err := db.encode(header, value)
 		if err != nil {
 			return err
 		}
-		if !db.RawSet(tableKey, encoded) {
-			return ErrFailedToSet
+		if err = db.archive(tableKey, raw, UpdateOperation); err != nil {
+			return err
+		}
+		if err = db.writeRecord(tableKey, header, encoded); err != nil {
+			return err
 		}
-		return nil
+
+		return db.updateIndexes(tableKey, oldValue, value)
 	})
+
+	return header, err
 }
 
 // Get retrieves a record specified by tableKey, decodes it (using the current marshaller),
@@ -192,147 +538,317 @@ func (db *KVStoreManager) Set(tableKey *TableKey, value *any) error {
 // If the key does not exist, ErrInvalidId is returned.
 // Triggers run if defined.
 func (db *KVStoreManager) Get(tableKey *TableKey) (*any, error) {
+	return db.GetCtx(context.Background(), tableKey)
+}
 
-	var value *any
+// GetCtx is Get with a context, handed to the triggers.
+func (db *KVStoreManager) GetCtx(ctx context.Context, tableKey *TableKey) (*any, error) {
+	record, err := db.get(ctx, tableKey)
+	return record.value, err
+}
 
-	rawValue, found := db.RawGet(tableKey)
-	if found {
-		var err error
-		value, err = db.marshaller.Decode(rawValue)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		return nil, ErrInvalidId
+// get is GetCtx, also returning the header of the record.
+func (db *KVStoreManager) get(ctx context.Context, tableKey *TableKey) (storedRecord, error) {
+
+	if err := ctx.Err(); err != nil {
+		return storedRecord{}, err
+	}
+
+	rawValue, err := db.RawGet(tableKey)
+	if err != nil {
+		return storedRecord{}, invalidIdOr(err)
+	}
+	value, header, err := db.decode(rawValue)
+	if err != nil {
+		return storedRecord{}, err
+	}
+	if !db.isLive(header, time.Now().UnixNano()) {
+		return storedRecord{}, invalidIdOr(errExpired)
 	}
 
 	// TODO don't report trigger action error to an API call!
-	err := db.withTriggerWrapper(tableKey, value, GetOperation, func() error {
+	err = db.withTriggerWrapper(ctx, tableKey, value, GetOperation, func() error {
 		return nil
 	})
 
-	return value, err
+	return storedRecord{key: tableKey, value: value, header: header}, err
 }
 
 // Update retrieves the current object matching tableKey, runs the user-provided editor
-// function to modify it in memory, then encodes and re-saves it.
+// function to modify it in memory, then encodes and re-saves it. The former value is kept
+// as a revision when the table has a history, see SetHistory.
+// The editor runs once: if the record is written by someone else in the meantime,
+// ErrVersionConflict is returned and nothing is saved, see UpdateWithRetry.
 // If the key does not exist, ErrInvalidId is returned.
 // If the final writing step fails, ErrFailedToSet is raised.
 // Triggers run if defined.
 func (db *KVStoreManager) Update(tableKey *TableKey, editor func(value *any) *any) (*any, error) {
+	return db.UpdateCtx(context.Background(), tableKey, editor)
+}
 
-	raw, found := db.RawGet(tableKey)
-	if !found {
-		return nil, ErrInvalidId
+// UpdateCtx is Update with a context, handed to the triggers. Nothing is committed once
+// ctx is done.
+func (db *KVStoreManager) UpdateCtx(
+	ctx context.Context,
+	tableKey *TableKey,
+	editor func(value *any) *any,
+) (*any, error) {
+	record, err := db.update(ctx, tableKey, editor, 0)
+	return record.value, err
+}
+
+// UpdateWithRetry is Update, running the editor again on the new value of the record
+// when it was written by someone else in the meantime, up to MaxTxRetries times.
+// The editor must thus have no side effects.
+//
+// Possible Errors:
+//   - ErrVersionConflict: If the record is still written concurrently after the retries.
+//   - ErrInvalidId: If the key does not exist in the store.
+func (db *KVStoreManager) UpdateWithRetry(tableKey *TableKey, editor func(value *any) *any) (*any, error) {
+	return db.UpdateWithRetryCtx(context.Background(), tableKey, editor)
+}
+
+// UpdateWithRetryCtx is UpdateWithRetry with a context, handed to the triggers. Nothing
+// is committed once ctx is done.
+func (db *KVStoreManager) UpdateWithRetryCtx(
+	ctx context.Context,
+	tableKey *TableKey,
+	editor func(value *any) *any,
+) (*any, error) {
+	record, err := db.update(ctx, tableKey, editor, MaxTxRetries)
+	return record.value, err
+}
+
+// update is UpdateCtx, reading the record again and rerunning the editor up to retries
+// times on ErrVersionConflict. It also returns the header of the record.
+func (db *KVStoreManager) update(
+	ctx context.Context,
+	tableKey *TableKey,
+	editor func(value *any) *any,
+	retries int,
+) (storedRecord, error) {
+
+	for attempt := 0; ; attempt++ {
+		record, err := db.updateOnce(ctx, tableKey, editor)
+		if !errors.Is(err, ErrVersionConflict) || attempt >= retries {
+			return record, err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return record, ctxErr
+		}
 	}
+}
 
-	value, err := db.marshaller.Decode(raw)
+// updateOnce makes one attempt of update. The version of the record is read first, so
+// that a concurrent write, whether it is noticed by the transaction of the update or
+// makes it retry, gives ErrVersionConflict instead of running the editor again.
+func (db *KVStoreManager) updateOnce(
+	ctx context.Context,
+	tableKey *TableKey,
+	editor func(value *any) *any,
+) (storedRecord, error) {
+
+	raw, err := db.RawGet(tableKey)
 	if err != nil {
-		return nil, err
+		return storedRecord{}, invalidIdOr(err)
+	}
+	read, _, err := decodeRecord(raw)
+	if err != nil {
+		return storedRecord{}, err
+	}
+	if !db.isLive(read, time.Now().UnixNano()) {
+		return storedRecord{}, invalidIdOr(errExpired)
 	}
 
-	err = db.withTriggerWrapper(tableKey, value, UpdateOperation, func() error {
-		*value = *editor(value)
-		rawUpdatedValue, encodeErr := db.marshaller.Encode(value)
-		if encodeErr != nil {
-			return encodeErr
+	record := storedRecord{key: tableKey}
+
+	err = db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
+		raw, err := tx.rawLive(ctx, tableKey)
+		if err != nil {
+			return invalidIdOr(err)
 		}
-		if !db.RawSet(tableKey, rawUpdatedValue) {
-			return ErrFailedToSet
+
+		var value *any
+		value, record.header, err = tx.decode(raw)
+		if err != nil {
+			return err
 		}
-		return nil
+		if record.header.version != read.version {
+			return ErrVersionConflict
+		}
+		record.header = tx.nextHeader(record.header)
+		record.value = value
+
+		oldValue := *value
+
+		return tx.withTriggerWrapper(ctx, tableKey, value, UpdateOperation, func() error {
+			*value = *editor(value)
+			rawUpdatedValue, encodeErr := tx.encode(record.header, value)
+			if encodeErr != nil {
+				return encodeErr
+			}
+			if err := tx.archive(tableKey, raw, UpdateOperation); err != nil {
+				return err
+			}
+			if err := tx.writeRecord(tableKey, record.header, rawUpdatedValue); err != nil {
+				return err
+			}
+			return tx.updateIndexes(tableKey, &oldValue, value)
+		})
 	})
 
-	return value, err
+	return record, err
 }
 
 // Delete removes the record associated with the given tableKey.
 // Before removing, it fetches the value for triggers or auditing, then reclaims its ID.
-// Any links referencing the deleted item are also removed.
+// Any links referencing the deleted item are also removed. Its value is kept as a
+// revision when the table has a history, see SetHistory.
+// When soft delete is set for the table (see SetSoftDelete), the record is moved to the
+// trash instead, as with SoftDelete.
 // If the key does not exist, ErrInvalidId is returned.
 // Triggers run if defined.
 func (db *KVStoreManager) Delete(tableKey *TableKey) error {
+	return db.DeleteCtx(context.Background(), tableKey)
+}
 
-	raw, found := db.RawGet(tableKey)
-	if !found {
-		return ErrInvalidId
-	}
-	value, err := db.marshaller.Decode(raw)
-	if err != nil {
-		return err
-	}
+// DeleteCtx is Delete with a context, handed to the triggers. Nothing is committed once
+// ctx is done.
+func (db *KVStoreManager) DeleteCtx(ctx context.Context, tableKey *TableKey) error {
+	return db.delete(ctx, tableKey, db.softDeletes(tableKey.Name()))
+}
+
+// delete is DeleteCtx, moving the record to the trash when soft is set.
+func (db *KVStoreManager) delete(ctx context.Context, tableKey *TableKey, soft bool) error {
 
-	return db.withTriggerWrapper(tableKey, value, DeleteOperation, func() error {
-		if !db.RawDelete(tableKey) {
-			return ErrInvalidId
+	return db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
+		raw, err := tx.rawLive(ctx, tableKey)
+		if err != nil {
+			return invalidIdOr(err)
+		}
+		value, header, err := tx.decode(raw)
+		if err != nil {
+			return err
 		}
-		db.FreeId(tableKey.Id())
 
-		// Remove all links referencing this key.
-		db.RawIterKey(NewProtoLinkKey(), func(key IKey) (stop bool) {
-			linkKey := key.(*LinkKey)
+		return tx.withTriggerWrapper(ctx, tableKey, value, DeleteOperation, func() error {
+			_, err := tx.removeRecord(tableKey, raw, value, header, soft)
+			return err
+		})
+	})
+}
 
-			if linkKey.currentTableKey.Equals(tableKey) ||
-				linkKey.targetTableKey.Equals(tableKey) {
-				db.RawDelete(linkKey)
-			}
+// removeRecord is deleteRecord, keeping raw as a revision when the table has a history,
+// or trashRecord when soft is set.
+func (db *KVStoreManager) removeRecord(
+	tableKey *TableKey,
+	raw []byte,
+	value *any,
+	header recordHeader,
+	soft bool,
+) ([]*TableKey, error) {
+	if soft {
+		return db.trashRecord(tableKey, raw, value)
+	}
+	if err := db.archive(tableKey, raw, DeleteOperation); err != nil {
+		return nil, err
+	}
+	return db.deleteRecord(tableKey, value, header)
+}
 
-			return false
-		})
+// deleteRecord removes the record of tableKey, whose value and header are given, with its
+// index and expiry entries and the links referencing it, then releases its ID, see
+// releaseRecordId. It returns
+// the keys of the records it was linked to.
+func (db *KVStoreManager) deleteRecord(
+	tableKey *TableKey,
+	value *any,
+	header recordHeader,
+) ([]*TableKey, error) {
 
-		return nil
-	})
+	if err := db.RawDelete(tableKey); err != nil {
+		return nil, invalidIdOr(err)
+	}
+	if err := db.releaseRecordId(tableKey); err != nil {
+		return nil, err
+	}
+
+	if err := db.updateIndexes(tableKey, value, nil); err != nil {
+		return nil, err
+	}
+	if err := db.dropExpiry(tableKey, header.expires); err != nil {
+		return nil, err
+	}
+
+	// Remove all links referencing this key.
+	return unlinkAll(db, tableKey)
 }
 
 // DeepDelete removes the record and all directly connected entries, recursively.
-// This is similar to Delete but also calls DeepDelete on any linked object.
+// This is similar to Delete but also calls DeepDelete on any linked object; each record
+// is moved to the trash if soft delete is set for its table.
 // If the key does not exist, ErrInvalidId is returned.
 // Triggers run if defined.
 func (db *KVStoreManager) DeepDelete(tableKey *TableKey) error {
+	return db.DeepDeleteCtx(context.Background(), tableKey)
+}
 
-	raw, found := db.RawGet(tableKey)
-	if !found {
-		return ErrInvalidId
-	}
-	value, err := db.marshaller.Decode(raw)
-	if err != nil {
-		return err
-	}
+// DeepDeleteCtx is DeepDelete with a context, handed to the triggers. Nothing is
+// committed once ctx is done.
+func (db *KVStoreManager) DeepDeleteCtx(ctx context.Context, tableKey *TableKey) error {
 
-	return db.withTriggerWrapper(tableKey, value, DeleteOperation, func() error {
-		if !db.RawDelete(tableKey) {
-			return ErrInvalidId
+	return db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
+		raw, err := tx.rawLive(ctx, tableKey)
+		if err != nil {
+			return invalidIdOr(err)
+		}
+		value, header, err := tx.decode(raw)
+		if err != nil {
+			return err
 		}
 
-		db.FreeId(tableKey.Id())
-
-		// Recursively remove links and linked objects.
-		db.RawIterKey(NewProtoLinkKey(), func(key IKey) (stop bool) {
-			linkKey := key.(*LinkKey)
+		soft := tx.softDeletes(tableKey.Name())
 
-			if linkKey.CurrentTableKey().Equals(tableKey) {
-				db.RawDelete(linkKey)
-				_ = db.DeepDelete(linkKey.TargetTableKey())
-			} else if linkKey.TargetTableKey().Equals(tableKey) {
-				db.RawDelete(linkKey)
+		return tx.withTriggerWrapper(ctx, tableKey, value, DeleteOperation, func() error {
+			// Recursively remove links and linked objects.
+			targets, err := tx.removeRecord(tableKey, raw, value, header, soft)
+			if err != nil {
+				return err
+			}
+			for _, target := range targets {
+				err = tx.DeepDeleteCtx(ctx, target)
+				if err != nil && !errors.Is(err, ErrInvalidId) {
+					return err
+				}
 			}
 
-			return false
+			return nil
 		})
-
-		return nil
 	})
 }
 
 // Count returns the number of entries in the store whose keys match the tableKey prefix.
-// This is effectively counting the records in a particular “table” domain.
+// This is effectively counting the records in a particular “table” domain. The expired
+// records waiting for the sweeper are not counted.
 func (db *KVStoreManager) Count(key *TableKey) int {
+	ct, _ := db.CountCtx(context.Background(), key)
+	return ct
+}
+
+// CountCtx is Count with a context: the scan stops once ctx is done, returning ctx.Err().
+func (db *KVStoreManager) CountCtx(ctx context.Context, key *TableKey) (int, error) {
 	var ct int
 	db.RawIterKey(key, func(_ IKey) (stop bool) {
+		if ctx.Err() != nil {
+			return true
+		}
 		ct++
 		return false
 	})
-	return ct
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return ct - db.countExpired(key), nil
 }
 
 // Foreach iterates over all key-value pairs matching the given tableKey prefix.
@@ -342,23 +858,56 @@ func (db *KVStoreManager) Foreach(
 	tableKey *TableKey,
 	do func(tableKey *TableKey, value *any),
 ) {
+	_ = db.ForeachCtx(context.Background(), tableKey, do)
+}
 
-	pool := NewTaskPool()
+// ForeachCtx is Foreach with a context: once ctx is done, the scan stops, the pending
+// callbacks are skipped and ctx.Err() is returned.
+func (db *KVStoreManager) ForeachCtx(
+	ctx context.Context,
+	tableKey *TableKey,
+	do func(tableKey *TableKey, value *any),
+) error {
+	return db.foreach(ctx, tableKey, nil, func(record storedRecord) {
+		do(record.key, record.value)
+	})
+}
+
+// foreach is ForeachCtx, handing whole records to do. When accept is not nil, only the
+// records whose header it accepts are decoded and handed to do.
+func (db *KVStoreManager) foreach(
+	ctx context.Context,
+	tableKey *TableKey,
+	accept func(header recordHeader) bool,
+	do func(record storedRecord),
+) error {
+
+	pool := NewTaskPoolWithContext(ctx)
+	now := time.Now().UnixNano()
 
 	db.RawIterKV(tableKey, func(key IKey, rawValue []byte) (stop bool) {
+		if ctx.Err() != nil {
+			return true
+		}
 		valCopy := rawValue
 		keyCopy := key.(*TableKey)
 		pool.AddTask(func() {
-			decoded, err := db.marshaller.Decode(valCopy)
+			header, payload, err := decodeRecord(valCopy)
+			if err != nil || !db.isLive(header, now) || accept != nil && !accept(header) {
+				return
+			}
+			decoded, err := db.marshaller.Decode(payload)
 			if err != nil {
 				return
 			}
-			do(keyCopy, decoded)
+			do(storedRecord{key: keyCopy, value: decoded, header: header})
 		})
 		return false
 	})
 
 	pool.Close()
+
+	return ctx.Err()
 }
 
 // FindFirst scans the store for all items matching the provided tableKey prefix,
@@ -370,25 +919,52 @@ func (db *KVStoreManager) FindFirst(
 	tableKey *TableKey,
 	predicate func(tableKey *TableKey, value *any) bool,
 ) (*TableKey, *any) {
+	resultKey, resultValue, _ := db.FindFirstCtx(context.Background(), tableKey, predicate)
+	return resultKey, resultValue
+}
+
+// FindFirstCtx is FindFirst with a context: the scan stops once ctx is done, returning
+// ctx.Err().
+func (db *KVStoreManager) FindFirstCtx(
+	ctx context.Context,
+	tableKey *TableKey,
+	predicate func(tableKey *TableKey, value *any) bool,
+) (*TableKey, *any, error) {
+	record, err := db.findFirst(ctx, tableKey, predicate)
+	return record.key, record.value, err
+}
+
+// findFirst is FindFirstCtx, returning the whole record; its key is nil if none matches.
+func (db *KVStoreManager) findFirst(
+	ctx context.Context,
+	tableKey *TableKey,
+	predicate func(tableKey *TableKey, value *any) bool,
+) (storedRecord, error) {
 
-	var resultKey *TableKey
-	var resultValue *any
+	var result storedRecord
+	now := time.Now().UnixNano()
 
 	db.RawIterKV(tableKey, func(key IKey, rawValue []byte) (stop bool) {
-		tmpValue, err := db.marshaller.Decode(rawValue)
-		if err != nil {
+		if ctx.Err() != nil {
+			return true
+		}
+		tmpValue, header, err := db.decode(rawValue)
+		if err != nil || !db.isLive(header, now) {
 			return false
 		}
 		tmpKey := key.(*TableKey)
-		if predicate(resultKey, tmpValue) {
-			resultKey = tmpKey
-			resultValue = tmpValue
+		if predicate(result.key, tmpValue) {
+			result = storedRecord{key: tmpKey, value: tmpValue, header: header}
 			return true
 		}
 		return false
 	})
 
-	return resultKey, resultValue
+	if err := ctx.Err(); err != nil {
+		return storedRecord{}, err
+	}
+
+	return result, nil
 }
 
 // FindAll iterates over every item matching the tableKey prefix, decodes each value,
@@ -398,36 +974,118 @@ func (db *KVStoreManager) FindAll(
 	tableKey *TableKey,
 	predicate func(tableKey *TableKey, value *any) bool,
 ) ([]*TableKey, []*any) {
+	tableKeys, resultValues, _ := db.FindAllCtx(context.Background(), tableKey, predicate)
+	return tableKeys, resultValues
+}
 
-	var tableKeys []*TableKey
-	var resultValues []*any
+// FindAllCtx is FindAll with a context: once ctx is done, the scan stops, the pending
+// predicates are skipped and ctx.Err() is returned.
+func (db *KVStoreManager) FindAllCtx(
+	ctx context.Context,
+	tableKey *TableKey,
+	predicate func(tableKey *TableKey, value *any) bool,
+) ([]*TableKey, []*any, error) {
 
-	pool := NewTaskPool()
+	records, err := db.findAll(ctx, tableKey, predicate)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	db.RawIterKV(tableKey, func(key IKey, value []byte) (stop bool) {
-		valCopy := value
-		keyCopy := key.(*TableKey)
-		pool.AddTask(func() {
-			curObj, err := db.marshaller.Decode(valCopy)
-			if err != nil {
-				return
-			}
-			if predicate(keyCopy, curObj) {
-				tableKeys = append(tableKeys, keyCopy)
-				resultValues = append(resultValues, curObj)
-			}
-		})
-		return false
+	return splitRecords(records)
+}
+
+// findAll is FindAllCtx, returning whole records.
+func (db *KVStoreManager) findAll(
+	ctx context.Context,
+	tableKey *TableKey,
+	predicate func(tableKey *TableKey, value *any) bool,
+) ([]storedRecord, error) {
+
+	var records []storedRecord
+	var m sync.Mutex
+
+	err := db.foreach(ctx, tableKey, nil, func(record storedRecord) {
+		if predicate(record.key, record.value) {
+			m.Lock()
+			records = append(records, record)
+			m.Unlock()
+		}
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	pool.Close()
+	return records, nil
+}
 
-	return tableKeys, resultValues
+// ModifiedSince returns the keys and the values of the records matching the tableKey
+// prefix which were written at or after since. Only their headers are read to select
+// them; the records stored before their update time was recorded are never returned.
+func (db *KVStoreManager) ModifiedSince(tableKey *TableKey, since time.Time) ([]*TableKey, []*any) {
+	tableKeys, values, _ := db.ModifiedSinceCtx(context.Background(), tableKey, since)
+	return tableKeys, values
+}
+
+// ModifiedSinceCtx is ModifiedSince with a context: once ctx is done, the scan stops and
+// ctx.Err() is returned.
+func (db *KVStoreManager) ModifiedSinceCtx(
+	ctx context.Context,
+	tableKey *TableKey,
+	since time.Time,
+) ([]*TableKey, []*any, error) {
+
+	records, err := db.modifiedSince(ctx, tableKey, since)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return splitRecords(records)
+}
+
+// modifiedSince is ModifiedSinceCtx, returning whole records.
+func (db *KVStoreManager) modifiedSince(
+	ctx context.Context,
+	tableKey *TableKey,
+	since time.Time,
+) ([]storedRecord, error) {
+
+	var records []storedRecord
+	var m sync.Mutex
+
+	err := db.foreach(ctx, tableKey,
+		func(header recordHeader) bool {
+			return header.updated != 0 && !time.Unix(0, header.updated).Before(since)
+		},
+		func(record storedRecord) {
+			m.Lock()
+			records = append(records, record)
+			m.Unlock()
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// splitRecords returns the keys and the values of records, as the scans of the manager
+// return them.
+func splitRecords(records []storedRecord) ([]*TableKey, []*any, error) {
+
+	var tableKeys []*TableKey
+	var values []*any
+	for _, record := range records {
+		tableKeys = append(tableKeys, record.key)
+		values = append(values, record.value)
+	}
+
+	return tableKeys, values, nil
 }
 
 //region Trigger
 
 func (db *KVStoreManager) runBeforeTriggers(
+	ctx context.Context,
 	operation Operation,
 	key IKey,
 	value *any,
@@ -437,7 +1095,7 @@ func (db *KVStoreManager) runBeforeTriggers(
 
 	pool := NewTaskPool()
 
-	for _, trig := range db.triggers {
+	for _, trig := range db.root().triggers {
 
 		if trig.IsBefore() == true &&
 			trig.TableName() == StructName(*value) &&
@@ -445,7 +1103,7 @@ func (db *KVStoreManager) runBeforeTriggers(
 
 			trigCopy := trig
 			pool.AddTask(func() {
-				ok = ok && trigCopy.StartBefore(operation, key, value)
+				ok = ok && startBefore(ctx, trigCopy, operation, key, value)
 			})
 		}
 	}
@@ -456,13 +1114,14 @@ func (db *KVStoreManager) runBeforeTriggers(
 }
 
 func (db *KVStoreManager) runAfterTriggers(
+	ctx context.Context,
 	operation Operation,
 	key IKey,
 	value *any,
 ) {
 	pool := NewTaskPool()
 
-	for _, trig := range db.triggers {
+	for _, trig := range db.root().triggers {
 
 		if trig.IsBefore() == false &&
 			trig.TableName() == StructName(*value) &&
@@ -470,7 +1129,7 @@ func (db *KVStoreManager) runAfterTriggers(
 
 			trigCopy := trig
 			pool.AddTask(func() {
-				trigCopy.StartAfter(operation, key, value)
+				startAfter(ctx, trigCopy, operation, key, value)
 			})
 		}
 	}
@@ -479,13 +1138,14 @@ func (db *KVStoreManager) runAfterTriggers(
 }
 
 func (db *KVStoreManager) withTriggerWrapper(
+	ctx context.Context,
 	key IKey,
 	value *any,
 	operation Operation,
 	action func() error,
 ) error {
 
-	if !db.runBeforeTriggers(operation, key, value) {
+	if !db.runBeforeTriggers(ctx, operation, key, value) {
 		return ErrCancelledByTrigger
 	}
 
@@ -493,7 +1153,9 @@ func (db *KVStoreManager) withTriggerWrapper(
 		return err
 	}
 
-	db.runAfterTriggers(operation, key, value)
+	db.afterCommit(func() {
+		db.runAfterTriggers(ctx, operation, key, value)
+	})
 
 	return nil
 }
@@ -107,6 +107,9 @@ func CheckGetInvalidId(
 	if !errors.Is(err, ErrInvalidId) {
 		t.Errorf("Get failed: expected %v, got %v", ErrInvalidId, err)
 	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get failed: expected %v, got %v", ErrNotFound, err)
+	}
 
 	if isFluentTest {
 		if !resultObjWrp.IsEmpty() {
@@ -760,6 +763,26 @@ func TestGet_InvalidId(t *testing.T) {
 	}, nil)
 }
 
+func TestGet_ClosedDriver(t *testing.T) {
+
+	// Arrange
+	db := prepareMemoryDb()
+	value := any(NewSimpleType("t1", "t2", 1))
+	key, _ := db.Insert(&value)
+	db.Close()
+
+	// Act
+	_, err := db.Get(key)
+
+	// Assert
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("Get failed: expected %v, got %v", ErrClosed, err)
+	}
+	if errors.Is(err, ErrInvalidId) {
+		t.Errorf("Get failed: unexpected %v", ErrInvalidId)
+	}
+}
+
 func TestSet_ValidId(t *testing.T) {
 	CheckSetValidId(t, func(db *KVStoreManager, key *TableKey, value *any) error {
 		return db.Set(key, value)
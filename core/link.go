@@ -0,0 +1,70 @@
+package core
+
+import "errors"
+
+// setLink records the link and its reverse index entry.
+func setLink(db KVDriver, link *LinkKey) error {
+	if err := db.RawSet(link.Forward(), nil); err != nil {
+		return err
+	}
+	return db.RawSet(link.Reverse(), nil)
+}
+
+// deleteLink removes the link and its reverse index entry.
+// It returns an error wrapping ErrNotFound if the link did not exist.
+func deleteLink(db KVDriver, link *LinkKey) error {
+	err := db.RawDelete(link.Forward())
+	if reverseErr := db.RawDelete(link.Reverse()); !errors.Is(reverseErr, ErrNotFound) {
+		err = errors.Join(err, reverseErr)
+	}
+	return err
+}
+
+// outgoingLinks returns the links going out of current, towards the table of target when
+// target is not nil. Only the links of current are scanned.
+func outgoingLinks(db KVDriver, current *TableKey, target *TableKey) []*LinkKey {
+
+	var links []*LinkKey
+
+	db.RawIterKey(NewLinkKey(current, target), func(key IKey) (stop bool) {
+		links = append(links, key.(*LinkKey))
+		return false
+	})
+
+	return links
+}
+
+// incomingLinks returns the links pointing to target, coming from the table of current
+// when current is not nil. Only the reverse index entries of target are scanned.
+func incomingLinks(db KVDriver, current *TableKey, target *TableKey) []*LinkKey {
+
+	var links []*LinkKey
+
+	db.RawIterKey(NewLinkKey(current, target).Reverse(), func(key IKey) (stop bool) {
+		links = append(links, key.(*LinkKey).Forward())
+		return false
+	})
+
+	return links
+}
+
+// unlinkAll removes every link going out of or pointing to tableKey.
+// It returns the keys of the objects tableKey was linking to.
+func unlinkAll(db KVDriver, tableKey *TableKey) ([]*TableKey, error) {
+
+	var targets []*TableKey
+
+	for _, link := range outgoingLinks(db, tableKey, nil) {
+		if err := deleteLink(db, link); err != nil {
+			return nil, err
+		}
+		targets = append(targets, link.TargetTableKey())
+	}
+	for _, link := range incomingLinks(db, nil, tableKey) {
+		if err := deleteLink(db, link); err != nil {
+			return nil, err
+		}
+	}
+
+	return targets, nil
+}
@@ -18,8 +18,29 @@ type IMarshaller interface {
 	Decode([]byte) (*any, error)
 }
 
+// IIdentifiedMarshaller is implemented by the marshallers naming their encoding: the id
+// is recorded in the metadata of the records they write (see RecordMeta).
+type IIdentifiedMarshaller interface {
+	IMarshaller
+	Id() string
+}
+
+// marshallerId returns the id of marshaller, or "" if it does not implement
+// IIdentifiedMarshaller.
+func marshallerId(marshaller IMarshaller) string {
+	if identified, ok := marshaller.(IIdentifiedMarshaller); ok {
+		return identified.Id()
+	}
+	return ""
+}
+
 type GobMarshaller struct{}
 
+// Id returns "gob".
+func (g *GobMarshaller) Id() string {
+	return "gob"
+}
+
 func (g *GobMarshaller) Encode(value *any) ([]byte, error) {
 
 	buffer := bytes.Buffer{}
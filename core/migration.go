@@ -0,0 +1,244 @@
+package core
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownLayout indicates a store written with a key layout newer than this version
+// of FluentKV knows.
+var ErrUnknownLayout = errors.New("the store uses a newer key layout than supported")
+
+// MigrationBatchSize is the number of entries a step of Migrate rewrites per transaction,
+// which keeps the transactions below the size the drivers accept.
+var MigrationBatchSize = 1000
+
+// migration is a step of Migrate, bringing a store from one layout version to the next a
+// batch at a time. It is called in a new transaction tx with the cursor it returned the
+// previous time, empty the first time, until it reports done. db reads the store outside
+// of tx, see nextBatch.
+type migration func(db, tx *KVStoreManager, cursor string) (next string, done bool, err error)
+
+// migrations rewrite the keys of a store from one layout to the next: migrations[i]
+// brings a store from layout version i to i+1. They are only ever appended.
+var migrations = []migration{
+	migrateLinkReverseIndex,
+	migrateIdAllocator,
+	migrateOrderedIds,
+}
+
+// LayoutVersion returns the key layout version of the store; a store which never
+// recorded it is at version 0.
+func (db *KVStoreManager) LayoutVersion() (int, error) {
+	raw, err := db.RawGet(NewTankKey(TankLayoutVersion))
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(raw))
+}
+
+// Migrate brings the keys of a persistent store to the current layout. Each step runs in
+// batches of MigrationBatchSize entries, each in its own transaction along with the
+// cursor of the step, and the recorded layout version is only bumped by the last one, so
+// an interrupted migration resumes where it stopped.
+//
+// Possible Error(s):
+//   - ErrUnknownLayout: If the store was written by a newer version.
+//   - ErrFailedToSet: If the underlying driver fails to rewrite a key.
+func (db *KVStoreManager) Migrate() error {
+
+	version, err := db.LayoutVersion()
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return ErrUnknownLayout
+	}
+
+	for ; version < len(migrations); version++ {
+		cursor, err := db.migrationCursor()
+		if err != nil {
+			return err
+		}
+
+		for done := false; !done; {
+			var next string
+			err = db.WithTx(func(tx *KVStoreManager) (err error) {
+				if next, done, err = migrations[version](db, tx, cursor); err != nil {
+					return err
+				}
+				if !done {
+					return failedToSet(tx.RawSet(NewTankKey(TankMigrationCursor), []byte(next)))
+				}
+				err = tx.RawDelete(NewTankKey(TankMigrationCursor))
+				if err != nil && !errors.Is(err, ErrNotFound) {
+					return err
+				}
+				next := strconv.Itoa(version + 1)
+				return failedToSet(tx.RawSet(NewTankKey(TankLayoutVersion), []byte(next)))
+			})
+			if err != nil {
+				return err
+			}
+			cursor = next
+		}
+	}
+
+	return nil
+}
+
+// migrationCursor returns the cursor recorded by the interrupted step of Migrate, empty
+// when the step did not start.
+func (db *KVStoreManager) migrationCursor() (string, error) {
+	raw, err := db.RawGet(NewTankKey(TankMigrationCursor))
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	return string(raw), err
+}
+
+// nextBatch returns the keys under the prefix of key stored after cursor, see sourceOf,
+// in their stored order, up to MigrationBatchSize. The drivers implementing
+// KVOrderedDriver seek to cursor; with the others, each batch takes a pass over the
+// prefix, holding no more than a batch of keys.
+func (db *KVStoreManager) nextBatch(key IKey, cursor string) []IKey {
+
+	var batch []IKey
+	if ordered, ok := db.KVDriver.(KVOrderedDriver); ok {
+		ordered.RawIterKVFrom(key, cursor, false, func(key IKey, _ []byte) (stop bool) {
+			if sourceOf(key) == cursor {
+				return false
+			}
+			batch = append(batch, key)
+			return len(batch) == MigrationBatchSize
+		})
+		return batch
+	}
+
+	db.RawIterKey(key, func(key IKey) (stop bool) {
+		source := sourceOf(key)
+		if source <= cursor ||
+			len(batch) == MigrationBatchSize && source > sourceOf(batch[len(batch)-1]) {
+			return false
+		}
+		i, _ := slices.BinarySearchFunc(batch, source, func(k IKey, source string) int {
+			return strings.Compare(sourceOf(k), source)
+		})
+		batch = slices.Insert(batch, i, key)
+		if len(batch) > MigrationBatchSize {
+			batch = batch[:MigrationBatchSize]
+		}
+		return false
+	})
+	return batch
+}
+
+// batchCursor returns the cursor following batch, and whether it was the last one.
+func batchCursor(batch []IKey) (string, bool) {
+	if len(batch) < MigrationBatchSize {
+		return "", true
+	}
+	return sourceOf(batch[len(batch)-1]), false
+}
+
+// migrateLinkReverseIndex writes the reverse index entry of every existing link, so
+// that the links pointing to an object can be found without scanning all of them.
+func migrateLinkReverseIndex(db, tx *KVStoreManager, cursor string) (string, bool, error) {
+
+	links := db.nextBatch(NewProtoLinkKey(), cursor)
+	for _, link := range links {
+		if err := setLink(tx, link.(*LinkKey)); err != nil {
+			return "", false, failedToSet(err)
+		}
+	}
+
+	next, done := batchCursor(links)
+	return next, done, nil
+}
+
+// migrateIdAllocator records the high-water mark and the free list of the IDs, computed
+// from the tables, so that the store is no longer scanned when it is opened. The seeding
+// writes its own batches outside of tx, see seedIdAllocator.
+func migrateIdAllocator(db, _ *KVStoreManager, _ string) (string, bool, error) {
+	_, _, err := seedIdAllocator(db.KVDriver)
+	return "", true, err
+}
+
+// orderedIdDomains are the domains of the keys holding an ID, in the order
+// migrateOrderedIds rewrites them.
+var orderedIdDomains = []IKey{
+	NewProtoTableKey(),
+	NewProtoLinkKey(),
+	NewProtoLinkKey().Reverse(),
+	NewProtoIndexKey(),
+	NewTrashKey(NewProtoTableKey()),
+	NewRevisionKey(NewProtoTableKey()),
+	NewProtoExpiryKey(),
+}
+
+// migrateOrderedIds rewrites the keys holding an ID, whose decimal IDs were written as
+// they are, in the order-preserving form of TableKey.Key: the records, the links and
+// their reverse index, the index entries, the trash, the revisions and the expiry entries.
+// Its cursor is the last key of the batch as stored, or the prefix of the next domain.
+func migrateOrderedIds(db, tx *KVStoreManager, cursor string) (string, bool, error) {
+
+	domain := 0
+	for i, key := range orderedIdDomains {
+		if strings.HasPrefix(cursor, key.Prefix()) {
+			domain = i
+		}
+	}
+
+	keys := db.nextBatch(orderedIdDomains[domain], cursor)
+	for _, key := range keys {
+		source := rawKey(sourceOf(key))
+		if source.Key() == key.Key() {
+			continue // Already in the order-preserving form.
+		}
+		value, err := tx.RawGet(source)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", false, err
+		}
+		if err = tx.RawSet(key, value); err != nil {
+			return "", false, failedToSet(err)
+		}
+		if err = tx.RawDelete(source); err != nil {
+			return "", false, err
+		}
+	}
+
+	if next, done := batchCursor(keys); !done {
+		return next, false, nil
+	}
+	if domain++; domain < len(orderedIdDomains) {
+		return orderedIdDomains[domain].Prefix(), false, nil
+	}
+	return "", true, nil
+}
+
+// rawKey addresses an entry by its whole key, as stored.
+type rawKey string
+
+func (k rawKey) Prefix() string {
+	return string(k)
+}
+
+func (k rawKey) RawPrefix() []byte {
+	return []byte(k)
+}
+
+func (k rawKey) Key() string {
+	return string(k)
+}
+
+func (k rawKey) RawKey() []byte {
+	return []byte(k)
+}
@@ -0,0 +1,301 @@
+package core_test
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+
+	. "github.com/Phosmachina/FluentKV/core"
+	"github.com/Phosmachina/FluentKV/driver"
+)
+
+// errTxnTooBig is returned by a boundedTx writing more entries than its limit.
+var errTxnTooBig = errors.New("the transaction is too big")
+
+// boundedDriver bounds the number of entries its transactions write, as Badger does.
+type boundedDriver struct {
+	KVDriver
+	limit int
+}
+
+func (d boundedDriver) Begin() (KVTx, error) {
+	tx, err := d.KVDriver.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &boundedTx{KVTx: tx, limit: d.limit}, nil
+}
+
+type boundedTx struct {
+	KVTx
+	limit  int
+	writes int
+}
+
+func (tx *boundedTx) RawSet(key IKey, value []byte) error {
+	if tx.writes++; tx.writes > tx.limit {
+		return errTxnTooBig
+	}
+	return tx.KVTx.RawSet(key, value)
+}
+
+func (tx *boundedTx) RawDelete(key IKey) error {
+	if tx.writes++; tx.writes > tx.limit {
+		return errTxnTooBig
+	}
+	return tx.KVTx.RawDelete(key)
+}
+
+func (tx *boundedTx) NewWriteBatch() KVWriteBatch {
+	return NewLoopWriteBatch(tx)
+}
+
+// orderedBoundedDriver is a boundedDriver over a driver keeping its keys in order.
+type orderedBoundedDriver struct {
+	boundedDriver
+	KVOrderedDriver
+}
+
+// prepareBoundedDbs returns stores whose transactions write at most limit entries, over
+// an ordered and an unordered driver, with batches of Migrate of batchSize entries.
+func prepareBoundedDbs(t *testing.T, limit int, batchSize int) map[string]*KVStoreManager {
+
+	previous := MigrationBatchSize
+	MigrationBatchSize = batchSize
+	t.Cleanup(func() { MigrationBatchSize = previous })
+
+	prepareTestableDb() // Registers the types.
+	memory := driver.NewMemory().KVDriver
+	return map[string]*KVStoreManager{
+		"ordered": NewKVStoreManager(orderedBoundedDriver{
+			boundedDriver{memory, limit},
+			memory.(KVOrderedDriver),
+		}),
+		"unordered": NewKVStoreManager(boundedDriver{driver.NewGeneric().KVDriver, limit}),
+	}
+}
+
+func TestMigrate_LinkReverseIndex(t *testing.T) {
+
+	// Arrange: links written by a previous layout have no reverse entry.
+	db := prepareTestableDb()
+	current, _ := Insert(db, NewAnotherType("t3", 1.1))
+	target, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	db.RawSet(NewLinkKey(current.Key(), target.Key()), nil)
+
+	// Act
+	err := db.Migrate()
+
+	// Assert
+	if err != nil {
+		t.Errorf("Migrate failed: expected %v, got %v", nil, err)
+	}
+	if _, err := db.RawGet(NewLinkKey(current.Key(), target.Key()).Reverse()); err != nil {
+		t.Error("Migrate failed: expected the reverse entry of the link")
+	}
+	if version, _ := db.LayoutVersion(); version == 0 {
+		t.Errorf("Migrate failed: expected the layout version to be recorded")
+	}
+	UnlinkAll[SimpleType](db, target.Key().Id())
+	if len(CollectLinked[AnotherType, SimpleType](db, current.Key().Id())) != 0 {
+		t.Error("Expecting no linked object")
+	}
+}
+
+func TestMigrate_LinkReverseIndexBatches(t *testing.T) {
+
+	for name, db := range prepareBoundedDbs(t, 50, 10) {
+		// Arrange: more links without reverse entry than a transaction can write.
+		current, _ := Insert(db, NewAnotherType("t3", 1.1))
+		for i := range 100 {
+			target, _ := Insert(db, NewSimpleType("t1", "t2", i))
+			_ = db.RawSet(NewLinkKey(current.Key(), target.Key()), nil)
+		}
+
+		// Act
+		err := db.Migrate()
+
+		// Assert
+		if err != nil {
+			t.Errorf("Migrate failed (%s): expected %v, got %v", name, nil, err)
+		}
+		reverse := 0
+		db.RawIterKey(NewProtoLinkKey().Reverse(), func(IKey) (stop bool) {
+			reverse++
+			return false
+		})
+		if reverse != 100 {
+			t.Errorf("Migrate failed (%s): expected %d reverse entries, got %d", name, 100, reverse)
+		}
+		if db.Exist(NewTankKey(TankMigrationCursor)) {
+			t.Errorf("Migrate failed (%s): expected the cursor to be dropped", name)
+		}
+	}
+}
+
+func TestMigrate_Resumes(t *testing.T) {
+
+	// Arrange: a step interrupted after the first of two links.
+	db := prepareTestableDb()
+	current, _ := Insert(db, NewAnotherType("t3", 1.1))
+	first, _ := InsertWithId(db, "a", NewSimpleType("t1", "t2", 1))
+	second, _ := InsertWithId(db, "b", NewSimpleType("t1", "t2", 2))
+	for _, target := range []*TableKey{first.Key(), second.Key()} {
+		_ = db.RawSet(NewLinkKey(current.Key(), target), nil)
+	}
+	cursor := NewLinkKey(current.Key(), first.Key()).Key()
+	_ = db.RawSet(NewTankKey(TankMigrationCursor), []byte(cursor))
+
+	// Act
+	err := db.Migrate()
+
+	// Assert
+	if err != nil {
+		t.Errorf("Migrate failed: expected %v, got %v", nil, err)
+	}
+	if db.Exist(NewLinkKey(current.Key(), first.Key()).Reverse()) {
+		t.Error("Migrate failed: expected the links before the cursor to be skipped")
+	}
+	if !db.Exist(NewLinkKey(current.Key(), second.Key()).Reverse()) {
+		t.Error("Migrate failed: expected the links after the cursor to be migrated")
+	}
+}
+
+func TestMigrate_IdAllocator(t *testing.T) {
+
+	// Arrange: a store whose IDs were only known by scanning its tables.
+	db := prepareTestableDb()
+	for _, id := range []string{"0", "2"} {
+		_ = db.RawSet(NewTableKey[SimpleType]().SetId(id), nil)
+	}
+
+	// Act
+	err := db.Migrate()
+
+	// Assert
+	if err != nil {
+		t.Errorf("Migrate failed: expected %v, got %v", nil, err)
+	}
+	if mark, _ := db.RawGet(NewTankKey(TankIdHighWater)); string(mark) != "3" {
+		t.Errorf("Migrate failed: expected the high-water mark %v, got %s", 3, mark)
+	}
+	if ids, _ := db.GetFreeIds(2); len(ids) != 2 || ids[0] != "1" || ids[1] != "3" {
+		t.Errorf("GetFreeIds failed: expected %v, got %v", []string{"1", "3"}, ids)
+	}
+}
+
+func TestMigrate_IdAllocatorBatches(t *testing.T) {
+
+	for name, db := range prepareBoundedDbs(t, 5, 2) {
+		// Arrange: more pages of free IDs than a transaction can write.
+		last := 20 * AutoIdBuffer
+		for _, id := range []int{0, last} {
+			_ = db.RawSet(NewTableKey[SimpleType]().SetId(strconv.Itoa(id)), nil)
+		}
+
+		// Act
+		err := db.Migrate()
+
+		// Assert
+		if err != nil {
+			t.Errorf("Migrate failed (%s): expected %v, got %v", name, nil, err)
+		}
+		ids, _ := db.GetFreeIds(last)
+		slices.SortFunc(ids, func(a, b string) int {
+			x, _ := strconv.Atoi(a)
+			y, _ := strconv.Atoi(b)
+			return x - y
+		})
+		if len(ids) != last || ids[0] != "1" || ids[last-2] != strconv.Itoa(last-1) {
+			t.Errorf("GetFreeIds failed (%s): expected the IDs from %d to %d, then one fresh", name, 1, last-1)
+		}
+	}
+}
+
+// legacyKey addresses an entry by its whole key, as written by a previous layout.
+type legacyKey string
+
+func (k legacyKey) Prefix() string    { return string(k) }
+func (k legacyKey) RawPrefix() []byte { return []byte(k) }
+func (k legacyKey) Key() string       { return string(k) }
+func (k legacyKey) RawKey() []byte    { return []byte(k) }
+
+func TestMigrate_OrderedIds(t *testing.T) {
+
+	// Arrange: entries written by a previous layout, with their decimal IDs as they are.
+	db := prepareMemoryDb()
+	_, _ = InsertWithId(db, "2", NewSimpleType("t1", "t2", 2))
+	target, _ := InsertWithId(db, "10", NewSimpleType("t1", "t2", 10))
+	current, _ := InsertWithId(db, "1", NewAnotherType("t3", 1.1))
+	_ = Link(current, false, target)
+	for key, legacy := range map[IKey]string{
+		NewTableKey[SimpleType]().SetId("2"):              "tbl%SimpleType_2",
+		target.Key():                                      "tbl%SimpleType_10",
+		current.Key():                                     "tbl%AnotherType_1",
+		NewLinkKey(current.Key(), target.Key()):           "lnk%AnotherType_1@SimpleType_10",
+		NewLinkKey(current.Key(), target.Key()).Reverse(): "rlk%SimpleType_10@AnotherType_1",
+	} {
+		raw, _ := db.RawGet(key)
+		_ = db.RawDelete(key)
+		_ = db.RawSet(legacyKey(legacy), raw)
+	}
+	_ = db.RawSet(NewTankKey(TankLayoutVersion), []byte("2"))
+
+	// Act
+	err := db.Migrate()
+
+	// Assert
+	if err != nil {
+		t.Errorf("Migrate failed: expected %v, got %v", nil, err)
+	}
+	var ids []string
+	db.RawIterKey(NewTableKey[SimpleType](), func(key IKey) (stop bool) {
+		ids = append(ids, key.(*TableKey).Id())
+		return false
+	})
+	if expected := []string{"2", "10"}; !slices.Equal(ids, expected) {
+		t.Errorf("Migrate failed: expected the IDs %v in order, got %v", expected, ids)
+	}
+	if db.Exist(legacyKey("tbl%SimpleType_10")) || !db.Exist(target.Key()) {
+		t.Error("Migrate failed: expected the record under its new key only")
+	}
+	if linked := CollectLinked[AnotherType, SimpleType](db, "1"); len(linked) != 1 {
+		t.Errorf("CollectLinked failed: expected %d object, got %v", 1, linked)
+	}
+	if !db.Exist(NewLinkKey(current.Key(), target.Key()).Reverse()) {
+		t.Error("Migrate failed: expected the reverse entry of the link under its new key")
+	}
+}
+
+func TestMigrate_OrderedIdsBatches(t *testing.T) {
+
+	for name, db := range prepareBoundedDbs(t, 25, 10) {
+		// Arrange: more records written by a previous layout than a transaction can rewrite.
+		for i := range 100 {
+			id := strconv.Itoa(i)
+			record, _ := InsertWithId(db, id, NewSimpleType("t1", "t2", i))
+			raw, _ := db.RawGet(record.Key())
+			_ = db.RawDelete(record.Key())
+			_ = db.RawSet(legacyKey("tbl%SimpleType_"+id), raw)
+		}
+		_ = db.RawSet(NewTankKey(TankLayoutVersion), []byte("2"))
+
+		// Act
+		err := db.Migrate()
+
+		// Assert
+		if err != nil {
+			t.Errorf("Migrate failed (%s): expected %v, got %v", name, nil, err)
+		}
+		if ct := Count[SimpleType](db); ct != 100 {
+			t.Errorf("Count failed (%s): expected %d, got %d", name, 100, ct)
+		}
+		for i := range 100 {
+			if id := strconv.Itoa(i); db.Exist(legacyKey("tbl%SimpleType_" + id)) {
+				t.Errorf("Migrate failed (%s): expected %v under its new key only", name, id)
+				break
+			}
+		}
+	}
+}
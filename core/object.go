@@ -1,9 +1,10 @@
 package core
 
 type KVWrapper[T any] struct {
-	db    *KVStoreManager
-	key   *TableKey
-	value *T
+	db     *KVStoreManager
+	key    *TableKey
+	value  *T
+	header recordHeader
 }
 
 func (w *KVWrapper[T]) IsEmpty() bool {
@@ -18,6 +19,21 @@ func (w *KVWrapper[T]) Value() *T {
 	return w.value
 }
 
+// Version returns the version of the record when the wrapper was made: 1 once inserted,
+// incremented by each write. SetWrp only succeeds while the record is still at it.
+// Version 0 stands for an unknown version: the one of the wrappers made with
+// NewKVWrapper, and of the records stored before versions existed.
+func (w *KVWrapper[T]) Version() uint64 {
+	return w.header.version
+}
+
+// Meta returns the metadata of the record when the wrapper was made: its version, the
+// times it was created and last updated, and the marshaller which encoded it. It is zero
+// for the wrappers made with NewKVWrapper.
+func (w *KVWrapper[T]) Meta() RecordMeta {
+	return w.header.meta()
+}
+
 func NewKVWrapper[T any](
 	db *KVStoreManager,
 	key *TableKey,
@@ -26,4 +42,20 @@ func NewKVWrapper[T any](
 	return KVWrapper[T]{db: db, key: key, value: value}
 }
 
+// newRecordWrapper wraps value, stored under key with header.
+func newRecordWrapper[T any](
+	db *KVStoreManager,
+	key *TableKey,
+	value *T,
+	header recordHeader,
+) KVWrapper[T] {
+	return KVWrapper[T]{db: db, key: key, value: value, header: header}
+}
+
+// wrapRecord wraps a record read from db, holding a T.
+func wrapRecord[T any](db *KVStoreManager, record storedRecord) KVWrapper[T] {
+	valueAsT := (*record.value).(T)
+	return newRecordWrapper(db, record.key, &valueAsT, record.header)
+}
+
 // TODO rename all S and T by something more intuitive like 'current' and 'target'.
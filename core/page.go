@@ -0,0 +1,185 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor indicates a cursor which was not returned by a page.
+var ErrInvalidCursor = errors.New("the cursor is invalid")
+
+// Page returns the records of the table of tableKey following cursor, up to limit, in the
+// order of their keys, with the cursor of the next page, empty after the last one. An
+// empty cursor starts from the first record, and a limit of 0 or less reads them all.
+//
+// A cursor only holds the key of the last record returned, so that a page starts right
+// after it even if records were inserted or deleted meanwhile, including that one. The
+// drivers implementing KVOrderedDriver seek straight to it; the others list the keys of
+// the table first.
+//
+// Possible Error:
+//   - ErrInvalidCursor: If cursor was not returned by a page.
+func (db *KVStoreManager) Page(tableKey *TableKey, cursor string, limit int) (
+	[]*TableKey,
+	[]*any,
+	string,
+	error,
+) {
+	return db.PageCtx(context.Background(), tableKey, cursor, limit)
+}
+
+// PageCtx is Page with a context: the scan stops once ctx is done, returning ctx.Err().
+func (db *KVStoreManager) PageCtx(ctx context.Context, tableKey *TableKey, cursor string, limit int) (
+	[]*TableKey,
+	[]*any,
+	string,
+	error,
+) {
+	return db.pageRecords(ctx, tableKey, cursor, limit, false)
+}
+
+// PageReverse is Page in the reverse order of the keys: an empty cursor starts from the
+// last record.
+func (db *KVStoreManager) PageReverse(tableKey *TableKey, cursor string, limit int) (
+	[]*TableKey,
+	[]*any,
+	string,
+	error,
+) {
+	return db.PageReverseCtx(context.Background(), tableKey, cursor, limit)
+}
+
+// PageReverseCtx is PageReverse with a context: the scan stops once ctx is done,
+// returning ctx.Err().
+func (db *KVStoreManager) PageReverseCtx(ctx context.Context, tableKey *TableKey, cursor string, limit int) (
+	[]*TableKey,
+	[]*any,
+	string,
+	error,
+) {
+	return db.pageRecords(ctx, tableKey, cursor, limit, true)
+}
+
+// pageRecords is PageCtx, or PageReverseCtx when reverse is set, splitting the records.
+func (db *KVStoreManager) pageRecords(
+	ctx context.Context,
+	tableKey *TableKey,
+	cursor string,
+	limit int,
+	reverse bool,
+) ([]*TableKey, []*any, string, error) {
+
+	records, next, err := db.page(ctx, tableKey, cursor, limit, reverse)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	tableKeys, values, _ := splitRecords(records)
+	return tableKeys, values, next, nil
+}
+
+// page is PageCtx, or PageReverseCtx when reverse is set, returning whole records.
+func (db *KVStoreManager) page(
+	ctx context.Context,
+	tableKey *TableKey,
+	cursor string,
+	limit int,
+	reverse bool,
+) (records []storedRecord, next string, err error) {
+
+	prefix := NewProtoTableKey().setName(tableKey.Name())
+	start := ""
+	if cursor != "" {
+		id, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil || len(id) == 0 {
+			return nil, "", ErrInvalidCursor
+		}
+		start = NewProtoTableKey().setName(tableKey.Name()).SetId(string(id)).Key()
+	}
+
+	more := false
+	now := time.Now().UnixNano()
+	db.rawIterKVFrom(prefix, start, reverse, func(key IKey, raw []byte) (stop bool) {
+		if ctx.Err() != nil {
+			return true
+		}
+		if key.Key() == start {
+			return false // The last record of the previous page.
+		}
+		header, _, err := decodeRecord(raw)
+		if err != nil || !db.isLive(header, now) {
+			return false
+		}
+		if limit > 0 && len(records) == limit {
+			more = true
+			return true
+		}
+		value, header, err := db.decode(raw)
+		if err != nil {
+			return false
+		}
+		records = append(records, storedRecord{key: key.(*TableKey), value: value, header: header})
+		return false
+	})
+
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if more {
+		next = encodeCursor(records[len(records)-1].key)
+	}
+
+	return records, next, nil
+}
+
+// rawIterKVFrom calls action on the entries under the prefix of key, as does
+// KVOrderedDriver.RawIterKVFrom. Without such a driver, the keys are listed and sorted
+// first, then the values read one by one.
+func (db *KVStoreManager) rawIterKVFrom(
+	key IKey,
+	start string,
+	reverse bool,
+	action func(key IKey, value []byte) (stop bool),
+) {
+	if ordered, ok := db.KVDriver.(KVOrderedDriver); ok {
+		ordered.RawIterKVFrom(key, start, reverse, action)
+		return
+	}
+
+	var keys []IKey
+	db.RawIterKey(key, func(key IKey) (stop bool) {
+		if start == "" ||
+			!reverse && key.Key() >= start ||
+			reverse && key.Key() <= start {
+			keys = append(keys, key)
+		}
+		return false
+	})
+
+	slices.SortFunc(keys, func(a, b IKey) int {
+		if reverse {
+			return strings.Compare(b.Key(), a.Key())
+		}
+		return strings.Compare(a.Key(), b.Key())
+	})
+
+	for _, k := range keys {
+		raw, err := db.RawGet(k)
+		if err != nil {
+			continue // Deleted since listed.
+		}
+		if action(k, raw) {
+			return
+		}
+	}
+}
+
+// encodeCursor returns the cursor of a page ending with the record of tableKey.
+func encodeCursor(tableKey *TableKey) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(tableKey.Id()))
+}
@@ -0,0 +1,111 @@
+package core_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	. "github.com/Phosmachina/FluentKV/core"
+	"github.com/Phosmachina/FluentKV/driver"
+)
+
+func preparePagedDb(db *KVStoreManager) *KVStoreManager {
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		_, _ = InsertWithId(db, id, NewSimpleType(id, "", 0))
+	}
+	return db
+}
+
+func ids(wrappers []KVWrapper[SimpleType]) []string {
+	var result []string
+	for _, wrapper := range wrappers {
+		result = append(result, wrapper.Key().Id())
+	}
+	return result
+}
+
+// readPages returns the IDs of each page read from the first one.
+func readPages(db *KVStoreManager, limit int, reverse bool) (pages [][]string, err error) {
+
+	read := Page[SimpleType]
+	if reverse {
+		read = PageReverse[SimpleType]
+	}
+
+	cursor := ""
+	for {
+		result, err := read(db, cursor, limit)
+		if err != nil {
+			return pages, err
+		}
+		pages = append(pages, ids(result.Items))
+		if result.Next == "" {
+			return pages, nil
+		}
+		cursor = result.Next
+	}
+}
+
+func TestPage(t *testing.T) {
+
+	for name, db := range map[string]*KVStoreManager{
+		"ordered":   prepareTestableDb(),
+		"unordered": driver.NewGeneric(),
+	} {
+		// Arrange
+		preparePagedDb(db)
+
+		// Act
+		pages, err := readPages(db, 2, false)
+		reversed, errReverse := readPages(db, 2, true)
+
+		// Assert
+		if expected := [][]string{{"a", "b"}, {"c", "d"}, {"e"}}; err != nil ||
+			!slices.EqualFunc(pages, expected, slices.Equal) {
+			t.Errorf("Page failed (%s): expected %v, got %v (%v)", name, expected, pages, err)
+		}
+		if expected := [][]string{{"e", "d"}, {"c", "b"}, {"a"}}; errReverse != nil ||
+			!slices.EqualFunc(reversed, expected, slices.Equal) {
+			t.Errorf("PageReverse failed (%s): expected %v, got %v (%v)", name, expected, reversed, errReverse)
+		}
+	}
+}
+
+func TestPage_Changes(t *testing.T) {
+
+	// Arrange
+	db := preparePagedDb(prepareTestableDb())
+	first, _ := Page[SimpleType](db, "", 2)
+	_ = Delete[SimpleType](db, "b")
+	_, _ = InsertWithId(db, "bb", NewSimpleType("bb", "", 0))
+	_, _ = InsertWithId(db, "0", NewSimpleType("0", "", 0))
+
+	// Act
+	second, err := Page[SimpleType](db, first.Next, 2)
+	back, errBack := PageReverse[SimpleType](db, second.Previous, 0)
+
+	// Assert
+	if expected := []string{"bb", "c"}; err != nil || !slices.Equal(ids(second.Items), expected) {
+		t.Errorf("Page failed: expected %v, got %v (%v)", expected, ids(second.Items), err)
+	}
+	if expected := []string{"a", "0"}; errBack != nil || !slices.Equal(ids(back.Items), expected) {
+		t.Errorf("PageReverse failed: expected %v, got %v (%v)", expected, ids(back.Items), errBack)
+	}
+	if back.Next != "" {
+		t.Errorf("PageReverse failed: expected no next page, got %q", back.Next)
+	}
+}
+
+func TestPage_InvalidCursor(t *testing.T) {
+
+	// Arrange
+	db := preparePagedDb(prepareTestableDb())
+
+	// Act
+	_, err := Page[SimpleType](db, "not a cursor!", 2)
+
+	// Assert
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Page failed: expected %v, got %v", ErrInvalidCursor, err)
+	}
+}
@@ -0,0 +1,699 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidQuery indicates a query naming an unknown field, or comparing a field with a
+// value of an incompatible type.
+var ErrInvalidQuery = errors.New("the query is invalid")
+
+// Operator compares the value of a field with the one given to QueryBuilder.Where.
+type Operator int
+
+const (
+	// Eq matches the fields equal to the value.
+	Eq Operator = iota
+	// Ne matches the fields different from the value.
+	Ne
+	// Gt matches the fields greater than the value.
+	Gt
+	// Ge matches the fields greater than or equal to the value.
+	Ge
+	// Lt matches the fields less than the value.
+	Lt
+	// Le matches the fields less than or equal to the value.
+	Le
+	// In matches the fields equal to one of the elements of the value, a slice.
+	In
+	// Contains matches the strings holding the value, and the slices holding an element
+	// equal to it.
+	Contains
+)
+
+// Direction orders the results of a query, see QueryBuilder.OrderBy.
+type Direction int
+
+const (
+	// Asc orders from the least value to the greatest.
+	Asc Direction = iota
+	// Desc orders from the greatest value to the least.
+	Desc
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// QueryBuilder selects records of the table of T by conditions on their fields, then
+// orders and pages them; it is made by Query. The conditions apply together.
+//
+// A condition Eq or In on a field with a secondary index of the same name, as declared by
+// the struct tags, is looked up through the index. Otherwise, the table is scanned one
+// record at a time, and the scan stops as soon as the page is complete when the results
+// are not ordered. Without OrderBy, the results come in the order of the scan.
+type QueryBuilder[T any] struct {
+	db         *KVStoreManager
+	conditions []condition
+	orders     []order
+	limit      int
+	offset     int
+	err        error
+}
+
+// condition is a condition of a query on the field at path.
+type condition struct {
+	path     fieldPath
+	operator Operator
+	value    reflect.Value
+	values   []reflect.Value // The elements of the value of In.
+}
+
+// order is an ordering of a query on the field at path.
+type order struct {
+	path      fieldPath
+	direction Direction
+}
+
+// Query starts a query over the objects of type T.
+func Query[T any](db *KVStoreManager) *QueryBuilder[T] {
+	return &QueryBuilder[T]{db: db}
+}
+
+// Where adds a condition on the field at path, a field name or a dotted path through
+// nested structs such as "Address.City"; pointers along the path are followed, and an
+// object with a nil one does not match. A field is compared with value as a number, a
+// string, a bool or a time.Time, or else for equality only.
+// The query fails with ErrInvalidQuery if the field does not exist or can not be compared
+// with value with this operator.
+func (q *QueryBuilder[T]) Where(path string, operator Operator, value any) *QueryBuilder[T] {
+
+	if q.err != nil {
+		return q
+	}
+
+	c, err := newCondition(reflect.TypeFor[T](), path, operator, value)
+	if err != nil {
+		q.err = err
+		return q
+	}
+	q.conditions = append(q.conditions, c)
+
+	return q
+}
+
+// And adds a condition, as Where does.
+func (q *QueryBuilder[T]) And(path string, operator Operator, value any) *QueryBuilder[T] {
+	return q.Where(path, operator, value)
+}
+
+// OrderBy orders the results by the field at path, see Where; the objects for which it is
+// missing come first. Each call adds an ordering, applied to the objects the previous
+// ones leave tied.
+func (q *QueryBuilder[T]) OrderBy(path string, direction Direction) *QueryBuilder[T] {
+
+	if q.err != nil {
+		return q
+	}
+
+	resolved, err := resolvePath(reflect.TypeFor[T](), path)
+	if err == nil && !orderable(resolved.typ) {
+		err = fmt.Errorf("%w: the field %s can not be ordered", ErrInvalidQuery, path)
+	}
+	if err != nil {
+		q.err = err
+		return q
+	}
+	q.orders = append(q.orders, order{path: resolved, direction: direction})
+
+	return q
+}
+
+// Limit caps the number of results; 0 means no cap.
+func (q *QueryBuilder[T]) Limit(limit int) *QueryBuilder[T] {
+	q.limit = max(limit, 0)
+	return q
+}
+
+// Offset skips the given number of results first.
+func (q *QueryBuilder[T]) Offset(offset int) *QueryBuilder[T] {
+	q.offset = max(offset, 0)
+	return q
+}
+
+// All returns the wrappers of the objects matching the query.
+func (q *QueryBuilder[T]) All() ([]KVWrapper[T], error) {
+	return q.AllCtx(context.Background())
+}
+
+// AllCtx is All with a context: the scan stops once ctx is done, returning ctx.Err().
+func (q *QueryBuilder[T]) AllCtx(ctx context.Context) ([]KVWrapper[T], error) {
+
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	// Without ordering, the results are known once the page is complete.
+	wanted := -1
+	if len(q.orders) == 0 && q.limit > 0 {
+		wanted = q.offset + q.limit
+	}
+
+	var results []KVWrapper[T]
+	err := q.scan(ctx, func(wrapper KVWrapper[T]) (stop bool) {
+		results = append(results, wrapper)
+		return len(results) == wanted
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	q.sort(results)
+
+	start := min(q.offset, len(results))
+	end := len(results)
+	if q.limit > 0 {
+		end = min(start+q.limit, end)
+	}
+
+	return results[start:end], nil
+}
+
+// Count returns how many objects All would return.
+func (q *QueryBuilder[T]) Count() (int, error) {
+	return q.CountCtx(context.Background())
+}
+
+// CountCtx is Count with a context: the scan stops once ctx is done, returning ctx.Err().
+func (q *QueryBuilder[T]) CountCtx(ctx context.Context) (int, error) {
+
+	if q.err != nil {
+		return 0, q.err
+	}
+
+	ct := 0
+	err := q.scan(ctx, func(KVWrapper[T]) (stop bool) {
+		ct++
+		return q.limit > 0 && ct == q.offset+q.limit
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	ct = max(ct-q.offset, 0)
+	if q.limit > 0 {
+		ct = min(ct, q.limit)
+	}
+
+	return ct, nil
+}
+
+// First returns the wrapper of the first object All would return, or an empty wrapper
+// (see KVWrapper.IsEmpty) if there is none.
+func (q *QueryBuilder[T]) First() (KVWrapper[T], error) {
+	return q.FirstCtx(context.Background())
+}
+
+// FirstCtx is First with a context: the scan stops once ctx is done, returning ctx.Err().
+func (q *QueryBuilder[T]) FirstCtx(ctx context.Context) (KVWrapper[T], error) {
+
+	first := *q
+	first.limit = 1
+
+	results, err := first.AllCtx(ctx)
+	if err != nil || len(results) == 0 {
+		return KVWrapper[T]{}, err
+	}
+
+	return results[0], nil
+}
+
+// Exists reports whether All would return an object.
+func (q *QueryBuilder[T]) Exists() (bool, error) {
+	return q.ExistsCtx(context.Background())
+}
+
+// ExistsCtx is Exists with a context: the scan stops once ctx is done, returning
+// ctx.Err().
+func (q *QueryBuilder[T]) ExistsCtx(ctx context.Context) (bool, error) {
+	first, err := q.FirstCtx(ctx)
+	return !first.IsEmpty(), err
+}
+
+// Delete deletes the objects All would return, each in its own transaction as with
+// Delete, and returns how many were deleted. The objects deleted meanwhile by someone
+// else are skipped.
+func (q *QueryBuilder[T]) Delete() (int, error) {
+	return q.DeleteCtx(context.Background())
+}
+
+// DeleteCtx is Delete with a context, handed to the triggers: the deletion stops once ctx
+// is done, returning ctx.Err().
+func (q *QueryBuilder[T]) DeleteCtx(ctx context.Context) (int, error) {
+
+	results, err := q.AllCtx(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, result := range results {
+		err = q.db.DeleteCtx(ctx, result.key)
+		if errors.Is(err, ErrInvalidId) {
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// scan calls do with the wrapper of each live object matching the conditions, until it
+// returns true. The objects come from an index when a condition fits one, or from the
+// whole table otherwise.
+func (q *QueryBuilder[T]) scan(ctx context.Context, do func(wrapper KVWrapper[T]) (stop bool)) error {
+
+	now := time.Now().UnixNano()
+	visit := func(key *TableKey, raw []byte) (stop bool) {
+		if ctx.Err() != nil {
+			return true
+		}
+		value, header, err := q.db.decode(raw)
+		if err != nil || !q.db.isLive(header, now) {
+			return false
+		}
+		valueAsT, ok := (*value).(T)
+		if !ok || !q.matches(reflect.ValueOf(valueAsT)) {
+			return false
+		}
+		return do(newRecordWrapper(q.db, key, &valueAsT, header))
+	}
+
+	keys, indexed := q.indexedKeys(ctx)
+	if !indexed {
+		q.db.RawIterKV(NewTableKey[T](), func(key IKey, raw []byte) (stop bool) {
+			return visit(key.(*TableKey), raw)
+		})
+		return ctx.Err()
+	}
+
+	for _, key := range keys {
+		raw, err := q.db.RawGet(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if visit(key, raw) {
+			break
+		}
+	}
+
+	return ctx.Err()
+}
+
+// indexedKeys returns the keys of the records the index of the first Eq or In condition
+// having one lists for its values; indexed is false when no condition has an index. Only
+// the indexes of the struct tags are used: an index of AddIndex may hold other values
+// than its field.
+func (q *QueryBuilder[T]) indexedKeys(ctx context.Context) (keys []*TableKey, indexed bool) {
+
+	var t T
+	table := NewTableKey[T]().Name()
+	q.db.schemaOf(t) // Declares the indexes of the struct tags.
+
+	for _, c := range q.conditions {
+		if c.operator != Eq && c.operator != In || !indexable(c.path.typ) ||
+			!q.db.hasFieldIndex(table, c.path.name) {
+			continue
+		}
+
+		values := c.values
+		if c.operator == Eq {
+			values = []reflect.Value{c.value}
+		}
+
+		seen := make(map[string]bool)
+		for _, value := range values {
+			indexed, ok := indexValue(value, c.path.typ)
+			if !ok {
+				continue // No value of the field equals it.
+			}
+			indexKey := NewIndexKey(table, c.path.name).SetValue(indexed)
+			q.db.RawIterKey(indexKey, func(key IKey) (stop bool) {
+				tableKey := key.(*IndexKey).TableKey()
+				if !seen[tableKey.Key()] {
+					seen[tableKey.Key()] = true
+					keys = append(keys, tableKey)
+				}
+				return ctx.Err() != nil
+			})
+		}
+
+		return keys, true
+	}
+
+	return nil, false
+}
+
+// indexValue returns value as a value of the field type typ, as the index entries hold
+// it, so that both are formatted alike; ok is false when no value of typ equals it.
+func indexValue(value reflect.Value, typ reflect.Type) (indexed any, ok bool) {
+
+	value = indirect(value)
+	if !value.IsValid() || !value.Type().ConvertibleTo(typ) {
+		return nil, false
+	}
+	converted := value.Convert(typ)
+	if !equalValues(converted, value) {
+		return nil, false
+	}
+
+	return converted.Interface(), true
+}
+
+// matches reports whether value meets every condition.
+func (q *QueryBuilder[T]) matches(value reflect.Value) bool {
+	for _, c := range q.conditions {
+		if !c.matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// sort orders results by the orderings of the query, if any.
+func (q *QueryBuilder[T]) sort(results []KVWrapper[T]) {
+
+	if len(q.orders) == 0 {
+		return
+	}
+
+	slices.SortStableFunc(results, func(a, b KVWrapper[T]) int {
+		for _, o := range q.orders {
+			x, okX := o.path.get(reflect.ValueOf(*a.value))
+			y, okY := o.path.get(reflect.ValueOf(*b.value))
+
+			var c int
+			switch {
+			case !okX || !okY:
+				c = cmp.Compare(boolRank(okX), boolRank(okY))
+			default:
+				c, _ = compareValues(x, y)
+			}
+			if o.direction == Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+}
+
+// newCondition checks that the field at path of t can be compared with value by operator.
+func newCondition(t reflect.Type, path string, operator Operator, value any) (condition, error) {
+
+	resolved, err := resolvePath(t, path)
+	if err != nil {
+		return condition{}, err
+	}
+	c := condition{path: resolved, operator: operator, value: reflect.ValueOf(value)}
+
+	invalid := func(reason string) (condition, error) {
+		return condition{}, fmt.Errorf("%w: the field %s %s", ErrInvalidQuery, path, reason)
+	}
+	if value == nil {
+		return invalid("can not be compared with nil")
+	}
+	valueType := indirectType(c.value.Type())
+
+	switch operator {
+	case Eq, Ne:
+		if !compatible(resolved.typ, valueType) {
+			return invalid("can not be compared with a " + valueType.String())
+		}
+	case Gt, Ge, Lt, Le:
+		if !orderable(resolved.typ) || !compatible(resolved.typ, valueType) {
+			return invalid("can not be ordered against a " + valueType.String())
+		}
+	case In:
+		if valueType.Kind() != reflect.Slice && valueType.Kind() != reflect.Array {
+			return invalid("needs a slice to be compared with In")
+		}
+		if !compatible(resolved.typ, indirectType(valueType.Elem())) {
+			return invalid("can not be compared with the elements of a " + valueType.String())
+		}
+		elements := indirect(c.value)
+		for i := 0; i < elements.Len(); i++ {
+			c.values = append(c.values, elements.Index(i))
+		}
+	case Contains:
+		switch resolved.typ.Kind() {
+		case reflect.String:
+			if valueType.Kind() != reflect.String {
+				return invalid("can only contain a string")
+			}
+		case reflect.Slice, reflect.Array:
+			if !compatible(indirectType(resolved.typ.Elem()), valueType) {
+				return invalid("can not contain a " + valueType.String())
+			}
+		case reflect.Interface:
+		default:
+			return invalid("can not contain anything")
+		}
+	default:
+		return invalid("has an unknown operator")
+	}
+
+	return c, nil
+}
+
+// matches reports whether the field of value meets the condition. An object whose field
+// is missing, through a nil pointer, does not.
+func (c condition) matches(value reflect.Value) bool {
+
+	field, ok := c.path.get(value)
+	if !ok {
+		return false
+	}
+
+	switch c.operator {
+	case Eq:
+		return equalValues(field, c.value)
+	case Ne:
+		return !equalValues(field, c.value)
+	case In:
+		return slices.ContainsFunc(c.values, func(element reflect.Value) bool {
+			return equalValues(field, element)
+		})
+	case Contains:
+		switch field.Kind() {
+		case reflect.String:
+			value := indirect(c.value)
+			return value.Kind() == reflect.String && strings.Contains(field.String(), value.String())
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < field.Len(); i++ {
+				if equalValues(field.Index(i), c.value) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	r, ok := compareValues(field, c.value)
+	if !ok {
+		return false
+	}
+	switch c.operator {
+	case Gt:
+		return r > 0
+	case Ge:
+		return r >= 0
+	case Lt:
+		return r < 0
+	case Le:
+		return r <= 0
+	}
+
+	return false
+}
+
+// fieldPath locates a field within the nested structs of a value.
+type fieldPath struct {
+	name    string
+	indexes [][]int      // The index of the field at each step, see reflect.StructField.
+	typ     reflect.Type // The type of the field, pointers removed.
+}
+
+// resolvePath resolves path, dotted field names, within t.
+func resolvePath(t reflect.Type, path string) (fieldPath, error) {
+
+	resolved := fieldPath{name: path}
+	current := t
+
+	for _, name := range strings.Split(path, ".") {
+		current = indirectType(current)
+		if current.Kind() != reflect.Struct {
+			return resolved, fmt.Errorf("%w: %s is not a struct in %s", ErrInvalidQuery, current, path)
+		}
+		field, ok := current.FieldByName(name)
+		if !ok || !field.IsExported() {
+			return resolved, fmt.Errorf("%w: no exported field %s in %s", ErrInvalidQuery, name, current)
+		}
+		resolved.indexes = append(resolved.indexes, field.Index)
+		current = field.Type
+	}
+	resolved.typ = indirectType(current)
+
+	return resolved, nil
+}
+
+// get returns the field of value at the path, pointers removed; ok is false when a nil
+// pointer is met on the way.
+func (p fieldPath) get(value reflect.Value) (field reflect.Value, ok bool) {
+
+	field = value
+	for _, index := range p.indexes {
+		field = indirect(field)
+		if !field.IsValid() {
+			return field, false
+		}
+		var err error
+		if field, err = field.FieldByIndexErr(index); err != nil {
+			return field, false
+		}
+	}
+	field = indirect(field)
+
+	return field, field.IsValid()
+}
+
+// indirect follows the pointers and interfaces of v, down to an invalid value on nil.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// indirectType follows the pointers of t.
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// compareValues orders a and b when they are both numbers, strings, bools or times; ok is
+// false otherwise.
+func compareValues(a, b reflect.Value) (r int, ok bool) {
+
+	a, b = indirect(a), indirect(b)
+	if !a.IsValid() || !b.IsValid() {
+		return 0, false
+	}
+
+	switch {
+	case isInt(a.Kind()) && isInt(b.Kind()):
+		return cmp.Compare(a.Int(), b.Int()), true
+	case isUint(a.Kind()) && isUint(b.Kind()):
+		return cmp.Compare(a.Uint(), b.Uint()), true
+	case isNumber(a.Kind()) && isNumber(b.Kind()):
+		return cmp.Compare(toFloat(a), toFloat(b)), true
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return strings.Compare(a.String(), b.String()), true
+	case a.Kind() == reflect.Bool && b.Kind() == reflect.Bool:
+		return cmp.Compare(boolRank(a.Bool()), boolRank(b.Bool())), true
+	case a.Type() == timeType && b.Type() == timeType:
+		return a.Interface().(time.Time).Compare(b.Interface().(time.Time)), true
+	}
+
+	return 0, false
+}
+
+// equalValues reports whether a and b are equal, as numbers, strings, bools or times when
+// they are, or else when they are deeply equal.
+func equalValues(a, b reflect.Value) bool {
+
+	if r, ok := compareValues(a, b); ok {
+		return r == 0
+	}
+
+	a, b = indirect(a), indirect(b)
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() == b.IsValid()
+	}
+
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// compatible reports whether the values of the field type can be compared with the ones
+// of the value type. Fields of an interface type are checked on each value.
+func compatible(field, value reflect.Type) bool {
+	switch {
+	case field.Kind() == reflect.Interface, value.AssignableTo(field):
+		return true
+	case isNumber(field.Kind()):
+		return isNumber(value.Kind())
+	case field.Kind() == reflect.String, field.Kind() == reflect.Bool:
+		return value.Kind() == field.Kind()
+	}
+	return false
+}
+
+// orderable reports whether the values of t can be ordered.
+func orderable(t reflect.Type) bool {
+	return isNumber(t.Kind()) || t.Kind() == reflect.String || t == timeType ||
+		t.Kind() == reflect.Interface
+}
+
+// indexable reports whether the values of t are found in an index by their value alone.
+func indexable(t reflect.Type) bool {
+	return isNumber(t.Kind()) || t.Kind() == reflect.String || t.Kind() == reflect.Bool
+}
+
+func isInt(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Int64
+}
+
+func isUint(kind reflect.Kind) bool {
+	return kind >= reflect.Uint && kind <= reflect.Uintptr
+}
+
+func isNumber(kind reflect.Kind) bool {
+	return isInt(kind) || isUint(kind) || kind == reflect.Float32 || kind == reflect.Float64
+}
+
+// toFloat returns the number v as a float64.
+func toFloat(v reflect.Value) float64 {
+	switch {
+	case isInt(v.Kind()):
+		return float64(v.Int())
+	case isUint(v.Kind()):
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+// boolRank ranks false before true.
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
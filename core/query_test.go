@@ -0,0 +1,239 @@
+package core_test
+
+import (
+	"encoding/gob"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/Phosmachina/FluentKV/core"
+)
+
+type Address struct {
+	City string
+}
+
+type PersonType struct {
+	Name    string
+	Age     int
+	Tags    []string
+	Address *Address
+}
+
+func NewPersonType(name string, age int, city string, tags ...string) *PersonType {
+	person := &PersonType{Name: name, Age: age, Tags: tags}
+	if city != "" {
+		person.Address = &Address{City: city}
+	}
+	return person
+}
+
+func preparePersonDb() *KVStoreManager {
+	gob.Register(PersonType{})
+	db := prepareTestableDb()
+	_, _ = Insert(db, NewPersonType("Ada", 36, "London", "math"))
+	_, _ = Insert(db, NewPersonType("Alan", 41, "London", "math", "crypto"))
+	_, _ = Insert(db, NewPersonType("Grace", 85, "New York", "navy"))
+	_, _ = Insert(db, NewPersonType("Linus", 28, ""))
+	return db
+}
+
+func names(wrappers []KVWrapper[PersonType]) []string {
+	var result []string
+	for _, wrapper := range wrappers {
+		result = append(result, wrapper.Value().Name)
+	}
+	return result
+}
+
+func TestQuery_All(t *testing.T) {
+
+	// Arrange
+	db := preparePersonDb()
+
+	// Act
+	results, err := Query[PersonType](db).
+		Where("Age", Gt, 30).
+		And("Address.City", Eq, "London").
+		OrderBy("Name", Desc).
+		All()
+
+	// Assert
+	if expected := []string{"Alan", "Ada"}; err != nil || !slices.Equal(names(results), expected) {
+		t.Errorf("All failed: expected %v, got %v (%v)", expected, names(results), err)
+	}
+}
+
+func TestQuery_Operators(t *testing.T) {
+
+	// Arrange
+	db := preparePersonDb()
+	tests := []struct {
+		path     string
+		operator Operator
+		value    any
+		expected []string
+	}{
+		{"Age", Ge, 41, []string{"Alan", "Grace"}},
+		{"Age", Lt, 36.5, []string{"Ada", "Linus"}},
+		{"Age", Le, int64(36), []string{"Ada", "Linus"}},
+		{"Name", Ne, "Ada", []string{"Alan", "Grace", "Linus"}},
+		{"Name", In, []string{"Grace", "Linus", "Bob"}, []string{"Grace", "Linus"}},
+		{"Name", Contains, "la", []string{"Alan"}},
+		{"Tags", Contains, "math", []string{"Ada", "Alan"}},
+		{"Address.City", Ne, "London", []string{"Grace"}},
+	}
+
+	for _, test := range tests {
+		// Act
+		results, err := Query[PersonType](db).
+			Where(test.path, test.operator, test.value).
+			OrderBy("Name", Asc).
+			All()
+
+		// Assert
+		if err != nil || !slices.Equal(names(results), test.expected) {
+			t.Errorf("All failed for %s %v %v: expected %v, got %v (%v)",
+				test.path, test.operator, test.value, test.expected, names(results), err)
+		}
+	}
+}
+
+func TestQuery_LimitOffset(t *testing.T) {
+
+	// Arrange
+	db := preparePersonDb()
+	query := Query[PersonType](db).OrderBy("Age", Asc).Offset(1).Limit(2)
+
+	// Act
+	results, err := query.All()
+	ct, errCount := query.Count()
+	first, errFirst := Query[PersonType](db).OrderBy("Age", Desc).First()
+	exists, errExists := Query[PersonType](db).Where("Age", Gt, 100).Exists()
+
+	// Assert
+	if expected := []string{"Ada", "Alan"}; err != nil || !slices.Equal(names(results), expected) {
+		t.Errorf("All failed: expected %v, got %v (%v)", expected, names(results), err)
+	}
+	if errCount != nil || ct != 2 {
+		t.Errorf("Count failed: expected %d, got %d (%v)", 2, ct, errCount)
+	}
+	if errFirst != nil || first.Value().Name != "Grace" {
+		t.Errorf("First failed: expected %v, got %v (%v)", "Grace", first.Value(), errFirst)
+	}
+	if errExists != nil || exists {
+		t.Errorf("Exists failed: expected %v, got %v (%v)", false, exists, errExists)
+	}
+}
+
+func TestQuery_Delete(t *testing.T) {
+
+	// Arrange
+	db := preparePersonDb()
+
+	// Act
+	deleted, err := Query[PersonType](db).Where("Address.City", Eq, "London").Delete()
+
+	// Assert
+	if err != nil || deleted != 2 {
+		t.Errorf("Delete failed: expected %d, got %d (%v)", 2, deleted, err)
+	}
+	if ct := Count[PersonType](db); ct != 2 {
+		t.Errorf("Count failed: expected %d, got %d", 2, ct)
+	}
+}
+
+func TestQuery_Index(t *testing.T) {
+
+	// Arrange: the entry of one record is removed, so that only a lookup through the
+	// index misses it.
+	db := prepareIndexedDb()
+	_, _ = Insert(db, NewIndexedType("a@b.c", "a", 1))
+	hidden, _ := Insert(db, NewIndexedType("d@e.f", "d", 2))
+	_ = db.RawDelete(NewIndexKey("IndexedType", "Email").SetValue("d@e.f").SetId(hidden.Key().Id()))
+
+	// Act
+	indexed, err := Query[IndexedType](db).Where("Email", In, []string{"a@b.c", "d@e.f"}).All()
+	scanned, errScan := Query[IndexedType](db).Where("Email", Ne, "").All()
+
+	// Assert
+	if err != nil || len(indexed) != 1 || indexed[0].Value().Name != "a" {
+		t.Errorf("All failed: expected the object %v through the index, got %v (%v)", "a", indexed, err)
+	}
+	if errScan != nil || len(scanned) != 2 {
+		t.Errorf("All failed: expected %d objects, got %v (%v)", 2, scanned, errScan)
+	}
+}
+
+func TestQuery_ExtractorIndex(t *testing.T) {
+
+	// Arrange: an index of AddIndex named like a field, holding other values.
+	db := prepareIndexedDb()
+	_ = AddIndex(db, "Name", func(value *IndexedType) any { return strings.ToLower(value.Name) })
+	_, _ = Insert(db, NewIndexedType("a@b.c", "Bob", 1))
+
+	// Act
+	results, err := Query[IndexedType](db).Where("Name", Eq, "Bob").All()
+
+	// Assert
+	if err != nil || len(results) != 1 {
+		t.Errorf("All failed: expected %d object, got %v (%v)", 1, results, err)
+	}
+}
+
+// Level is indexed by its String form, which differs from its underlying value.
+type Level int
+
+func (l Level) String() string {
+	return "level-" + strconv.Itoa(int(l))
+}
+
+type LeveledType struct {
+	Level Level `fkv:"index"`
+}
+
+func TestQuery_IndexNamedType(t *testing.T) {
+
+	// Arrange
+	gob.Register(LeveledType{})
+	db := prepareTestableDb()
+	_, _ = Insert(db, &LeveledType{Level: 2})
+	_, _ = Insert(db, &LeveledType{Level: 3})
+
+	// Act
+	equal, err := Query[LeveledType](db).Where("Level", Eq, 2).All()
+	in, errIn := Query[LeveledType](db).Where("Level", In, []float64{2, 3.5}).All()
+
+	// Assert
+	if err != nil || len(equal) != 1 || equal[0].Value().Level != 2 {
+		t.Errorf("All failed: expected the object at level %v, got %v (%v)", 2, equal, err)
+	}
+	if errIn != nil || len(in) != 1 || in[0].Value().Level != 2 {
+		t.Errorf("All failed: expected the object at level %v, got %v (%v)", 2, in, errIn)
+	}
+}
+
+func TestQuery_Invalid(t *testing.T) {
+
+	// Arrange
+	db := preparePersonDb()
+	queries := []*QueryBuilder[PersonType]{
+		Query[PersonType](db).Where("Unknown", Eq, 1),
+		Query[PersonType](db).Where("Age", Eq, "36"),
+		Query[PersonType](db).Where("Tags", Gt, 1),
+		Query[PersonType](db).Where("Name", In, "Ada"),
+		Query[PersonType](db).OrderBy("Address", Asc),
+	}
+
+	for i, query := range queries {
+		// Act
+		_, err := query.All()
+
+		// Assert
+		if !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("All failed for query %d: expected %v, got %v", i, ErrInvalidQuery, err)
+		}
+	}
+}
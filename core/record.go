@@ -0,0 +1,251 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// ErrVersionConflict indicates that a record was written by someone else since the
+// version the write was based on was read.
+var ErrVersionConflict = errors.New("the record was modified since it was read")
+
+// recordMagic starts the stored records which have a header. A gob stream never starts
+// with it, so the records written before headers existed are still read as-is.
+const recordMagic byte = 0x00
+
+// Tags of the fields of a record header. The tags below headerBytes are followed by a
+// uvarint, the others by the uvarint length of a byte string and the string itself; the
+// header ends with headerEnd. Readers skip the tags they do not know.
+const (
+	headerEnd byte = iota
+	headerVersion
+	headerCreated
+	headerUpdated
+	headerExpires
+	headerDeleted
+	headerArchived
+	headerOperation
+)
+
+const (
+	headerBytes byte = 0x80 + iota
+	headerMarshaller
+	headerLink
+)
+
+// RecordMeta describes a stored record, see KVWrapper.Meta. The records stored before
+// FluentKV recorded it have a zero RecordMeta.
+type RecordMeta struct {
+	// Version counts the writes of the record: 1 once inserted, incremented by each
+	// update.
+	Version uint64
+
+	// CreatedAt is the time the record was inserted; it is zero for the records inserted
+	// before it was recorded.
+	CreatedAt time.Time
+
+	// UpdatedAt is the time of the last write of the record.
+	UpdatedAt time.Time
+
+	// MarshallerId is the id of the marshaller which encoded the record, when it
+	// implements IIdentifiedMarshaller.
+	MarshallerId string
+
+	// ExpiresAt is the time the record expires at, zero when it has no time-to-live, see
+	// InsertWithTTL.
+	ExpiresAt time.Time
+
+	// DeletedAt is the time the record was moved to the trash, zero for a live record,
+	// see SoftDelete.
+	DeletedAt time.Time
+}
+
+// recordHeader holds what the manager stores along with the encoded value of a record.
+// Times are in Unix nanoseconds, 0 when unknown.
+type recordHeader struct {
+	version    uint64
+	created    int64
+	updated    int64
+	expires    int64
+	marshaller string
+
+	// deleted and links are only set on the records in the trash: the time they were
+	// moved there and the keys of the links they had, each stored under a headerLink.
+	deleted int64
+	links   []string
+
+	// archived and operation are only set on the revisions kept by the history: the time
+	// the value was replaced and the Operation which replaced it.
+	archived  int64
+	operation Operation
+}
+
+// meta returns the exported form of h.
+func (h recordHeader) meta() RecordMeta {
+	meta := RecordMeta{Version: h.version, MarshallerId: h.marshaller}
+	if h.created != 0 {
+		meta.CreatedAt = time.Unix(0, h.created)
+	}
+	if h.updated != 0 {
+		meta.UpdatedAt = time.Unix(0, h.updated)
+	}
+	if h.expires != 0 {
+		meta.ExpiresAt = time.Unix(0, h.expires)
+	}
+	if h.deleted != 0 {
+		meta.DeletedAt = time.Unix(0, h.deleted)
+	}
+	return meta
+}
+
+// expired reports whether the record has a time-to-live which elapsed at now, in Unix
+// nanoseconds.
+func (h recordHeader) expired(now int64) bool {
+	return h.expires != 0 && h.expires <= now
+}
+
+// newHeader returns the header of a record inserted now.
+func (db *KVStoreManager) newHeader() recordHeader {
+	now := time.Now().UnixNano()
+	return recordHeader{
+		version:    1,
+		created:    now,
+		updated:    now,
+		marshaller: marshallerId(db.marshaller),
+	}
+}
+
+// nextHeader returns the header of a record written now over the one of previous. The
+// expiry time of previous is kept.
+func (db *KVStoreManager) nextHeader(previous recordHeader) recordHeader {
+	header := previous
+	header.version++
+	header.updated = time.Now().UnixNano()
+	header.marshaller = marshallerId(db.marshaller)
+	return header
+}
+
+// storedRecord is a record as read from the store.
+type storedRecord struct {
+	key    *TableKey
+	value  *any
+	header recordHeader
+}
+
+// encodeRecord prepends header to payload, the encoded value of a record.
+func encodeRecord(header recordHeader, payload []byte) []byte {
+
+	raw := make([]byte, 0, 9+7*binary.MaxVarintLen64+len(header.marshaller)+len(payload))
+	raw = append(raw, recordMagic, headerVersion)
+	raw = binary.AppendUvarint(raw, header.version)
+	raw = append(raw, headerCreated)
+	raw = binary.AppendUvarint(raw, uint64(header.created))
+	raw = append(raw, headerUpdated)
+	raw = binary.AppendUvarint(raw, uint64(header.updated))
+	if header.expires != 0 {
+		raw = append(raw, headerExpires)
+		raw = binary.AppendUvarint(raw, uint64(header.expires))
+	}
+	if header.deleted != 0 {
+		raw = append(raw, headerDeleted)
+		raw = binary.AppendUvarint(raw, uint64(header.deleted))
+	}
+	if header.archived != 0 {
+		raw = append(raw, headerArchived)
+		raw = binary.AppendUvarint(raw, uint64(header.archived))
+		raw = append(raw, headerOperation)
+		raw = binary.AppendUvarint(raw, uint64(header.operation))
+	}
+	if header.marshaller != "" {
+		raw = appendHeaderBytes(raw, headerMarshaller, header.marshaller)
+	}
+	for _, link := range header.links {
+		raw = appendHeaderBytes(raw, headerLink, link)
+	}
+	raw = append(raw, headerEnd)
+
+	return append(raw, payload...)
+}
+
+// appendHeaderBytes appends the field tag, holding the byte string value, to raw.
+func appendHeaderBytes(raw []byte, tag byte, value string) []byte {
+	raw = append(raw, tag)
+	raw = binary.AppendUvarint(raw, uint64(len(value)))
+	return append(raw, value...)
+}
+
+// decodeRecord splits raw, a stored record, into its header and its encoded value.
+func decodeRecord(raw []byte) (recordHeader, []byte, error) {
+
+	var header recordHeader
+	if len(raw) == 0 || raw[0] != recordMagic {
+		return header, raw, nil
+	}
+
+	for i := 1; i < len(raw); {
+		tag := raw[i]
+		i++
+		if tag == headerEnd {
+			return header, raw[i:], nil
+		}
+
+		value, n := binary.Uvarint(raw[i:])
+		if n <= 0 {
+			break
+		}
+		i += n
+
+		if tag >= headerBytes {
+			if value > uint64(len(raw)-i) {
+				break
+			}
+			switch tag {
+			case headerMarshaller:
+				header.marshaller = string(raw[i : i+int(value)])
+			case headerLink:
+				header.links = append(header.links, string(raw[i:i+int(value)]))
+			}
+			i += int(value)
+			continue
+		}
+
+		switch tag {
+		case headerVersion:
+			header.version = value
+		case headerCreated:
+			header.created = int64(value)
+		case headerUpdated:
+			header.updated = int64(value)
+		case headerExpires:
+			header.expires = int64(value)
+		case headerDeleted:
+			header.deleted = int64(value)
+		case headerArchived:
+			header.archived = int64(value)
+		case headerOperation:
+			header.operation = Operation(value)
+		}
+	}
+
+	return header, nil, DecodeErr
+}
+
+// encode marshals value and prepends header to it.
+func (db *KVStoreManager) encode(header recordHeader, value *any) ([]byte, error) {
+	payload, err := db.marshaller.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	return encodeRecord(header, payload), nil
+}
+
+// decode reads the header of raw, a stored record, and unmarshals its value.
+func (db *KVStoreManager) decode(raw []byte) (*any, recordHeader, error) {
+	header, payload, err := decodeRecord(raw)
+	if err != nil {
+		return nil, header, err
+	}
+	value, err := db.marshaller.Decode(payload)
+	return value, header, err
+}
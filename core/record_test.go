@@ -0,0 +1,262 @@
+package core_test
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/Phosmachina/FluentKV/core"
+)
+
+func TestVersion_Increments(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	inserted, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	id := inserted.Key().Id()
+
+	// Act
+	set, _ := Set(db, id, NewSimpleType("t1", "t2", 2))
+	updated, _ := Update(db, id, func(value *SimpleType) { value.Val = 3 })
+	read, _ := Get[SimpleType](db, id)
+	found := FindAll(db, func(key *TableKey, value *SimpleType) bool { return true })
+
+	// Assert
+	for i, version := range []uint64{inserted.Version(), set.Version(), updated.Version()} {
+		if version != uint64(i+1) {
+			t.Errorf("Version failed: expected %v, got %v", i+1, version)
+		}
+	}
+	if read.Version() != 3 {
+		t.Errorf("Get failed: expected version %v, got %v", 3, read.Version())
+	}
+	if len(found) != 1 || found[0].Version() != 3 {
+		t.Errorf("FindAll failed: expected version %v, got %v", 3, found)
+	}
+}
+
+func TestSetWrp_VersionConflict(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	inserted, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	stale, _ := Get[SimpleType](db, inserted.Key().Id())
+	fresh, _ := Get[SimpleType](db, inserted.Key().Id())
+	fresh.Value().Val = 2
+	saved, errFresh := SetWrp(fresh)
+
+	// Act
+	stale.Value().Val = 3
+	_, errStale := SetWrp(stale)
+
+	// Assert
+	if errFresh != nil || saved.Version() != 2 {
+		t.Errorf("SetWrp failed: expected version %v, got %v (%v)", 2, saved.Version(), errFresh)
+	}
+	if !errors.Is(errStale, ErrVersionConflict) {
+		t.Errorf("SetWrp failed: expected %v, got %v", ErrVersionConflict, errStale)
+	}
+	if read, _ := Get[SimpleType](db, inserted.Key().Id()); read.Value().Val != 2 {
+		t.Errorf("SetWrp failed: expected Val=%v, got %v", 2, read.Value().Val)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	inserted, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	id := inserted.Key().Id()
+
+	// Act
+	_, errStale := CompareAndSwap(db, id, 2, NewSimpleType("t1", "t2", 2))
+	swapped, err := CompareAndSwap(db, id, 1, NewSimpleType("t1", "t2", 3))
+	_, errMissing := CompareAndSwap(db, "missing", 1, NewSimpleType("t1", "t2", 4))
+
+	// Assert
+	if !errors.Is(errStale, ErrVersionConflict) {
+		t.Errorf("CompareAndSwap failed: expected %v, got %v", ErrVersionConflict, errStale)
+	}
+	if err != nil || swapped.Version() != 2 {
+		t.Errorf("CompareAndSwap failed: expected version %v, got %v (%v)", 2, swapped.Version(), err)
+	}
+	if !errors.Is(errMissing, ErrInvalidId) {
+		t.Errorf("CompareAndSwap failed: expected %v, got %v", ErrInvalidId, errMissing)
+	}
+}
+
+func TestUpdate_VersionConflict(t *testing.T) {
+
+	// Arrange
+	db := prepareMemoryDb()
+	inserted, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	id := inserted.Key().Id()
+
+	// Act: a concurrent write happens while the editor runs.
+	_, err := Update(db, id, func(value *SimpleType) {
+		_, _ = Set(db, id, NewSimpleType("t1", "t2", 10))
+		value.Val++
+	})
+
+	// Assert
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Update failed: expected %v, got %v", ErrVersionConflict, err)
+	}
+	if read, _ := Get[SimpleType](db, id); read.Value().Val != 10 {
+		t.Errorf("Update failed: expected the concurrent Val=%v, got %v", 10, read.Value().Val)
+	}
+}
+
+func TestUpdateWithRetry(t *testing.T) {
+
+	// Arrange
+	db := prepareMemoryDb()
+	inserted, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	id := inserted.Key().Id()
+	calls := 0
+
+	// Act
+	updated, err := UpdateWithRetry(db, id, func(value *SimpleType) {
+		calls++
+		if calls == 1 {
+			_, _ = Set(db, id, NewSimpleType("t1", "t2", 10))
+		}
+		value.Val++
+	})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("UpdateWithRetry failed: expected %v, got %v", nil, err)
+	}
+	if calls != 2 {
+		t.Errorf("UpdateWithRetry failed: expected %d editor calls, got %d", 2, calls)
+	}
+	if updated.Value().Val != 11 || updated.Version() != 3 {
+		t.Errorf("UpdateWithRetry failed: expected Val=%v at version %v, got %v at %v",
+			11, 3, updated.Value().Val, updated.Version())
+	}
+}
+
+func TestUpdateWithRetry_Concurrent(t *testing.T) {
+
+	// Arrange
+	db := prepareMemoryDb()
+	inserted, _ := Insert(db, NewSimpleType("t1", "t2", 0))
+	id := inserted.Key().Id()
+	var succeeded int
+	var m sync.Mutex
+	var wg sync.WaitGroup
+
+	// Act
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				_, err := UpdateWithRetry(db, id, func(value *SimpleType) { value.Val++ })
+				if err == nil {
+					m.Lock()
+					succeeded++
+					m.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Assert: no update is lost.
+	read, _ := Get[SimpleType](db, id)
+	if read.Value().Val != succeeded {
+		t.Errorf("UpdateWithRetry failed: expected Val=%v, got %v", succeeded, read.Value().Val)
+	}
+	if read.Version() != uint64(succeeded+1) {
+		t.Errorf("UpdateWithRetry failed: expected version %v, got %v", succeeded+1, read.Version())
+	}
+}
+
+func TestVersion_LegacyRecord(t *testing.T) {
+
+	// Arrange: a record stored before versions existed.
+	db := prepareTestableDb()
+	var value any = *NewSimpleType("t1", "t2", 1)
+	raw, _ := db.Marshaller().Encode(&value)
+	_ = db.RawSet(NewTableKey[SimpleType]().SetId("legacy"), raw)
+
+	// Act
+	read, err := Get[SimpleType](db, "legacy")
+	updated, errUpdate := Update(db, "legacy", func(value *SimpleType) { value.Val = 2 })
+
+	// Assert
+	if err != nil || read.Version() != 0 || read.Value().Val != 1 {
+		t.Errorf("Get failed: expected Val=%v at version %v, got %v (%v)", 1, 0, read, err)
+	}
+	if errUpdate != nil || updated.Version() != 1 {
+		t.Errorf("Update failed: expected version %v, got %v (%v)", 1, updated.Version(), errUpdate)
+	}
+}
+
+func TestMeta(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	before := time.Now()
+	inserted, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	time.Sleep(time.Millisecond)
+
+	// Act
+	updated, _ := Update(db, inserted.Key().Id(), func(value *SimpleType) { value.Val = 2 })
+	read, _ := Get[SimpleType](db, inserted.Key().Id())
+
+	// Assert
+	created := inserted.Meta()
+	if created.CreatedAt.Before(before) || !created.UpdatedAt.Equal(created.CreatedAt) {
+		t.Errorf("Meta failed: expected creation after %v, got %+v", before, created)
+	}
+	if created.Version != 1 || created.MarshallerId != "gob" {
+		t.Errorf("Meta failed: expected version %v by %v, got %+v", 1, "gob", created)
+	}
+	meta := read.Meta()
+	if !meta.CreatedAt.Equal(created.CreatedAt) || !meta.UpdatedAt.After(created.UpdatedAt) {
+		t.Errorf("Meta failed: expected an update after %v, got %+v", created.UpdatedAt, meta)
+	}
+	if meta.Version != 2 || updated.Meta() != meta {
+		t.Errorf("Meta failed: expected %+v, got %+v", meta, updated.Meta())
+	}
+}
+
+func TestModifiedSince(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	var legacy any = *NewSimpleType("t1", "t2", 0)
+	raw, _ := db.Marshaller().Encode(&legacy)
+	_ = db.RawSet(NewTableKey[SimpleType]().SetId("legacy"), raw)
+	_, _ = Insert(db, NewSimpleType("t1", "t2", 1))
+	old, _ := Insert(db, NewSimpleType("t1", "t2", 2))
+	time.Sleep(time.Millisecond)
+	since := time.Now()
+	_, _ = Update(db, old.Key().Id(), func(value *SimpleType) { value.Val = 20 })
+	_, _ = Insert(db, NewSimpleType("t1", "t2", 3))
+
+	// Act
+	modified := ModifiedSince[SimpleType](db, since)
+	all := ModifiedSince[SimpleType](db, time.Time{})
+
+	// Assert
+	var values []int
+	for _, obj := range modified {
+		values = append(values, obj.Value().Val)
+	}
+	slices.Sort(values)
+	if !slices.Equal(values, []int{3, 20}) {
+		t.Errorf("ModifiedSince failed: expected %v, got %v", []int{3, 20}, values)
+	}
+	if len(all) != 3 {
+		t.Errorf("ModifiedSince failed: expected %d objects without the legacy one, got %d", 3, len(all))
+	}
+	if read, _ := Get[SimpleType](db, "legacy"); read.Meta() != (RecordMeta{}) {
+		t.Errorf("Meta failed: expected a zero RecordMeta, got %+v", read.Meta())
+	}
+}
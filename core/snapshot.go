@@ -0,0 +1,72 @@
+package core
+
+import "errors"
+
+var (
+	// ErrReadOnly indicates a write through a snapshot, see KVStoreManager.Snapshot.
+	ErrReadOnly = errors.New("the snapshot is read-only")
+
+	// ErrSnapshotUnsupported indicates a driver which does not implement KVSnapshotDriver.
+	ErrSnapshotUnsupported = errors.New("the driver does not support snapshots")
+)
+
+// Snapshot returns a read-only manager pinned to the data as it is now: Get, Foreach,
+// FindAll, Count, CollectLinked, NewCollection and the other reads made through it all
+// see the same state, whatever is written to db in the meantime. Its writes fail with
+// ErrReadOnly, and so do those of the wrappers it returns.
+// The snapshot shares the triggers and the marshaller of db. Close releases it, without
+// closing db; until then, it holds the resources of the view, e.g. a badger.Txn.
+//
+// The driver must implement KVSnapshotDriver, as BadgerDB, Memory and Generic do;
+// otherwise ErrSnapshotUnsupported is returned.
+func (db *KVStoreManager) Snapshot() (*KVStoreManager, error) {
+
+	driver, ok := db.KVDriver.(KVSnapshotDriver)
+	if !ok {
+		return nil, ErrSnapshotUnsupported
+	}
+
+	view, err := driver.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	var readOnly KVDriver = readOnlyDriver{KVDriver: view}
+	if ordered, ok := view.(KVOrderedDriver); ok {
+		readOnly = orderedReadOnlyDriver{readOnlyDriver{KVDriver: view}, ordered}
+	}
+
+	return &KVStoreManager{
+		KVDriver:   readOnly,
+		marshaller: db.marshaller,
+		parent:     db,
+	}, nil
+}
+
+// readOnlyDriver rejects the writes to the KVDriver it wraps with ErrReadOnly.
+type readOnlyDriver struct {
+	KVDriver
+}
+
+func (d readOnlyDriver) RawSet(IKey, []byte) error {
+	return ErrReadOnly
+}
+
+func (d readOnlyDriver) RawDelete(IKey) error {
+	return ErrReadOnly
+}
+
+func (d readOnlyDriver) Begin() (KVTx, error) {
+	return nil, ErrReadOnly
+}
+
+func (d readOnlyDriver) NewWriteBatch() KVWriteBatch {
+	return NewLoopWriteBatch(d)
+}
+
+// orderedReadOnlyDriver is a readOnlyDriver over a view implementing KVOrderedDriver, so
+// that Page and the other ordered reads of a snapshot seek instead of listing the keys.
+type orderedReadOnlyDriver struct {
+	readOnlyDriver
+	KVOrderedDriver
+}
@@ -0,0 +1,60 @@
+package core_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/Phosmachina/FluentKV/core"
+)
+
+func TestSnapshot(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	updated, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	deleted, _ := Insert(db, NewSimpleType("t1", "t2", 2))
+	owner, _ := Insert(db, NewAnotherType("t3", 0))
+	_ = Link(owner, false, deleted)
+
+	snapshot, err := db.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: expected %v, got %v", nil, err)
+	}
+	defer snapshot.Close()
+
+	// Act
+	_, _ = Update(db, updated.Key().Id(), func(value *SimpleType) { value.Val = 10 })
+	_ = Delete[SimpleType](db, deleted.Key().Id())
+	_, _ = Insert(db, NewSimpleType("t1", "t2", 3))
+
+	read, errGet := Get[SimpleType](snapshot, updated.Key().Id())
+	sum := 0
+	Foreach(snapshot, func(key IKey, value *SimpleType) { sum += value.Val })
+	found := FindAll(snapshot, func(key *TableKey, value *SimpleType) bool { return value.Val == 2 })
+	linked := CollectLinked[AnotherType, SimpleType](snapshot, owner.Key().Id())
+	_, errInsert := Insert(snapshot, NewSimpleType("t1", "t2", 4))
+	_, errSet := SetWrp(read)
+
+	// Assert
+	if errGet != nil || read.Value().Val != 1 {
+		t.Errorf("Get failed: expected Val=%v, got %v (%v)", 1, read.Value(), errGet)
+	}
+	if ct := Count[SimpleType](snapshot); ct != 2 {
+		t.Errorf("Count failed: expected %d, got %d", 2, ct)
+	}
+	if sum != 3 {
+		t.Errorf("Foreach failed: expected a sum of %d, got %d", 3, sum)
+	}
+	if len(found) != 1 || len(linked) != 1 || linked[0].Value().Val != 2 {
+		t.Errorf("FindAll failed: expected the deleted object, got %v and %v", found, linked)
+	}
+	if ct := len(NewCollection[SimpleType](snapshot).GetArray()); ct != 2 {
+		t.Errorf("NewCollection failed: expected %d objects, got %d", 2, ct)
+	}
+	if !errors.Is(errInsert, ErrReadOnly) || !errors.Is(errSet, ErrReadOnly) {
+		t.Errorf("Insert failed: expected %v, got %v and %v", ErrReadOnly, errInsert, errSet)
+	}
+	if ct := Count[SimpleType](db); ct != 2 {
+		t.Errorf("Count failed: expected %d, got %d", 2, ct)
+	}
+}
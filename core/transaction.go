@@ -0,0 +1,168 @@
+package core
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// MaxTxRetries bounds how many times WithTx re-runs a transaction whose commit
+	// failed with ErrConflict before giving up and returning the conflict.
+	MaxTxRetries = 10
+
+	// ErrConflict indicates that a transaction could not be committed because another
+	// transaction modified the data it read in the meantime.
+	ErrConflict = errors.New("the transaction conflicts with a concurrent one")
+
+	// ErrTxDone indicates an operation on a transaction already committed or rolled back.
+	ErrTxDone = errors.New("the transaction has already been committed or rolled back")
+
+	// ErrNestedTx indicates an attempt to begin a transaction from inside another one.
+	ErrNestedTx = errors.New("nested transactions are not supported")
+)
+
+// KVTx is a KVDriver bound to a single read-write transaction.
+//
+// Every operation made through it is isolated from other readers until Commit succeeds;
+// Rollback discards them. Close behaves like Rollback and Begin always fails with ErrNestedTx.
+type KVTx interface {
+	KVDriver
+
+	// Commit atomically applies every write made through the transaction.
+	// It returns ErrConflict when a concurrent transaction invalidated what was read.
+	Commit() error
+
+	// Rollback discards every write made through the transaction.
+	// Calling it after Commit is a no-op.
+	Rollback()
+}
+
+// txState tracks what a transaction-bound manager must settle once its transaction ends.
+type txState struct {
+	// allocatedIds are the IDs taken from the generators, or claimed, during the
+	// transaction; they are given back if it is rolled back.
+	allocatedIds []idLease
+
+	// freedIds are the IDs released during the transaction; they only return to their
+	// generator once it is committed, so a rolled back delete never frees an ID still in use.
+	freedIds []idLease
+
+	// afterCommit holds the after triggers, postponed until the data is visible.
+	afterCommit []func()
+}
+
+// idLease gathers IDs of a table handed out or released by an IdGenerator.
+type idLease struct {
+	generator IdGenerator
+	table     string
+	ids       []string
+}
+
+// WithTx runs fn inside a transaction and hands it a manager bound to that transaction.
+// All the writes made through tx (Insert, Set, Update, Delete, Link...) are committed
+// together when fn returns nil, or rolled back when it returns an error.
+//
+// When the commit fails with ErrConflict, fn is run again in a fresh transaction, up to
+// MaxTxRetries times, so it must not have side effects outside tx.
+// Calling WithTx on a manager already bound to a transaction simply runs fn in it.
+//
+// After triggers fire once the transaction is committed. Wrappers built from tx remain
+// usable after WithTx returns: tx then falls back to db.
+func (db *KVStoreManager) WithTx(fn func(tx *KVStoreManager) error) error {
+	return db.WithTxCtx(context.Background(), fn)
+}
+
+// WithTxCtx is WithTx with a context: once ctx is done, the transaction is rolled back
+// instead of being committed or retried, and ctx.Err() is returned.
+func (db *KVStoreManager) WithTxCtx(ctx context.Context, fn func(tx *KVStoreManager) error) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if db.tx != nil {
+		return fn(db)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := db.runTx(ctx, fn)
+		if !errors.Is(err, ErrConflict) || attempt >= MaxTxRetries {
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+	}
+}
+
+// runTx makes one attempt of WithTxCtx.
+func (db *KVStoreManager) runTx(ctx context.Context, fn func(tx *KVStoreManager) error) error {
+
+	driverTx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer driverTx.Rollback() // No-op once committed, but releases it if fn panics.
+
+	tx := &KVStoreManager{
+		KVDriver:   driverTx,
+		marshaller: db.marshaller,
+		parent:     db,
+		tx:         &txState{},
+	}
+	state := tx.tx
+
+	if err = fn(tx); err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		driverTx.Rollback()
+		db.detach(tx)
+		db.settleIds(state.allocatedIds)
+		return err
+	}
+
+	if err = driverTx.Commit(); err != nil {
+		db.detach(tx)
+		db.settleIds(state.allocatedIds)
+		return err
+	}
+
+	db.detach(tx)
+	db.settleIds(state.freedIds)
+	for _, after := range state.afterCommit {
+		after()
+	}
+
+	return nil
+}
+
+// detach unbinds tx from its settled transaction so that wrappers created through it
+// keep working on db.
+func (db *KVStoreManager) detach(tx *KVStoreManager) {
+	tx.m.Lock()
+	defer tx.m.Unlock()
+
+	tx.KVDriver = db.KVDriver
+	tx.tx = nil
+}
+
+// settleIds gives the IDs of the leases back to their generators.
+func (db *KVStoreManager) settleIds(leases []idLease) {
+	for _, lease := range leases {
+		_ = db.giveIds(lease.generator, lease.table, lease.ids)
+	}
+}
+
+// afterCommit runs action right away, or once the current transaction is committed.
+func (db *KVStoreManager) afterCommit(action func()) {
+
+	db.m.Lock()
+	if db.tx != nil {
+		db.tx.afterCommit = append(db.tx.afterCommit, action)
+		db.m.Unlock()
+		return
+	}
+	db.m.Unlock()
+
+	action()
+}
@@ -0,0 +1,294 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// setSoftDelete makes Delete and DeepDelete move the records of the value's table to the
+// trash when enabled is set.
+func (db *KVStoreManager) setSoftDelete(value any, enabled bool) {
+
+	schema := db.schemaOf(value)
+
+	root := db.root()
+	root.m.Lock()
+	defer root.m.Unlock()
+
+	schema.softDelete = enabled
+}
+
+// softDeletes reports whether soft delete is set for the table.
+func (db *KVStoreManager) softDeletes(table string) bool {
+
+	root := db.root()
+	root.m.Lock()
+	defer root.m.Unlock()
+
+	schema, ok := root.schemas[table]
+	return ok && schema.softDelete
+}
+
+// SoftDelete moves the record of tableKey to the trash, with its links: it is no longer
+// read, found or linked, but its ID is held back until it is purged, so that Restore
+// brings it back as it was. Its index entries are removed, and restored with it.
+// Triggers run with DeleteOperation.
+// If the key does not exist, ErrInvalidId is returned.
+func (db *KVStoreManager) SoftDelete(tableKey *TableKey) error {
+	return db.SoftDeleteCtx(context.Background(), tableKey)
+}
+
+// SoftDeleteCtx is SoftDelete with a context, handed to the triggers. Nothing is
+// committed once ctx is done.
+func (db *KVStoreManager) SoftDeleteCtx(ctx context.Context, tableKey *TableKey) error {
+	return db.delete(ctx, tableKey, true)
+}
+
+// trashRecord moves raw, the record of tableKey holding value, to the trash along with
+// the keys of its links, which are removed. Its index and expiry entries are removed as
+// well, but its ID is kept. It returns the keys of the records it was linked to.
+func (db *KVStoreManager) trashRecord(tableKey *TableKey, raw []byte, value *any) ([]*TableKey, error) {
+
+	header, payload, err := decodeRecord(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	header.deleted = time.Now().UnixNano()
+	header.links = nil
+	for _, link := range outgoingLinks(db, tableKey, nil) {
+		header.links = append(header.links, link.Key())
+	}
+	for _, link := range incomingLinks(db, nil, tableKey) {
+		header.links = append(header.links, link.Key())
+	}
+
+	if err = db.RawSet(NewTrashKey(tableKey), encodeRecord(header, payload)); err != nil {
+		return nil, failedToSet(err)
+	}
+	if err = db.RawDelete(tableKey); err != nil {
+		return nil, invalidIdOr(err)
+	}
+	if err = db.updateIndexes(tableKey, value, nil); err != nil {
+		return nil, err
+	}
+	if err = db.dropExpiry(tableKey, header.expires); err != nil {
+		return nil, err
+	}
+
+	return unlinkAll(db, tableKey)
+}
+
+// Restore brings the record of tableKey back from the trash, with its index entries and
+// its links to the records which are not deleted or trashed themselves; the links to a
+// record in the trash are brought back when it is restored too.
+// Triggers run with InsertOperation.
+//
+// Possible Errors:
+//   - ErrInvalidId: If the record is not in the trash.
+//   - ErrIdTaken: If a record was stored under its key since, e.g. with Set on a raw key.
+//   - ErrUniqueViolation: If a unique value of the record was taken since it was trashed.
+func (db *KVStoreManager) Restore(tableKey *TableKey) error {
+	return db.RestoreCtx(context.Background(), tableKey)
+}
+
+// RestoreCtx is Restore with a context, handed to the triggers. Nothing is committed
+// once ctx is done.
+func (db *KVStoreManager) RestoreCtx(ctx context.Context, tableKey *TableKey) error {
+	_, err := db.restore(ctx, tableKey)
+	return err
+}
+
+// restore is RestoreCtx, also returning the restored record.
+func (db *KVStoreManager) restore(ctx context.Context, tableKey *TableKey) (storedRecord, error) {
+
+	record := storedRecord{key: tableKey}
+
+	err := db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
+		trashKey := NewTrashKey(tableKey)
+		raw, err := tx.RawGet(trashKey)
+		if err != nil {
+			return invalidIdOr(err)
+		}
+		if tx.Exist(tableKey) {
+			return ErrIdTaken
+		}
+
+		header, payload, err := decodeRecord(raw)
+		if err != nil {
+			return err
+		}
+		record.value, err = tx.marshaller.Decode(payload)
+		if err != nil {
+			return err
+		}
+		links := header.links
+		header.deleted, header.links = 0, nil
+		record.header = header
+
+		return tx.withTriggerWrapper(ctx, tableKey, record.value, InsertOperation, func() error {
+			if err := tx.RawDelete(trashKey); err != nil {
+				return err
+			}
+			if err := tx.writeRecord(tableKey, header, encodeRecord(header, payload)); err != nil {
+				return err
+			}
+			if err := tx.scheduleExpiry(tableKey, header.expires); err != nil {
+				return err
+			}
+			if err := tx.updateIndexes(tableKey, nil, record.value); err != nil {
+				return err
+			}
+
+			for _, key := range links {
+				link := NewLinkKeyFromString(key)
+				other := link.TargetTableKey()
+				if other.Equals(tableKey) {
+					other = link.CurrentTableKey()
+				}
+				if !tx.exists(other) {
+					// Kept for when the other record is restored, if it is in the trash.
+					if err := tx.keepTrashedLink(other, key); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := setLink(tx, link); err != nil {
+					return failedToSet(err)
+				}
+			}
+
+			return nil
+		})
+	})
+
+	return record, err
+}
+
+// keepTrashedLink adds the link key to the ones of the record of tableKey, if it is in the
+// trash, so that the link comes back when it is restored.
+func (db *KVStoreManager) keepTrashedLink(tableKey *TableKey, link string) error {
+
+	trashKey := NewTrashKey(tableKey)
+	raw, err := db.RawGet(trashKey)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	header, payload, err := decodeRecord(raw)
+	if err != nil || slices.Contains(header.links, link) {
+		return err
+	}
+	header.links = append(header.links, link)
+
+	return failedToSet(db.RawSet(trashKey, encodeRecord(header, payload)))
+}
+
+// Purge removes the record of tableKey from the trash for good, and releases its ID, unless
+// its history still holds revisions, see History.
+// No trigger runs: they did when the record was deleted.
+// If the record is not in the trash, ErrInvalidId is returned.
+func (db *KVStoreManager) Purge(tableKey *TableKey) error {
+	return db.PurgeCtx(context.Background(), tableKey)
+}
+
+// PurgeCtx is Purge with a context. Nothing is committed once ctx is done.
+func (db *KVStoreManager) PurgeCtx(ctx context.Context, tableKey *TableKey) error {
+
+	return db.WithTxCtx(ctx, func(tx *KVStoreManager) error {
+		if err := tx.RawDelete(NewTrashKey(tableKey)); err != nil {
+			return invalidIdOr(err)
+		}
+		return tx.releaseRecordId(tableKey)
+	})
+}
+
+// PurgeOlderThan purges the records matching the tableKey prefix which were moved to the
+// trash more than age ago, and returns how many it purged. Each one is purged in its own
+// transaction, as with Purge.
+func (db *KVStoreManager) PurgeOlderThan(tableKey *TableKey, age time.Duration) (int, error) {
+	return db.PurgeOlderThanCtx(context.Background(), tableKey, age)
+}
+
+// PurgeOlderThanCtx is PurgeOlderThan with a context: the purge stops once ctx is done,
+// returning ctx.Err().
+func (db *KVStoreManager) PurgeOlderThanCtx(
+	ctx context.Context,
+	tableKey *TableKey,
+	age time.Duration,
+) (int, error) {
+
+	before := time.Now().Add(-age).UnixNano()
+
+	var due []*TableKey
+	db.RawIterKV(NewTrashKey(tableKey), func(key IKey, raw []byte) (stop bool) {
+		header, _, err := decodeRecord(raw)
+		if err == nil && header.deleted <= before {
+			due = append(due, key.(*TrashKey).TableKey())
+		}
+		return ctx.Err() != nil
+	})
+
+	purged := 0
+	for _, key := range due {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+		if err := db.PurgeCtx(ctx, key); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// Trash returns the keys and the values of the records in the trash matching the
+// tableKey prefix. The keys are the ones of the records outside the trash.
+func (db *KVStoreManager) Trash(tableKey *TableKey) ([]*TableKey, []*any) {
+	tableKeys, values, _ := db.TrashCtx(context.Background(), tableKey)
+	return tableKeys, values
+}
+
+// TrashCtx is Trash with a context: the scan stops once ctx is done, returning ctx.Err().
+func (db *KVStoreManager) TrashCtx(ctx context.Context, tableKey *TableKey) ([]*TableKey, []*any, error) {
+
+	records, err := db.trash(ctx, tableKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return splitRecords(records)
+}
+
+// trash is TrashCtx, returning whole records.
+func (db *KVStoreManager) trash(ctx context.Context, tableKey *TableKey) ([]storedRecord, error) {
+
+	var records []storedRecord
+
+	db.RawIterKV(NewTrashKey(tableKey), func(key IKey, raw []byte) (stop bool) {
+		if ctx.Err() != nil {
+			return true
+		}
+		value, header, err := db.decode(raw)
+		if err == nil {
+			records = append(records, storedRecord{
+				key:    key.(*TrashKey).TableKey(),
+				value:  value,
+				header: header,
+			})
+		}
+		return false
+	})
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
@@ -0,0 +1,138 @@
+package core_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/Phosmachina/FluentKV/core"
+)
+
+func TestSoftDelete_Restore(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	trashed, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	owner, _ := Insert(db, NewAnotherType("t3", 0))
+	_ = Link(owner, true, trashed)
+	id := trashed.Key().Id()
+
+	// Act
+	err := SoftDelete[SimpleType](db, id)
+	_, errGet := Get[SimpleType](db, id)
+	_, errTaken := InsertWithId(db, id, NewSimpleType("t1", "t2", 2))
+	inserted, _ := Insert(db, NewSimpleType("t1", "t2", 3))
+	linksInTrash := CollectAllLinkedKey[AnotherType](db, owner.Key().Id())
+	trash := Trash[SimpleType](db)
+	restored, errRestore := Restore[SimpleType](db, id)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("SoftDelete failed: expected %v, got %v", nil, err)
+	}
+	if !errors.Is(errGet, ErrInvalidId) {
+		t.Errorf("Get failed: expected %v, got %v", ErrInvalidId, errGet)
+	}
+	if !errors.Is(errTaken, ErrIdTaken) {
+		t.Errorf("InsertWithId failed: expected %v, got %v", ErrIdTaken, errTaken)
+	}
+	if inserted.Key().Id() == id {
+		t.Errorf("Insert failed: the trashed ID %v was handed out", id)
+	}
+	if len(linksInTrash) != 0 {
+		t.Errorf("SoftDelete failed: expected no link, got %v", linksInTrash)
+	}
+	if len(trash) != 1 || trash[0].Value().Val != 1 || trash[0].Meta().DeletedAt.IsZero() {
+		t.Errorf("Trash failed: expected the trashed object, got %v", trash)
+	}
+	if errRestore != nil || restored.Value().Val != 1 || !restored.Meta().DeletedAt.IsZero() {
+		t.Errorf("Restore failed: expected Val=%v, got %v (%v)", 1, restored.Value(), errRestore)
+	}
+	if read, _ := Get[SimpleType](db, id); read.Value().Val != 1 {
+		t.Errorf("Get failed: expected Val=%v, got %v", 1, read.Value())
+	}
+	if links := CollectAllLinkedKey[AnotherType](db, owner.Key().Id()); len(links) != 1 {
+		t.Errorf("Restore failed: expected %d link, got %v", 1, links)
+	}
+	if len(Trash[SimpleType](db)) != 0 {
+		t.Errorf("Restore failed: expected an empty trash, got %v", Trash[SimpleType](db))
+	}
+}
+
+func TestSetSoftDelete_DeepDelete(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	SetSoftDelete[SimpleType](db, true)
+	SetSoftDelete[AnotherType](db, true)
+	var deleted int
+	_ = AddAfterTrigger[SimpleType](db, "trigger", DeleteOperation,
+		func(operation Operation, key IKey, value *SimpleType) { deleted++ })
+	current, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	target, _ := Insert(db, NewAnotherType("t3", 2))
+	_ = Link(current, false, target)
+
+	// Act
+	err := DeepDelete[SimpleType](db, current.Key().Id())
+	_, errCurrent := Restore[SimpleType](db, current.Key().Id())
+	_, errTarget := Restore[AnotherType](db, target.Key().Id())
+
+	// Assert
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeepDelete failed: expected %d trigger run, got %d (%v)", 1, deleted, err)
+	}
+	if errCurrent != nil || errTarget != nil {
+		t.Errorf("Restore failed: expected %v, got %v and %v", nil, errCurrent, errTarget)
+	}
+	linked := CollectLinked[SimpleType, AnotherType](db, current.Key().Id())
+	if len(linked) != 1 || linked[0].Value().Numeric != 2 {
+		t.Errorf("Restore failed: expected the link restored, got %v", linked)
+	}
+}
+
+func TestPurge(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	trashed, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	id := trashed.Key().Id()
+	_ = SoftDelete[SimpleType](db, id)
+
+	// Act
+	err := Purge[SimpleType](db, id)
+	_, errRestore := Restore[SimpleType](db, id)
+	inserted, _ := Insert(db, NewSimpleType("t1", "t2", 2))
+
+	// Assert
+	if err != nil {
+		t.Errorf("Purge failed: expected %v, got %v", nil, err)
+	}
+	if !errors.Is(errRestore, ErrInvalidId) {
+		t.Errorf("Restore failed: expected %v, got %v", ErrInvalidId, errRestore)
+	}
+	if inserted.Key().Id() != id {
+		t.Errorf("Purge failed: expected the ID %v released, got %v", id, inserted.Key().Id())
+	}
+}
+
+func TestPurgeOlderThan(t *testing.T) {
+
+	// Arrange
+	db := prepareTestableDb()
+	old, _ := Insert(db, NewSimpleType("t1", "t2", 1))
+	recent, _ := Insert(db, NewSimpleType("t1", "t2", 2))
+	_ = SoftDelete[SimpleType](db, old.Key().Id())
+	time.Sleep(20 * time.Millisecond)
+	_ = SoftDelete[SimpleType](db, recent.Key().Id())
+
+	// Act
+	purged, err := PurgeOlderThan[SimpleType](db, 10*time.Millisecond)
+
+	// Assert
+	if err != nil || purged != 1 {
+		t.Errorf("PurgeOlderThan failed: expected %d, got %d (%v)", 1, purged, err)
+	}
+	if trash := Trash[SimpleType](db); len(trash) != 1 || trash[0].Value().Val != 2 {
+		t.Errorf("PurgeOlderThan failed: expected the recent object kept, got %v", trash)
+	}
+}
@@ -1,6 +1,9 @@
 package core
 
-import "errors"
+import (
+	"context"
+	"errors"
+)
 
 var (
 	ErrCancelledByTrigger = errors.New("a trigger executed before cancelled the operation")
@@ -17,11 +20,14 @@ func (o Operation) Contain(s Operation) bool {
 }
 
 // CRUD Operation used for trigger as a filter.
+// ExpireOperation is the removal of a record whose time-to-live elapsed, see
+// InsertWithTTL; its before triggers can not cancel it.
 const (
 	GetOperation Operation = 1 << iota
 	InsertOperation
 	DeleteOperation
 	UpdateOperation
+	ExpireOperation
 )
 
 type ITrigger interface {
@@ -34,13 +40,22 @@ type ITrigger interface {
 	Equals(ITrigger) bool
 }
 
+// ITriggerCtx is an ITrigger whose tasks also receive the context of the operation, as
+// registered by AddBeforeTriggerCtx and AddAfterTriggerCtx. Such triggers are started
+// through StartBeforeCtx and StartAfterCtx instead of StartBefore and StartAfter.
+type ITriggerCtx interface {
+	ITrigger
+	StartBeforeCtx(context.Context, Operation, IKey, *any) bool
+	StartAfterCtx(context.Context, Operation, IKey, *any)
+}
+
 type trigger struct {
 	id         string
 	tableName  string
 	operations Operation
 	isBefore   bool
-	beforeTask func(operation Operation, key IKey, value *any) bool
-	afterTask  func(operation Operation, key IKey, value *any)
+	beforeTask func(ctx context.Context, operation Operation, key IKey, value *any) bool
+	afterTask  func(ctx context.Context, operation Operation, key IKey, value *any)
 }
 
 func (t trigger) Id() string {
@@ -60,11 +75,19 @@ func (t trigger) IsBefore() bool {
 }
 
 func (t trigger) StartBefore(operation Operation, key IKey, value *any) bool {
-	return t.beforeTask(operation, key, value)
+	return t.beforeTask(context.Background(), operation, key, value)
 }
 
 func (t trigger) StartAfter(operation Operation, key IKey, value *any) {
-	t.afterTask(operation, key, value)
+	t.afterTask(context.Background(), operation, key, value)
+}
+
+func (t trigger) StartBeforeCtx(ctx context.Context, operation Operation, key IKey, value *any) bool {
+	return t.beforeTask(ctx, operation, key, value)
+}
+
+func (t trigger) StartAfterCtx(ctx context.Context, operation Operation, key IKey, value *any) {
+	t.afterTask(ctx, operation, key, value)
 }
 
 func (t trigger) Equals(other ITrigger) bool {
@@ -79,3 +102,20 @@ func indexOf(t ITrigger, triggers []ITrigger) int {
 	}
 	return -1 // not found.
 }
+
+// startBefore starts the before trigger, handing it ctx if it is an ITriggerCtx.
+func startBefore(ctx context.Context, t ITrigger, operation Operation, key IKey, value *any) bool {
+	if withCtx, ok := t.(ITriggerCtx); ok {
+		return withCtx.StartBeforeCtx(ctx, operation, key, value)
+	}
+	return t.StartBefore(operation, key, value)
+}
+
+// startAfter starts the after trigger, handing it ctx if it is an ITriggerCtx.
+func startAfter(ctx context.Context, t ITrigger, operation Operation, key IKey, value *any) {
+	if withCtx, ok := t.(ITriggerCtx); ok {
+		withCtx.StartAfterCtx(ctx, operation, key, value)
+		return
+	}
+	t.StartAfter(operation, key, value)
+}
@@ -4,59 +4,198 @@ import (
 	"errors"
 	"fmt"
 	. "github.com/Phosmachina/FluentKV/core"
-	"github.com/dgraph-io/badger"
+	"github.com/dgraph-io/badger/v2"
 	"os"
 	"runtime"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const (
 	defaultFileMode = 0755
 )
 
+// BadgerOptions tunes a BadgerDB store.
+type BadgerOptions struct {
+	// InMemory keeps everything in memory; the directory is then ignored.
+	InMemory bool
+
+	// SyncWrites flushes every write to the disk before returning.
+	SyncWrites bool
+
+	// EncryptionKey enables the encryption at rest; it must be 16, 24 or 32 bytes long
+	// (AES-128, 192 or 256). A store created with a key can only be opened with it.
+	EncryptionKey []byte
+
+	// EncryptionKeyRotation is how long a data key is used before being rotated; badger
+	// defaults to 10 days.
+	EncryptionKeyRotation time.Duration
+
+	// ReadOnly opens the store without allowing writes, so that several processes can
+	// read it. The key layout is then not migrated: the store must already be up to date.
+	ReadOnly bool
+
+	// Logger receives the logs of badger; nil keeps its default logger.
+	Logger badger.Logger
+
+	// GCInterval is the delay between two runs of the value log garbage collection,
+	// which reclaims the space of overwritten and deleted values; 0 disables it.
+	GCInterval time.Duration
+
+	// GCDiscardRatio is the share of a value log file which must be garbage for the
+	// collection to rewrite it.
+	GCDiscardRatio float64
+}
+
+// DefaultBadgerOptions are the options used by NewBadgerDB.
+var DefaultBadgerOptions = BadgerOptions{
+	GCInterval:     5 * time.Minute,
+	GCDiscardRatio: 0.5,
+}
+
 type BadgerDB struct {
 	Service *badger.DB
 	closed  uint32 // if 1 is closed.
+
+	// stopGC ends the value log garbage collection loop, if any, and gcDone is closed
+	// once it has returned.
+	stopGC chan struct{}
+	gcDone chan struct{}
+
+	closeMutex sync.Mutex
 }
 
+// NewBadgerDB opens, or creates, the badger store of the directory with the
+// DefaultBadgerOptions.
 func NewBadgerDB(directoryPath string) (*KVStoreManager, error) {
+	return NewBadgerDBWithOptions(directoryPath, DefaultBadgerOptions)
+}
 
-	if directoryPath == "" {
-		return nil, errors.New("directoryPath is empty")
-	}
+// NewBadgerDBWithOptions opens, or creates, the badger store of the directory.
+//
+// A directory written by badger v1, as by the former versions of FluentKV, is upgraded
+// first: its store is converted into a badger v2 one, with the options, and the original
+// directory is kept beside it with the ".v1" suffix. A read-only opening fails with
+// ErrBadgerV1Directory instead.
+func NewBadgerDBWithOptions(directoryPath string, options BadgerOptions) (*KVStoreManager, error) {
+
+	if !options.InMemory {
+		if directoryPath == "" {
+			return nil, errors.New("directoryPath is empty")
+		}
 
-	lindex := directoryPath[len(directoryPath)-1]
-	if lindex != os.PathSeparator && lindex != '/' {
-		directoryPath += string(os.PathSeparator)
-	}
-	// create directories if necessary
-	if err := os.MkdirAll(directoryPath, os.FileMode(defaultFileMode)); err != nil {
-		return nil, err
-	}
+		if err := upgradeBadgerV1(directoryPath, options); err != nil {
+			return nil, err
+		}
 
-	opts := badger.DefaultOptions(directoryPath).WithTruncate(true)
+		lindex := directoryPath[len(directoryPath)-1]
+		if lindex != os.PathSeparator && lindex != '/' {
+			directoryPath += string(os.PathSeparator)
+		}
+		// create directories if necessary
+		if err := os.MkdirAll(directoryPath, os.FileMode(defaultFileMode)); err != nil {
+			return nil, err
+		}
+	}
 
-	service, err := badger.Open(opts)
+	service, err := badger.Open(badgerOpenOptions(directoryPath, options))
 	if err != nil {
-		fmt.Printf("unable to initialize the badger-based session database: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("unable to initialize the badger database: %w", err)
 	}
 
 	db := &BadgerDB{Service: service}
+	if options.GCInterval > 0 && !options.InMemory && !options.ReadOnly {
+		db.stopGC, db.gcDone = make(chan struct{}), make(chan struct{})
+		go runValueLogGC(service, options.GCInterval, options.GCDiscardRatio, db.stopGC, db.gcDone)
+	}
 	runtime.SetFinalizer(db, closeBadgerDB)
 
-	return NewKVStoreManager(db), nil
+	manager := NewKVStoreManager(db)
+	if !options.ReadOnly {
+		if err = manager.Migrate(); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return manager, nil
 }
 
+// badgerOpenOptions translates the options of the store of the directory to badger ones.
+func badgerOpenOptions(directoryPath string, options BadgerOptions) badger.Options {
+
+	opts := badger.DefaultOptions("").WithInMemory(true)
+	if !options.InMemory {
+		opts = badger.DefaultOptions(directoryPath).WithTruncate(!options.ReadOnly)
+	}
+
+	opts = opts.
+		WithSyncWrites(options.SyncWrites).
+		WithReadOnly(options.ReadOnly)
+	if len(options.EncryptionKey) > 0 {
+		// Badger requires a block cache to hold the decrypted blocks.
+		opts = opts.WithEncryptionKey(options.EncryptionKey).WithIndexCacheSize(100 << 20)
+	}
+	if options.EncryptionKeyRotation > 0 {
+		opts = opts.WithEncryptionKeyRotationDuration(options.EncryptionKeyRotation)
+	}
+	if options.Logger != nil {
+		opts = opts.WithLogger(options.Logger)
+	}
+
+	return opts
+}
+
+// runValueLogGC collects the value log of service at every interval until stop is closed.
+// It does not reference the BadgerDB, which can thus be finalized.
+func runValueLogGC(
+	service *badger.DB,
+	interval time.Duration,
+	discardRatio float64,
+	stop <-chan struct{},
+	done chan<- struct{},
+) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// Each successful run rewrites one file: keep going while there is garbage.
+			for service.RunValueLogGC(discardRatio) == nil {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+			}
+		}
+	}
+}
+
+// Close stops the value log garbage collection and closes the store.
 func (db *BadgerDB) Close() {
 	_ = closeBadgerDB(db)
 }
 
 func closeBadgerDB(db *BadgerDB) error {
 
+	db.closeMutex.Lock()
+	defer db.closeMutex.Unlock()
+
 	if atomic.LoadUint32(&db.closed) > 0 {
 		return nil
 	}
+	if db.stopGC != nil {
+		close(db.stopGC)
+		<-db.gcDone
+		db.stopGC = nil
+	}
 	err := db.Service.Close()
 	if err == nil {
 		atomic.StoreUint32(&db.closed, 1)
@@ -74,55 +213,60 @@ var iterOptionsNoValues = badger.IteratorOptions{
 
 // region KVDriver implementation
 
-func (db *BadgerDB) RawSet(key IKey, value []byte) bool {
+func (db *BadgerDB) RawSet(key IKey, value []byte) error {
 
-	err := db.Service.Update(func(txn *badger.Txn) error {
-		return txn.SetEntry(badger.NewEntry(key.RawKey(), value))
-	})
+	if atomic.LoadUint32(&db.closed) > 0 {
+		return ErrClosed
+	}
 
-	return err == nil
+	return badgerError(db.Service.Update(func(txn *badger.Txn) error {
+		return txnSet(txn, key, value)
+	}))
 }
 
-func (db *BadgerDB) RawGet(key IKey) ([]byte, bool) {
+// RawSetWithTTL stores value under key with badger.Entry.WithTTL: badger drops it once
+// ttl elapsed.
+func (db *BadgerDB) RawSetWithTTL(key IKey, value []byte, ttl time.Duration) error {
+
+	if atomic.LoadUint32(&db.closed) > 0 {
+		return ErrClosed
+	}
+
+	return badgerError(db.Service.Update(func(txn *badger.Txn) error {
+		return txnSetWithTTL(txn, key, value, ttl)
+	}))
+}
+
+func (db *BadgerDB) RawGet(key IKey) ([]byte, error) {
+
+	if atomic.LoadUint32(&db.closed) > 0 {
+		return nil, ErrClosed
+	}
 
 	var value []byte
 
 	err := db.Service.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(key.RawKey())
-		if err != nil {
-			return err
-		}
-		return item.Value(func(v []byte) error {
-			value = v
-			return nil
-		})
+		var err error
+		value, err = txnGet(txn, key)
+		return err
 	})
 
-	if errors.Is(err, badger.ErrKeyNotFound) {
-		return nil, false
-	}
-
 	if err != nil {
-		return nil, false
+		return nil, badgerError(err)
 	}
 
-	return value, true
+	return value, nil
 }
 
-func (db *BadgerDB) RawDelete(key IKey) bool {
-
-	if !db.Exist(key) {
-		return false
-	}
+func (db *BadgerDB) RawDelete(key IKey) error {
 
-	txn := db.Service.NewTransaction(true)
-	err := txn.Delete(key.RawKey())
-
-	if err != nil {
-		return false
+	if atomic.LoadUint32(&db.closed) > 0 {
+		return ErrClosed
 	}
 
-	return txn.Commit() == nil
+	return badgerError(db.Service.Update(func(txn *badger.Txn) error {
+		return txnDelete(txn, key)
+	}))
 }
 
 func (db *BadgerDB) RawIterKey(
@@ -164,6 +308,36 @@ func (db *BadgerDB) RawIterKV(
 	}
 }
 
+func (db *BadgerDB) RawIterKVFrom(
+	key IKey,
+	start string,
+	reverse bool,
+	action func(key IKey, value []byte) (stop bool),
+) {
+	txn := db.Service.NewTransaction(false)
+	defer txn.Discard()
+
+	options := badger.DefaultIteratorOptions
+	options.Prefix = key.RawPrefix()
+	options.Reverse = reverse
+	iter := txn.NewIterator(options)
+	defer iter.Close()
+
+	seek := []byte(start)
+	if start == "" && reverse {
+		seek = append(key.RawPrefix(), 0xff) // Past every key of the prefix.
+	} else if start < key.Prefix() {
+		seek = key.RawPrefix()
+	}
+
+	for iter.Seek(seek); iter.Valid(); iter.Next() {
+		valueCopy, _ := iter.Item().ValueCopy(nil)
+		if action(NewKeyFromString(string(iter.Item().Key())), valueCopy) {
+			return
+		}
+	}
+}
+
 func (db *BadgerDB) Exist(key IKey) bool {
 	return db.Service.View(func(txn *badger.Txn) error {
 		_, err := txn.Get(key.RawKey())
@@ -171,4 +345,345 @@ func (db *BadgerDB) Exist(key IKey) bool {
 	}) == nil
 }
 
+func (db *BadgerDB) Begin() (KVTx, error) {
+	if atomic.LoadUint32(&db.closed) > 0 {
+		return nil, ErrClosed
+	}
+	return &badgerTx{txn: db.Service.NewTransaction(true)}, nil
+}
+
+// NewWriteBatch returns a batch backed by badger.WriteBatch, which commits its writes by
+// large transactions as they accumulate.
+func (db *BadgerDB) NewWriteBatch() KVWriteBatch {
+	return &badgerWriteBatch{wb: db.Service.NewWriteBatch()}
+}
+
+// endregion
+
+// region Write batch
+
+type badgerWriteBatch struct {
+	wb   *badger.WriteBatch
+	done bool
+}
+
+func (b *badgerWriteBatch) RawSet(key IKey, value []byte) error {
+	if b.done {
+		return ErrBatchDone
+	}
+	return badgerError(b.wb.Set(key.RawKey(), value))
+}
+
+func (b *badgerWriteBatch) RawDelete(key IKey) error {
+	if b.done {
+		return ErrBatchDone
+	}
+	return badgerError(b.wb.Delete(key.RawKey()))
+}
+
+func (b *badgerWriteBatch) Flush() error {
+	if b.done {
+		return ErrBatchDone
+	}
+	b.done = true
+	return badgerError(b.wb.Flush())
+}
+
+func (b *badgerWriteBatch) Cancel() {
+	if !b.done {
+		b.done = true
+		b.wb.Cancel()
+	}
+}
+
+// endregion
+
+// region Transaction
+
+// badgerTx is a KVTx backed by a read-write badger.Txn, which provides snapshot
+// isolation and reports write conflicts at commit time.
+type badgerTx struct {
+	txn  *badger.Txn
+	done bool
+}
+
+func (tx *badgerTx) RawSet(key IKey, value []byte) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	return badgerError(txnSet(tx.txn, key, value))
+}
+
+func (tx *badgerTx) RawSetWithTTL(key IKey, value []byte, ttl time.Duration) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	return badgerError(txnSetWithTTL(tx.txn, key, value, ttl))
+}
+
+func (tx *badgerTx) RawGet(key IKey) ([]byte, error) {
+
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	value, err := txnGet(tx.txn, key)
+	if err != nil {
+		return nil, badgerError(err)
+	}
+
+	return value, nil
+}
+
+func (tx *badgerTx) RawDelete(key IKey) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	return badgerError(txnDelete(tx.txn, key))
+}
+
+// RawIterKey reads the matching keys by batches before calling action: a read-write
+// badger.Txn only supports one iterator at a time, and action may well iterate again.
+func (tx *badgerTx) RawIterKey(
+	key IKey,
+	action func(key IKey) (stop bool),
+) {
+	iterKey(tx, key, action)
+}
+
+// RawIterKV reads the matching entries by batches before calling action, see RawIterKey.
+func (tx *badgerTx) RawIterKV(
+	key IKey,
+	action func(key IKey, value []byte) (stop bool),
+) {
+	iterKV(tx, key, action)
+}
+
+// scanFrom implements orderedStore, with an iterator of its own for each batch.
+func (tx *badgerTx) scanFrom(
+	prefix string,
+	bound string,
+	reverse bool,
+	withValues bool,
+	n int,
+) []versionedEntry {
+
+	if tx.done {
+		return nil
+	}
+
+	options := badger.DefaultIteratorOptions
+	if !withValues {
+		options = iterOptionsNoValues
+	}
+	options.Prefix = []byte(prefix)
+	options.Reverse = reverse
+	iter := tx.txn.NewIterator(options)
+	defer iter.Close()
+
+	seek := []byte(bound)
+	if bound == "" && reverse {
+		seek = append([]byte(prefix), 0xff) // Past every key of the prefix.
+	} else if !reverse && bound < prefix {
+		seek = []byte(prefix)
+	}
+
+	var entries []versionedEntry
+	for iter.Seek(seek); iter.Valid() && len(entries) < n; iter.Next() {
+		k := string(iter.Item().Key())
+		if reverse && bound != "" && k >= bound {
+			continue // Seeking in reverse stops at bound itself, which is excluded.
+		}
+		entry := versionedEntry{key: k}
+		if withValues {
+			value, err := iter.Item().ValueCopy(nil)
+			if err != nil {
+				break
+			}
+			entry.value = value
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func (tx *badgerTx) Exist(key IKey) bool {
+	if tx.done {
+		return false
+	}
+	_, err := tx.txn.Get(key.RawKey())
+	return err == nil
+}
+
+func (tx *badgerTx) NewWriteBatch() KVWriteBatch {
+	return NewLoopWriteBatch(tx)
+}
+
+func (tx *badgerTx) Begin() (KVTx, error) {
+	return nil, ErrNestedTx
+}
+
+func (tx *badgerTx) Commit() error {
+
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+
+	return badgerError(tx.txn.Commit())
+}
+
+func (tx *badgerTx) Rollback() {
+	if !tx.done {
+		tx.done = true
+		tx.txn.Discard()
+	}
+}
+
+func (tx *badgerTx) Close() {
+	tx.Rollback()
+}
+
+// badgerError wraps the errors of badger into the matching sentinel of the KVDriver
+// contract, keeping the original error in the chain.
+func badgerError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, badger.ErrKeyNotFound):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case errors.Is(err, badger.ErrConflict):
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case errors.Is(err, badger.ErrDBClosed), errors.Is(err, badger.ErrBlockedWrites):
+		return fmt.Errorf("%w: %w", ErrClosed, err)
+	default:
+		return err
+	}
+}
+
+func txnSet(txn *badger.Txn, key IKey, value []byte) error {
+	return txn.SetEntry(badger.NewEntry(key.RawKey(), value))
+}
+
+func txnSetWithTTL(txn *badger.Txn, key IKey, value []byte, ttl time.Duration) error {
+	return txn.SetEntry(badger.NewEntry(key.RawKey(), value).WithTTL(ttl))
+}
+
+func txnGet(txn *badger.Txn, key IKey) ([]byte, error) {
+	item, err := txn.Get(key.RawKey())
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+func txnDelete(txn *badger.Txn, key IKey) error {
+	if _, err := txn.Get(key.RawKey()); err != nil {
+		return err
+	}
+	return txn.Delete(key.RawKey())
+}
+
+// endregion
+
+// region Snapshot
+
+// Snapshot returns a view of the store backed by a read-only badger.Txn, kept open until
+// the view is closed.
+func (db *BadgerDB) Snapshot() (KVDriver, error) {
+	if atomic.LoadUint32(&db.closed) > 0 {
+		return nil, ErrClosed
+	}
+	return &badgerSnapshot{tx: &badgerTx{txn: db.Service.NewTransaction(false)}}, nil
+}
+
+// badgerSnapshot is a read-only badgerTx whose reads are serialized, as a badger.Txn is
+// not safe for concurrent use while a snapshot is typically shared. Its writes fail.
+type badgerSnapshot struct {
+	m  sync.Mutex
+	tx *badgerTx
+}
+
+func (s *badgerSnapshot) RawSet(IKey, []byte) error {
+	return ErrReadOnly
+}
+
+func (s *badgerSnapshot) RawGet(key IKey) ([]byte, error) {
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.tx.RawGet(key)
+}
+
+func (s *badgerSnapshot) RawDelete(IKey) error {
+	return ErrReadOnly
+}
+
+// RawIterKey reads the matching keys by batches, calling action with the lock released so
+// that it may read the snapshot again.
+func (s *badgerSnapshot) RawIterKey(
+	key IKey,
+	action func(key IKey) (stop bool),
+) {
+	iterKey(s, key, action)
+}
+
+// RawIterKV reads the matching entries by batches, see RawIterKey.
+func (s *badgerSnapshot) RawIterKV(
+	key IKey,
+	action func(key IKey, value []byte) (stop bool),
+) {
+	iterKV(s, key, action)
+}
+
+func (s *badgerSnapshot) RawIterKVFrom(
+	key IKey,
+	start string,
+	reverse bool,
+	action func(key IKey, value []byte) (stop bool),
+) {
+	iterKVFrom(s, key, start, reverse, action)
+}
+
+func (s *badgerSnapshot) scanFrom(
+	prefix string,
+	bound string,
+	reverse bool,
+	withValues bool,
+	n int,
+) []versionedEntry {
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.tx.scanFrom(prefix, bound, reverse, withValues, n)
+}
+
+func (s *badgerSnapshot) Exist(key IKey) bool {
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.tx.Exist(key)
+}
+
+func (s *badgerSnapshot) Begin() (KVTx, error) {
+	return nil, ErrReadOnly
+}
+
+func (s *badgerSnapshot) NewWriteBatch() KVWriteBatch {
+	return NewLoopWriteBatch(s)
+}
+
+// Close discards the badger.Txn of the snapshot.
+func (s *badgerSnapshot) Close() {
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.tx.Rollback()
+}
+
 // endregion
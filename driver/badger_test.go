@@ -1,8 +1,16 @@
 package driver_test
 
 import (
+	"encoding/gob"
+	"errors"
+	. "github.com/Phosmachina/FluentKV/core"
 	. "github.com/Phosmachina/FluentKV/driver"
+	badgerv1 "github.com/dgraph-io/badger"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestBadger(t *testing.T) {
@@ -13,3 +21,295 @@ func TestBadger(t *testing.T) {
 		}).
 		RunAllTests()
 }
+
+func TestBadger_TxConflict(t *testing.T) {
+
+	// Arrange
+	db, _ := NewBadgerDB(t.TempDir())
+	defer db.Close()
+	key := NewTableKey[SimpleType]().SetId("0")
+	db.RawSet(key, []byte("initial"))
+
+	tx1, _ := db.Begin()
+	tx2, _ := db.Begin()
+
+	// Act
+	tx1.RawGet(key)
+	tx1.RawSet(key, []byte("tx1"))
+	tx2.RawGet(key)
+	tx2.RawSet(key, []byte("tx2"))
+
+	err1 := tx1.Commit()
+	err2 := tx2.Commit()
+
+	// Assert
+	if err1 != nil {
+		t.Errorf("First commit failed: expected %v, got %v", nil, err1)
+	}
+	if !errors.Is(err2, ErrConflict) {
+		t.Errorf("Second commit failed: expected %v, got %v", ErrConflict, err2)
+	}
+	if value, _ := db.RawGet(key); string(value) != "tx1" {
+		t.Errorf("Unexpected value after conflict: %s", value)
+	}
+}
+
+type UniqueType struct {
+	Email string `fkv:"unique"`
+}
+
+func TestBadger_UniqueConcurrentInsert(t *testing.T) {
+
+	// Arrange
+	gob.Register(UniqueType{})
+	db, _ := NewBadgerDB(t.TempDir())
+	defer db.Close()
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+
+	// Act
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := Insert(db, &UniqueType{Email: "a@b.c"})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// Assert
+	succeeded := 0
+	for err := range errs {
+		var violation *ErrUniqueViolation
+		if err == nil {
+			succeeded++
+		} else if !errors.As(err, &violation) {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 || Count[UniqueType](db) != 1 {
+		t.Errorf("Expected exactly 1 insert, got %d (%d stored)", succeeded, Count[UniqueType](db))
+	}
+}
+
+func TestBadger_InMemory(t *testing.T) {
+	NewDriverTester(t).
+		SetSetUp(func(i *DriverTester) {
+			db, err := NewBadgerDBWithOptions("", BadgerOptions{InMemory: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			i.SetDb(db)
+		}).
+		SetTearDown(func(i *DriverTester) {
+			i.Db().Close()
+		}).
+		RunAllTests()
+}
+
+func TestBadger_Encryption(t *testing.T) {
+
+	// Arrange
+	dir := t.TempDir()
+	key := []byte("0123456789abcdef")
+	options := BadgerOptions{EncryptionKey: key, EncryptionKeyRotation: time.Hour}
+	db, err := NewBadgerDBWithOptions(dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tableKey := NewTableKey[SimpleType]().SetId("0")
+	db.RawSet(tableKey, []byte("secret"))
+	db.Close()
+
+	// Act
+	_, errWithoutKey := NewBadgerDB(dir)
+	reopened, err := NewBadgerDBWithOptions(dir, options)
+
+	// Assert
+	if errWithoutKey == nil {
+		t.Error("Encrypted store opened without its key")
+	}
+	if err != nil {
+		t.Fatalf("Reopen failed: expected %v, got %v", nil, err)
+	}
+	defer reopened.Close()
+	if value, _ := reopened.RawGet(tableKey); string(value) != "secret" {
+		t.Errorf("Unexpected value after reopen: %s", value)
+	}
+}
+
+func TestBadger_ReadOnly(t *testing.T) {
+
+	// Arrange
+	dir := t.TempDir()
+	db, _ := NewBadgerDB(dir)
+	tableKey := NewTableKey[SimpleType]().SetId("0")
+	db.RawSet(tableKey, []byte("value"))
+	db.Close()
+
+	// Act
+	readOnly, err := NewBadgerDBWithOptions(dir, BadgerOptions{ReadOnly: true})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Open failed: expected %v, got %v", nil, err)
+	}
+	defer readOnly.Close()
+	if value, _ := readOnly.RawGet(tableKey); string(value) != "value" {
+		t.Errorf("Unexpected value: %s", value)
+	}
+	if readOnly.RawSet(tableKey, []byte("other")) == nil {
+		t.Error("Write accepted by a read-only store")
+	}
+}
+
+// newBadgerV1Store writes a badger v1 store, as the former versions of FluentKV did, in a
+// directory of the test, holding value under key.
+func newBadgerV1Store(t *testing.T, key IKey, value []byte) string {
+
+	dir := filepath.Join(t.TempDir(), "data")
+	db, err := badgerv1.Open(badgerv1.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(txn *badgerv1.Txn) error {
+		return txn.Set(key.RawKey(), value)
+	})
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestBadger_UpgradeV1Directory(t *testing.T) {
+
+	// Arrange
+	key := NewTankKey("custom")
+	dir := newBadgerV1Store(t, key, []byte("v1"))
+	options := DefaultBadgerOptions
+	options.EncryptionKey = []byte("0123456789abcdef")
+
+	// Act
+	db, err := NewBadgerDBWithOptions(dir, options)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Open failed: expected %v, got %v", nil, err)
+	}
+	value, err := db.RawGet(key)
+	db.Close()
+	if err != nil || string(value) != "v1" {
+		t.Errorf("RawGet failed: expected %s, got %s (%v)", "v1", value, err)
+	}
+	if _, err = os.Stat(dir + ".v1"); err != nil {
+		t.Errorf("Upgrade failed: expected the badger v1 directory to be kept, got %v", err)
+	}
+	if _, err = NewBadgerDB(dir); err == nil {
+		t.Error("Upgrade failed: expected the store to be encrypted")
+	}
+}
+
+func TestBadger_UpgradeV1DirectoryInterrupted(t *testing.T) {
+
+	// Arrange: the conversion completed, but not the replacement of the directory.
+	key := NewTankKey("custom")
+	dir := newBadgerV1Store(t, key, []byte("v1"))
+	db, _ := NewBadgerDB(dir)
+	db.Close()
+	_ = os.Rename(dir, dir+".v2-upgrade")
+
+	// Act
+	db, err := NewBadgerDB(dir)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Open failed: expected %v, got %v", nil, err)
+	}
+	defer db.Close()
+	if value, err := db.RawGet(key); err != nil || string(value) != "v1" {
+		t.Errorf("RawGet failed: expected %s, got %s (%v)", "v1", value, err)
+	}
+}
+
+func TestBadger_V1DirectoryReadOnly(t *testing.T) {
+
+	// Arrange
+	dir := newBadgerV1Store(t, NewTankKey("custom"), []byte("v1"))
+
+	// Act
+	db, err := NewBadgerDBWithOptions(dir, BadgerOptions{ReadOnly: true})
+
+	// Assert
+	if !errors.Is(err, ErrBadgerV1Directory) {
+		t.Errorf("Open failed: expected %v, got %v", ErrBadgerV1Directory, err)
+	}
+	if db != nil {
+		db.Close()
+	}
+}
+
+func TestBadger_GCStopsOnClose(t *testing.T) {
+
+	// Arrange
+	options := DefaultBadgerOptions
+	options.GCInterval = time.Millisecond
+	db, err := NewBadgerDBWithOptions(t.TempDir(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		db.RawSet(NewTableKey[SimpleType]().SetId("0"), make([]byte, 1024))
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// Act
+	closed := make(chan struct{})
+	go func() {
+		db.Close()
+		close(closed)
+	}()
+
+	// Assert
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return while the GC loop runs")
+	}
+}
+
+func TestBadger_TTL(t *testing.T) {
+
+	// Arrange: without grace period, badger drops the record before the sweeper runs.
+	gracePeriod := ExpiryGracePeriod
+	ExpiryGracePeriod = 0
+	defer func() { ExpiryGracePeriod = gracePeriod }()
+
+	gob.Register(SimpleType{})
+	db, _ := NewBadgerDB(t.TempDir())
+	defer db.Close()
+	session, _ := InsertWithTTL(db, NewSimpleType("t1", "t2", 1), time.Second)
+	time.Sleep(1100 * time.Millisecond)
+
+	// Act
+	_, errRaw := db.RawGet(session.Key())
+	swept, err := db.SweepExpired()
+	reinserted, _ := Insert(db, NewSimpleType("t1", "t2", 2))
+
+	// Assert
+	if !errors.Is(errRaw, ErrNotFound) {
+		t.Errorf("RawGet failed: expected %v, got %v", ErrNotFound, errRaw)
+	}
+	if err != nil || swept != 1 {
+		t.Errorf("SweepExpired failed: expected %d, got %d (%v)", 1, swept, err)
+	}
+	if reinserted.Key().Id() != session.Key().Id() {
+		t.Errorf("SweepExpired failed: expected the ID %v released, got %v",
+			session.Key().Id(), reinserted.Key().Id())
+	}
+}
@@ -0,0 +1,132 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	badgerv1 "github.com/dgraph-io/badger"
+	"github.com/dgraph-io/badger/v2"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// badgerV1ManifestVersion is the version written in its MANIFEST by badger v1, whose
+	// directories badger v2 cannot read.
+	badgerV1ManifestVersion = 4
+
+	// badgerUpgradeSuffix names the directory a badger v1 store is converted into, and
+	// badgerV1Suffix the one it is kept in once converted.
+	badgerUpgradeSuffix = ".v2-upgrade"
+	badgerV1Suffix      = ".v1"
+
+	// badgerLoadPendingWrites bounds the writes in flight while loading a backup.
+	badgerLoadPendingWrites = 256
+)
+
+// ErrBadgerV1Directory indicates a directory written by badger v1, opened read-only: it
+// must be opened once for writing, which upgrades it, see NewBadgerDBWithOptions.
+var ErrBadgerV1Directory = errors.New("the directory holds a badger v1 store")
+
+// upgradeBadgerV1 converts the badger v1 store of the directory, if any, into a badger v2
+// one created with the options, through a backup of the former streamed into the latter.
+//
+// The store is converted into a sibling directory, which replaces the original one once
+// complete; the original one is kept beside it, with the badgerV1Suffix. An interrupted
+// conversion starts over, or only completes the replacement when it was left in between.
+func upgradeBadgerV1(directoryPath string, options BadgerOptions) error {
+
+	directoryPath = filepath.Clean(directoryPath)
+	upgradePath := directoryPath + badgerUpgradeSuffix
+	v1Path := directoryPath + badgerV1Suffix
+
+	if _, err := os.Stat(directoryPath); errors.Is(err, os.ErrNotExist) {
+		if _, err = os.Stat(upgradePath); err == nil {
+			return os.Rename(upgradePath, directoryPath)
+		}
+		return nil // A new store.
+	}
+
+	v1, err := isBadgerV1Directory(directoryPath)
+	if err != nil || !v1 {
+		return err
+	}
+	if options.ReadOnly {
+		return ErrBadgerV1Directory
+	}
+	if _, err = os.Stat(v1Path); err == nil {
+		return fmt.Errorf("unable to upgrade the badger v1 store: %s already exists", v1Path)
+	}
+
+	if err = os.RemoveAll(upgradePath); err != nil {
+		return err
+	}
+	if err = convertBadgerV1(directoryPath, upgradePath, options); err != nil {
+		_ = os.RemoveAll(upgradePath)
+		return fmt.Errorf("unable to upgrade the badger v1 store: %w", err)
+	}
+
+	if err = os.Rename(directoryPath, v1Path); err != nil {
+		return err
+	}
+	return os.Rename(upgradePath, directoryPath)
+}
+
+// convertBadgerV1 loads a backup of the badger v1 store of source into a new badger v2
+// store in target.
+func convertBadgerV1(source string, target string, options BadgerOptions) error {
+
+	sourceOptions := badgerv1.DefaultOptions(source).WithTruncate(true)
+	if options.Logger != nil {
+		sourceOptions = sourceOptions.WithLogger(options.Logger)
+	}
+	from, err := badgerv1.Open(sourceOptions)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+
+	options.ReadOnly = false
+	to, err := badger.Open(badgerOpenOptions(target, options))
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		_, err := from.Backup(writer, 0)
+		_ = writer.CloseWithError(err)
+	}()
+
+	err = to.Load(reader, badgerLoadPendingWrites)
+	_ = reader.CloseWithError(io.ErrClosedPipe) // Ends the backup if the load failed.
+	if closeErr := to.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// isBadgerV1Directory tells whether the MANIFEST of the directory was written by badger
+// v1, rather than letting badger v2 fail on it.
+func isBadgerV1Directory(directoryPath string) (bool, error) {
+
+	file, err := os.Open(filepath.Join(directoryPath, badger.ManifestFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil // A new store.
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	header := make([]byte, 8)
+	if _, err = io.ReadFull(file, header); err != nil {
+		return false, nil // Left for badger to report.
+	}
+
+	return bytes.Equal(header[:4], []byte("Bdgr")) &&
+		binary.BigEndian.Uint32(header[4:]) <= badgerV1ManifestVersion, nil
+}
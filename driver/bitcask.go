@@ -0,0 +1,676 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/Phosmachina/FluentKV/core"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BitcaskOptions tunes a Bitcask store.
+type BitcaskOptions struct {
+	// MaxFileSize is the size beyond which the active data file is sealed and a new one
+	// started; 0 means no limit.
+	MaxFileSize int64
+
+	// SyncWrites flushes every write to the disk before returning.
+	SyncWrites bool
+}
+
+// DefaultBitcaskOptions are the options used by NewBitcaskDB.
+var DefaultBitcaskOptions = BitcaskOptions{
+	MaxFileSize: 64 << 20,
+	SyncWrites:  false,
+}
+
+// Bitcask is a dependency-free persistent KVDriver following the Bitcask design: every
+// write is appended to the active data file and an in-memory key directory maps each
+// live key to the position of its latest value.
+//
+// Records are CRC-checked; at opening, a torn tail left by a crash is truncated, and the
+// writes of a transaction are either all replayed or not at all. Any other corruption
+// fails the opening with ErrCorruptedRecord, rather than dropping the data after it. Sealed data files come
+// with a hint file listing their keys, so that opening does not read every value.
+// The space of overwritten and deleted values is only reclaimed by Compact.
+//
+// A store must not be opened by more than one process at a time.
+type Bitcask struct {
+	m       sync.RWMutex
+	dir     string
+	options BitcaskOptions
+
+	files      map[uint32]*os.File
+	activeId   uint32
+	activeSize int64
+
+	// activeHints holds the hint of every record of the active file, written out when
+	// it gets sealed.
+	activeHints []bitcaskHint
+
+	keydir  *skiplist[bitcaskEntry]
+	version uint64
+	closed  bool
+}
+
+// bitcaskEntry locates the latest value of a key.
+type bitcaskEntry struct {
+	fileId  uint32
+	offset  int64
+	size    uint32
+	version uint64
+}
+
+const (
+	bitcaskDataExt = ".data"
+	bitcaskHintExt = ".hint"
+)
+
+// ErrCorruptedRecord indicates a record of a data file whose checksum does not match, and
+// which is not the torn tail of the active file.
+var ErrCorruptedRecord = errors.New("corrupted record in the data file")
+
+// NewBitcaskDB opens, or creates, the Bitcask store of the directory with the
+// DefaultBitcaskOptions.
+func NewBitcaskDB(directoryPath string) (*KVStoreManager, error) {
+	return NewBitcaskDBWithOptions(directoryPath, DefaultBitcaskOptions)
+}
+
+// NewBitcaskDBWithOptions opens, or creates, the Bitcask store of the directory.
+func NewBitcaskDBWithOptions(directoryPath string, options BitcaskOptions) (*KVStoreManager, error) {
+
+	if directoryPath == "" {
+		return nil, errors.New("directoryPath is empty")
+	}
+	if err := os.MkdirAll(directoryPath, os.FileMode(defaultFileMode)); err != nil {
+		return nil, err
+	}
+
+	db := &Bitcask{
+		dir:     directoryPath,
+		options: options,
+		files:   make(map[uint32]*os.File),
+		keydir:  newSkiplist[bitcaskEntry](),
+	}
+	if err := db.open(); err != nil {
+		db.closeFiles()
+		return nil, fmt.Errorf("unable to open the bitcask database: %w", err)
+	}
+	runtime.SetFinalizer(db, closeBitcask)
+
+	manager := NewKVStoreManager(db)
+	if err := manager.Migrate(); err != nil {
+		return nil, err
+	}
+
+	return manager, nil
+}
+
+func closeBitcask(db *Bitcask) {
+	db.Close()
+}
+
+// region KVDriver implementation
+
+func (db *Bitcask) RawSet(key IKey, value []byte) error {
+
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	return db.append([]bitcaskRecord{{key: key.Key(), value: value}})
+}
+
+func (db *Bitcask) RawGet(key IKey) ([]byte, error) {
+	entry, err := db.getVersioned(key.Key())
+	return entry.value, err
+}
+
+func (db *Bitcask) RawDelete(key IKey) error {
+
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	if _, ok := db.keydir.Get(key.Key()); !ok {
+		return ErrNotFound
+	}
+
+	return db.append([]bitcaskRecord{{key: key.Key(), tombstone: true}})
+}
+
+func (db *Bitcask) RawIterKey(
+	currentKey IKey,
+	action func(key IKey) (stop bool),
+) {
+	iterKey(db, currentKey, action)
+}
+
+func (db *Bitcask) RawIterKV(
+	key IKey,
+	action func(key IKey, value []byte) (stop bool),
+) {
+	iterKV(db, key, action)
+}
+
+func (db *Bitcask) Exist(key IKey) bool {
+
+	db.m.RLock()
+	defer db.m.RUnlock()
+
+	if db.closed {
+		return false
+	}
+	_, ok := db.keydir.Get(key.Key())
+
+	return ok
+}
+
+func (db *Bitcask) Begin() (KVTx, error) {
+	return newOptimisticTx(db), nil
+}
+
+func (db *Bitcask) NewWriteBatch() KVWriteBatch {
+	return NewLoopWriteBatch(db)
+}
+
+// Close seals the active data file, writing its hint file, and releases the files.
+func (db *Bitcask) Close() {
+
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	if db.closed {
+		return
+	}
+	db.closed = true
+
+	if active := db.files[db.activeId]; active != nil {
+		if db.activeSize == 0 {
+			_ = active.Close()
+			delete(db.files, db.activeId)
+			_ = os.Remove(db.dataPath(db.activeId))
+		} else if err := active.Sync(); err == nil {
+			_ = writeHintFile(db.hintPath(db.activeId), db.activeHints, db.activeSize)
+		}
+	}
+	db.closeFiles()
+}
+
+// endregion
+
+// region Compaction
+
+// Compact rewrites the live entries into a fresh data file, with its hint file, and
+// removes the former files, reclaiming the space of overwritten and deleted values.
+// The store stays usable meanwhile, writers waiting for the compaction to end.
+func (db *Bitcask) Compact() error {
+
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	compactedId := db.activeId + 1
+	file, err := os.OpenFile(db.dataPath(compactedId), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	var hints []bitcaskHint
+	var size int64
+	var readErr error
+	var buffer []byte
+	db.keydir.Ascend("", func(key string, entry bitcaskEntry) (stop bool) {
+		var value []byte
+		if value, readErr = db.readValue(entry); readErr != nil {
+			return true
+		}
+		record := bitcaskRecord{key: key, value: value}
+		buffer = record.appendTo(buffer[:0], false)
+		if _, readErr = file.Write(buffer); readErr != nil {
+			return true
+		}
+		hints = append(hints, record.hint(size))
+		size += int64(len(buffer))
+		return false
+	})
+	if readErr == nil {
+		readErr = file.Sync()
+	}
+	if readErr == nil {
+		readErr = writeHintFile(db.hintPath(compactedId), hints, size)
+	}
+	if readErr != nil {
+		_ = file.Close()
+		_ = os.Remove(db.dataPath(compactedId))
+		_ = os.Remove(db.hintPath(compactedId))
+		return readErr
+	}
+
+	// Point the key directory to the compacted file, then drop the former files, oldest
+	// first so that a crash meanwhile never resurrects a deleted value.
+	for _, hint := range hints {
+		db.keydir.Set(hint.key, bitcaskEntry{
+			fileId:  compactedId,
+			offset:  hint.offset,
+			size:    hint.size,
+			version: db.mustGetVersion(hint.key),
+		})
+	}
+	formerIds := db.fileIds()
+	db.files[compactedId] = file
+	for _, id := range formerIds {
+		_ = db.files[id].Close()
+		delete(db.files, id)
+		_ = os.Remove(db.dataPath(id))
+		_ = os.Remove(db.hintPath(id))
+	}
+
+	return db.startActive(compactedId + 1)
+}
+
+// mustGetVersion returns the version of a key known to be in the key directory.
+func (db *Bitcask) mustGetVersion(key string) uint64 {
+	entry, _ := db.keydir.Get(key)
+	return entry.version
+}
+
+// endregion
+
+// region KVOrderedDriver implementation
+
+func (db *Bitcask) RawIterKVFrom(
+	key IKey,
+	start string,
+	reverse bool,
+	action func(key IKey, value []byte) (stop bool),
+) {
+	iterKVFrom(db, key, start, reverse, action)
+}
+
+func (db *Bitcask) scanFrom(
+	prefix string,
+	bound string,
+	reverse bool,
+	withValues bool,
+	n int,
+) []versionedEntry {
+
+	db.m.RLock()
+	defer db.m.RUnlock()
+
+	if db.closed {
+		return nil
+	}
+
+	var entries []versionedEntry
+	collect := func(key string, entry bitcaskEntry) (stop bool) {
+		matched := versionedEntry{key: key, version: entry.version}
+		if withValues {
+			value, err := db.readValue(entry)
+			if err != nil {
+				return false
+			}
+			matched.value = value
+		}
+		entries = append(entries, matched)
+		return len(entries) == n
+	}
+	if reverse {
+		db.keydir.DescendBefore(prefix, bound, collect)
+	} else {
+		db.keydir.AscendFrom(prefix, bound, collect)
+	}
+
+	return entries
+}
+
+// endregion
+
+// region versionedStore implementation
+
+func (db *Bitcask) getVersioned(key string) (versionedEntry, error) {
+
+	db.m.RLock()
+	defer db.m.RUnlock()
+
+	if db.closed {
+		return versionedEntry{}, ErrClosed
+	}
+
+	entry, ok := db.keydir.Get(key)
+	if !ok {
+		return versionedEntry{key: key}, ErrNotFound
+	}
+	value, err := db.readValue(entry)
+	if err != nil {
+		return versionedEntry{key: key}, err
+	}
+
+	return versionedEntry{key: key, value: value, version: entry.version}, nil
+}
+
+func (db *Bitcask) scanVersioned(
+	prefix string,
+	withValues bool,
+	reads map[string]uint64,
+) []versionedEntry {
+
+	db.m.RLock()
+	defer db.m.RUnlock()
+
+	if db.closed {
+		return nil
+	}
+
+	var entries []versionedEntry
+	db.keydir.Ascend(prefix, func(key string, entry bitcaskEntry) (stop bool) {
+		matched := versionedEntry{key: key, version: entry.version}
+		if withValues {
+			value, err := db.readValue(entry)
+			if err != nil {
+				return false
+			}
+			matched.value = value
+		}
+		entries = append(entries, matched)
+		if _, read := reads[key]; reads != nil && !read {
+			reads[key] = entry.version
+		}
+		return false
+	})
+
+	return entries
+}
+
+func (db *Bitcask) commitVersioned(
+	reads map[string]uint64,
+	scans map[string]bool,
+	writes map[string][]byte,
+	deletes map[string]bool,
+) error {
+
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	for k, version := range reads {
+		if entry, _ := db.keydir.Get(k); entry.version != version {
+			return ErrConflict
+		}
+	}
+	for prefix := range scans {
+		phantom := false
+		db.keydir.Ascend(prefix, func(key string, _ bitcaskEntry) (stop bool) {
+			_, read := reads[key]
+			phantom = !read
+			return phantom
+		})
+		if phantom {
+			return ErrConflict
+		}
+	}
+
+	records := make([]bitcaskRecord, 0, len(writes)+len(deletes))
+	for k := range deletes {
+		if _, ok := db.keydir.Get(k); ok {
+			records = append(records, bitcaskRecord{key: k, tombstone: true})
+		}
+	}
+	for k, value := range writes {
+		records = append(records, bitcaskRecord{key: k, value: value})
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	return db.append(records)
+}
+
+// endregion
+
+// region Files
+
+// open loads the key directory from the data files of the directory, and picks the
+// active file.
+func (db *Bitcask) open() error {
+
+	ids, err := listDataFiles(db.dir)
+	if err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		file, err := os.OpenFile(db.dataPath(id), os.O_RDWR, 0o644)
+		if err != nil {
+			return err
+		}
+		db.files[id] = file
+
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+
+		last := i == len(ids)-1
+		if hints, err := readHintFile(db.hintPath(id), info.Size()); err == nil {
+			db.loadHints(id, hints)
+			if last {
+				return db.startActive(id + 1)
+			}
+			continue
+		}
+
+		// No usable hint file: the file was active when the store was left, so it is
+		// scanned, and its torn tail dropped. Only the last file can have one: the others
+		// were complete when sealed, and are never cut.
+		hints, size, err := scanDataFile(file)
+		if err != nil {
+			return err
+		}
+		if size != info.Size() && !last {
+			return fmt.Errorf("%w: %s ends with an incomplete batch", ErrCorruptedRecord, file.Name())
+		}
+		if size != info.Size() {
+			if err = file.Truncate(size); err != nil {
+				return err
+			}
+		}
+		if _, err = file.Seek(size, io.SeekStart); err != nil {
+			return err
+		}
+		db.loadHints(id, hints)
+		_ = os.Remove(db.hintPath(id))
+
+		if last {
+			db.activeId, db.activeSize, db.activeHints = id, size, hints
+			return nil
+		}
+		if err = writeHintFile(db.hintPath(id), hints, size); err != nil {
+			return err
+		}
+	}
+
+	return db.startActive(0)
+}
+
+// loadHints replays the hints of a data file into the key directory.
+func (db *Bitcask) loadHints(fileId uint32, hints []bitcaskHint) {
+	for _, hint := range hints {
+		if hint.tombstone {
+			db.keydir.Delete(hint.key)
+			continue
+		}
+		db.version++
+		db.keydir.Set(hint.key, bitcaskEntry{
+			fileId:  fileId,
+			offset:  hint.offset,
+			size:    hint.size,
+			version: db.version,
+		})
+	}
+}
+
+// append writes the records at the end of the active file as one batch, then updates
+// the key directory. On failure, the partial batch is cut off.
+func (db *Bitcask) append(records []bitcaskRecord) error {
+
+	var buffer []byte
+	for i, record := range records {
+		buffer = record.appendTo(buffer, i < len(records)-1)
+	}
+
+	if db.options.MaxFileSize > 0 && db.activeSize > 0 &&
+		db.activeSize+int64(len(buffer)) > db.options.MaxFileSize {
+		if err := db.seal(); err != nil {
+			return err
+		}
+	}
+
+	active := db.files[db.activeId]
+	if _, err := active.Write(buffer); err != nil {
+		_ = active.Truncate(db.activeSize)
+		_, _ = active.Seek(db.activeSize, io.SeekStart)
+		return fmt.Errorf("unable to append to the data file: %w", err)
+	}
+	if db.options.SyncWrites {
+		if err := active.Sync(); err != nil {
+			return fmt.Errorf("unable to sync the data file: %w", err)
+		}
+	}
+
+	db.version++
+	offset := db.activeSize
+	for _, record := range records {
+		hint := record.hint(offset)
+		db.activeHints = append(db.activeHints, hint)
+		offset += record.encodedSize()
+
+		if record.tombstone {
+			db.keydir.Delete(record.key)
+			continue
+		}
+		db.keydir.Set(record.key, bitcaskEntry{
+			fileId:  db.activeId,
+			offset:  hint.offset,
+			size:    hint.size,
+			version: db.version,
+		})
+	}
+	db.activeSize = offset
+
+	return nil
+}
+
+// seal writes the hint file of the active file and starts a new one.
+func (db *Bitcask) seal() error {
+
+	if err := db.files[db.activeId].Sync(); err != nil {
+		return err
+	}
+	if err := writeHintFile(db.hintPath(db.activeId), db.activeHints, db.activeSize); err != nil {
+		return err
+	}
+
+	return db.startActive(db.activeId + 1)
+}
+
+// startActive creates the data file with the given ID and makes it the active one.
+func (db *Bitcask) startActive(id uint32) error {
+
+	file, err := os.OpenFile(db.dataPath(id), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	db.files[id] = file
+	db.activeId, db.activeSize, db.activeHints = id, 0, nil
+
+	return nil
+}
+
+// readValue reads the value located by entry.
+func (db *Bitcask) readValue(entry bitcaskEntry) ([]byte, error) {
+
+	file, ok := db.files[entry.fileId]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	value := make([]byte, entry.size)
+	if _, err := file.ReadAt(value, entry.offset); err != nil {
+		return nil, fmt.Errorf("unable to read the data file: %w", err)
+	}
+
+	return value, nil
+}
+
+// fileIds returns the IDs of the open data files, in ascending order.
+func (db *Bitcask) fileIds() []uint32 {
+	ids := make([]uint32, 0, len(db.files))
+	for id := range db.files {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (db *Bitcask) closeFiles() {
+	for id, file := range db.files {
+		_ = file.Close()
+		delete(db.files, id)
+	}
+}
+
+func (db *Bitcask) dataPath(id uint32) string {
+	return filepath.Join(db.dir, fmt.Sprintf("%09d%s", id, bitcaskDataExt))
+}
+
+func (db *Bitcask) hintPath(id uint32) string {
+	return filepath.Join(db.dir, fmt.Sprintf("%09d%s", id, bitcaskHintExt))
+}
+
+// listDataFiles returns the IDs of the data files of the directory, in ascending order.
+func listDataFiles(dir string) ([]uint32, error) {
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint32
+	for _, entry := range entries {
+		name, isData := strings.CutSuffix(entry.Name(), bitcaskDataExt)
+		if !isData || entry.IsDir() {
+			continue
+		}
+		id, err := strconv.ParseUint(name, 10, 32)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint32(id))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
+
+// endregion
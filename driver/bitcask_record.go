@@ -0,0 +1,235 @@
+package driver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+)
+
+// A data file is a sequence of records:
+//
+//	crc (4) | flags (1) | key length (4) | value length (4) | key | value
+//
+// where crc is the CRC-32 of everything following it. The records of a transaction are
+// written together, each but the last flagged as continued, so that a batch cut by a
+// crash is dropped as a whole.
+const (
+	bitcaskHeaderSize = 13
+
+	bitcaskFlagTombstone byte = 1
+	bitcaskFlagContinued byte = 2
+)
+
+// A hint file lists the records of a sealed data file, without their values:
+//
+//	flags (1) | key length (4) | value length (4) | value offset (8) | key
+//
+// followed by the size of the data file (8) and the CRC-32 of all the preceding bytes (4).
+const (
+	bitcaskHintHeaderSize  = 17
+	bitcaskHintTrailerSize = 12
+)
+
+// ErrInvalidHintFile indicates a hint file that is truncated, corrupted, or out of date
+// with its data file.
+var ErrInvalidHintFile = errors.New("invalid hint file")
+
+// bitcaskRecord is a write to append to a data file.
+type bitcaskRecord struct {
+	key       string
+	value     []byte
+	tombstone bool
+}
+
+// bitcaskHint locates the value of a record in its data file.
+type bitcaskHint struct {
+	key       string
+	offset    int64
+	size      uint32
+	tombstone bool
+}
+
+func (r *bitcaskRecord) encodedSize() int64 {
+	return int64(bitcaskHeaderSize + len(r.key) + len(r.value))
+}
+
+// appendTo encodes the record at the end of buffer.
+func (r *bitcaskRecord) appendTo(buffer []byte, continued bool) []byte {
+
+	var flags byte
+	if r.tombstone {
+		flags |= bitcaskFlagTombstone
+	}
+	if continued {
+		flags |= bitcaskFlagContinued
+	}
+
+	start := len(buffer)
+	buffer = binary.BigEndian.AppendUint32(buffer, 0)
+	buffer = append(buffer, flags)
+	buffer = binary.BigEndian.AppendUint32(buffer, uint32(len(r.key)))
+	buffer = binary.BigEndian.AppendUint32(buffer, uint32(len(r.value)))
+	buffer = append(buffer, r.key...)
+	buffer = append(buffer, r.value...)
+	binary.BigEndian.PutUint32(buffer[start:], crc32.ChecksumIEEE(buffer[start+4:]))
+
+	return buffer
+}
+
+// hint returns the hint of the record, written at offset in its data file.
+func (r *bitcaskRecord) hint(offset int64) bitcaskHint {
+	return bitcaskHint{
+		key:       r.key,
+		offset:    offset + bitcaskHeaderSize + int64(len(r.key)),
+		size:      uint32(len(r.value)),
+		tombstone: r.tombstone,
+	}
+}
+
+// scanDataFile reads the records of a data file, stopping at the torn tail left by a crash,
+// if any. It returns the hints of the complete batches and the size they span. A corrupted
+// record followed by more data is not a torn tail: it fails with ErrCorruptedRecord.
+func scanDataFile(file *os.File) (hints []bitcaskHint, size int64, err error) {
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, 0, math.MaxInt64))
+	header := make([]byte, bitcaskHeaderSize)
+
+	var pending []bitcaskHint
+	offset := int64(0)
+	for {
+		if _, err = io.ReadFull(reader, header); err != nil {
+			break
+		}
+		flags := header[4]
+		keyLength := binary.BigEndian.Uint32(header[5:])
+		valueLength := binary.BigEndian.Uint32(header[9:])
+
+		// A torn header may claim any length: never read past the end of the file.
+		end := offset + bitcaskHeaderSize + int64(keyLength) + int64(valueLength)
+		if end > info.Size() {
+			err = io.ErrUnexpectedEOF
+			break
+		}
+
+		body := make([]byte, int(keyLength)+int(valueLength))
+		if _, err = io.ReadFull(reader, body); err != nil {
+			break
+		}
+		checksum := crc32.Update(crc32.ChecksumIEEE(header[4:]), crc32.IEEETable, body)
+		if checksum != binary.BigEndian.Uint32(header) {
+			if end < info.Size() {
+				return nil, 0, fmt.Errorf(
+					"%w: %s at offset %d", ErrCorruptedRecord, file.Name(), offset,
+				)
+			}
+			break
+		}
+
+		record := bitcaskRecord{
+			key:       string(body[:keyLength]),
+			value:     body[keyLength:],
+			tombstone: flags&bitcaskFlagTombstone != 0,
+		}
+		pending = append(pending, record.hint(offset))
+		offset += record.encodedSize()
+
+		if flags&bitcaskFlagContinued == 0 {
+			hints = append(hints, pending...)
+			pending = pending[:0]
+			size = offset
+		}
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+
+	return hints, size, err
+}
+
+// writeHintFile atomically writes the hint file of a data file of the given size.
+func writeHintFile(path string, hints []bitcaskHint, dataSize int64) error {
+
+	var buffer []byte
+	for _, hint := range hints {
+		var flags byte
+		if hint.tombstone {
+			flags |= bitcaskFlagTombstone
+		}
+		buffer = append(buffer, flags)
+		buffer = binary.BigEndian.AppendUint32(buffer, uint32(len(hint.key)))
+		buffer = binary.BigEndian.AppendUint32(buffer, hint.size)
+		buffer = binary.BigEndian.AppendUint64(buffer, uint64(hint.offset))
+		buffer = append(buffer, hint.key...)
+	}
+	buffer = binary.BigEndian.AppendUint64(buffer, uint64(dataSize))
+	buffer = binary.BigEndian.AppendUint32(buffer, crc32.ChecksumIEEE(buffer))
+
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(buffer); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// readHintFile reads the hint file of a data file of the given size.
+func readHintFile(path string, dataSize int64) ([]bitcaskHint, error) {
+
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(buffer) < bitcaskHintTrailerSize {
+		return nil, ErrInvalidHintFile
+	}
+
+	trailer := buffer[len(buffer)-bitcaskHintTrailerSize:]
+	content := buffer[:len(buffer)-4]
+	if crc32.ChecksumIEEE(content) != binary.BigEndian.Uint32(trailer[8:]) ||
+		int64(binary.BigEndian.Uint64(trailer)) != dataSize {
+		return nil, ErrInvalidHintFile
+	}
+
+	var hints []bitcaskHint
+	content = buffer[:len(buffer)-bitcaskHintTrailerSize]
+	for len(content) > 0 {
+		if len(content) < bitcaskHintHeaderSize {
+			return nil, ErrInvalidHintFile
+		}
+		keyLength := int(binary.BigEndian.Uint32(content[1:]))
+		if len(content) < bitcaskHintHeaderSize+keyLength {
+			return nil, ErrInvalidHintFile
+		}
+		hints = append(hints, bitcaskHint{
+			key:       string(content[bitcaskHintHeaderSize : bitcaskHintHeaderSize+keyLength]),
+			size:      binary.BigEndian.Uint32(content[5:]),
+			offset:    int64(binary.BigEndian.Uint64(content[9:])),
+			tombstone: content[0]&bitcaskFlagTombstone != 0,
+		})
+		content = content[bitcaskHintHeaderSize+keyLength:]
+	}
+
+	return hints, nil
+}
@@ -0,0 +1,318 @@
+package driver_test
+
+import (
+	"errors"
+	. "github.com/Phosmachina/FluentKV/core"
+	. "github.com/Phosmachina/FluentKV/driver"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBitcask(t *testing.T) {
+	NewDriverTester(t).
+		SetSetUp(func(i *DriverTester) {
+			db, err := NewBitcaskDB(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			i.SetDb(db)
+		}).
+		RunAllTests()
+}
+
+func TestBitcask_OrderedIteration(t *testing.T) {
+	db, _ := NewBitcaskDB(t.TempDir())
+	defer db.Close()
+	testOrderedIteration(t, db)
+}
+
+func TestBitcask_TxPhantom(t *testing.T) {
+	db, _ := NewBitcaskDB(t.TempDir())
+	defer db.Close()
+	testTxPhantom(t, db)
+}
+
+func TestBitcask_OrderedSeek(t *testing.T) {
+	db, _ := NewBitcaskDB(t.TempDir())
+	defer db.Close()
+	testOrderedSeek(t, db)
+}
+
+func TestBitcask_BatchedIteration(t *testing.T) {
+	db, _ := NewBitcaskDB(t.TempDir())
+	defer db.Close()
+	testBatchedIteration(t, db)
+}
+
+func TestBitcask_Reopen(t *testing.T) {
+
+	// Arrange
+	dir := t.TempDir()
+	db, _ := NewBitcaskDB(dir)
+	for i := 0; i < 10; i++ {
+		db.RawSet(NewTableKey[SimpleType]().SetId(strconv.Itoa(i)), []byte(strconv.Itoa(i)))
+	}
+	db.RawDelete(NewTableKey[SimpleType]().SetId("3"))
+	db.Close()
+
+	// Act
+	db, err := NewBitcaskDB(dir)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Reopen failed: expected %v, got %v", nil, err)
+	}
+	defer db.Close()
+	if hints, _ := filepath.Glob(filepath.Join(dir, "*.hint")); len(hints) == 0 {
+		t.Error("Expecting a hint file after close")
+	}
+	assertBitcaskContent(t, db, 10, "3")
+}
+
+func TestBitcask_ReopenKeepsIds(t *testing.T) {
+
+	// Arrange
+	dir := t.TempDir()
+	db, _ := NewBitcaskDB(dir)
+	for i := 0; i < 10; i++ {
+		_, _ = Insert(db, NewSimpleType("t1", "t2", i))
+	}
+	_ = Delete[SimpleType](db, "3")
+	db.Close()
+
+	// Act
+	db, _ = NewBitcaskDB(dir)
+	defer db.Close()
+	ids, err := db.GetFreeIds(2)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("GetFreeIds failed: expected %v, got %v", nil, err)
+	}
+	if ids[0] != "3" || ids[1] != "10" {
+		t.Errorf("GetFreeIds failed: expected %v, got %v", []string{"3", "10"}, ids)
+	}
+}
+
+func TestBitcask_RecoverWithoutHint(t *testing.T) {
+
+	// Arrange: a store left without closing has no hint for its active file.
+	dir := t.TempDir()
+	db, _ := NewBitcaskDB(dir)
+	for i := 0; i < 10; i++ {
+		db.RawSet(NewTableKey[SimpleType]().SetId(strconv.Itoa(i)), []byte(strconv.Itoa(i)))
+	}
+	db.RawDelete(NewTableKey[SimpleType]().SetId("3"))
+	crashed := copyDir(t, dir)
+	db.Close()
+
+	// Act
+	recovered, err := NewBitcaskDB(crashed)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Recovery failed: expected %v, got %v", nil, err)
+	}
+	defer recovered.Close()
+	assertBitcaskContent(t, recovered, 10, "3")
+}
+
+func TestBitcask_TornTail(t *testing.T) {
+
+	// Arrange
+	dir := t.TempDir()
+	db, _ := NewBitcaskDB(dir)
+	for i := 0; i < 10; i++ {
+		db.RawSet(NewTableKey[SimpleType]().SetId(strconv.Itoa(i)), []byte(strconv.Itoa(i)))
+	}
+	_ = db.WithTx(func(tx *KVStoreManager) error {
+		tx.RawSet(NewTableKey[SimpleType]().SetId("10"), []byte("10"))
+		tx.RawSet(NewTableKey[SimpleType]().SetId("11"), []byte("11"))
+		return nil
+	})
+	crashed := copyDir(t, dir)
+	db.Close()
+
+	// Cut the last record of the transaction in the middle.
+	dataFiles, _ := filepath.Glob(filepath.Join(crashed, "*.data"))
+	last := dataFiles[len(dataFiles)-1]
+	info, _ := os.Stat(last)
+	_ = os.Truncate(last, info.Size()-1)
+
+	// Act
+	recovered, err := NewBitcaskDB(crashed)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Recovery failed: expected %v, got %v", nil, err)
+	}
+	defer recovered.Close()
+	assertBitcaskContent(t, recovered, 10)
+	if recovered.Exist(NewTableKey[SimpleType]().SetId("10")) {
+		t.Error("Partial transaction replayed after recovery")
+	}
+	if err = recovered.RawSet(NewTableKey[SimpleType]().SetId("10"), []byte("10")); err != nil {
+		t.Errorf("Recovered store not writable: %v", err)
+	}
+	if value, _ := recovered.RawGet(NewTableKey[SimpleType]().SetId("10")); string(value) != "10" {
+		t.Errorf("Unexpected value after recovery: %s", value)
+	}
+}
+
+func TestBitcask_CorruptedRecord(t *testing.T) {
+
+	// Arrange
+	dir := t.TempDir()
+	db, _ := NewBitcaskDB(dir)
+	for i := 0; i < 10; i++ {
+		db.RawSet(NewTableKey[SimpleType]().SetId(strconv.Itoa(i)), []byte(strconv.Itoa(i)))
+	}
+	crashed := copyDir(t, dir)
+	db.Close()
+
+	// Flip a bit of the checksum of the first record, followed by the others.
+	dataFiles, _ := filepath.Glob(filepath.Join(crashed, "*.data"))
+	last := dataFiles[len(dataFiles)-1]
+	content, _ := os.ReadFile(last)
+	content[0] ^= 1
+	_ = os.WriteFile(last, content, 0o644)
+
+	// Act
+	recovered, err := NewBitcaskDB(crashed)
+
+	// Assert
+	if !errors.Is(err, ErrCorruptedRecord) {
+		t.Errorf("NewBitcaskDB failed: expected %v, got %v", ErrCorruptedRecord, err)
+	}
+	if recovered != nil {
+		recovered.Close()
+	}
+	if info, _ := os.Stat(last); info.Size() != int64(len(content)) {
+		t.Errorf("Data file truncated: expected %d bytes, got %d", len(content), info.Size())
+	}
+}
+
+func TestBitcask_CorruptedSealedFile(t *testing.T) {
+
+	// Arrange
+	dir := t.TempDir()
+	db, _ := NewBitcaskDBWithOptions(dir, BitcaskOptions{MaxFileSize: 256})
+	for i := 0; i < 50; i++ {
+		db.RawSet(NewTableKey[SimpleType]().SetId(strconv.Itoa(i)), []byte(strconv.Itoa(i)))
+	}
+	db.Close()
+
+	// Cut the first data file, and remove its hint so that it is scanned.
+	dataFiles, _ := filepath.Glob(filepath.Join(dir, "*.data"))
+	first := dataFiles[0]
+	info, _ := os.Stat(first)
+	_ = os.Truncate(first, info.Size()-1)
+	_ = os.Remove(strings.TrimSuffix(first, ".data") + ".hint")
+
+	// Act
+	recovered, err := NewBitcaskDB(dir)
+
+	// Assert
+	if len(dataFiles) < 2 {
+		t.Fatalf("Unexpected data files: expected several, got %d", len(dataFiles))
+	}
+	if !errors.Is(err, ErrCorruptedRecord) {
+		t.Errorf("NewBitcaskDB failed: expected %v, got %v", ErrCorruptedRecord, err)
+	}
+	if recovered != nil {
+		recovered.Close()
+	}
+	if cut, _ := os.Stat(first); cut.Size() != info.Size()-1 {
+		t.Errorf("Sealed file truncated: expected %d bytes, got %d", info.Size()-1, cut.Size())
+	}
+}
+
+func TestBitcask_Compact(t *testing.T) {
+
+	// Arrange
+	dir := t.TempDir()
+	db, _ := NewBitcaskDBWithOptions(dir, BitcaskOptions{MaxFileSize: 256})
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 10; i++ {
+			db.RawSet(NewTableKey[SimpleType]().SetId(strconv.Itoa(i)), []byte(strconv.Itoa(i)))
+		}
+	}
+	db.RawDelete(NewTableKey[SimpleType]().SetId("3"))
+	sizeBefore := dirSize(t, dir)
+
+	// Act
+	err := db.KVDriver.(*Bitcask).Compact()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Compact failed: expected %v, got %v", nil, err)
+	}
+	if sizeAfter := dirSize(t, dir); sizeAfter >= sizeBefore {
+		t.Errorf("Compact failed: expected less than %d bytes, got %d", sizeBefore, sizeAfter)
+	}
+	assertBitcaskContent(t, db, 10, "3")
+
+	db.Close()
+	db, _ = NewBitcaskDB(dir)
+	defer db.Close()
+	assertBitcaskContent(t, db, 10, "3")
+}
+
+// assertBitcaskContent checks that the store holds the IDs below count, with their ID as
+// value, except the deleted ones.
+func assertBitcaskContent(t *testing.T, db *KVStoreManager, count int, deleted ...string) {
+
+	expected := count - len(deleted)
+	if actual := db.Count(NewTableKey[SimpleType]()); actual != expected {
+		t.Errorf("Unexpected count: expected %v, got %v", expected, actual)
+	}
+
+	for i := 0; i < count; i++ {
+		id := strconv.Itoa(i)
+		value, err := db.RawGet(NewTableKey[SimpleType]().SetId(id))
+		found := err == nil
+		isDeleted := false
+		for _, deletedId := range deleted {
+			isDeleted = isDeleted || deletedId == id
+		}
+		if found == isDeleted || found && string(value) != id {
+			t.Errorf("Unexpected value for %s: %q (found: %v)", id, value, found)
+		}
+	}
+}
+
+// copyDir copies the files of dir into a new temporary directory.
+func copyDir(t *testing.T, dir string) string {
+
+	copied := t.TempDir()
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(copied, entry.Name()), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return copied
+}
+
+func dirSize(t *testing.T, dir string) int64 {
+
+	var size int64
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += info.Size()
+	}
+
+	return size
+}
@@ -2,9 +2,12 @@ package driver
 
 import (
 	. "github.com/Phosmachina/FluentKV/core"
+	"maps"
 	"strings"
 )
 
+// Generic is a minimal map-backed KVDriver. It is not safe for concurrent use and
+// iterates in no particular order; Memory is the faithful in-memory stand-in for BadgerDB.
 type Generic struct {
 	store map[string][]byte
 }
@@ -18,26 +21,29 @@ func NewGeneric() *KVStoreManager {
 
 // region KVDriver implementation
 
-func (db *Generic) RawSet(key IKey, value []byte) bool {
+func (db *Generic) RawSet(key IKey, value []byte) error {
 	db.store[key.Key()] = value
-	return true
+	return nil
 }
 
-func (db *Generic) RawGet(key IKey) ([]byte, bool) {
+func (db *Generic) RawGet(key IKey) ([]byte, error) {
 	value, ok := db.store[key.Key()]
-	return value, ok
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
 }
 
-func (db *Generic) RawDelete(key IKey) bool {
+func (db *Generic) RawDelete(key IKey) error {
 
 	_, ok := db.store[key.Key()]
 	if !ok {
-		return false
+		return ErrNotFound
 	}
 
 	delete(db.store, key.Key())
 
-	return true
+	return nil
 }
 
 func (db *Generic) RawIterKey(
@@ -77,6 +83,168 @@ func (db *Generic) Exist(key IKey) bool {
 	return ok
 }
 
+func (db *Generic) Begin() (KVTx, error) {
+	return &genericTx{
+		db:      db,
+		writes:  make(map[string][]byte),
+		deletes: make(map[string]bool),
+	}, nil
+}
+
+func (db *Generic) NewWriteBatch() KVWriteBatch {
+	return NewLoopWriteBatch(db)
+}
+
 func (db *Generic) Close() {}
 
 // endregion
+
+// region KVSnapshotDriver implementation
+
+// Snapshot returns a frozen copy of the store.
+func (db *Generic) Snapshot() (KVDriver, error) {
+	return &Generic{store: maps.Clone(db.store)}, nil
+}
+
+// endregion
+
+// region Transaction
+
+// genericTx is a copy-on-write view of a Generic store: writes land in an overlay
+// which is only copied into the store on Commit.
+type genericTx struct {
+	db      *Generic
+	writes  map[string][]byte
+	deletes map[string]bool
+	done    bool
+}
+
+func (tx *genericTx) RawSet(key IKey, value []byte) error {
+
+	if tx.done {
+		return ErrTxDone
+	}
+
+	delete(tx.deletes, key.Key())
+	tx.writes[key.Key()] = value
+
+	return nil
+}
+
+func (tx *genericTx) RawGet(key IKey) ([]byte, error) {
+
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	if tx.deletes[key.Key()] {
+		return nil, ErrNotFound
+	}
+
+	if value, ok := tx.writes[key.Key()]; ok {
+		return value, nil
+	}
+
+	return tx.db.RawGet(key)
+}
+
+func (tx *genericTx) RawDelete(key IKey) error {
+
+	if _, err := tx.RawGet(key); err != nil {
+		return err
+	}
+
+	delete(tx.writes, key.Key())
+	tx.deletes[key.Key()] = true
+
+	return nil
+}
+
+func (tx *genericTx) RawIterKey(
+	currentKey IKey,
+	action func(key IKey) (stop bool),
+) {
+	for _, k := range tx.matchingKeys(currentKey) {
+		if action(NewKeyFromString(k)) {
+			break
+		}
+	}
+}
+
+func (tx *genericTx) RawIterKV(
+	key IKey,
+	action func(key IKey, value []byte) (stop bool),
+) {
+	for _, k := range tx.matchingKeys(key) {
+		value, err := tx.RawGet(NewKeyFromString(k))
+		if err != nil {
+			continue
+		}
+		if action(NewKeyFromString(k), value) {
+			break
+		}
+	}
+}
+
+// matchingKeys lists the visible keys starting with the prefix of key. They are
+// collected upfront so that the action of an iteration can freely write.
+func (tx *genericTx) matchingKeys(key IKey) []string {
+
+	if tx.done {
+		return nil
+	}
+
+	var keys []string
+	for k := range tx.db.store {
+		if _, overwritten := tx.writes[k]; !overwritten && !tx.deletes[k] &&
+			strings.HasPrefix(k, key.Prefix()) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range tx.writes {
+		if strings.HasPrefix(k, key.Prefix()) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+func (tx *genericTx) Exist(key IKey) bool {
+	_, err := tx.RawGet(key)
+	return err == nil
+}
+
+func (tx *genericTx) NewWriteBatch() KVWriteBatch {
+	return NewLoopWriteBatch(tx)
+}
+
+func (tx *genericTx) Begin() (KVTx, error) {
+	return nil, ErrNestedTx
+}
+
+func (tx *genericTx) Commit() error {
+
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+
+	for k := range tx.deletes {
+		delete(tx.db.store, k)
+	}
+	for k, value := range tx.writes {
+		tx.db.store[k] = value
+	}
+
+	return nil
+}
+
+func (tx *genericTx) Rollback() {
+	tx.done = true
+}
+
+func (tx *genericTx) Close() {
+	tx.Rollback()
+}
+
+// endregion
@@ -2,6 +2,7 @@ package driver_test
 
 import (
 	"encoding/gob"
+	"errors"
 	. "github.com/Phosmachina/FluentKV/core"
 	. "github.com/Phosmachina/FluentKV/driver"
 	. "github.com/Phosmachina/FluentKV/helper"
@@ -63,17 +64,25 @@ func (i *DriverTester) SetDb(db *KVStoreManager) {
 	i.db = db
 }
 
+func (i *DriverTester) Db() *KVStoreManager {
+	return i.db
+}
+
 func (i *DriverTester) RunAllTests() {
 
 	tests := []func(*testing.T){
 		i.TestRawSet,
 		i.TestRawGet,
+		i.TestRawGet_Inexistant,
 		i.TestRawDelete_Existant,
 		i.TestRawDelete_Inexistant,
 		i.TestRawIterKey,
 		i.TestRawIterKV,
 		i.TestExist_Existant,
 		i.TestExist_Inexistant,
+		i.TestTx_Commit,
+		i.TestTx_Rollback,
+		i.TestWriteBatch,
 	}
 
 	for _, test := range tests {
@@ -102,10 +111,10 @@ func (i *DriverTester) TestRawSet(t *testing.T) {
 	tableKey := NewTableKey[SimpleType]().SetId("0")
 	i.db.RawSet(tableKey, encoded)
 
-	_, exist := i.db.RawGet(tableKey)
+	_, err = i.db.RawGet(tableKey)
 
-	if !exist {
-		t.Error("Value not found after SET.")
+	if err != nil {
+		t.Errorf("Value not found after SET: %v", err)
 	}
 }
 
@@ -148,8 +157,8 @@ func (i *DriverTester) TestRawDelete_Existant(t *testing.T) {
 	tableKey := NewTableKey[SimpleType]().SetId("0")
 	i.db.RawSet(tableKey, encoded)
 
-	if !i.db.RawDelete(tableKey) {
-		t.Error("Marked as not deleted after correct DELETE")
+	if err = i.db.RawDelete(tableKey); err != nil {
+		t.Errorf("Marked as not deleted after correct DELETE: %v", err)
 	}
 
 	if i.db.Exist(tableKey) {
@@ -159,8 +168,14 @@ func (i *DriverTester) TestRawDelete_Existant(t *testing.T) {
 }
 
 func (i *DriverTester) TestRawDelete_Inexistant(t *testing.T) {
-	if i.db.RawDelete(NewTableKey[AnotherType]().SetId("42")) {
-		t.Error("Inexistant entry marked as deleted.")
+	if err := i.db.RawDelete(NewTableKey[AnotherType]().SetId("42")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete failed: expected %v, got %v", ErrNotFound, err)
+	}
+}
+
+func (i *DriverTester) TestRawGet_Inexistant(t *testing.T) {
+	if _, err := i.db.RawGet(NewTableKey[AnotherType]().SetId("42")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get failed: expected %v, got %v", ErrNotFound, err)
 	}
 }
 
@@ -270,6 +285,80 @@ func (i *DriverTester) TestExist_Inexistant(t *testing.T) {
 	}
 }
 
+func (i *DriverTester) TestTx_Commit(t *testing.T) {
+
+	// Arrange
+	deletedKey := NewTableKey[SimpleType]().SetId("0")
+	insertedKey := NewTableKey[SimpleType]().SetId("1")
+	i.db.RawSet(deletedKey, []byte("deleted"))
+
+	tx, err := i.db.Begin()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	// Act
+	tx.RawSet(insertedKey, []byte("inserted"))
+	tx.RawDelete(deletedKey)
+
+	visibleBeforeCommit := i.db.Exist(insertedKey) || !i.db.Exist(deletedKey)
+	var keysInTx []IKey
+	tx.RawIterKey(NewTableKey[SimpleType](), func(key IKey) (stop bool) {
+		keysInTx = append(keysInTx, key)
+		return false
+	})
+
+	err = tx.Commit()
+
+	// Assert
+	if err != nil {
+		t.Error(err)
+	}
+	if visibleBeforeCommit {
+		t.Error("Writes of the transaction visible before commit.")
+	}
+	if len(keysInTx) != 1 || !keysInTx[0].(*TableKey).Equals(insertedKey) {
+		t.Errorf("Unexpected keys when iterate in transaction: %v", keysInTx)
+	}
+	if value, _ := i.db.RawGet(insertedKey); string(value) != "inserted" {
+		t.Error("Value not found after commit.")
+	}
+	if i.db.Exist(deletedKey) {
+		t.Error("Deleted value found after commit.")
+	}
+}
+
+func (i *DriverTester) TestTx_Rollback(t *testing.T) {
+
+	// Arrange
+	deletedKey := NewTableKey[SimpleType]().SetId("0")
+	insertedKey := NewTableKey[SimpleType]().SetId("1")
+	i.db.RawSet(deletedKey, []byte("deleted"))
+
+	tx, err := i.db.Begin()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	// Act
+	tx.RawSet(insertedKey, []byte("inserted"))
+	tx.RawDelete(deletedKey)
+	tx.Rollback()
+
+	// Assert
+	if i.db.Exist(insertedKey) {
+		t.Error("Value found after rollback.")
+	}
+	if !i.db.Exist(deletedKey) {
+		t.Error("Deleted value not found after rollback.")
+	}
+	if !errors.Is(tx.Commit(), ErrTxDone) {
+		t.Error("Commit after rollback should fail with ErrTxDone.")
+	}
+}
+
 func TestGeneric(t *testing.T) {
 	NewDriverTester(t).
 		SetSetUp(func(tester *DriverTester) {
@@ -277,3 +366,36 @@ func TestGeneric(t *testing.T) {
 		}).
 		RunAllTests()
 }
+
+func (i *DriverTester) TestWriteBatch(t *testing.T) {
+
+	// Arrange
+	deletedKey := NewTableKey[SimpleType]().SetId("0")
+	i.db.RawSet(deletedKey, []byte("deleted"))
+	batch := i.db.NewWriteBatch()
+
+	// Act
+	for id := 1; id <= 100; id++ {
+		if err := batch.RawSet(NewTableKey[SimpleType]().SetId(strconv.Itoa(id)), []byte("inserted")); err != nil {
+			t.Fatalf("Batch set failed: expected %v, got %v", nil, err)
+		}
+	}
+	if err := batch.RawDelete(deletedKey); err != nil {
+		t.Fatalf("Batch delete failed: expected %v, got %v", nil, err)
+	}
+	err := batch.Flush()
+
+	// Assert
+	if err != nil {
+		t.Errorf("Flush failed: expected %v, got %v", nil, err)
+	}
+	if count := i.db.Count(NewTableKey[SimpleType]()); count != 100 {
+		t.Errorf("Unexpected count after flush: expected %v, got %v", 100, count)
+	}
+	if i.db.Exist(deletedKey) {
+		t.Error("Deleted value found after flush.")
+	}
+	if err = batch.RawSet(deletedKey, nil); !errors.Is(err, ErrBatchDone) {
+		t.Errorf("Set after flush failed: expected %v, got %v", ErrBatchDone, err)
+	}
+}
@@ -0,0 +1,252 @@
+// Package resp reads and writes the RESP2 protocol spoken by Redis.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Type is the kind of RESP value, given by its first byte on the wire.
+type Type byte
+
+const (
+	SimpleString Type = '+'
+	Error        Type = '-'
+	Integer      Type = ':'
+	BulkString   Type = '$'
+	Array        Type = '*'
+)
+
+// ErrProtocol indicates a malformed RESP message.
+var ErrProtocol = errors.New("resp: protocol error")
+
+// maxBulkLength bounds the announced length of a bulk string, as Redis does.
+const maxBulkLength = 512 << 20
+
+// Value is a RESP value. Null bulk strings and arrays have Null set.
+type Value struct {
+	Type  Type
+	Str   []byte
+	Int   int64
+	Array []Value
+	Null  bool
+}
+
+// Err returns the error carried by an Error value, or nil.
+func (v Value) Err() error {
+	if v.Type == Error {
+		return ServerError(v.Str)
+	}
+	return nil
+}
+
+// ServerError is an error reply of the server.
+type ServerError string
+
+func (e ServerError) Error() string {
+	return string(e)
+}
+
+// Reader decodes RESP values.
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read decodes the next value.
+func (r *Reader) Read() (Value, error) {
+
+	line, err := r.line()
+	if err != nil {
+		return Value{}, err
+	}
+	if len(line) == 0 {
+		return Value{}, ErrProtocol
+	}
+
+	value := Value{Type: Type(line[0])}
+	switch value.Type {
+	case SimpleString, Error:
+		value.Str = line[1:]
+
+	case Integer:
+		value.Int, err = strconv.ParseInt(string(line[1:]), 10, 64)
+
+	case BulkString:
+		var length int64
+		length, err = strconv.ParseInt(string(line[1:]), 10, 64)
+		if err != nil || length > maxBulkLength {
+			return Value{}, ErrProtocol
+		}
+		if length < 0 {
+			value.Null = true
+			break
+		}
+		value.Str = make([]byte, length+2)
+		if _, err = io.ReadFull(r.r, value.Str); err != nil {
+			return Value{}, err
+		}
+		if value.Str[length] != '\r' || value.Str[length+1] != '\n' {
+			return Value{}, ErrProtocol
+		}
+		value.Str = value.Str[:length]
+
+	case Array:
+		var length int64
+		length, err = strconv.ParseInt(string(line[1:]), 10, 64)
+		if err != nil {
+			return Value{}, ErrProtocol
+		}
+		if length < 0 {
+			value.Null = true
+			break
+		}
+		value.Array = make([]Value, 0, min(length, 1024))
+		for i := int64(0); i < length; i++ {
+			element, err := r.Read()
+			if err != nil {
+				return Value{}, err
+			}
+			value.Array = append(value.Array, element)
+		}
+
+	default:
+		return Value{}, ErrProtocol
+	}
+
+	if err != nil {
+		return Value{}, ErrProtocol
+	}
+
+	return value, nil
+}
+
+// line reads a line, without its CRLF terminator.
+func (r *Reader) line() ([]byte, error) {
+
+	line, err := r.r.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, ErrProtocol
+		}
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, ErrProtocol
+	}
+
+	return append([]byte(nil), line[:len(line)-2]...), nil
+}
+
+// Writer encodes RESP values. Nothing is sent before Flush.
+type Writer struct {
+	w *bufio.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// WriteCommand encodes a command as an array of bulk strings.
+func (w *Writer) WriteCommand(args ...[]byte) {
+	w.writeHeader(Array, len(args))
+	for _, arg := range args {
+		if arg == nil {
+			arg = []byte{}
+		}
+		w.WriteBulk(arg)
+	}
+}
+
+// WriteBulk encodes a bulk string; a nil one is sent as a null bulk string.
+func (w *Writer) WriteBulk(bulk []byte) {
+	if bulk == nil {
+		_, _ = w.w.WriteString("$-1\r\n")
+		return
+	}
+	w.writeHeader(BulkString, len(bulk))
+	_, _ = w.w.Write(bulk)
+	_, _ = w.w.WriteString("\r\n")
+}
+
+// WriteSimple encodes a simple string.
+func (w *Writer) WriteSimple(s string) {
+	_, _ = fmt.Fprintf(w.w, "+%s\r\n", s)
+}
+
+// WriteError encodes an error reply.
+func (w *Writer) WriteError(message string) {
+	_, _ = fmt.Fprintf(w.w, "-%s\r\n", message)
+}
+
+// WriteInteger encodes an integer.
+func (w *Writer) WriteInteger(i int64) {
+	_, _ = fmt.Fprintf(w.w, ":%d\r\n", i)
+}
+
+// WriteArrayHeader announces an array of n values, to be written next; a negative n
+// stands for a null array.
+func (w *Writer) WriteArrayHeader(n int) {
+	w.writeHeader(Array, n)
+}
+
+// WriteValue encodes any value.
+func (w *Writer) WriteValue(value Value) {
+	switch {
+	case value.Type == Array && value.Null:
+		w.writeHeader(Array, -1)
+	case value.Type == Array:
+		w.writeHeader(Array, len(value.Array))
+		for _, element := range value.Array {
+			w.WriteValue(element)
+		}
+	case value.Type == BulkString && value.Null:
+		w.WriteBulk(nil)
+	case value.Type == BulkString && value.Str == nil:
+		w.WriteBulk([]byte{})
+	case value.Type == BulkString:
+		w.WriteBulk(value.Str)
+	case value.Type == Integer:
+		w.WriteInteger(value.Int)
+	case value.Type == Error:
+		w.WriteError(string(value.Str))
+	default:
+		w.WriteSimple(string(value.Str))
+	}
+}
+
+func (w *Writer) writeHeader(t Type, n int) {
+	_ = w.w.WriteByte(byte(t))
+	_, _ = w.w.WriteString(strconv.Itoa(n))
+	_, _ = w.w.WriteString("\r\n")
+}
+
+// Flush sends what was written.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Command builds the arguments of a command from strings and byte slices.
+func Command(name string, args ...any) [][]byte {
+	command := make([][]byte, 0, len(args)+1)
+	command = append(command, []byte(name))
+	for _, arg := range args {
+		switch a := arg.(type) {
+		case []byte:
+			command = append(command, a)
+		case string:
+			command = append(command, []byte(a))
+		case int:
+			command = append(command, []byte(strconv.Itoa(a)))
+		default:
+			command = append(command, []byte(fmt.Sprint(a)))
+		}
+	}
+	return command
+}
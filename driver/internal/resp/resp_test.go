@@ -0,0 +1,45 @@
+package resp_test
+
+import (
+	"bytes"
+	"github.com/Phosmachina/FluentKV/driver/internal/resp"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+
+	// Arrange
+	value := resp.Value{Type: resp.Array, Array: []resp.Value{
+		{Type: resp.SimpleString, Str: []byte("OK")},
+		{Type: resp.Error, Str: []byte("ERR boom")},
+		{Type: resp.Integer, Int: -42},
+		{Type: resp.BulkString, Str: []byte("bin\r\nary")},
+		{Type: resp.BulkString, Str: []byte{}},
+		{Type: resp.BulkString, Null: true},
+		{Type: resp.Array, Null: true},
+	}}
+	var buffer bytes.Buffer
+	writer := resp.NewWriter(&buffer)
+
+	// Act
+	writer.WriteValue(value)
+	_ = writer.Flush()
+	decoded, err := resp.NewReader(&buffer).Read()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Read failed: expected %v, got %v", nil, err)
+	}
+	if !reflect.DeepEqual(decoded, value) {
+		t.Errorf("Read failed: expected %v, got %v", value, decoded)
+	}
+}
+
+func TestRead_Malformed(t *testing.T) {
+	for _, input := range []string{"?\r\n", "$3\r\nab\r\n", "*x\r\n", ":1\n"} {
+		if _, err := resp.NewReader(bytes.NewBufferString(input)).Read(); err == nil {
+			t.Errorf("Read failed: expected an error for %q", input)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package driver
+
+import (
+	. "github.com/Phosmachina/FluentKV/core"
+	"slices"
+	"sync"
+)
+
+// Memory is an in-memory KVDriver, safe for concurrent use, which mirrors the behaviour
+// of BadgerDB: prefix iterations come in lexicographic order, read by batches each taken
+// over a consistent view, and transactions are optimistic, failing with ErrConflict on
+// commit when a concurrent one changed what they read, including by adding a key under a
+// prefix they iterated.
+//
+// It suits tests and caches; nothing is persisted.
+type Memory struct {
+	m       sync.RWMutex
+	store   *skiplist[memoryEntry]
+	version uint64
+	closed  bool
+}
+
+// memoryEntry is a stored value along with the version of the write which made it.
+type memoryEntry struct {
+	value   []byte
+	version uint64
+}
+
+func NewMemory() *KVStoreManager {
+
+	db := &Memory{store: newSkiplist[memoryEntry]()}
+
+	return NewKVStoreManager(db)
+}
+
+// region KVDriver implementation
+
+func (db *Memory) RawSet(key IKey, value []byte) error {
+
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	db.version++
+	db.store.Set(key.Key(), memoryEntry{value: slices.Clone(value), version: db.version})
+
+	return nil
+}
+
+func (db *Memory) RawGet(key IKey) ([]byte, error) {
+	entry, err := db.getVersioned(key.Key())
+	return entry.value, err
+}
+
+func (db *Memory) RawDelete(key IKey) error {
+
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	if !db.store.Delete(key.Key()) {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (db *Memory) RawIterKey(
+	currentKey IKey,
+	action func(key IKey) (stop bool),
+) {
+	iterKey(db, currentKey, action)
+}
+
+func (db *Memory) RawIterKV(
+	key IKey,
+	action func(key IKey, value []byte) (stop bool),
+) {
+	iterKV(db, key, action)
+}
+
+func (db *Memory) Exist(key IKey) bool {
+	_, err := db.getVersioned(key.Key())
+	return err == nil
+}
+
+func (db *Memory) Begin() (KVTx, error) {
+	return newOptimisticTx(db), nil
+}
+
+func (db *Memory) NewWriteBatch() KVWriteBatch {
+	return NewLoopWriteBatch(db)
+}
+
+// Close releases the store; every later operation fails as on a closed BadgerDB.
+func (db *Memory) Close() {
+
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	db.closed = true
+	db.store = newSkiplist[memoryEntry]()
+}
+
+// endregion
+
+// region KVOrderedDriver implementation
+
+func (db *Memory) RawIterKVFrom(
+	key IKey,
+	start string,
+	reverse bool,
+	action func(key IKey, value []byte) (stop bool),
+) {
+	iterKVFrom(db, key, start, reverse, action)
+}
+
+func (db *Memory) scanFrom(
+	prefix string,
+	bound string,
+	reverse bool,
+	withValues bool,
+	n int,
+) []versionedEntry {
+
+	db.m.RLock()
+	defer db.m.RUnlock()
+
+	if db.closed {
+		return nil
+	}
+
+	var entries []versionedEntry
+	collect := func(key string, entry memoryEntry) (stop bool) {
+		matched := versionedEntry{key: key, version: entry.version}
+		if withValues {
+			matched.value = slices.Clone(entry.value)
+		}
+		entries = append(entries, matched)
+		return len(entries) == n
+	}
+	if reverse {
+		db.store.DescendBefore(prefix, bound, collect)
+	} else {
+		db.store.AscendFrom(prefix, bound, collect)
+	}
+
+	return entries
+}
+
+// endregion
+
+// region KVSnapshotDriver implementation
+
+// Snapshot returns a frozen copy of the store. The values are shared with it, as they are
+// never modified in place.
+func (db *Memory) Snapshot() (KVDriver, error) {
+
+	db.m.RLock()
+	defer db.m.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	frozen := &Memory{store: newSkiplist[memoryEntry](), version: db.version}
+	db.store.Ascend("", func(key string, entry memoryEntry) (stop bool) {
+		frozen.store.Set(key, entry)
+		return false
+	})
+
+	return frozen, nil
+}
+
+// endregion
+
+// region versionedStore implementation
+
+func (db *Memory) getVersioned(key string) (versionedEntry, error) {
+
+	db.m.RLock()
+	defer db.m.RUnlock()
+
+	if db.closed {
+		return versionedEntry{}, ErrClosed
+	}
+
+	entry, ok := db.store.Get(key)
+	if !ok {
+		return versionedEntry{key: key}, ErrNotFound
+	}
+
+	return versionedEntry{key: key, value: slices.Clone(entry.value), version: entry.version}, nil
+}
+
+func (db *Memory) scanVersioned(
+	prefix string,
+	withValues bool,
+	reads map[string]uint64,
+) []versionedEntry {
+
+	db.m.RLock()
+	defer db.m.RUnlock()
+
+	if db.closed {
+		return nil
+	}
+
+	var entries []versionedEntry
+	db.store.Ascend(prefix, func(key string, entry memoryEntry) (stop bool) {
+		matched := versionedEntry{key: key, version: entry.version}
+		if withValues {
+			matched.value = slices.Clone(entry.value)
+		}
+		entries = append(entries, matched)
+		if _, read := reads[key]; reads != nil && !read {
+			reads[key] = entry.version
+		}
+		return false
+	})
+
+	return entries
+}
+
+func (db *Memory) commitVersioned(
+	reads map[string]uint64,
+	scans map[string]bool,
+	writes map[string][]byte,
+	deletes map[string]bool,
+) error {
+
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	for k, version := range reads {
+		if entry, _ := db.store.Get(k); entry.version != version {
+			return ErrConflict
+		}
+	}
+	for prefix := range scans {
+		phantom := false
+		db.store.Ascend(prefix, func(key string, _ memoryEntry) (stop bool) {
+			_, read := reads[key]
+			phantom = !read
+			return phantom
+		})
+		if phantom {
+			return ErrConflict
+		}
+	}
+
+	db.version++
+	for k := range deletes {
+		db.store.Delete(k)
+	}
+	for k, value := range writes {
+		db.store.Set(k, memoryEntry{value: value, version: db.version})
+	}
+
+	return nil
+}
+
+// endregion
@@ -0,0 +1,382 @@
+package driver_test
+
+import (
+	"errors"
+	. "github.com/Phosmachina/FluentKV/core"
+	. "github.com/Phosmachina/FluentKV/driver"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	NewDriverTester(t).
+		SetSetUp(func(tester *DriverTester) {
+			tester.SetDb(NewMemory())
+		}).
+		RunAllTests()
+}
+
+func TestMemory_TxConflict(t *testing.T) {
+
+	// Arrange
+	db := NewMemory()
+	key := NewTableKey[SimpleType]().SetId("0")
+	db.RawSet(key, []byte("initial"))
+
+	tx1, _ := db.Begin()
+	tx2, _ := db.Begin()
+
+	// Act
+	tx1.RawGet(key)
+	tx1.RawSet(key, []byte("tx1"))
+	tx2.RawGet(key)
+	tx2.RawSet(key, []byte("tx2"))
+
+	err1 := tx1.Commit()
+	err2 := tx2.Commit()
+
+	// Assert
+	if err1 != nil {
+		t.Errorf("First commit failed: expected %v, got %v", nil, err1)
+	}
+	if !errors.Is(err2, ErrConflict) {
+		t.Errorf("Second commit failed: expected %v, got %v", ErrConflict, err2)
+	}
+	if value, _ := db.RawGet(key); string(value) != "tx1" {
+		t.Errorf("Unexpected value after conflict: %s", value)
+	}
+}
+
+func TestMemory_TxPhantom(t *testing.T) {
+	testTxPhantom(t, NewMemory())
+}
+
+// testTxPhantom checks that a transaction fails to commit when a key was added, by another
+// one, under a prefix it iterated.
+func testTxPhantom(t *testing.T, db *KVStoreManager) {
+
+	// Arrange
+	db.RawSet(NewTableKey[SimpleType]().SetId("0"), []byte("initial"))
+	tx1, _ := db.Begin()
+	tx2, _ := db.Begin()
+
+	// Act
+	ct := 0
+	tx1.RawIterKey(NewTableKey[SimpleType](), func(key IKey) (stop bool) {
+		ct++
+		return false
+	})
+	tx1.RawSet(NewTableKey[AnotherType]().SetId("0"), []byte(strconv.Itoa(ct)))
+	tx2.RawSet(NewTableKey[SimpleType]().SetId("1"), []byte("tx2"))
+
+	err2 := tx2.Commit()
+	err1 := tx1.Commit()
+
+	// Assert
+	if err2 != nil {
+		t.Errorf("First commit failed: expected %v, got %v", nil, err2)
+	}
+	if !errors.Is(err1, ErrConflict) {
+		t.Errorf("Second commit failed: expected %v, got %v", ErrConflict, err1)
+	}
+	if db.Exist(NewTableKey[AnotherType]().SetId("0")) {
+		t.Errorf("Unexpected write after conflict")
+	}
+}
+
+func TestMemory_OrderedIteration(t *testing.T) {
+	testOrderedIteration(t, NewMemory())
+}
+
+func TestBadger_OrderedIteration(t *testing.T) {
+	db, _ := NewBadgerDB(t.TempDir())
+	defer db.Close()
+	testOrderedIteration(t, db)
+}
+
+// testOrderedIteration checks that prefix iterations come in lexicographic order, with
+// or without a transaction, which is the order of the decimal IDs.
+func testOrderedIteration(t *testing.T, db *KVStoreManager) {
+
+	// Arrange
+	for _, id := range []string{"3", "1", "20", "0"} {
+		db.RawSet(NewTableKey[SimpleType]().SetId(id), nil)
+	}
+	db.RawSet(NewTableKey[AnotherType]().SetId("0"), nil)
+	tx, _ := db.Begin()
+	defer tx.Rollback()
+	tx.RawSet(NewTableKey[SimpleType]().SetId("10"), nil)
+
+	// Act
+	var ids, idsInTx []string
+	db.RawIterKey(NewTableKey[SimpleType](), func(key IKey) (stop bool) {
+		ids = append(ids, key.(*TableKey).Id())
+		return false
+	})
+	tx.RawIterKey(NewTableKey[SimpleType](), func(key IKey) (stop bool) {
+		idsInTx = append(idsInTx, key.(*TableKey).Id())
+		return false
+	})
+
+	// Assert
+	if expected := []string{"0", "1", "3", "20"}; !slices.Equal(ids, expected) {
+		t.Errorf("Unexpected order: expected %v, got %v", expected, ids)
+	}
+	if expected := []string{"0", "1", "3", "10", "20"}; !slices.Equal(idsInTx, expected) {
+		t.Errorf("Unexpected order in transaction: expected %v, got %v", expected, idsInTx)
+	}
+}
+
+func TestMemory_OrderedSeek(t *testing.T) {
+	testOrderedSeek(t, NewMemory())
+}
+
+func TestBadger_OrderedSeek(t *testing.T) {
+	db, _ := NewBadgerDB(t.TempDir())
+	defer db.Close()
+	testOrderedSeek(t, db)
+}
+
+// testOrderedSeek checks that iterations starting at a key visit the keys from it, in
+// both orders, across the batches of the driver and without leaving the prefix.
+func testOrderedSeek(t *testing.T, db *KVStoreManager) {
+
+	// Arrange
+	var all []string
+	for i := 0; i < 150; i++ {
+		id := strconv.Itoa(i)
+		all = append(all, id)
+		db.RawSet(NewTableKey[SimpleType]().SetId(id), []byte(id))
+	}
+	db.RawSet(NewTableKeyFromString("tbl%SimpleTypez_0"), nil)
+	db.RawSet(NewTableKey[AnotherType]().SetId("0"), nil)
+	ordered := db.KVDriver.(KVOrderedDriver)
+	iter := func(start string, reverse bool) (ids []string) {
+		ordered.RawIterKVFrom(NewTableKey[SimpleType](), start, reverse, func(key IKey, value []byte) (stop bool) {
+			if id := key.(*TableKey).Id(); id == string(value) {
+				ids = append(ids, id)
+			}
+			db.RawDelete(NewTableKey[AnotherType]().SetId("0")) // Writes during the iteration.
+			return false
+		})
+		return ids
+	}
+	start := NewTableKey[SimpleType]().SetId("100").Key()
+	reversed := slices.Clone(all)
+	slices.Reverse(reversed)
+
+	// Act & Assert
+	if ids := iter("", false); !slices.Equal(ids, all) {
+		t.Errorf("Unexpected keys: expected %v, got %v", all, ids)
+	}
+	if ids := iter(start, false); !slices.Equal(ids, all[100:]) {
+		t.Errorf("Unexpected keys from %s: expected %v, got %v", start, all[100:], ids)
+	}
+	if ids := iter("", true); !slices.Equal(ids, reversed) {
+		t.Errorf("Unexpected keys in reverse: expected %v, got %v", reversed, ids)
+	}
+	if ids := iter(start, true); !slices.Equal(ids, reversed[49:]) {
+		t.Errorf("Unexpected keys in reverse from %s: expected %v, got %v", start, reversed[49:], ids)
+	}
+}
+
+func TestMemory_Snapshot(t *testing.T) {
+	testSnapshot(t, NewMemory())
+}
+
+func TestGeneric_Snapshot(t *testing.T) {
+	testSnapshot(t, NewGeneric())
+}
+
+func TestBadger_Snapshot(t *testing.T) {
+	db, _ := NewBadgerDB(t.TempDir())
+	defer db.Close()
+	testSnapshot(t, db)
+}
+
+// testSnapshot checks that a snapshot keeps reading the data as it was when it was taken,
+// and rejects writes.
+func testSnapshot(t *testing.T, db *KVStoreManager) {
+
+	// Arrange
+	kept := NewTableKey[SimpleType]().SetId("0")
+	deleted := NewTableKey[SimpleType]().SetId("1")
+	added := NewTableKey[SimpleType]().SetId("2")
+	db.RawSet(kept, []byte("before"))
+	db.RawSet(deleted, []byte("deleted"))
+
+	snapshot, err := db.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: expected %v, got %v", nil, err)
+	}
+	defer snapshot.Close()
+
+	// Act
+	db.RawSet(kept, []byte("after"))
+	db.RawDelete(deleted)
+	db.RawSet(added, nil)
+	value, _ := snapshot.RawGet(kept)
+	var ids []string
+	snapshot.RawIterKV(NewTableKey[SimpleType](), func(key IKey, value []byte) (stop bool) {
+		ids = append(ids, key.(*TableKey).Id())
+		return false
+	})
+	errSet := snapshot.RawSet(added, nil)
+	_, errTx := snapshot.Begin()
+
+	// Assert
+	if string(value) != "before" {
+		t.Errorf("RawGet failed: expected %s, got %s", "before", value)
+	}
+	if slices.Sort(ids); !slices.Equal(ids, []string{"0", "1"}) {
+		t.Errorf("RawIterKV failed: expected %v, got %v", []string{"0", "1"}, ids)
+	}
+	if !errors.Is(errSet, ErrReadOnly) || !errors.Is(errTx, ErrReadOnly) {
+		t.Errorf("RawSet failed: expected %v, got %v and %v", ErrReadOnly, errSet, errTx)
+	}
+	if value, _ := db.RawGet(kept); string(value) != "after" {
+		t.Errorf("RawGet failed: expected %s, got %s", "after", value)
+	}
+}
+
+func TestMemory_SnapshotOrderedSeek(t *testing.T) {
+	testSnapshotOrderedSeek(t, NewMemory())
+}
+
+func TestBadger_SnapshotOrderedSeek(t *testing.T) {
+	db, _ := NewBadgerDB(t.TempDir())
+	defer db.Close()
+	testSnapshotOrderedSeek(t, db)
+}
+
+// testSnapshotOrderedSeek checks that the snapshot of an ordered store is ordered too, and
+// seeks in the data as it was when it was taken.
+func testSnapshotOrderedSeek(t *testing.T, db *KVStoreManager) {
+
+	// Arrange
+	var all []string
+	for i := 0; i < 150; i++ {
+		id := strconv.Itoa(i)
+		all = append(all, id)
+		db.RawSet(NewTableKey[SimpleType]().SetId(id), []byte(id))
+	}
+	snapshot, err := db.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: expected %v, got %v", nil, err)
+	}
+	defer snapshot.Close()
+	db.RawSet(NewTableKey[SimpleType]().SetId("1000"), nil)
+
+	ordered, ok := snapshot.KVDriver.(KVOrderedDriver)
+	if !ok {
+		t.Fatalf("Snapshot failed: expected a %s", "KVOrderedDriver")
+	}
+	iter := func(start string, reverse bool) (ids []string) {
+		ordered.RawIterKVFrom(NewTableKey[SimpleType](), start, reverse, func(key IKey, value []byte) (stop bool) {
+			ids = append(ids, key.(*TableKey).Id())
+			return false
+		})
+		return ids
+	}
+	start := NewTableKey[SimpleType]().SetId("100").Key()
+	reversed := slices.Clone(all)
+	slices.Reverse(reversed)
+
+	// Act & Assert
+	if ids := iter(start, false); !slices.Equal(ids, all[100:]) {
+		t.Errorf("Unexpected keys from %s: expected %v, got %v", start, all[100:], ids)
+	}
+	if ids := iter("", true); !slices.Equal(ids, reversed) {
+		t.Errorf("Unexpected keys in reverse: expected %v, got %v", reversed, ids)
+	}
+	if ids := iter(start, true); !slices.Equal(ids, reversed[49:]) {
+		t.Errorf("Unexpected keys in reverse from %s: expected %v, got %v", start, reversed[49:], ids)
+	}
+}
+
+func TestMemory_BatchedIteration(t *testing.T) {
+	testBatchedIteration(t, NewMemory())
+}
+
+func TestBadger_BatchedIteration(t *testing.T) {
+	db, _ := NewBadgerDB(t.TempDir())
+	defer db.Close()
+	tx, _ := db.Begin()
+	defer tx.Rollback()
+	testBatchedIteration(t, tx)
+}
+
+// testBatchedIteration checks that a prefix iteration reads the store as it goes, rather
+// than a copy of the whole prefix: a key written past the current one is reached.
+func testBatchedIteration(t *testing.T, db KVDriver) {
+
+	// Arrange
+	var expected []string
+	for i := 0; i < 150; i++ {
+		id := strconv.Itoa(i)
+		expected = append(expected, id)
+		db.RawSet(NewTableKey[SimpleType]().SetId(id), []byte(id))
+	}
+	expected = append(expected, "1000")
+
+	// Act
+	var ids []string
+	db.RawIterKV(NewTableKey[SimpleType](), func(key IKey, value []byte) (stop bool) {
+		if len(ids) == 0 {
+			db.RawSet(NewTableKey[SimpleType]().SetId("1000"), []byte("1000"))
+		}
+		ids = append(ids, key.(*TableKey).Id())
+		return false
+	})
+
+	// Assert
+	if !slices.Equal(ids, expected) {
+		t.Errorf("RawIterKV failed: expected %v, got %v", expected, ids)
+	}
+}
+
+func TestMemory_Concurrent(t *testing.T) {
+
+	// Arrange
+	db := NewMemory()
+	var wg sync.WaitGroup
+
+	// Act
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, _ = Insert(db, NewSimpleType("t1", strconv.Itoa(i), j))
+				_ = Count[SimpleType](db)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Assert
+	if count := Count[SimpleType](db); count != 8*50 {
+		t.Errorf("Unexpected count: expected %v, got %v", 8*50, count)
+	}
+}
+
+func TestMemory_Close(t *testing.T) {
+
+	// Arrange
+	db := NewMemory()
+	key := NewTableKey[SimpleType]().SetId("0")
+	db.RawSet(key, []byte("value"))
+
+	// Act
+	db.Close()
+
+	// Assert
+	if db.Exist(key) {
+		t.Error("Closed store still usable.")
+	}
+	if err := db.RawSet(key, []byte("value")); !errors.Is(err, ErrClosed) {
+		t.Errorf("Set failed: expected %v, got %v", ErrClosed, err)
+	}
+}
@@ -0,0 +1,195 @@
+package driver
+
+import (
+	"errors"
+	. "github.com/Phosmachina/FluentKV/core"
+	"slices"
+	"strings"
+)
+
+// versionedStore is a store whose entries carry the version of the write which made
+// them, allowing optimisticTx to detect conflicts.
+type versionedStore interface {
+
+	// getVersioned returns the entry stored under key. An absent key has version 0 and
+	// comes with ErrNotFound.
+	getVersioned(key string) (entry versionedEntry, err error)
+
+	// scanVersioned collects, in order, the entries whose key starts with prefix, over a
+	// consistent view. Values are only read when withValues is set. The version of each
+	// entry is recorded in reads unless the key was already read.
+	scanVersioned(prefix string, withValues bool, reads map[string]uint64) []versionedEntry
+
+	// commitVersioned atomically checks that no key of reads changed version and that no
+	// key was added under one of the scanned prefixes, then applies deletes and writes. It
+	// returns ErrConflict when a read is stale.
+	commitVersioned(
+		reads map[string]uint64,
+		scans map[string]bool,
+		writes map[string][]byte,
+		deletes map[string]bool,
+	) error
+}
+
+// versionedEntry is an entry of a versionedStore.
+type versionedEntry struct {
+	key     string
+	value   []byte
+	version uint64
+}
+
+// optimisticTx is an optimistic transaction on a versionedStore. Writes land in an
+// overlay applied on Commit; the version of every key read and every prefix scanned are
+// recorded, and the commit fails with ErrConflict if one of the keys changed or a key
+// appeared under one of the prefixes in the meantime.
+type optimisticTx struct {
+	store   versionedStore
+	writes  map[string][]byte
+	deletes map[string]bool
+	reads   map[string]uint64
+	scans   map[string]bool
+	done    bool
+}
+
+func newOptimisticTx(store versionedStore) *optimisticTx {
+	return &optimisticTx{
+		store:   store,
+		writes:  make(map[string][]byte),
+		deletes: make(map[string]bool),
+		reads:   make(map[string]uint64),
+		scans:   make(map[string]bool),
+	}
+}
+
+func (tx *optimisticTx) RawSet(key IKey, value []byte) error {
+
+	if tx.done {
+		return ErrTxDone
+	}
+
+	delete(tx.deletes, key.Key())
+	tx.writes[key.Key()] = slices.Clone(value)
+
+	return nil
+}
+
+func (tx *optimisticTx) RawGet(key IKey) ([]byte, error) {
+
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	if tx.deletes[key.Key()] {
+		return nil, ErrNotFound
+	}
+
+	if value, ok := tx.writes[key.Key()]; ok {
+		return slices.Clone(value), nil
+	}
+
+	entry, err := tx.store.getVersioned(key.Key())
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if _, read := tx.reads[key.Key()]; !read {
+		tx.reads[key.Key()] = entry.version
+	}
+
+	return entry.value, err
+}
+
+func (tx *optimisticTx) RawDelete(key IKey) error {
+
+	if _, err := tx.RawGet(key); err != nil {
+		return err
+	}
+
+	delete(tx.writes, key.Key())
+	tx.deletes[key.Key()] = true
+
+	return nil
+}
+
+func (tx *optimisticTx) RawIterKey(
+	currentKey IKey,
+	action func(key IKey) (stop bool),
+) {
+	for _, entry := range tx.matching(currentKey.Prefix(), false) {
+		if action(NewKeyFromString(entry.key)) {
+			return
+		}
+	}
+}
+
+func (tx *optimisticTx) RawIterKV(
+	key IKey,
+	action func(key IKey, value []byte) (stop bool),
+) {
+	for _, entry := range tx.matching(key.Prefix(), true) {
+		if action(NewKeyFromString(entry.key), slices.Clone(entry.value)) {
+			return
+		}
+	}
+}
+
+// matching merges the committed entries starting with prefix with the overlay of the
+// transaction, in order.
+func (tx *optimisticTx) matching(prefix string, withValues bool) []versionedEntry {
+
+	if tx.done {
+		return nil
+	}
+
+	tx.scans[prefix] = true
+	committed := tx.store.scanVersioned(prefix, withValues, tx.reads)
+	matches := make([]versionedEntry, 0, len(committed))
+	for _, entry := range committed {
+		if _, overwritten := tx.writes[entry.key]; !overwritten && !tx.deletes[entry.key] {
+			matches = append(matches, entry)
+		}
+	}
+
+	kept := len(matches)
+	for k, value := range tx.writes {
+		if strings.HasPrefix(k, prefix) {
+			matches = append(matches, versionedEntry{key: k, value: value})
+		}
+	}
+	if kept != len(matches) {
+		slices.SortFunc(matches, func(a, b versionedEntry) int {
+			return strings.Compare(a.key, b.key)
+		})
+	}
+
+	return matches
+}
+
+func (tx *optimisticTx) Exist(key IKey) bool {
+	_, err := tx.RawGet(key)
+	return err == nil
+}
+
+func (tx *optimisticTx) NewWriteBatch() KVWriteBatch {
+	return NewLoopWriteBatch(tx)
+}
+
+func (tx *optimisticTx) Begin() (KVTx, error) {
+	return nil, ErrNestedTx
+}
+
+func (tx *optimisticTx) Commit() error {
+
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+
+	return tx.store.commitVersioned(tx.reads, tx.scans, tx.writes, tx.deletes)
+}
+
+func (tx *optimisticTx) Rollback() {
+	tx.done = true
+}
+
+func (tx *optimisticTx) Close() {
+	tx.Rollback()
+}
@@ -0,0 +1,79 @@
+package driver
+
+import (
+	. "github.com/Phosmachina/FluentKV/core"
+)
+
+// orderedScanBatch is the number of entries an ordered iteration reads at once, under
+// the lock of the store, before handing them to the action.
+const orderedScanBatch = 64
+
+// orderedStore is a store keeping its keys in order, which can read them from any key.
+type orderedStore interface {
+
+	// scanFrom collects up to n entries whose key starts with prefix: from the first key
+	// not less than bound in lexicographic order or, when reverse is set, from the last key
+	// less than bound (the last key of the prefix when bound is empty) in reverse order.
+	// Values are only read when withValues is set.
+	scanFrom(prefix string, bound string, reverse bool, withValues bool, n int) []versionedEntry
+}
+
+// iterKey implements KVDriver.RawIterKey over store, reading the keys by batches as
+// iterKVFrom does.
+func iterKey(store orderedStore, key IKey, action func(key IKey) (stop bool)) {
+	scanBatches(store, key.Prefix(), "", false, false, func(entry versionedEntry) (stop bool) {
+		return action(NewKeyFromString(entry.key))
+	})
+}
+
+// iterKV implements KVDriver.RawIterKV over store, see iterKVFrom.
+func iterKV(store orderedStore, key IKey, action func(key IKey, value []byte) (stop bool)) {
+	iterKVFrom(store, key, "", false, action)
+}
+
+// iterKVFrom implements KVOrderedDriver.RawIterKVFrom over store. The entries are read by
+// batches, so that action runs without the lock of the store and may use it again.
+func iterKVFrom(
+	store orderedStore,
+	key IKey,
+	start string,
+	reverse bool,
+	action func(key IKey, value []byte) (stop bool),
+) {
+	bound := start
+	if reverse && start != "" {
+		bound = start + "\x00" // The least key greater than start, so that start is included.
+	}
+
+	scanBatches(store, key.Prefix(), bound, reverse, true, func(entry versionedEntry) (stop bool) {
+		return action(NewKeyFromString(entry.key), entry.value)
+	})
+}
+
+// scanBatches runs action on the entries of store from bound, see orderedStore.scanFrom,
+// reading them orderedScanBatch at a time.
+func scanBatches(
+	store orderedStore,
+	prefix string,
+	bound string,
+	reverse bool,
+	withValues bool,
+	action func(entry versionedEntry) (stop bool),
+) {
+	for {
+		entries := store.scanFrom(prefix, bound, reverse, withValues, orderedScanBatch)
+		for _, entry := range entries {
+			if action(entry) {
+				return
+			}
+		}
+		if len(entries) < orderedScanBatch {
+			return
+		}
+
+		bound = entries[len(entries)-1].key
+		if !reverse {
+			bound += "\x00"
+		}
+	}
+}
@@ -0,0 +1,513 @@
+package driver
+
+import (
+	"fmt"
+	. "github.com/Phosmachina/FluentKV/core"
+	"github.com/Phosmachina/FluentKV/driver/internal/resp"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisOptions tunes the connection to a Redis server.
+type RedisOptions struct {
+	// PoolSize bounds how many idle connections are kept for reuse.
+	PoolSize int
+
+	// DialTimeout bounds the time to establish a connection.
+	DialTimeout time.Duration
+
+	// ScanCount is the COUNT hint given to SCAN during prefix iterations, and the number of
+	// values they read at once.
+	ScanCount int
+}
+
+// DefaultRedisOptions are the options used by NewRedis.
+var DefaultRedisOptions = RedisOptions{
+	PoolSize:    8,
+	DialTimeout: 5 * time.Second,
+	ScanCount:   256,
+}
+
+// Redis is a KVDriver storing the entries in a Redis server, through a pool of
+// connections speaking RESP2. Several processes can thus share one dataset.
+//
+// Prefix iterations use SCAN with MATCH and come in lexicographic order: the keys are all
+// listed first, then their values read by batches of ScanCount. Transactions
+// WATCH every key they read and commit through MULTI/EXEC, failing with ErrConflict when
+// another client changed one of them. Redis can only WATCH existing keys: unlike with
+// Memory, a key added under a prefix the transaction iterated goes undetected.
+//
+// Auto-generated IDs are reserved by blocks by each KVStoreManager, in transactions, so
+// processes sharing a dataset can insert into it concurrently.
+type Redis struct {
+	options RedisOptions
+	addr    string
+
+	m      sync.Mutex
+	idle   []*redisConn
+	closed bool
+}
+
+// NewRedis connects to the Redis server at addr with the DefaultRedisOptions.
+func NewRedis(addr string) (*KVStoreManager, error) {
+	return NewRedisWithOptions(addr, DefaultRedisOptions)
+}
+
+// NewRedisWithOptions connects to the Redis server at addr.
+func NewRedisWithOptions(addr string, options RedisOptions) (*KVStoreManager, error) {
+
+	db := &Redis{addr: addr, options: options}
+
+	conn, err := db.conn()
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to redis: %w", err)
+	}
+	if _, err = conn.do(resp.Command("PING")); err != nil {
+		conn.close()
+		return nil, fmt.Errorf("unable to connect to redis: %w", err)
+	}
+	db.release(conn)
+
+	manager := NewKVStoreManager(db)
+	if err = manager.Migrate(); err != nil {
+		return nil, err
+	}
+
+	return manager, nil
+}
+
+// region KVDriver implementation
+
+func (db *Redis) RawSet(key IKey, value []byte) error {
+	_, err := db.do(resp.Command("SET", key.Key(), nonNil(value)))
+	return err
+}
+
+func (db *Redis) RawGet(key IKey) ([]byte, error) {
+	reply, err := db.do(resp.Command("GET", key.Key()))
+	if err != nil {
+		return nil, err
+	}
+	if reply.Null {
+		return nil, ErrNotFound
+	}
+	return reply.Str, nil
+}
+
+func (db *Redis) RawDelete(key IKey) error {
+	reply, err := db.do(resp.Command("DEL", key.Key()))
+	if err != nil {
+		return err
+	}
+	if reply.Int == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (db *Redis) RawIterKey(
+	currentKey IKey,
+	action func(key IKey) (stop bool),
+) {
+	conn, err := db.conn()
+	if err != nil {
+		return
+	}
+	entries, err := conn.scan(currentKey.Prefix(), false, db.options.ScanCount)
+	db.release(conn)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if action(NewKeyFromString(entry.key)) {
+			return
+		}
+	}
+}
+
+func (db *Redis) RawIterKV(
+	key IKey,
+	action func(key IKey, value []byte) (stop bool),
+) {
+	conn, err := db.conn()
+	if err != nil {
+		return
+	}
+	keys, err := conn.scanKeys(key.Prefix(), db.options.ScanCount)
+	db.release(conn)
+	if err != nil {
+		return
+	}
+
+	for batch := range slices.Chunk(keys, max(db.options.ScanCount, 1)) {
+		if conn, err = db.conn(); err != nil {
+			return
+		}
+		entries, err := conn.getValues(batch)
+		db.release(conn)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			if action(NewKeyFromString(entry.key), entry.value) {
+				return
+			}
+		}
+	}
+}
+
+func (db *Redis) Exist(key IKey) bool {
+	reply, err := db.do(resp.Command("EXISTS", key.Key()))
+	return err == nil && reply.Int > 0
+}
+
+func (db *Redis) Begin() (KVTx, error) {
+
+	conn, err := db.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	store := &redisTxStore{db: db, conn: conn}
+	return &redisTx{optimisticTx: newOptimisticTx(store), store: store}, nil
+}
+
+func (db *Redis) NewWriteBatch() KVWriteBatch {
+	return NewLoopWriteBatch(db)
+}
+
+// Close closes the idle connections; those in use are closed once released.
+func (db *Redis) Close() {
+
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	db.closed = true
+	for _, conn := range db.idle {
+		conn.close()
+	}
+	db.idle = nil
+}
+
+// endregion
+
+// region Connection pool
+
+// do runs a command on a pooled connection.
+func (db *Redis) do(command [][]byte) (resp.Value, error) {
+
+	conn, err := db.conn()
+	if err != nil {
+		return resp.Value{}, err
+	}
+	defer db.release(conn)
+
+	return conn.do(command)
+}
+
+// conn takes an idle connection from the pool, or dials a new one.
+func (db *Redis) conn() (*redisConn, error) {
+
+	db.m.Lock()
+	if db.closed {
+		db.m.Unlock()
+		return nil, ErrClosed
+	}
+	if n := len(db.idle); n > 0 {
+		conn := db.idle[n-1]
+		db.idle = db.idle[:n-1]
+		db.m.Unlock()
+		return conn, nil
+	}
+	db.m.Unlock()
+
+	netConn, err := net.DialTimeout("tcp", db.addr, db.options.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &redisConn{
+		conn:   netConn,
+		reader: resp.NewReader(netConn),
+		writer: resp.NewWriter(netConn),
+	}, nil
+}
+
+// release gives a connection back to the pool, unless it is broken or the pool full.
+func (db *Redis) release(conn *redisConn) {
+
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	if conn.broken || db.closed || len(db.idle) >= db.options.PoolSize {
+		conn.close()
+		return
+	}
+	db.idle = append(db.idle, conn)
+}
+
+// redisConn is a connection to the server. It is used by one goroutine at a time.
+type redisConn struct {
+	conn   net.Conn
+	reader *resp.Reader
+	writer *resp.Writer
+	broken bool
+}
+
+// do sends a command and reads its reply. An error reply of the server is returned as a
+// resp.ServerError; any other error breaks the connection.
+func (c *redisConn) do(command [][]byte) (resp.Value, error) {
+
+	c.writer.WriteCommand(command...)
+	if err := c.writer.Flush(); err != nil {
+		c.broken = true
+		return resp.Value{}, err
+	}
+
+	reply, err := c.reader.Read()
+	if err != nil {
+		c.broken = true
+		return resp.Value{}, err
+	}
+
+	return reply, reply.Err()
+}
+
+// scan collects, in lexicographic order, the entries whose key starts with prefix.
+func (c *redisConn) scan(prefix string, withValues bool, count int) ([]versionedEntry, error) {
+
+	keys, err := c.scanKeys(prefix, count)
+	if err != nil {
+		return nil, err
+	}
+	if withValues {
+		return c.getValues(keys)
+	}
+
+	entries := make([]versionedEntry, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, versionedEntry{key: key})
+	}
+	return entries, nil
+}
+
+// scanKeys collects, in lexicographic order, the keys starting with prefix.
+func (c *redisConn) scanKeys(prefix string, count int) ([]string, error) {
+
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := c.do(resp.Command("SCAN", cursor, "MATCH", globEscape(prefix)+"*", "COUNT", count))
+		if err != nil {
+			return nil, err
+		}
+		if len(reply.Array) != 2 {
+			return nil, resp.ErrProtocol
+		}
+		for _, key := range reply.Array[1].Array {
+			keys = append(keys, string(key.Str))
+		}
+		cursor = string(reply.Array[0].Str)
+		if cursor == "0" {
+			break
+		}
+	}
+
+	// SCAN may return a key more than once.
+	slices.Sort(keys)
+	return slices.Compact(keys), nil
+}
+
+// getValues reads the entries of keys with MGET, in the same order.
+func (c *redisConn) getValues(keys []string) ([]versionedEntry, error) {
+
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	args := make([]any, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	reply, err := c.do(resp.Command("MGET", args...))
+	if err != nil {
+		return nil, err
+	}
+	if len(reply.Array) != len(keys) {
+		return nil, resp.ErrProtocol
+	}
+
+	// Drop the entries deleted between SCAN and MGET.
+	var entries []versionedEntry
+	for i, value := range reply.Array {
+		if !value.Null {
+			entries = append(entries, versionedEntry{key: keys[i], value: value.Str})
+		}
+	}
+
+	return entries, nil
+}
+
+func (c *redisConn) close() {
+	_ = c.conn.Close()
+}
+
+// globEscape escapes the characters of s which are special in a Redis glob pattern.
+func globEscape(s string) string {
+	var escaped strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// nonNil turns a nil value into an empty one, as a nil bulk string means null.
+func nonNil(value []byte) []byte {
+	if value == nil {
+		return []byte{}
+	}
+	return value
+}
+
+// endregion
+
+// region Transaction
+
+// redisTx is an optimisticTx whose store is a connection dedicated to the transaction,
+// on which every key read is WATCHed.
+type redisTx struct {
+	*optimisticTx
+	store *redisTxStore
+}
+
+func (tx *redisTx) Commit() error {
+	defer tx.store.release()
+	return tx.optimisticTx.Commit()
+}
+
+func (tx *redisTx) Rollback() {
+	tx.optimisticTx.Rollback()
+	tx.store.release()
+}
+
+func (tx *redisTx) Close() {
+	tx.Rollback()
+}
+
+// redisTxStore is the versionedStore of a redisTx. Versions are not needed: the server
+// tracks the WATCHed keys and aborts EXEC when one of them changed.
+type redisTxStore struct {
+	db       *Redis
+	conn     *redisConn
+	released bool
+}
+
+func (s *redisTxStore) getVersioned(key string) (versionedEntry, error) {
+
+	if _, err := s.conn.do(resp.Command("WATCH", key)); err != nil {
+		return versionedEntry{key: key}, err
+	}
+
+	reply, err := s.conn.do(resp.Command("GET", key))
+	if err != nil {
+		return versionedEntry{key: key}, err
+	}
+	if reply.Null {
+		return versionedEntry{key: key}, ErrNotFound
+	}
+
+	return versionedEntry{key: key, value: reply.Str}, nil
+}
+
+func (s *redisTxStore) scanVersioned(
+	prefix string,
+	withValues bool,
+	_ map[string]uint64,
+) []versionedEntry {
+
+	entries, err := s.conn.scan(prefix, false, s.db.options.ScanCount)
+	if err != nil || len(entries) == 0 {
+		return nil
+	}
+
+	args := make([]any, len(entries))
+	for i, entry := range entries {
+		args[i] = entry.key
+	}
+	if _, err = s.conn.do(resp.Command("WATCH", args...)); err != nil {
+		return nil
+	}
+	if !withValues {
+		return entries
+	}
+
+	// Read the values after WATCH, so that a change in between aborts the commit.
+	entries, err = s.conn.scan(prefix, true, s.db.options.ScanCount)
+	if err != nil {
+		return nil
+	}
+
+	return entries
+}
+
+func (s *redisTxStore) commitVersioned(
+	_ map[string]uint64,
+	_ map[string]bool,
+	writes map[string][]byte,
+	deletes map[string]bool,
+) error {
+
+	if len(writes) == 0 && len(deletes) == 0 {
+		_, err := s.conn.do(resp.Command("UNWATCH"))
+		return err
+	}
+
+	if _, err := s.conn.do(resp.Command("MULTI")); err != nil {
+		return err
+	}
+	for k := range deletes {
+		if _, err := s.conn.do(resp.Command("DEL", k)); err != nil {
+			_, _ = s.conn.do(resp.Command("DISCARD"))
+			return err
+		}
+	}
+	for k, value := range writes {
+		if _, err := s.conn.do(resp.Command("SET", k, nonNil(value))); err != nil {
+			_, _ = s.conn.do(resp.Command("DISCARD"))
+			return err
+		}
+	}
+
+	reply, err := s.conn.do(resp.Command("EXEC"))
+	if err != nil {
+		return err
+	}
+	if reply.Null {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// release gives the connection back to the pool, without any key left WATCHed.
+func (s *redisTxStore) release() {
+
+	if s.released {
+		return
+	}
+	s.released = true
+
+	if _, err := s.conn.do(resp.Command("UNWATCH")); err != nil {
+		s.conn.broken = true
+	}
+	s.db.release(s.conn)
+}
+
+// endregion
@@ -0,0 +1,182 @@
+package driver_test
+
+import (
+	"encoding/gob"
+	"errors"
+	. "github.com/Phosmachina/FluentKV/core"
+	. "github.com/Phosmachina/FluentKV/driver"
+	"github.com/Phosmachina/FluentKV/driver/redistest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// newRedisTestDb starts a fake Redis server for the test and connects a store to it.
+func newRedisTestDb(t *testing.T) (*KVStoreManager, *redistest.Server) {
+
+	server, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+
+	gob.Register(SimpleType{})
+	db, err := NewRedis(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	return db, server
+}
+
+func TestRedis(t *testing.T) {
+	NewDriverTester(t).
+		SetSetUp(func(i *DriverTester) {
+			db, _ := newRedisTestDb(t)
+			i.SetDb(db)
+		}).
+		RunAllTests()
+}
+
+func TestRedis_OrderedIteration(t *testing.T) {
+	db, _ := newRedisTestDb(t)
+	testOrderedIteration(t, db)
+}
+
+func TestRedis_TxConflict(t *testing.T) {
+
+	// Arrange
+	db, _ := newRedisTestDb(t)
+	key := NewTableKey[SimpleType]().SetId("0")
+	db.RawSet(key, []byte("initial"))
+
+	tx1, _ := db.Begin()
+	tx2, _ := db.Begin()
+
+	// Act
+	tx1.RawGet(key)
+	tx1.RawSet(key, []byte("tx1"))
+	tx2.RawGet(key)
+	tx2.RawSet(key, []byte("tx2"))
+
+	err1 := tx1.Commit()
+	err2 := tx2.Commit()
+
+	// Assert
+	if err1 != nil {
+		t.Errorf("First commit failed: expected %v, got %v", nil, err1)
+	}
+	if !errors.Is(err2, ErrConflict) {
+		t.Errorf("Second commit failed: expected %v, got %v", ErrConflict, err2)
+	}
+	if value, _ := db.RawGet(key); string(value) != "tx1" {
+		t.Errorf("Unexpected value after conflict: %s", value)
+	}
+}
+
+func TestRedis_BatchedValues(t *testing.T) {
+
+	// Arrange
+	_, server := newRedisTestDb(t)
+	options := DefaultRedisOptions
+	options.ScanCount = 10
+	db, err := NewRedisWithOptions(server.Addr(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 30; i++ {
+		db.RawSet(NewTableKey[SimpleType]().SetId(strconv.Itoa(i)), []byte("before"))
+	}
+	last := NewTableKey[SimpleType]().SetId("29")
+
+	// Act
+	var value []byte
+	db.RawIterKV(NewTableKey[SimpleType](), func(key IKey, raw []byte) (stop bool) {
+		if key.Key() == last.Key() {
+			value = raw
+		} else {
+			db.RawSet(last, []byte("after"))
+		}
+		return false
+	})
+
+	// Assert
+	if string(value) != "after" {
+		t.Errorf("RawIterKV failed: expected %s, got %s", "after", value)
+	}
+}
+
+func TestRedis_SharedDataset(t *testing.T) {
+
+	// Arrange
+	db, server := newRedisTestDb(t)
+	other, err := NewRedis(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	// Act
+	inserted, err := Insert(db, NewSimpleType("t1", "t2", 42))
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Insert failed: expected %v, got %v", nil, err)
+	}
+	value, err := Get[SimpleType](other, inserted.Key().Id())
+	if err != nil || value.Value().Val != 42 {
+		t.Errorf("Get failed: expected %v, got %v (%v)", 42, value.Value(), err)
+	}
+}
+
+func TestRedis_SharedDatasetIds(t *testing.T) {
+
+	// Arrange: two stores on one dataset, as two processes sharing it.
+	db, server := newRedisTestDb(t)
+	other, err := NewRedis(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	// Act: each one needs several blocks while the other holds its own, and the second one
+	// is closed while the first one still holds a block.
+	var ids, otherIds []string
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 3*AutoIdBuffer; i++ {
+			id, _ := db.GetFreeId()
+			ids = append(ids, id)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 3*AutoIdBuffer; i++ {
+			id, _ := other.GetFreeId()
+			otherIds = append(otherIds, id)
+		}
+	}()
+	wg.Wait()
+	other.Close()
+	reopened, err := NewRedis(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	reopenedIds, _ := reopened.GetFreeIds(2 * AutoIdBuffer)
+	moreIds, _ := db.GetFreeIds(AutoIdBuffer)
+
+	// Assert
+	seen := make(map[string]bool)
+	for _, id := range slices.Concat(ids, otherIds, reopenedIds, moreIds) {
+		if seen[id] {
+			t.Errorf("GetFreeId failed: %v handed out twice", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,83 @@
+package redistest
+
+// Match reports whether s matches the Redis glob pattern: '*' matches any sequence, '?'
+// any character, '[...]' a class (with '^' negation and ranges) and '\' escapes the
+// next character.
+func Match(pattern, s string) bool {
+
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if Match(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			matched, rest, ok := matchClass(pattern[1:], s[0])
+			if !ok || !matched {
+				return false
+			}
+			pattern, s = rest, s[1:]
+
+		default:
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+
+	return len(s) == 0
+}
+
+// matchClass matches c against the class starting after '[' in pattern, returning the
+// pattern following the closing ']'.
+func matchClass(pattern string, c byte) (matched bool, rest string, ok bool) {
+
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == ']':
+			return matched != negate, pattern[i+1:], true
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			matched = matched || pattern[i] == c
+		case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+			low, high := pattern[i], pattern[i+2]
+			if low > high {
+				low, high = high, low
+			}
+			matched = matched || low <= c && c <= high
+			i += 2
+		default:
+			matched = matched || pattern[i] == c
+		}
+	}
+
+	return false, "", false
+}
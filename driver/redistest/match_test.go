@@ -0,0 +1,31 @@
+package redistest_test
+
+import (
+	"github.com/Phosmachina/FluentKV/driver/redistest"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+
+	cases := []struct {
+		pattern string
+		s       string
+		matched bool
+	}{
+		{"tbl%User_*", "tbl%User_12", true},
+		{"tbl%User_*", "tbl%Users_12", false},
+		{"h?llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{`a\*b*`, "a*bc", true},
+		{`a\*b*`, "axbc", false},
+		{"*", "", true},
+	}
+
+	for _, c := range cases {
+		if matched := redistest.Match(c.pattern, c.s); matched != c.matched {
+			t.Errorf("Match(%q, %q) failed: expected %v, got %v", c.pattern, c.s, c.matched, matched)
+		}
+	}
+}
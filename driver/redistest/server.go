@@ -0,0 +1,371 @@
+// Package redistest provides an in-process Redis server, speaking the subset of RESP2
+// used by driver.Redis, so that the driver can be exercised without a real server.
+package redistest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Phosmachina/FluentKV/driver/internal/resp"
+)
+
+// Server is an in-memory Redis server listening on a local port.
+//
+// It supports PING, GET, SET, DEL, EXISTS, MGET, SCAN (with MATCH and COUNT), FLUSHALL,
+// and transactions with WATCH, UNWATCH, MULTI, EXEC and DISCARD.
+type Server struct {
+	listener net.Listener
+
+	m        sync.Mutex
+	data     map[string][]byte
+	versions map[string]uint64
+	version  uint64
+	conns    map[net.Conn]bool
+	closed   bool
+
+	wg sync.WaitGroup
+}
+
+// NewServer starts a server on a free local port.
+func NewServer() (*Server, error) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener: listener,
+		data:     make(map[string][]byte),
+		versions: make(map[string]uint64),
+		conns:    make(map[net.Conn]bool),
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server and closes its connections.
+func (s *Server) Close() {
+
+	s.m.Lock()
+	s.closed = true
+	_ = s.listener.Close()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.m.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.m.Lock()
+		if s.closed {
+			s.m.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[conn] = true
+		s.m.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+// session is the state of a client connection.
+type session struct {
+	watched map[string]uint64
+	dirty   bool
+	queued  [][][]byte
+	inMulti bool
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.m.Lock()
+		delete(s.conns, conn)
+		s.m.Unlock()
+		_ = conn.Close()
+	}()
+
+	reader := resp.NewReader(conn)
+	writer := resp.NewWriter(conn)
+	state := &session{}
+
+	for {
+		request, err := reader.Read()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				writer.WriteError("ERR " + err.Error())
+				_ = writer.Flush()
+			}
+			return
+		}
+		if request.Type != resp.Array || len(request.Array) == 0 {
+			writer.WriteError("ERR invalid request")
+			_ = writer.Flush()
+			continue
+		}
+
+		args := make([][]byte, len(request.Array))
+		for i, arg := range request.Array {
+			args[i] = arg.Str
+		}
+
+		writer.WriteValue(s.dispatch(state, args))
+		if err = writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// dispatch runs a command of a session, queuing it inside MULTI.
+func (s *Server) dispatch(state *session, args [][]byte) resp.Value {
+
+	name := strings.ToUpper(string(args[0]))
+
+	switch name {
+	case "MULTI":
+		if state.inMulti {
+			return errorValue("ERR MULTI calls can not be nested")
+		}
+		state.inMulti = true
+		return simpleValue("OK")
+
+	case "DISCARD":
+		if !state.inMulti {
+			return errorValue("ERR DISCARD without MULTI")
+		}
+		*state = session{}
+		return simpleValue("OK")
+
+	case "EXEC":
+		if !state.inMulti {
+			return errorValue("ERR EXEC without MULTI")
+		}
+		return s.exec(state)
+
+	case "WATCH":
+		if state.inMulti {
+			return errorValue("ERR WATCH inside MULTI is not allowed")
+		}
+		s.m.Lock()
+		defer s.m.Unlock()
+		if state.watched == nil {
+			state.watched = make(map[string]uint64)
+		}
+		for _, key := range args[1:] {
+			if _, watched := state.watched[string(key)]; !watched {
+				state.watched[string(key)] = s.versions[string(key)]
+			}
+		}
+		return simpleValue("OK")
+
+	case "UNWATCH":
+		state.watched = nil
+		return simpleValue("OK")
+	}
+
+	if state.inMulti {
+		state.queued = append(state.queued, args)
+		return simpleValue("QUEUED")
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.run(name, args)
+}
+
+// exec runs the queued commands of a session, unless a WATCHed key changed.
+func (s *Server) exec(state *session) resp.Value {
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	defer func() { *state = session{} }()
+
+	for key, version := range state.watched {
+		if s.versions[key] != version {
+			return resp.Value{Type: resp.Array, Null: true}
+		}
+	}
+
+	replies := make([]resp.Value, 0, len(state.queued))
+	for _, args := range state.queued {
+		replies = append(replies, s.run(strings.ToUpper(string(args[0])), args))
+	}
+
+	return resp.Value{Type: resp.Array, Array: replies}
+}
+
+// run executes a data command; the caller holds the lock.
+func (s *Server) run(name string, args [][]byte) resp.Value {
+
+	switch name {
+	case "PING":
+		return simpleValue("PONG")
+
+	case "GET":
+		if len(args) != 2 {
+			return wrongArity(name)
+		}
+		return bulkValue(s.data[string(args[1])])
+
+	case "SET":
+		if len(args) != 3 {
+			return wrongArity(name)
+		}
+		s.set(string(args[1]), slices.Clone(args[2]))
+		return simpleValue("OK")
+
+	case "DEL":
+		if len(args) < 2 {
+			return wrongArity(name)
+		}
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := s.data[string(key)]; ok {
+				s.del(string(key))
+				deleted++
+			}
+		}
+		return resp.Value{Type: resp.Integer, Int: int64(deleted)}
+
+	case "EXISTS":
+		if len(args) < 2 {
+			return wrongArity(name)
+		}
+		count := 0
+		for _, key := range args[1:] {
+			if _, ok := s.data[string(key)]; ok {
+				count++
+			}
+		}
+		return resp.Value{Type: resp.Integer, Int: int64(count)}
+
+	case "MGET":
+		if len(args) < 2 {
+			return wrongArity(name)
+		}
+		values := make([]resp.Value, 0, len(args)-1)
+		for _, key := range args[1:] {
+			values = append(values, bulkValue(s.data[string(key)]))
+		}
+		return resp.Value{Type: resp.Array, Array: values}
+
+	case "SCAN":
+		return s.scan(args)
+
+	case "FLUSHALL":
+		for key := range s.data {
+			s.del(key)
+		}
+		return simpleValue("OK")
+	}
+
+	return errorValue("ERR unknown command '" + name + "'")
+}
+
+// scan pages over the keys in lexicographic order; the cursor is the index of the next
+// key. Keys written meanwhile may be missed or returned twice, as allowed by Redis.
+func (s *Server) scan(args [][]byte) resp.Value {
+
+	if len(args) < 2 {
+		return wrongArity("SCAN")
+	}
+	cursor, err := strconv.Atoi(string(args[1]))
+	if err != nil || cursor < 0 {
+		return errorValue("ERR invalid cursor")
+	}
+
+	pattern, count := "*", 10
+	for i := 2; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+		case "COUNT":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil || count < 1 {
+				return errorValue("ERR syntax error")
+			}
+		default:
+			return errorValue("ERR syntax error")
+		}
+	}
+
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var matched []resp.Value
+	next := 0
+	for i := cursor; i < len(keys); i++ {
+		if i-cursor >= count {
+			next = i
+			break
+		}
+		if Match(pattern, keys[i]) {
+			matched = append(matched, bulkValue([]byte(keys[i])))
+		}
+	}
+
+	return resp.Value{Type: resp.Array, Array: []resp.Value{
+		bulkValue([]byte(strconv.Itoa(next))),
+		{Type: resp.Array, Array: matched},
+	}}
+}
+
+func (s *Server) set(key string, value []byte) {
+	s.version++
+	s.data[key] = value
+	s.versions[key] = s.version
+}
+
+func (s *Server) del(key string) {
+	s.version++
+	delete(s.data, key)
+	s.versions[key] = s.version
+}
+
+func simpleValue(s string) resp.Value {
+	return resp.Value{Type: resp.SimpleString, Str: []byte(s)}
+}
+
+func errorValue(message string) resp.Value {
+	return resp.Value{Type: resp.Error, Str: []byte(message)}
+}
+
+func bulkValue(value []byte) resp.Value {
+	if value == nil {
+		return resp.Value{Type: resp.BulkString, Null: true}
+	}
+	return resp.Value{Type: resp.BulkString, Str: value}
+}
+
+func wrongArity(name string) resp.Value {
+	return errorValue("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+}
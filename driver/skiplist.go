@@ -0,0 +1,199 @@
+package driver
+
+import (
+	"math/rand/v2"
+	"strings"
+)
+
+// skiplistMaxLevel bounds the height of the towers; with a branching factor of 4 it
+// keeps lookups logarithmic well beyond a billion entries.
+const skiplistMaxLevel = 16
+
+// skiplist is an ordered map from string keys to values. It is not safe for concurrent
+// use: its owner guards it.
+type skiplist[V any] struct {
+	head  *skiplistNode[V]
+	level int
+	len   int
+}
+
+type skiplistNode[V any] struct {
+	key   string
+	value V
+	next  []*skiplistNode[V]
+}
+
+func newSkiplist[V any]() *skiplist[V] {
+	return &skiplist[V]{
+		head:  &skiplistNode[V]{next: make([]*skiplistNode[V], skiplistMaxLevel)},
+		level: 1,
+	}
+}
+
+// Len returns the number of entries.
+func (s *skiplist[V]) Len() int {
+	return s.len
+}
+
+// Get returns the value stored under key.
+func (s *skiplist[V]) Get(key string) (V, bool) {
+	node := s.seek(key, nil)
+	if node != nil && node.key == key {
+		return node.value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Set stores value under key, replacing any previous value.
+func (s *skiplist[V]) Set(key string, value V) {
+
+	var update [skiplistMaxLevel]*skiplistNode[V]
+	node := s.seek(key, &update)
+	if node != nil && node.key == key {
+		node.value = value
+		return
+	}
+
+	level := randomLevel()
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			update[i] = s.head
+		}
+		s.level = level
+	}
+
+	node = &skiplistNode[V]{key: key, value: value, next: make([]*skiplistNode[V], level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	s.len++
+}
+
+// Delete removes the entry stored under key and reports whether it existed.
+func (s *skiplist[V]) Delete(key string) bool {
+
+	var update [skiplistMaxLevel]*skiplistNode[V]
+	node := s.seek(key, &update)
+	if node == nil || node.key != key {
+		return false
+	}
+
+	for i := 0; i < len(node.next); i++ {
+		update[i].next[i] = node.next[i]
+	}
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.len--
+
+	return true
+}
+
+// Ascend calls action on each entry whose key starts with prefix, in lexicographic
+// order, until it returns true.
+func (s *skiplist[V]) Ascend(prefix string, action func(key string, value V) (stop bool)) {
+	for node := s.seek(prefix, nil); node != nil && strings.HasPrefix(node.key, prefix); node = node.next[0] {
+		if action(node.key, node.value) {
+			return
+		}
+	}
+}
+
+// AscendFrom calls action on each entry whose key starts with prefix, from the first key
+// not less than from, in lexicographic order, until it returns true.
+func (s *skiplist[V]) AscendFrom(prefix string, from string, action func(key string, value V) (stop bool)) {
+	for node := s.seek(max(prefix, from), nil); node != nil && strings.HasPrefix(node.key, prefix); node = node.next[0] {
+		if action(node.key, node.value) {
+			return
+		}
+	}
+}
+
+// DescendBefore calls action on each entry whose key starts with prefix, from the last key
+// less than before, or the last key of the prefix when before is empty, in reverse
+// lexicographic order, until it returns true.
+func (s *skiplist[V]) DescendBefore(prefix string, before string, action func(key string, value V) (stop bool)) {
+
+	end := prefixEnd(prefix)
+	if before == "" || end != "" && before > end {
+		before = end
+	}
+
+	var node *skiplistNode[V]
+	if before == "" {
+		node = s.last()
+	} else {
+		node = s.previous(before)
+	}
+
+	for ; node != nil && strings.HasPrefix(node.key, prefix); node = s.previous(node.key) {
+		if action(node.key, node.value) {
+			return
+		}
+	}
+}
+
+// previous returns the last node whose key is less than key, or nil.
+func (s *skiplist[V]) previous(key string) *skiplistNode[V] {
+	var update [skiplistMaxLevel]*skiplistNode[V]
+	s.seek(key, &update)
+	if update[0] == s.head {
+		return nil
+	}
+	return update[0]
+}
+
+// last returns the node of the greatest key, or nil when the list is empty.
+func (s *skiplist[V]) last() *skiplistNode[V] {
+	node := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for node.next[i] != nil {
+			node = node.next[i]
+		}
+	}
+	if node == s.head {
+		return nil
+	}
+	return node
+}
+
+// prefixEnd returns the least key greater than every key starting with prefix, or "" when
+// there is none, as for an empty prefix.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
+
+// seek returns the first node whose key is not less than key. When update is given, it
+// receives the last node before key at each level.
+func (s *skiplist[V]) seek(key string, update *[skiplistMaxLevel]*skiplistNode[V]) *skiplistNode[V] {
+
+	node := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && node.next[i].key < key {
+			node = node.next[i]
+		}
+		if update != nil {
+			update[i] = node
+		}
+	}
+
+	return node.next[0]
+}
+
+// randomLevel draws the height of a new tower, each level being 4 times less likely.
+func randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.IntN(4) == 0 {
+		level++
+	}
+	return level
+}
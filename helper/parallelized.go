@@ -1,6 +1,7 @@
 package helper
 
 import (
+	"context"
 	"fmt"
 	"sync"
 )
@@ -10,6 +11,7 @@ var MaxTasks = 50
 type Task func()
 
 type TaskPool struct {
+	ctx     context.Context
 	tasks   chan Task
 	wg      sync.WaitGroup
 	workers int
@@ -18,7 +20,14 @@ type TaskPool struct {
 }
 
 func NewTaskPool() *TaskPool {
+	return NewTaskPoolWithContext(context.Background())
+}
+
+// NewTaskPoolWithContext creates a pool whose tasks are dropped once ctx is done: those
+// not started yet are skipped, and AddTask no longer queues any.
+func NewTaskPoolWithContext(ctx context.Context) *TaskPool {
 	pool := &TaskPool{
+		ctx:   ctx,
 		tasks: make(chan Task, MaxTasks), // A buffered channel
 		wg:    sync.WaitGroup{},
 		quit:  make(chan bool)}
@@ -37,7 +46,9 @@ func (tp *TaskPool) worker() {
 					tp.wg.Done()
 				}
 			}()
-			task()
+			if tp.ctx.Err() == nil {
+				task()
+			}
 			tp.wg.Done()
 		case <-tp.quit:
 			tp.mu.Lock()
@@ -49,6 +60,9 @@ func (tp *TaskPool) worker() {
 }
 
 func (tp *TaskPool) AddTask(task Task) {
+	if tp.ctx.Err() != nil {
+		return
+	}
 	tp.mu.Lock()
 	if tp.workers < MaxTasks {
 		tp.workers++